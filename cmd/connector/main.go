@@ -0,0 +1,102 @@
+// Command connector is a reference on-premise connector. It opens a stream to ditto on behalf of a connector and
+// drives fake printers with it, printing the jobs it is handed by waiting a while per page and optionally saving
+// their documents. It is meant for exercising the connector protocol end to end.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"ditto/pkg/connector"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+)
+
+func main() {
+	server := flag.String("server", "localhost:7100", "address of the ditto grpc server")
+	useTls := flag.Bool("tls", false, "connect over TLS")
+	connectorId := flag.String("connector-id", os.Getenv("DITTO_CONNECTOR_ID"), "connector id, defaults to $DITTO_CONNECTOR_ID")
+	secret := flag.String("secret", os.Getenv("DITTO_CONNECTOR_SECRET"), "connector secret, defaults to $DITTO_CONNECTOR_SECRET")
+	printers := flag.String("printers", "FAKE0001:W1A53A:Fake printer", "comma separated serial_number:product_number:name of the fake printers")
+	pageDuration := flag.Duration("page-duration", 500*time.Millisecond, "time a fake printer takes per page")
+	failureRate := flag.Float64("failure-rate", 0, "probability of a job failing with a paper jam")
+	outputDir := flag.String("output-dir", "", "directory receiving a copy of every printed document")
+	spoolDir := flag.String("spool-dir", "", "directory documents are spooled to while received")
+	telemetryInterval := flag.Duration("telemetry-interval", 30*time.Second, "how often printer telemetry is reported")
+	pingInterval := flag.Duration("ping-interval", 30*time.Second, "how often an idle stream is pinged, at least the server's minimum ping interval")
+	flag.Parse()
+
+	logger := logrus.StandardLogger()
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	if *connectorId == "" || *secret == "" {
+		logger.Fatal("connector id and secret are required")
+	}
+	fakePrinters, err := parsePrinters(*printers, connector.FakePrinterOptions{
+		PageDuration: *pageDuration,
+		OutputDir:    *outputDir,
+		FailureRate:  *failureRate,
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	transport := grpc.WithInsecure()
+	if *useTls {
+		transport = grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{}))
+	}
+	conn, err := grpc.Dial(*server, transport, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+		Time:                *pingInterval,
+		Timeout:             10 * time.Second,
+		PermitWithoutStream: true,
+	}))
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+	agent := connector.NewAgent(conn, *connectorId, *secret, fakePrinters, logger, connector.AgentOptions{
+		TelemetryInterval: *telemetryInterval,
+		MinBackoff:        time.Second,
+		MaxBackoff:        time.Minute,
+		SpoolDir:          *spoolDir,
+	})
+	if err := agent.Run(ctx); err != nil && err != context.Canceled {
+		logger.Fatal(err)
+	}
+}
+
+func parsePrinters(spec string, options connector.FakePrinterOptions) ([]connector.Printer, error) {
+	var printers []connector.Printer
+	for _, entry := range strings.Split(spec, ",") {
+		fields := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if fields[0] == "" {
+			return nil, fmt.Errorf("printer %q has no serial number", entry)
+		}
+		info := connector.PrinterInfo{SerialNumber: fields[0]}
+		if len(fields) > 1 {
+			info.ProductNumber = fields[1]
+		}
+		if len(fields) > 2 {
+			info.Name = fields[2]
+		}
+		printers = append(printers, connector.NewFakePrinter(info, options))
+	}
+	return printers, nil
+}
@@ -1,14 +1,23 @@
 package main
 
+import "time"
+
 var (
 	DefaultConfig = map[string]interface{}{
 		"database_config": DatabaseConfig{
-			HostName:     "mysql",
-			Port:         3306,
-			DatabaseName: "ditto",
-			UserName:     "root",
-			Password:     "root",
-			Type:         "mysql",
+			HostName:             "mysql",
+			Port:                 3306,
+			DatabaseName:         "ditto",
+			UserName:             "root",
+			Password:             "root",
+			Type:                 "mysql",
+			MaxOpenConns:         20,
+			MaxIdleConns:         10,
+			ConnMaxLifetime:      30 * time.Minute,
+			ConnMaxIdleTime:      5 * time.Minute,
+			PingTimeout:          5 * time.Second,
+			ReplicaMaxLag:        5 * time.Second,
+			ReplicaCheckInterval: 10 * time.Second,
 		},
 		"logging_config": LoggingConfig{
 			LogLevel: "debug",
@@ -30,46 +39,337 @@ var (
 			InternalHealth:    "/health",
 			InternalReadiness: "/readiness",
 		},
+		"retention_config": RetentionConfig{
+			Enable:                   true,
+			InactivePrinterRetention: 720 * time.Hour,
+			Interval:                 time.Hour,
+		},
+		"batch_config": BatchConfig{
+			ChunkSize: 100,
+			MaxItems:  1000,
+		},
+		"idempotency_config": IdempotencyConfig{
+			Ttl:             24 * time.Hour,
+			Lease:           time.Minute,
+			CleanupInterval: time.Hour,
+		},
+		"pool_config": PoolConfig{
+			OnlineWindow: 2 * time.Minute,
+		},
+		"catalog_config": CatalogConfig{
+			Seed: true,
+		},
+		"conversion_config": ConversionConfig{
+			Workers:          4,
+			QueueSize:        64,
+			Timeout:          2 * time.Minute,
+			MaxDocumentBytes: 32 << 20,
+			GhostscriptPath:  "gs",
+			RasterResolution: 300,
+			MaxOutputBytes:   512 << 20,
+			RecoveryInterval: time.Minute,
+		},
+		"storage_config": StorageConfig{
+			Backend:         "file",
+			FileRoot:        "/var/lib/ditto/documents",
+			Retention:       24 * time.Hour,
+			UploadTtl:       24 * time.Hour,
+			CleanupInterval: 10 * time.Minute,
+		},
+		"release_config": ReleaseConfig{
+			HoldTimeout:      24 * time.Hour,
+			CleanupInterval:  5 * time.Minute,
+			MaxPinAttempts:   5,
+			MaxBadgeAttempts: 10,
+			Lockout:          15 * time.Minute,
+		},
+		"connector_config": ConnectorConfig{
+			DispatchInterval: 2 * time.Second,
+			MaxInFlight:      4,
+			ChunkBytes:       256 << 10,
+			MinPingInterval:  20 * time.Second,
+		},
+		"rate_limit_config": RateLimitConfig{
+			RequestsPerSecond: 50,
+			Burst:             100,
+		},
+		"cors_config": CorsConfig{
+			AllowOrigin:      "*",
+			AllowMethods:     "GET, POST, PUT, DELETE, HEAD, OPTIONS, PATCH",
+			AllowHeaders:     "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization",
+			AllowCredentials: true,
+		},
+		"reload_config": ReloadConfig{
+			Enable:         true,
+			RemoteInterval: 30 * time.Second,
+		},
+		"secrets_config": SecretsConfig{
+			VaultKvMounts:   []string{"secret"},
+			RefreshInterval: 5 * time.Minute,
+			VaultTimeout:    10 * time.Second,
+		},
+		"shutdown_config": ShutdownConfig{
+			Timeout:    30 * time.Second,
+			DrainDelay: 5 * time.Second,
+		},
+		"metrics_config": MetricsConfig{
+			RefreshInterval: time.Minute,
+			NamePrefix:      "ditto_",
+		},
+		"tracing_config": TracingConfig{
+			Exporter:     "none",
+			ServiceName:  "ditto",
+			OtlpEndpoint: "localhost:4318",
+			OtlpInsecure: true,
+			SampleRatio:  1,
+		},
+		"enrollment_config": EnrollmentConfig{
+			ClaimCodeTtl:    15 * time.Minute,
+			CertificateTtl:  2160 * time.Hour,
+			CleanupInterval: 10 * time.Minute,
+		},
 	}
 )
 
+// DatabaseConfig locates the database, either by Dsn or, when it is empty, by HostName, Port, DatabaseName, UserName
+// and Password.
 type DatabaseConfig struct {
-	HostName     string
-	Port         uint64
-	DatabaseName string
-	UserName     string
-	Password     string
-	Dsn          string
-	Type         string
+	HostName     string `mapstructure:"host_name"`
+	Port         uint64 `mapstructure:"port" validate:"port"`
+	DatabaseName string `mapstructure:"database_name"`
+	UserName     string `mapstructure:"user_name"`
+	Password     string `mapstructure:"password" secret:"true"`
+	Dsn          string `mapstructure:"dsn" secret:"true"`
+	Type         string `mapstructure:"type" validate:"oneof=mysql"`
+	// MaxOpenConns and MaxIdleConns size the connection pool, zero leaving it unbounded. Connections are closed once
+	// they are ConnMaxLifetime old or were idle for ConnMaxIdleTime, zero keeping them open.
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+	// PingTimeout bounds the readiness check of the database
+	PingTimeout time.Duration `mapstructure:"ping_timeout" validate:"positive"`
+	// ReplicaDsns are the DSNs of the read replicas, or references to them. Replicas more than ReplicaMaxLag behind
+	// the primary, checked every ReplicaCheckInterval, are read from no longer.
+	ReplicaDsns          []string      `mapstructure:"replica_dsns" secret:"true"`
+	ReplicaMaxLag        time.Duration `mapstructure:"replica_max_lag" validate:"positive"`
+	ReplicaCheckInterval time.Duration `mapstructure:"replica_check_interval" validate:"positive"`
 }
 
 type LoggingConfig struct {
-	LogLevel string
+	LogLevel string `mapstructure:"log_level" validate:"oneof=debug info warning error fatal panic"`
 }
 
 type HeartBeatConfig struct {
-	KeepAliveTime    uint64
-	KeepAliveTimeOut uint64
+	KeepAliveTime    uint64 `mapstructure:"keep_alive_time"`
+	KeepAliveTimeOut uint64 `mapstructure:"keep_alive_time_out"`
 }
 
 type ServerConfig struct {
-	Address           string
-	Port              string
-	GatewayEnable     bool
-	GatewayAddress    string
-	GatewayURL        string
-	GatewayPort       string
-	InternalEnable    bool
-	InternalAddress   string
-	InternalPort      string
-	InternalHealth    string
-	InternalReadiness string
+	Address           string `mapstructure:"address"`
+	Port              string `mapstructure:"port" validate:"required,port"`
+	GatewayEnable     bool   `mapstructure:"gateway_enable"`
+	GatewayAddress    string `mapstructure:"gateway_address"`
+	GatewayURL        string `mapstructure:"gateway_url" validate:"required"`
+	GatewayPort       string `mapstructure:"gateway_port" validate:"required,port"`
+	InternalEnable    bool   `mapstructure:"internal_enable"`
+	InternalAddress   string `mapstructure:"internal_address"`
+	InternalPort      string `mapstructure:"internal_port" validate:"required,port"`
+	InternalHealth    string `mapstructure:"internal_health"`
+	InternalReadiness string `mapstructure:"internal_readiness"`
 }
 
-type PikachuConfig struct {
-	DatabaseConfig  DatabaseConfig
-	LoggingConfig   LoggingConfig
-	HeartBeatConfig HeartBeatConfig
-	ServerConfig    ServerConfig
+type RetentionConfig struct {
+	Enable                   bool          `mapstructure:"enable"`
+	InactivePrinterRetention time.Duration `mapstructure:"inactive_printer_retention" validate:"positive"`
+	Interval                 time.Duration `mapstructure:"interval" validate:"positive"`
+}
+
+// PrivacyConfig holds the key erasure receipts are signed with. It has no default, a well known key would let anyone
+// forge receipts.
+type PrivacyConfig struct {
+	ReceiptSigningKey string `mapstructure:"receipt_signing_key" validate:"required" secret:"true"`
+}
+
+type BatchConfig struct {
+	ChunkSize int `mapstructure:"chunk_size" validate:"positive"`
+	MaxItems  int `mapstructure:"max_items" validate:"positive"`
 }
 
+// IdempotencyConfig keeps the responses of calls made with an idempotency key for Ttl. A call holds its key for Lease,
+// after which a retry may take over the key of a call that never finished, so Lease must outlast the slowest call.
+type IdempotencyConfig struct {
+	Ttl             time.Duration `mapstructure:"ttl" validate:"positive"`
+	Lease           time.Duration `mapstructure:"lease" validate:"positive"`
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval" validate:"positive"`
+}
+
+type PoolConfig struct {
+	OnlineWindow time.Duration `mapstructure:"online_window" validate:"positive"`
+}
+
+type CatalogConfig struct {
+	Seed bool `mapstructure:"seed"`
+	// ValidateProductNumbers rejects printers whose product number isn't in the catalog. It is off by default, as
+	// printers of models the catalog doesn't list yet would otherwise become impossible to create.
+	ValidateProductNumbers bool `mapstructure:"validate_product_numbers"`
+}
+
+type ConversionConfig struct {
+	Workers          int           `mapstructure:"workers" validate:"positive"`
+	QueueSize        int           `mapstructure:"queue_size" validate:"positive"`
+	Timeout          time.Duration `mapstructure:"timeout" validate:"positive"`
+	MaxDocumentBytes int64         `mapstructure:"max_document_bytes" validate:"positive"`
+	GhostscriptPath  string        `mapstructure:"ghostscript_path"`
+	RasterResolution int           `mapstructure:"raster_resolution" validate:"positive"`
+	MaxOutputBytes   int64         `mapstructure:"max_output_bytes" validate:"positive"`
+	// RecoveryInterval is how often jobs left converting for longer than Timeout are failed
+	RecoveryInterval time.Duration `mapstructure:"recovery_interval" validate:"positive"`
+}
+
+// StorageConfig selects where print documents are kept. Backend is either file or s3, EncryptionKey is a base64
+// encoded 32 byte AES key. Documents are only stored unencrypted, without EncryptionKey, when AllowUnencrypted is set.
+type StorageConfig struct {
+	Backend          string        `mapstructure:"backend" validate:"oneof=file s3"`
+	FileRoot         string        `mapstructure:"file_root"`
+	S3Endpoint       string        `mapstructure:"s3_endpoint"`
+	S3Region         string        `mapstructure:"s3_region"`
+	S3Bucket         string        `mapstructure:"s3_bucket"`
+	S3AccessKey      string        `mapstructure:"s3_access_key" secret:"true"`
+	S3SecretKey      string        `mapstructure:"s3_secret_key" secret:"true"`
+	S3PathStyle      bool          `mapstructure:"s3_path_style"`
+	EncryptionKey    string        `mapstructure:"encryption_key" secret:"true"`
+	AllowUnencrypted bool          `mapstructure:"allow_unencrypted"`
+	SpoolDir         string        `mapstructure:"spool_dir"`
+	Retention        time.Duration `mapstructure:"retention" validate:"positive"`
+	UploadTtl        time.Duration `mapstructure:"upload_ttl" validate:"positive"`
+	CleanupInterval  time.Duration `mapstructure:"cleanup_interval" validate:"positive"`
+}
+
+// ReleaseConfig bounds how long secure jobs are held, how many wrong PINs lock a user's release credential and how
+// many unknown badges lock badge release at a printer, either lock lasting Lockout.
+type ReleaseConfig struct {
+	HoldTimeout      time.Duration `mapstructure:"hold_timeout" validate:"positive"`
+	CleanupInterval  time.Duration `mapstructure:"cleanup_interval" validate:"positive"`
+	MaxPinAttempts   int           `mapstructure:"max_pin_attempts" validate:"positive"`
+	MaxBadgeAttempts int           `mapstructure:"max_badge_attempts" validate:"positive"`
+	Lockout          time.Duration `mapstructure:"lockout"`
+}
+
+// ConnectorConfig tunes the streams of on-premise connectors, MinPingInterval is the most often they may send
+// keepalive pings.
+type ConnectorConfig struct {
+	DispatchInterval time.Duration `mapstructure:"dispatch_interval" validate:"positive"`
+	MaxInFlight      int           `mapstructure:"max_in_flight" validate:"positive"`
+	ChunkBytes       int           `mapstructure:"chunk_bytes" validate:"positive"`
+	MinPingInterval  time.Duration `mapstructure:"min_ping_interval"`
+}
+
+// EnrollmentConfig points at the internal CA device certificates are issued from and the certificate the gateway
+// serves TLS with, device endpoints need the latter as they authenticate with client certificates.
+type EnrollmentConfig struct {
+	CaCertFile      string        `mapstructure:"ca_cert_file"`
+	CaKeyFile       string        `mapstructure:"ca_key_file"`
+	TlsCertFile     string        `mapstructure:"tls_cert_file"`
+	TlsKeyFile      string        `mapstructure:"tls_key_file"`
+	ClaimCodeTtl    time.Duration `mapstructure:"claim_code_ttl" validate:"positive"`
+	CertificateTtl  time.Duration `mapstructure:"certificate_ttl" validate:"positive"`
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval" validate:"positive"`
+}
+
+// RateLimitConfig bounds how many requests a user makes per second, a rate of zero lifting the limit.
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"`
+	Burst             int     `mapstructure:"burst"`
+}
+
+// CorsConfig sets the CORS headers of gateway responses.
+type CorsConfig struct {
+	AllowOrigin      string `mapstructure:"allow_origin"`
+	AllowMethods     string `mapstructure:"allow_methods"`
+	AllowHeaders     string `mapstructure:"allow_headers"`
+	AllowCredentials bool   `mapstructure:"allow_credentials"`
+}
+
+// ReloadConfig switches live reloading on, the config file is watched and the remote provider polled every
+// RemoteInterval.
+type ReloadConfig struct {
+	Enable         bool          `mapstructure:"enable"`
+	RemoteInterval time.Duration `mapstructure:"remote_interval" validate:"positive"`
+}
+
+// JwtConfig holds the key tokens are signed with and the users granted the admin role. The key has no default, tokens
+// signed with an empty or well known key could be forged by anyone.
+type JwtConfig struct {
+	SecretKey    string   `mapstructure:"secret_key" validate:"required" secret:"true"`
+	AdminUserIds []string `mapstructure:"admin_user_ids"`
+}
+
+// SecretsConfig configures the providers secret references in other settings are read from, references look like
+// vault:secret/ditto#db_password or file:/run/secrets/db_password. Vault is only used when VaultAddress is set.
+type SecretsConfig struct {
+	VaultAddress    string        `mapstructure:"vault_address"`
+	VaultToken      string        `mapstructure:"vault_token" secret:"true"`
+	VaultTokenFile  string        `mapstructure:"vault_token_file"`
+	VaultKvMounts   []string      `mapstructure:"vault_kv_mounts"`
+	RefreshInterval time.Duration `mapstructure:"refresh_interval" validate:"positive"`
+	// VaultTimeout bounds every request to Vault.
+	VaultTimeout time.Duration `mapstructure:"vault_timeout" validate:"positive"`
+}
+
+// ShutdownConfig bounds graceful shutdown, readiness fails for DrainDelay before the servers are drained and
+// everything has to be stopped within Timeout after that.
+type ShutdownConfig struct {
+	Timeout    time.Duration `mapstructure:"timeout" validate:"positive"`
+	DrainDelay time.Duration `mapstructure:"drain_delay"`
+}
+
+// MetricsConfig sets how often the metrics counted in the database, such as the active printers of every tenant, are
+// refreshed.
+type MetricsConfig struct {
+	RefreshInterval time.Duration `mapstructure:"refresh_interval" validate:"positive"`
+	// NamePrefix is prepended to the names of ditto's metrics, PROM_METRIC_NAME_PREFIX sets it as well. It only
+	// applies on startup.
+	NamePrefix string `mapstructure:"name_prefix"`
+}
+
+// TracingConfig picks the exporter of the spans, none, stdout or otlp, which sends them to the OTLP/HTTP collector at
+// OtlpEndpoint. SampleRatio of the traces starting in ditto are sampled, the others are sampled when the caller's are.
+type TracingConfig struct {
+	Exporter     string  `mapstructure:"exporter" validate:"oneof=none stdout otlp"`
+	ServiceName  string  `mapstructure:"service_name" validate:"required"`
+	OtlpEndpoint string  `mapstructure:"otlp_endpoint"`
+	OtlpInsecure bool    `mapstructure:"otlp_insecure"`
+	SampleRatio  float64 `mapstructure:"sample_ratio"`
+}
+
+type AppConfig struct {
+	Id string `mapstructure:"id"`
+}
+
+type PikachuConfig struct {
+	DatabaseConfig    DatabaseConfig    `mapstructure:"database_config"`
+	LoggingConfig     LoggingConfig     `mapstructure:"logging_config"`
+	HeartBeatConfig   HeartBeatConfig   `mapstructure:"heart_beat_config"`
+	ServerConfig      ServerConfig      `mapstructure:"server_config"`
+	RetentionConfig   RetentionConfig   `mapstructure:"retention_config"`
+	PrivacyConfig     PrivacyConfig     `mapstructure:"privacy_config"`
+	BatchConfig       BatchConfig       `mapstructure:"batch_config"`
+	IdempotencyConfig IdempotencyConfig `mapstructure:"idempotency_config"`
+	PoolConfig        PoolConfig        `mapstructure:"pool_config"`
+	CatalogConfig     CatalogConfig     `mapstructure:"catalog_config"`
+	ConversionConfig  ConversionConfig  `mapstructure:"conversion_config"`
+	StorageConfig     StorageConfig     `mapstructure:"storage_config"`
+	ReleaseConfig     ReleaseConfig     `mapstructure:"release_config"`
+	ConnectorConfig   ConnectorConfig   `mapstructure:"connector_config"`
+	EnrollmentConfig  EnrollmentConfig  `mapstructure:"enrollment_config"`
+	RateLimitConfig   RateLimitConfig   `mapstructure:"rate_limit_config"`
+	CorsConfig        CorsConfig        `mapstructure:"cors_config"`
+	ReloadConfig      ReloadConfig      `mapstructure:"reload_config"`
+	JwtConfig         JwtConfig         `mapstructure:"jwt_config"`
+	SecretsConfig     SecretsConfig     `mapstructure:"secrets_config"`
+	ShutdownConfig    ShutdownConfig    `mapstructure:"shutdown_config"`
+	MetricsConfig     MetricsConfig     `mapstructure:"metrics_config"`
+	TracingConfig     TracingConfig     `mapstructure:"tracing_config"`
+	App               AppConfig         `mapstructure:"app"`
+}
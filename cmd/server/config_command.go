@@ -0,0 +1,173 @@
+package main
+
+import (
+	"ditto/pkg/secrets"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const configCommandUsage = "usage: server config print|validate|schema [-config file] [-set key=value]"
+
+// redacted replaces the values of secret settings in printed configs, references to secrets are printed as they are.
+const redacted = "<redacted>"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// RunConfigCommand runs the config subcommand and returns its exit status:
+//
+//	print     prints the effective config, after every layer LoadConfig applies, with secrets redacted
+//	validate  reports every invalid setting of the effective config
+//	schema    prints the JSON Schema of the config
+func RunConfigCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, configCommandUsage)
+		return 2
+	}
+	switch args[0] {
+	case "schema":
+		return writeJsonTo(stdout, stderr, configSchema(reflect.ValueOf(defaultPikachuConfig())))
+	case "validate":
+		if _, err := LoadConfig(args[1:]); err != nil {
+			return reportConfigError(stderr, err)
+		}
+		fmt.Fprintln(stdout, "config is valid")
+		return 0
+	case "print":
+		config, err := LoadConfig(args[1:])
+		if err != nil {
+			return reportConfigError(stderr, err)
+		}
+		return writeJsonTo(stdout, stderr, configSettings(reflect.ValueOf(config).Elem()))
+	default:
+		fmt.Fprintln(stderr, configCommandUsage)
+		return 2
+	}
+}
+
+func reportConfigError(stderr io.Writer, err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	fmt.Fprintln(stderr, err)
+	return 1
+}
+
+func writeJsonTo(stdout io.Writer, stderr io.Writer, value interface{}) int {
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// configSettings lays the config struct in value out by setting key, printing durations as in config files.
+func configSettings(value reflect.Value) map[string]interface{} {
+	settings := make(map[string]interface{}, value.NumField())
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		settings[field.Tag.Get("mapstructure")] = settingValue(field, value.Field(i))
+	}
+	return settings
+}
+
+func settingValue(field reflect.StructField, value reflect.Value) interface{} {
+	switch {
+	case value.Kind() == reflect.Struct:
+		return configSettings(value)
+	case value.Type() == durationType:
+		return time.Duration(value.Int()).String()
+	case field.Tag.Get("secret") == "true" && value.Kind() == reflect.Slice:
+		settings := make([]string, value.Len())
+		for i := range settings {
+			settings[i] = redact(value.Index(i).String())
+		}
+		return settings
+	case field.Tag.Get("secret") == "true":
+		return redact(value.String())
+	}
+	return value.Interface()
+}
+
+func redact(setting string) string {
+	if _, ok := secrets.ParseReference(setting); ok || setting == "" {
+		return setting
+	}
+	return redacted
+}
+
+// configSchema describes the config struct in defaults, whose settings are the schema's defaults, as a JSON Schema.
+// It holds the rules of the validate tags a schema can express.
+func configSchema(defaults reflect.Value) map[string]interface{} {
+	schema := sectionSchema(defaults)
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "ditto config"
+	return schema
+}
+
+func sectionSchema(defaults reflect.Value) map[string]interface{} {
+	properties := make(map[string]interface{}, defaults.NumField())
+	for i := 0; i < defaults.NumField(); i++ {
+		field := defaults.Type().Field(i)
+		properties[field.Tag.Get("mapstructure")] = settingSchema(field, defaults.Field(i))
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+func settingSchema(field reflect.StructField, defaultValue reflect.Value) map[string]interface{} {
+	if defaultValue.Kind() == reflect.Struct {
+		return sectionSchema(defaultValue)
+	}
+	schema := map[string]interface{}{}
+	switch kind := defaultValue.Kind(); {
+	case defaultValue.Type() == durationType:
+		schema["type"] = "string"
+		schema["pattern"] = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+	case kind == reflect.String:
+		schema["type"] = "string"
+	case kind == reflect.Bool:
+		schema["type"] = "boolean"
+	case kind == reflect.Int || kind == reflect.Int64 || kind == reflect.Uint || kind == reflect.Uint64:
+		schema["type"] = "integer"
+	case kind == reflect.Float64:
+		schema["type"] = "number"
+	case kind == reflect.Slice:
+		schema["type"] = "array"
+		schema["items"] = map[string]interface{}{"type": "string"}
+	}
+	for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+		switch {
+		case rule == "required" && schema["type"] == "string":
+			schema["minLength"] = 1
+		case rule == "positive" && schema["type"] == "integer":
+			schema["minimum"] = 1
+		case rule == "positive" && schema["type"] == "number":
+			schema["exclusiveMinimum"] = 0
+		case rule == "port" && schema["type"] == "integer":
+			schema["minimum"] = 0
+			schema["maximum"] = 65535
+		case rule == "port" && schema["type"] == "string":
+			schema["pattern"] = "^[0-9]{1,5}$"
+		case strings.HasPrefix(rule, "oneof="):
+			schema["enum"] = strings.Fields(strings.TrimPrefix(rule, "oneof="))
+		}
+	}
+	if field.Tag.Get("secret") == "true" {
+		schema["writeOnly"] = true
+	} else if !defaultValue.IsZero() {
+		schema["default"] = settingValue(field, defaultValue)
+	}
+	return schema
+}
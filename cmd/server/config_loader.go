@@ -0,0 +1,291 @@
+package main
+
+import (
+	"ditto/pkg/secrets"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/spf13/viper"
+)
+
+// configFileKey names the environment variable pointing at the local config file, the -config flag takes precedence.
+var configFileKey = "CONFIG_FILE"
+
+// ConfigErrors lists every invalid setting found while validating the config.
+type ConfigErrors []string
+
+func (c ConfigErrors) Error() string {
+	return "invalid config:\n  " + strings.Join(c, "\n  ")
+}
+
+// currentConfig holds the *PikachuConfig in effect, replaced whenever the config is reloaded.
+var currentConfig atomic.Value
+
+// Config returns the config in effect, settings that reload live are read through it on every use.
+func Config() *PikachuConfig {
+	config, _ := currentConfig.Load().(*PikachuConfig)
+	return config
+}
+
+// settingFlags collects repeated -set key=value flags.
+type settingFlags map[string]string
+
+func (s settingFlags) String() string {
+	return fmt.Sprint(map[string]string(s))
+}
+
+func (s settingFlags) Set(setting string) error {
+	parts := strings.SplitN(setting, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("%q is not of the form key=value", setting)
+	}
+	s[parts[0]] = parts[1]
+	return nil
+}
+
+// LoadConfig layers the config into viper, every layer overriding the ones before it:
+//
+//  1. DefaultConfig
+//  2. the JSON, YAML or TOML file named by -config or CONFIG_FILE, ditto.{json,yaml,toml} in . or /etc/ditto otherwise
+//  3. the remote provider named by CONFIG_PROVIDER, CONFIG_ENDPOINT and CONFIG_PATH
+//  4. environment variables, DATABASE_CONFIG_HOST_NAME setting database_config.host_name
+//  5. -set key=value flags
+//
+// and decodes the result into a validated PikachuConfig. An unreachable remote provider is logged and skipped so ditto
+// starts on the lower layers alone.
+func LoadConfig(args []string) (*PikachuConfig, error) {
+	flags := flag.NewFlagSet("ditto", flag.ContinueOnError)
+	configFile := flags.String("config", "", "path of a JSON, YAML or TOML config file")
+	overrides := settingFlags{}
+	flags.Var(overrides, "set", "override a setting as in -set server_config.port=7200, may be repeated")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	viper.AutomaticEnv()
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	// METRICS_CONFIG_NAME_PREFIX takes precedence, the variable the prefix used to be read from still sets it
+	if err := viper.BindEnv("metrics_config.name_prefix", metricPrefixKey); err != nil {
+		return nil, err
+	}
+	setDefaults("", reflect.ValueOf(defaultPikachuConfig()))
+	if err := readConfigFile(*configFile); err != nil {
+		return nil, err
+	}
+	if remote, err := readRemoteSettings(); err != nil {
+		log.Printf("An error %v occurred while reading config from %v, continuing without it", err, viper.GetString(configProviderKey))
+	} else if err := viper.MergeConfigMap(remote); err != nil {
+		return nil, err
+	}
+	for key, value := range overrides {
+		viper.Set(key, value)
+	}
+
+	config, err := decodeConfig()
+	if err != nil {
+		return nil, err
+	}
+	currentConfig.Store(config)
+	return config, nil
+}
+
+// decodeConfig decodes the settings held by viper into a validated PikachuConfig.
+func decodeConfig() (*PikachuConfig, error) {
+	config := &PikachuConfig{}
+	if err := viper.Unmarshal(config); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+	if err := validateConfig(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// defaultPikachuConfig assembles DefaultConfig into a PikachuConfig, sections missing from it are left zero.
+func defaultPikachuConfig() PikachuConfig {
+	config := PikachuConfig{}
+	value := reflect.ValueOf(&config).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		if section, ok := DefaultConfig[value.Type().Field(i).Tag.Get("mapstructure")]; ok {
+			value.Field(i).Set(reflect.ValueOf(section))
+		}
+	}
+	return config
+}
+
+// setDefaults registers every setting of the struct in value as a viper default, which also makes settings that are
+// only given as environment variables visible to Unmarshal.
+func setDefaults(prefix string, value reflect.Value) {
+	for i := 0; i < value.NumField(); i++ {
+		key := prefix + value.Type().Field(i).Tag.Get("mapstructure")
+		if field := value.Field(i); field.Kind() == reflect.Struct {
+			setDefaults(key+".", field)
+		} else {
+			viper.SetDefault(key, field.Interface())
+		}
+	}
+}
+
+func readConfigFile(path string) error {
+	if path == "" {
+		path = viper.GetString(configFileKey)
+	}
+	if path != "" {
+		viper.SetConfigFile(path)
+		if err := viper.ReadInConfig(); err != nil {
+			return fmt.Errorf("invalid config file %v: %v", path, err)
+		}
+		return nil
+	}
+	viper.SetConfigName("ditto")
+	viper.AddConfigPath(".")
+	viper.AddConfigPath("/etc/ditto")
+	err := viper.ReadInConfig()
+	if errors.As(err, &viper.ConfigFileNotFoundError{}) {
+		return nil
+	}
+	return err
+}
+
+// readRemoteSettings reads the settings held by the remote provider, none when there is no provider. They are read
+// into a viper of their own to be merged over the local file's, as viper ranks a local file above a remote provider.
+func readRemoteSettings() (map[string]interface{}, error) {
+	return remoteSettings(viper.GetString(configProviderKey), viper.GetString(configSvcEndpointKey), viper.GetString(configPathKey))
+}
+
+// remoteSettings reads the settings held at path by provider, reached at endpoint, none when there is no provider.
+func remoteSettings(provider string, endpoint string, path string) (map[string]interface{}, error) {
+	if provider == "" {
+		return nil, nil
+	}
+	remote := viper.New()
+	if err := remote.AddRemoteProvider(provider, endpoint, path); err != nil {
+		return nil, err
+	}
+	remote.SetConfigType("json")
+	if err := remote.ReadRemoteConfig(); err != nil {
+		return nil, err
+	}
+	return remote.AllSettings(), nil
+}
+
+// validateConfig checks every setting against the rules in its validate tag:
+//
+//	required   the setting must not be empty
+//	positive   the number, or duration, must be greater than zero
+//	port       the port must be between 1 and 65535 when set
+//	oneof=a b  the setting must be one of the listed values
+//
+// and checks that the database can be located and that print documents are encrypted, unless explicitly allowed not
+// to be.
+func validateConfig(config *PikachuConfig) error {
+	var errs ConfigErrors
+	validateSection("", reflect.ValueOf(config).Elem(), &errs)
+	validateDatabase(config.DatabaseConfig, &errs)
+	validateStorage(config.StorageConfig, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateSection(prefix string, value reflect.Value, errs *ConfigErrors) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		key := prefix + field.Tag.Get("mapstructure")
+		if value.Field(i).Kind() == reflect.Struct {
+			validateSection(key+".", value.Field(i), errs)
+			continue
+		}
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+			if rule == "" {
+				continue
+			}
+			if err := checkRule(rule, value.Field(i)); err != nil {
+				*errs = append(*errs, fmt.Sprintf("%v: %v", key, err))
+				break
+			}
+		}
+	}
+}
+
+// validateDatabase checks the DSN parses, or that the settings it is built from are there when it isn't set.
+func validateDatabase(config DatabaseConfig, errs *ConfigErrors) {
+	if config.Dsn != "" {
+		if _, ok := secrets.ParseReference(config.Dsn); ok {
+			return
+		}
+		if _, err := mysqlDriver.ParseDSN(config.Dsn); err != nil {
+			*errs = append(*errs, fmt.Sprintf("database_config.dsn: %v", err))
+		}
+		return
+	}
+	pieces := []struct {
+		key   string
+		value string
+	}{
+		{"host_name", config.HostName},
+		{"database_name", config.DatabaseName},
+		{"user_name", config.UserName},
+	}
+	for _, piece := range pieces {
+		if piece.value == "" {
+			*errs = append(*errs, fmt.Sprintf("database_config.%v: must be set when database_config.dsn isn't", piece.key))
+		}
+	}
+}
+
+// validateStorage checks that print documents are encrypted at rest, storing them as plaintext has to be asked for.
+func validateStorage(config StorageConfig, errs *ConfigErrors) {
+	if config.EncryptionKey == "" && !config.AllowUnencrypted {
+		*errs = append(*errs, "storage_config.encryption_key: must be set unless storage_config.allow_unencrypted is")
+	}
+}
+
+func checkRule(rule string, value reflect.Value) error {
+	switch {
+	case rule == "required":
+		if value.IsZero() {
+			return fmt.Errorf("must be set")
+		}
+	case rule == "positive":
+		switch value.Kind() {
+		case reflect.Int, reflect.Int64:
+			if value.Int() <= 0 {
+				return fmt.Errorf("must be greater than zero, got %v", value.Interface())
+			}
+		case reflect.Uint, reflect.Uint64:
+			if value.Uint() == 0 {
+				return fmt.Errorf("must be greater than zero")
+			}
+		case reflect.Float64:
+			if value.Float() <= 0 {
+				return fmt.Errorf("must be greater than zero, got %v", value.Float())
+			}
+		}
+	case rule == "port":
+		port := fmt.Sprint(value.Interface())
+		if port == "" || port == "0" {
+			return nil
+		}
+		if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+			return fmt.Errorf("%q is not a port between 1 and 65535", port)
+		}
+	case strings.HasPrefix(rule, "oneof="):
+		allowed := strings.Fields(strings.TrimPrefix(rule, "oneof="))
+		for _, candidate := range allowed {
+			if value.String() == candidate {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %v, got %q", strings.Join(allowed, ", "), value.String())
+	}
+	return nil
+}
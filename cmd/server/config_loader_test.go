@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// loadConfig loads the config from a fresh viper, as ditto does on startup.
+func loadConfig(t *testing.T, args ...string) (*PikachuConfig, error) {
+	t.Helper()
+	viper.Reset()
+	defer viper.Reset()
+	return LoadConfig(args)
+}
+
+func TestLoadLocalConfig(t *testing.T) {
+	config, err := loadConfig(t, "-config", "../../ditto.yaml")
+	if err != nil {
+		t.Fatalf("the local config doesn't load: %v", err)
+	}
+	if config.DatabaseConfig.HostName != "127.0.0.1" || config.PrivacyConfig.ReceiptSigningKey == "" {
+		t.Errorf("the local config wasn't read, got %+v", config)
+	}
+	if config.ServerConfig.Port != "7100" || config.IdempotencyConfig.Lease == 0 {
+		t.Errorf("the defaults weren't kept under the local config, got %+v", config)
+	}
+}
+
+func TestLoadConfigLayers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ditto-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "ditto.json")
+	settings := `{
+		"server_config": {"port": "7200", "gateway_port": "7201"},
+		"logging_config": {"log_level": "info"},
+		"storage_config": {"allow_unencrypted": true},
+		"privacy_config": {"receipt_signing_key": "key"},
+		"jwt_config": {"secret_key": "key"}
+	}`
+	if err := ioutil.WriteFile(file, []byte(settings), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("SERVER_CONFIG_PORT", "7300")
+	os.Setenv("SERVER_CONFIG_INTERNAL_PORT", "7302")
+	defer os.Unsetenv("SERVER_CONFIG_PORT")
+	defer os.Unsetenv("SERVER_CONFIG_INTERNAL_PORT")
+
+	config, err := loadConfig(t, "-config", file, "-set", "server_config.port=7400")
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	tests := []struct {
+		setting string
+		got     string
+		want    string
+	}{
+		{"a flag over the environment", config.ServerConfig.Port, "7400"},
+		{"the environment over the file", config.ServerConfig.InternalPort, "7302"},
+		{"the file over the defaults", config.ServerConfig.GatewayPort, "7201"},
+		{"the file over the defaults", config.LoggingConfig.LogLevel, "info"},
+		{"the defaults", config.ServerConfig.GatewayURL, "/ditto"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%v: got %q, want %q", test.setting, test.got, test.want)
+		}
+	}
+}
+
+func TestLoadConfigRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"defaults alone", nil, []string{"privacy_config.receipt_signing_key", "jwt_config.secret_key", "storage_config.encryption_key"}},
+		{"no jwt key", []string{"-config", "../../ditto.yaml", "-set", "jwt_config.secret_key="}, []string{"jwt_config.secret_key"}},
+		{"invalid settings", []string{"-config", "../../ditto.yaml", "-set", "logging_config.log_level=verbose",
+			"-set", "server_config.port=70000", "-set", "database_config.dsn=root@mysql"},
+			[]string{"logging_config.log_level", "server_config.port", "database_config.dsn"}},
+	}
+	for _, test := range tests {
+		_, err := loadConfig(t, test.args...)
+		errs, ok := err.(ConfigErrors)
+		if !ok {
+			t.Errorf("%v: got %v, want ConfigErrors", test.name, err)
+			continue
+		}
+		if len(errs) != len(test.want) {
+			t.Errorf("%v: got %v, want errors on %v", test.name, errs, test.want)
+		}
+		for _, key := range test.want {
+			if !strings.Contains(errs.Error(), key+":") {
+				t.Errorf("%v: %v is missing %v", test.name, errs, key)
+			}
+		}
+	}
+}
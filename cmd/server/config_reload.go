@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+var configReloadMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "config_reloads_total",
+	Help: "total number of config reloads by source and result",
+}, []string{"source", "result"})
+
+// ConfigReloader re-reads the config when the local file changes or the remote provider's settings do, and hands
+// the new config to the subsystems subscribed to it. Settings read through Config() on every use, such as the jwt and
+// CORS ones, take effect as soon as the new config is stored.
+type ConfigReloader struct {
+	logger *logrus.Logger
+	// file is the config file watched, provider the remote provider polled through readRemote
+	file       string
+	provider   string
+	readRemote func() (map[string]interface{}, error)
+	// mu guards the global viper, which isn't safe for concurrent use, along with the fields below
+	mu          sync.Mutex
+	remote      map[string]interface{}
+	hash        string
+	version     int
+	loadedAt    time.Time
+	subscribers []func(config *PikachuConfig)
+}
+
+// NewConfigReloader starts from the config LoadConfig left in viper.
+func NewConfigReloader(logger *logrus.Logger) *ConfigReloader {
+	provider, endpoint, path := viper.GetString(configProviderKey), viper.GetString(configSvcEndpointKey), viper.GetString(configPathKey)
+	readRemote := func() (map[string]interface{}, error) {
+		return remoteSettings(provider, endpoint, path)
+	}
+	remote, err := readRemote()
+	if err != nil {
+		logger.Warnf("An error %v occurred while reading config from %v", err, provider)
+	}
+	return &ConfigReloader{
+		logger:     logger,
+		file:       viper.ConfigFileUsed(),
+		provider:   provider,
+		readRemote: readRemote,
+		remote:     remote,
+		hash:       settingsHash(viper.AllSettings()),
+		version:    1,
+		loadedAt:   time.Now(),
+	}
+}
+
+// OnReload subscribes apply to every config that is reloaded and valid.
+func (c *ConfigReloader) OnReload(apply func(config *PikachuConfig)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribers = append(c.subscribers, apply)
+}
+
+// Watch watches the config file and polls the remote provider until ctx is cancelled.
+func (c *ConfigReloader) Watch(ctx context.Context) {
+	if c.file != "" {
+		go c.watchFile(ctx)
+	}
+	if c.provider == "" {
+		return
+	}
+	ticker := time.NewTicker(Config().ReloadConfig.RemoteInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.pollRemote()
+		}
+	}
+}
+
+// watchFile reloads the config file whenever it is written until ctx is cancelled. It watches the file's directory
+// rather than viper.WatchConfig, which re-reads the file into viper outside of mu, so that editors replacing the file
+// and Kubernetes swapping the symlink to a mounted config map are noticed too.
+func (c *ConfigReloader) watchFile(ctx context.Context) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		c.logger.Errorf("An error %v occurred while watching config file %v", err, c.file)
+		return
+	}
+	defer watcher.Close()
+	if err := watcher.Add(filepath.Dir(c.file)); err != nil {
+		c.logger.Errorf("An error %v occurred while watching config file %v", err, c.file)
+		return
+	}
+	target, _ := filepath.EvalSymlinks(c.file)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			current, _ := filepath.EvalSymlinks(c.file)
+			written := filepath.Clean(event.Name) == filepath.Clean(c.file) && event.Op&(fsnotify.Write|fsnotify.Create) != 0
+			if written || (current != "" && current != target) {
+				target = current
+				c.reloadFile()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			c.logger.Errorf("An error %v occurred while watching config file %v", err, c.file)
+		}
+	}
+}
+
+func (c *ConfigReloader) reloadFile() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := viper.ReadInConfig(); err != nil {
+		configReloadMetric.WithLabelValues("file", "failed").Inc()
+		c.logger.Errorf("An error %v occurred while reading config file %v", err, c.file)
+		return
+	}
+	// the file's settings replaced every other, the remote ones go back on top
+	if err := viper.MergeConfigMap(c.remote); err != nil {
+		configReloadMetric.WithLabelValues("file", "failed").Inc()
+		c.logger.Errorf("An error %v occurred while merging remote config", err)
+		return
+	}
+	c.apply("file")
+}
+
+func (c *ConfigReloader) pollRemote() {
+	remote, err := c.readRemote()
+	if err != nil {
+		configReloadMetric.WithLabelValues("remote", "failed").Inc()
+		c.logger.Errorf("An error %v occurred while reading config from %v", err, c.provider)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if reflect.DeepEqual(remote, c.remote) {
+		return
+	}
+	c.remote = remote
+	// start over from the file so settings removed from the remote provider fall back
+	if c.file != "" {
+		if err := viper.ReadInConfig(); err != nil {
+			configReloadMetric.WithLabelValues("remote", "failed").Inc()
+			c.logger.Errorf("An error %v occurred while reading config file %v", err, c.file)
+			return
+		}
+	}
+	if err := viper.MergeConfigMap(remote); err != nil {
+		configReloadMetric.WithLabelValues("remote", "failed").Inc()
+		c.logger.Errorf("An error %v occurred while merging remote config", err)
+		return
+	}
+	c.apply("remote")
+}
+
+// apply validates the settings viper holds and, when they changed, hands them to the subscribers. It must be called
+// with mu held.
+func (c *ConfigReloader) apply(source string) {
+	hash := settingsHash(viper.AllSettings())
+	if hash == c.hash {
+		return
+	}
+	config, err := decodeConfig()
+	if err != nil {
+		configReloadMetric.WithLabelValues(source, "invalid").Inc()
+		c.logger.Errorf("Ignoring config reloaded from %v: %v", source, err)
+		return
+	}
+	c.hash = hash
+	c.version++
+	c.loadedAt = time.Now()
+	currentConfig.Store(config)
+	for _, subscriber := range c.subscribers {
+		subscriber(config)
+	}
+	configReloadMetric.WithLabelValues(source, "applied").Inc()
+	c.logger.WithFields(logrus.Fields{"source": source, "version": c.version, "hash": hash}).Info("config reloaded")
+}
+
+// ServeHTTP responds with the version and hash of the config in effect.
+func (c *ConfigReloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	body, err := json.Marshal(map[string]interface{}{
+		"version":   c.version,
+		"hash":      c.hash,
+		"loaded_at": c.loadedAt,
+	})
+	c.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// settingsHash fingerprints settings, encoding/json sorts map keys so equal settings hash the same.
+func settingsHash(settings map[string]interface{}) string {
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return ""
+	}
+	digest := sha256.Sum256(encoded)
+	return hex.EncodeToString(digest[:])
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// writeConfigFile writes a valid config file setting the log level.
+func writeConfigFile(t *testing.T, file string, logLevel string) {
+	t.Helper()
+	settings := fmt.Sprintf(`{
+		"logging_config": {"log_level": %q},
+		"storage_config": {"allow_unencrypted": true},
+		"privacy_config": {"receipt_signing_key": "key"},
+		"jwt_config": {"secret_key": "key"}
+	}`, logLevel)
+	if err := ioutil.WriteFile(file, []byte(settings), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestConfigReloader(t *testing.T, file string) *ConfigReloader {
+	t.Helper()
+	viper.Reset()
+	if _, err := LoadConfig([]string{"-config", file}); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	return NewConfigReloader(logger)
+}
+
+// awaitConfig waits for the config in effect to satisfy done.
+func awaitConfig(t *testing.T, done func(config *PikachuConfig) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done(Config()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("the config wasn't reloaded, got %+v", Config())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConfigReloaderReloadsTheFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ditto-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer viper.Reset()
+	file := filepath.Join(dir, "ditto.json")
+	writeConfigFile(t, file, "info")
+	reloader := newTestConfigReloader(t, file)
+	var applied []string
+	reloader.OnReload(func(config *PikachuConfig) {
+		applied = append(applied, config.LoggingConfig.LogLevel)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx)
+	// give the watcher time to start watching
+	time.Sleep(100 * time.Millisecond)
+
+	// an invalid config is ignored, the one in effect stays
+	writeConfigFile(t, file, "verbose")
+	writeConfigFile(t, file, "warning")
+	awaitConfig(t, func(config *PikachuConfig) bool { return config.LoggingConfig.LogLevel == "warning" })
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+	if len(applied) == 0 || applied[len(applied)-1] != "warning" || reloader.version < 2 {
+		t.Errorf("got configs %v applied as version %v, want warning applied", applied, reloader.version)
+	}
+	for _, level := range applied {
+		if level == "verbose" {
+			t.Errorf("the invalid config was applied: %v", applied)
+		}
+	}
+}
+
+// TestConfigReloaderReloadsConcurrently changes the file while the remote provider's settings change, run it with
+// -race to check the reloads don't race on viper.
+func TestConfigReloaderReloadsConcurrently(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ditto-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer viper.Reset()
+	file := filepath.Join(dir, "ditto.json")
+	writeConfigFile(t, file, "info")
+	reloader := newTestConfigReloader(t, file)
+	var polls int64
+	reloader.readRemote = func() (map[string]interface{}, error) {
+		polls++
+		return map[string]interface{}{"batch_config": map[string]interface{}{"chunk_size": polls}}, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			writeConfigFile(t, file, []string{"info", "warning"}[i%2])
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			reloader.pollRemote()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	wg.Wait()
+	writeConfigFile(t, file, "error")
+	awaitConfig(t, func(config *PikachuConfig) bool {
+		return config.LoggingConfig.LogLevel == "error" && config.BatchConfig.ChunkSize == 50
+	})
+}
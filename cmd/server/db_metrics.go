@@ -0,0 +1,61 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// dbStatsCollector exports the stats of a database connection pool, read from sql.DB on every scrape.
+type dbStatsCollector struct {
+	db                *sql.DB
+	maxOpen           *prometheus.Desc
+	open              *prometheus.Desc
+	inUse             *prometheus.Desc
+	idle              *prometheus.Desc
+	waitCount         *prometheus.Desc
+	waitDuration      *prometheus.Desc
+	maxIdleClosed     *prometheus.Desc
+	maxLifetimeClosed *prometheus.Desc
+	maxIdleTimeClosed *prometheus.Desc
+}
+
+func newDBStatsCollector(db *sql.DB) prometheus.Collector {
+	return &dbStatsCollector{
+		db:                db,
+		maxOpen:           prometheus.NewDesc("db_max_open_connections", "maximum number of open connections to the database", nil, nil),
+		open:              prometheus.NewDesc("db_open_connections", "number of established connections to the database, in use and idle", nil, nil),
+		inUse:             prometheus.NewDesc("db_in_use_connections", "number of connections to the database currently in use", nil, nil),
+		idle:              prometheus.NewDesc("db_idle_connections", "number of idle connections to the database", nil, nil),
+		waitCount:         prometheus.NewDesc("db_wait_count_total", "total number of connections waited for", nil, nil),
+		waitDuration:      prometheus.NewDesc("db_wait_duration_seconds_total", "total time spent waiting for connections", nil, nil),
+		maxIdleClosed:     prometheus.NewDesc("db_max_idle_closed_total", "total number of connections closed as max_idle_conns was reached", nil, nil),
+		maxLifetimeClosed: prometheus.NewDesc("db_max_lifetime_closed_total", "total number of connections closed as conn_max_lifetime passed", nil, nil),
+		maxIdleTimeClosed: prometheus.NewDesc("db_max_idle_time_closed_total", "total number of connections closed as conn_max_idle_time passed", nil, nil),
+	}
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClosed
+	ch <- c.maxLifetimeClosed
+	ch <- c.maxIdleTimeClosed
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(stats.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(c.maxLifetimeClosed, prometheus.CounterValue, float64(stats.MaxLifetimeClosed))
+	ch <- prometheus.MustNewConstMetric(c.maxIdleTimeClosed, prometheus.CounterValue, float64(stats.MaxIdleTimeClosed))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gathered returns the value of every metric gatherer serves by name, summed over their labels, the sample count of
+// histograms.
+func gathered(t *testing.T, gatherer prometheus.Gatherer) map[string]float64 {
+	t.Helper()
+	families, err := gatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			switch {
+			case metric.GetCounter() != nil:
+				values[family.GetName()] += metric.GetCounter().GetValue()
+			case metric.GetGauge() != nil:
+				values[family.GetName()] += metric.GetGauge().GetValue()
+			case metric.GetHistogram() != nil:
+				values[family.GetName()] += float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return values
+}
+
+func TestDBStatsCollector(t *testing.T) {
+	// the pool only connects when used, its stats are read all the same
+	db, err := sql.Open("mysql", "root@tcp(127.0.0.1:3306)/ditto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(7)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(newDBStatsCollector(db))
+
+	values := gathered(t, registry)
+	want := map[string]float64{
+		"db_max_open_connections":        7,
+		"db_open_connections":            0,
+		"db_in_use_connections":          0,
+		"db_idle_connections":            0,
+		"db_wait_count_total":            0,
+		"db_wait_duration_seconds_total": 0,
+		"db_max_idle_closed_total":       0,
+		"db_max_lifetime_closed_total":   0,
+		"db_max_idle_time_closed_total":  0,
+	}
+	for name, value := range want {
+		if got, ok := values[name]; !ok || got != value {
+			t.Errorf("%v: got %v, want %v", name, got, value)
+		}
+	}
+}
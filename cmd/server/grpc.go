@@ -2,27 +2,41 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"ditto/pkg/apierr"
+	"ditto/pkg/connector"
 	"ditto/pkg/domain"
+	"ditto/pkg/interceptor"
+	"ditto/pkg/pki"
 	"ditto/pkg/repository"
+	"ditto/pkg/secrets"
+	"ditto/pkg/storage"
 	"ditto/pkg/svc"
+	"ditto/pkg/worker"
+	"encoding/base64"
+	"fmt"
 	"github.com/dgrijalva/jwt-go"
+	mysqlDriver "github.com/go-sql-driver/mysql"
 	"github.com/kutty-kumar/charminder/pkg/util"
+	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	grpcMiddleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpcLogrus "github.com/grpc-ecosystem/go-grpc-middleware/logging/logrus"
 	grpcValidator "github.com/grpc-ecosystem/go-grpc-middleware/validator"
-	grpcPrometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/infobloxopen/atlas-app-toolkit/gateway"
 	"github.com/infobloxopen/atlas-app-toolkit/requestid"
 	"github.com/kutty-kumar/charminder/pkg"
 	"github.com/kutty-kumar/ho_oh/ditto_v1"
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/keepalive"
@@ -33,39 +47,41 @@ import (
 	gLogger "gorm.io/gorm/logger"
 )
 
-var (
-	reg                     = prometheus.NewRegistry()
-	grpcMetrics             = grpcPrometheus.NewServerMetrics()
-	createUserSuccessMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "user_service_create_user_success_count",
-		Help: "total number of successful invocations of create user method in user service",
-	}, []string{"create_user_success_count"})
-	createUserFailureMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "user_service_create_user_failure_count",
-		Help: "total number of failure invocations of create user method in user service",
-	}, []string{"create_user_failure_count"})
-)
-
+// Claims are the claims of the tokens ditto accepts, TenantId naming the tenant the user belongs to and TenantRole
+// being "admin" for users administering it.
 type Claims struct {
-	UserName string `json:"user_name"`
-	UserId   string `json:"user_id"`
+	UserName   string `json:"user_name"`
+	UserId     string `json:"user_id"`
+	TenantId   string `json:"tenant_id"`
+	TenantRole string `json:"tenant_role"`
 	jwt.StandardClaims
 }
 
-func init() {
-	reg.MustRegister(grpcMetrics, createUserSuccessMetric, createUserFailureMetric)
-	createUserSuccessMetric.WithLabelValues("user_service")
-	createUserFailureMetric.WithLabelValues("user_service")
-}
-
-func NewGRPCServer(logger *logrus.Logger) (*grpc.Server, error) {
+func NewGRPCServer(logger *logrus.Logger, config *PikachuConfig, repositories *Repositories, printerSvc *svc.PrinterSvc,
+	connectorSvc connector.ConnectorServer) (*grpc.Server, error) {
 	grpcServer := grpc.NewServer(
+		// connector messages are JSON, every other message protobuf
+		grpc.ForceServerCodec(connector.ServerCodec()),
 		grpc.KeepaliveParams(
 			keepalive.ServerParameters{
-				Time:    time.Duration(viper.GetInt("heart_beat_config.keep_alive_time")) * time.Second,
-				Timeout: time.Duration(viper.GetInt("heart_beat_config.keep_alive_timeout")) * time.Second,
+				Time:    time.Duration(config.HeartBeatConfig.KeepAliveTime) * time.Second,
+				Timeout: time.Duration(config.HeartBeatConfig.KeepAliveTimeOut) * time.Second,
 			},
 		),
+		// connectors ping to keep their streams open through NAT
+		grpc.KeepaliveEnforcementPolicy(
+			keepalive.EnforcementPolicy{
+				MinTime:             config.ConnectorConfig.MinPingInterval,
+				PermitWithoutStream: true,
+			},
+		),
+		grpc.StreamInterceptor(
+			grpcMiddleware.ChainStreamServer(
+				grpcLogrus.StreamServerInterceptor(logrus.NewEntry(logger)),
+				requestid.StreamServerInterceptor(),
+				grpcMetrics.StreamServerInterceptor(),
+			),
+		),
 		grpc.UnaryInterceptor(
 			grpcMiddleware.ChainUnaryServer(
 				// logging middleware
@@ -74,8 +90,14 @@ func NewGRPCServer(logger *logrus.Logger) (*grpc.Server, error) {
 				// Request-Id interceptor
 				requestid.UnaryServerInterceptor(),
 
+				// tracing middleware, must follow the logging and request id ones
+				interceptor.TracingUnaryServerInterceptor(),
+
+				// read your writes middleware, sends the reads following a write to the primary
+				interceptor.ReadYourWritesUnaryServerInterceptor(),
+
 				// Metrics middleware
-				grpcPrometheus.UnaryServerInterceptor,
+				grpcMetrics.UnaryServerInterceptor(),
 
 				// validation middleware
 				grpcValidator.UnaryServerInterceptor(),
@@ -84,10 +106,29 @@ func NewGRPCServer(logger *logrus.Logger) (*grpc.Server, error) {
 				gateway.UnaryServerInterceptor(),
 
 				AuthUnaryServerInterceptor(),
+
+				// rate limiting middleware, limits authenticated callers by user
+				rateLimiter.UnaryServerInterceptor(),
+
+				// idempotency middleware, must follow auth as keys are scoped to the caller
+				interceptor.IdempotencyUnaryServerInterceptor(repositories.Idempotency, logger,
+					config.IdempotencyConfig.Ttl, config.IdempotencyConfig.Lease,
+					"/ditto_v1.PrinterService/CreatePrinter",
+					"/ditto_v1.PrinterService/UpdatePrinter",
+					"/ditto_v1.PrinterService/DeletePrinter",
+				),
 			),
 		),
 	)
 
+	ditto_v1.RegisterPrinterServiceServer(grpcServer, printerSvc)
+	connector.RegisterConnectorServer(grpcServer, connectorSvc)
+	grpcMetrics.InitializeMetrics(grpcServer)
+	return grpcServer, nil
+}
+
+// NewDB opens the database connection and migrates the schema, the reads replicas routes to a replica go to one.
+func NewDB(config *PikachuConfig, replicas *repository.ReplicaRouting) (*gorm.DB, error) {
 	dbLogger := gLogger.New(
 		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
 		gLogger.Config{
@@ -98,35 +139,342 @@ func NewGRPCServer(logger *logrus.Logger) (*grpc.Server, error) {
 		},
 	)
 	// create new mysql database connection
-	db, err := gorm.Open(mysql.Open(viper.GetString("database_config.dsn")), &gorm.Config{Logger: dbLogger})
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sql.OpenDB(databaseConnector{})}), &gorm.Config{Logger: dbLogger})
 	if err != nil {
 		return nil, err
 	}
 
+	if err := db.Use(repository.NewTenantScoping(repository.TenantTables...)); err != nil {
+		return nil, err
+	}
+	if err := db.Use(replicas); err != nil {
+		return nil, err
+	}
+	if err := db.Use(repository.NewTracing()); err != nil {
+		return nil, err
+	}
+	if err := db.Use(repository.NewQueryMetrics()); err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	configurePool(sqlDB, config.DatabaseConfig)
 	//dropTables(db)
-	createTables(db)
-	baseDao := pkg.NewBaseGORMDao(pkg.WithDb(db),
+	createTables(db, config.CatalogConfig)
+	return db, nil
+}
+
+// databaseConnector opens every connection with the credentials in effect at the time, so the connections opened
+// after the database credentials rotated use the new ones.
+type databaseConnector struct{}
+
+func (databaseConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	config, err := databaseConfig()
+	if err != nil {
+		return nil, err
+	}
+	connector, err := mysqlDriver.NewConnector(config)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+func (databaseConnector) Driver() driver.Driver {
+	return &mysqlDriver.MySQLDriver{}
+}
+
+// databaseConfig parses the DSN of the database config in effect, or builds it from the other database settings when
+// it isn't set. A user name or password referring to a secret replaces the one in the DSN.
+func databaseConfig() (*mysqlDriver.Config, error) {
+	database := Config().DatabaseConfig
+	dsn, err := resolveSecret(database.Dsn)
+	if err != nil {
+		return nil, err
+	}
+	config := mysqlDriver.NewConfig()
+	if dsn != "" {
+		if config, err = mysqlDriver.ParseDSN(dsn); err != nil {
+			return nil, err
+		}
+	} else {
+		config.Net = "tcp"
+		config.Addr = net.JoinHostPort(database.HostName, strconv.FormatUint(database.Port, 10))
+		config.DBName = database.DatabaseName
+		config.ParseTime = true
+	}
+	credentials := map[string]*string{database.UserName: &config.User, database.Password: &config.Passwd}
+	for setting, credential := range credentials {
+		if _, ok := secrets.ParseReference(setting); !ok && dsn != "" {
+			continue
+		}
+		if *credential, err = resolveSecret(setting); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// NewReplicaRouting opens a connection pool to every read replica in config, the replicas are read from once the
+// ReplicaWorker found them caught up with the primary.
+func NewReplicaRouting(logger *logrus.Logger, config DatabaseConfig) *repository.ReplicaRouting {
+	replicas := make([]*repository.Replica, len(config.ReplicaDsns))
+	for i, dsn := range config.ReplicaDsns {
+		replicas[i] = &repository.Replica{Name: fmt.Sprintf("#%d", i+1), DB: sql.OpenDB(replicaConnector{dsn: dsn})}
+		configurePool(replicas[i].DB, config)
+	}
+	return repository.NewReplicaRouting(logger, config.ReplicaMaxLag, replicas...)
+}
+
+func replicaPools(replicas *repository.ReplicaRouting) []*sql.DB {
+	pools := make([]*sql.DB, 0, len(replicas.Replicas()))
+	for _, replica := range replicas.Replicas() {
+		pools = append(pools, replica.DB)
+	}
+	return pools
+}
+
+// replicaConnector opens the connections to a read replica, resolving its DSN on every connection like
+// databaseConnector.
+type replicaConnector struct {
+	dsn string
+}
+
+func (r replicaConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	dsn, err := resolveSecret(r.dsn)
+	if err != nil {
+		return nil, err
+	}
+	config, err := mysqlDriver.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	connector, err := mysqlDriver.NewConnector(config)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+func (replicaConnector) Driver() driver.Driver {
+	return &mysqlDriver.MySQLDriver{}
+}
+
+// configurePool sizes the connection pool of db, it may be called again while the pool is in use.
+func configurePool(db *sql.DB, config DatabaseConfig) {
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+}
+
+// Repositories holds the data access objects shared by the grpc server, the http handlers and the workers
+type Repositories struct {
+	BaseDao     pkg.BaseDao
+	Printer     repository.PrinterRepository
+	Idempotency repository.IdempotencyRepository
+	Search      repository.PrinterSearchRepository
+	Location    repository.LocationRepository
+	Group       repository.PrinterGroupRepository
+	PrintJob    repository.PrintJobRepository
+	Model       repository.PrinterModelRepository
+	Document    repository.DocumentRepository
+	Release     repository.ReleaseCredentialRepository
+	Connector   repository.ConnectorRepository
+	Enrollment  repository.EnrollmentRepository
+	Tenant      repository.TenantRepository
+	UserData    repository.UserDataRepository
+}
+
+// ProductCatalog returns the catalog new printers are validated against, nil when validation is switched off.
+func (r *Repositories) ProductCatalog() repository.PrinterModelRepository {
+	if !Config().CatalogConfig.ValidateProductNumbers {
+		return nil
+	}
+	return r.Model
+}
+
+func NewRepositories(db *gorm.DB, logger *logrus.Logger, config *PikachuConfig) *Repositories {
+	baseDao := newBaseDao(db, logger, func() pkg.Base {
+		return &domain.Printer{}
+	})
+	locationDao := newBaseDao(db, logger, func() pkg.Base {
+		return &domain.Location{}
+	})
+	groupDao := newBaseDao(db, logger, func() pkg.Base {
+		return &domain.PrinterGroup{}
+	})
+	printJobDao := newBaseDao(db, logger, func() pkg.Base {
+		return &domain.PrintJob{}
+	})
+	modelDao := newBaseDao(db, logger, func() pkg.Base {
+		return &domain.PrinterModel{}
+	})
+	return &Repositories{
+		BaseDao:     baseDao,
+		Printer:     repository.NewPrinterGORMRepository(baseDao),
+		Idempotency: repository.NewIdempotencyGORMRepository(db),
+		Search:      repository.NewPrinterSearchRepository(db),
+		Location:    repository.NewLocationGORMRepository(locationDao),
+		Group:       repository.NewPrinterGroupGORMRepository(groupDao),
+		PrintJob:    repository.NewPrintJobGORMRepository(printJobDao),
+		Model:       repository.NewPrinterModelGORMRepository(modelDao),
+		Document:    repository.NewDocumentGORMRepository(db),
+		Release:     repository.NewReleaseCredentialGORMRepository(db),
+		Connector:   repository.NewConnectorGORMRepository(db),
+		Enrollment:  repository.NewEnrollmentGORMRepository(db),
+		Tenant:      repository.NewTenantGORMRepository(db),
+		UserData:    repository.NewUserDataGORMRepository(db),
+	}
+}
+
+// NewDocumentStore opens the document store on the backend selected by storage_config.
+func NewDocumentStore(logger *logrus.Logger, config StorageConfig) (*storage.DocumentStore, error) {
+	var blobs storage.BlobStore
+	var err error
+	switch config.Backend {
+	case "file":
+		blobs, err = storage.NewFileBlobStore(config.FileRoot)
+	case "s3":
+		var accessKey, secretKey string
+		if accessKey, err = resolveSecret(config.S3AccessKey); err != nil {
+			return nil, err
+		}
+		if secretKey, err = resolveSecret(config.S3SecretKey); err != nil {
+			return nil, err
+		}
+		blobs, err = storage.NewS3BlobStore(storage.S3Config{
+			Endpoint:  config.S3Endpoint,
+			Region:    config.S3Region,
+			Bucket:    config.S3Bucket,
+			AccessKey: accessKey,
+			SecretKey: secretKey,
+			PathStyle: config.S3PathStyle,
+		}, http.DefaultClient)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", config.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	encodedKey, err := resolveSecret(config.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage encryption key: %v", err)
+	}
+	if len(key) == 0 {
+		logger.Warn("storage_config.allow_unencrypted is set and storage_config.encryption_key isn't, print documents are stored unencrypted")
+	}
+	return storage.NewDocumentStore(blobs, key, config.SpoolDir)
+}
+
+// NewCertificateAuthority loads the CA device certificates are issued from, falling back to one that only lives as
+// long as the process when enrollment_config doesn't point at one.
+func NewCertificateAuthority(logger *logrus.Logger, config EnrollmentConfig) (*pki.CertificateAuthority, error) {
+	certFile, keyFile := config.CaCertFile, config.CaKeyFile
+	if certFile == "" || keyFile == "" {
+		logger.Warn("enrollment_config.ca_cert_file is not set, device certificates are issued from an ephemeral CA and stop working on restart")
+		return pki.NewEphemeralCertificateAuthority()
+	}
+	certPem, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPem, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return pki.LoadCertificateAuthority(certPem, keyPem)
+}
+
+// NewPrinterSvc builds the printer service, served over grpc and, for the operations it has no rpcs for, plain http.
+func NewPrinterSvc(repositories *Repositories) *svc.PrinterSvc {
+	baseSvc := pkg.NewBaseSvc(repositories.BaseDao)
+	return svc.NewPrinterSvc(&baseSvc, repositories.Printer, repositories.ProductCatalog())
+}
+
+func newBaseDao(db *gorm.DB, logger *logrus.Logger, creator pkg.EntityCreator) pkg.BaseDao {
+	return pkg.NewBaseGORMDao(pkg.WithDb(db),
 		pkg.WithLogger(logger),
-		pkg.WithCreator(func() pkg.Base {
-			return &domain.Printer{}
-		}),
+		pkg.WithCreator(creator),
 		pkg.WithExternalIdSetter(func(externalId string, base pkg.Base) pkg.Base {
 			base.SetExternalId(externalId)
 			return base
 		}))
-	printerDao := repository.NewPrinterGORMRepository(baseDao)
-	baseSvc := pkg.NewBaseSvc(baseDao)
-	printerSvc := svc.NewPrinterSvc(&baseSvc, printerDao)
-	ditto_v1.RegisterPrinterServiceServer(grpcServer, printerSvc)
-	grpcMetrics.InitializeMetrics(grpcServer)
-	return grpcServer, nil
 }
 
-func createTables(db *gorm.DB) {
-	err := db.AutoMigrate(domain.Printer{})
+// StartWorkers launches the background workers enabled in config, they stop when ctx is cancelled and the returned
+// WaitGroup is done once they all returned.
+func StartWorkers(ctx context.Context, logger *logrus.Logger, config *PikachuConfig, repositories *Repositories, documentStore *storage.DocumentStore, replicas *repository.ReplicaRouting) *sync.WaitGroup {
+	wg := &sync.WaitGroup{}
+	run := func(task interface{ Run(ctx context.Context) }) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			task.Run(ctx)
+		}()
+	}
+	if config.RetentionConfig.Enable {
+		retentionWorker := worker.NewRetentionWorker(repositories.Printer, logger,
+			config.RetentionConfig.InactivePrinterRetention,
+			config.RetentionConfig.Interval)
+		run(retentionWorker)
+	}
+	idempotencyWorker := worker.NewIdempotencyWorker(repositories.Idempotency, logger, config.IdempotencyConfig.CleanupInterval)
+	run(idempotencyWorker)
+	documentWorker := worker.NewDocumentWorker(repositories.Document, documentStore, logger,
+		config.StorageConfig.Retention,
+		config.StorageConfig.CleanupInterval)
+	run(documentWorker)
+	heldJobWorker := worker.NewHeldJobWorker(repositories.PrintJob, logger,
+		config.ReleaseConfig.HoldTimeout,
+		config.ReleaseConfig.CleanupInterval)
+	run(heldJobWorker)
+	conversionWorker := worker.NewConversionWorker(repositories.PrintJob, logger,
+		config.ConversionConfig.Timeout,
+		config.ConversionConfig.RecoveryInterval)
+	run(conversionWorker)
+	enrollmentWorker := worker.NewEnrollmentWorker(repositories.Enrollment, logger, config.EnrollmentConfig.CleanupInterval)
+	run(enrollmentWorker)
+	secretWorker := worker.NewSecretWorker(secretResolver, config.SecretsConfig.RefreshInterval)
+	run(secretWorker)
+	metricsWorker := worker.NewMetricsWorker(repositories.Printer, logger, config.MetricsConfig.RefreshInterval)
+	run(metricsWorker)
+	if len(replicas.Replicas()) > 0 {
+		replicaWorker := worker.NewReplicaWorker(replicas, config.DatabaseConfig.ReplicaCheckInterval)
+		run(replicaWorker)
+	}
+	return wg
+}
+
+func createTables(db *gorm.DB, config CatalogConfig) {
+	err := repository.Migrate(db, domain.Printer{}, domain.IdempotencyRecord{}, domain.Location{},
+		domain.PrinterGroup{}, domain.PrinterGroupMember{}, domain.PrintJob{}, domain.PrinterModel{},
+		domain.PrintJobDocument{}, domain.DocumentUpload{}, domain.DocumentUploadChunk{},
+		domain.ReleaseCredential{}, domain.BadgeAttempts{}, domain.Connector{}, domain.ConnectorPrinter{},
+		domain.DeviceEnrollment{}, domain.DeviceCertificate{}, domain.Tenant{})
 	if err != nil {
 		log.Fatalf("An error %v occurred while automigrating", err)
 	}
+	if err := repository.BackfillTenants(db); err != nil {
+		log.Fatalf("An error %v occurred while assigning tenants to the rows that predate them", err)
+	}
+	if err := repository.CreatePrinterSerialIndex(db); err != nil {
+		log.Fatalf("An error %v occurred while creating the printer serial number index, it needs MySQL 8.0.13 or later and no duplicate serial numbers", err)
+	}
+	if err := repository.CreatePrinterSearchIndex(db); err != nil {
+		log.Fatalf("An error %v occurred while creating the printer search index", err)
+	}
+	if config.Seed {
+		if err := repository.SeedPrinterModels(db, domain.PrinterModelCatalog); err != nil {
+			log.Fatalf("An error %v occurred while seeding the printer model catalog", err)
+		}
+	}
 }
 
 func AuthUnaryServerInterceptor() grpc.UnaryServerInterceptor {
@@ -137,22 +485,59 @@ func AuthUnaryServerInterceptor() grpc.UnaryServerInterceptor {
 			return nil, status.Errorf(codes.InvalidArgument, "headers absent")
 		}
 		if headers.Len() != 0 && headers.Get("Authorization") != nil {
-			bearerTkn := headers.Get("Authorization")[0]
-			if strings.Contains(bearerTkn, "Bearer ") || strings.Contains(bearerTkn, "bearer ") {
-				bearerTkn = bearerTkn[7:]
-			}
-			claims, valid := util.ValidateTokenExpiry(viper.GetString("jwt_config.secret_key"), bearerTkn)
-			if !valid {
-				return nil, status.Errorf(codes.PermissionDenied, "invalid signature")
+			user, err := authenticate(headers.Get("Authorization")[0])
+			if err != nil {
+				return nil, err
 			}
-			childCtx := context.WithValue(ctx, "user", map[string]string{"user_id": claims.UserId})
+			childCtx := context.WithValue(ctx, "user", user)
 			return handler(childCtx, req)
 		}
 
 		if headers.Len() != 0 && headers.Get("Authorization") == nil {
-			return nil, status.Errorf(codes.Unauthenticated, "auth failure")
+			return nil, apierr.Unauthenticated("auth failure")
 		}
 
 		return handler(ctx, req)
 	}
 }
+
+// authenticate validates the bearer token and returns the user it was issued to
+func authenticate(bearerTkn string) (map[string]string, error) {
+	if strings.Contains(bearerTkn, "Bearer ") || strings.Contains(bearerTkn, "bearer ") {
+		bearerTkn = bearerTkn[7:]
+	}
+	secretKey, err := resolveSecret(Config().JwtConfig.SecretKey)
+	if err == nil && secretKey == "" {
+		err = fmt.Errorf("the key is empty")
+	}
+	if err != nil {
+		logrus.Errorf("An error %v occurred while reading the jwt secret key", err)
+		return nil, apierr.Unavailable("jwt secret key unavailable", time.Second)
+	}
+	claims, valid := util.ValidateTokenExpiry(secretKey, bearerTkn)
+	if !valid {
+		return nil, apierr.Unauthenticated("invalid signature")
+	}
+	// the signature was verified above, this only reads the tenant claims the util package drops
+	tenantClaims := &Claims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(bearerTkn, tenantClaims); err != nil {
+		return nil, apierr.Unauthenticated("invalid claims")
+	}
+	user := map[string]string{"user_id": claims.UserId, "tenant_id": tenantClaims.TenantId}
+	if tenantClaims.TenantRole == "admin" {
+		user["tenant_role"] = "admin"
+	}
+	if isAdmin(claims.UserId) {
+		user["role"] = "admin"
+	}
+	return user, nil
+}
+
+func isAdmin(userId string) bool {
+	for _, adminId := range Config().JwtConfig.AdminUserIds {
+		if adminId == userId {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"ditto/pkg/apierr"
+	"ditto/pkg/domain"
+	"ditto/pkg/handler"
+	"ditto/pkg/interceptor"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// rateLimiter limits the requests of every user to both rpcs and plain http endpoints.
+var rateLimiter = interceptor.NewRateLimiter(0, 0)
+
+// AuthHandler authenticates plain http endpoints served next to the gateway the same way
+// AuthUnaryServerInterceptor authenticates rpcs, and rate limits them the same way too. Rejections are written the
+// way the gateway writes the errors of rpcs.
+func AuthHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		if authorization == "" {
+			handler.WriteStatusError(w, apierr.Unauthenticated("auth failure"))
+			return
+		}
+		user, err := authenticate(authorization)
+		if err != nil {
+			handler.WriteStatusError(w, err)
+			return
+		}
+		ctx := context.WithValue(r.Context(), "user", user)
+		if !rateLimiter.AllowCaller(ctx) {
+			handler.WriteStatusError(w, apierr.ResourceExhausted("rate limit exceeded", rateLimiter.RetryDelay()))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// DeviceAuthHandler authenticates device endpoints by the client certificate verified during the TLS handshake,
+// putting the printer it was issued to, and its tenant, in the context.
+func DeviceAuthHandler(authenticate func(context.Context, *x509.Certificate) (*domain.Printer, error), next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			handler.WriteStatusError(w, apierr.Unauthenticated("client certificate required"))
+			return
+		}
+		printer, err := authenticate(r.Context(), r.TLS.VerifiedChains[0][0])
+		if err != nil {
+			handler.WriteStatusError(w, err)
+			return
+		}
+		device := map[string]string{"printer_id": printer.ExternalId, "user_id": printer.UserId, "tenant_id": printer.TenantId}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "device", device)))
+	})
+}
+
+// setCorsHeaders sets the CORS headers configured in cors_config, which apply as soon as they are reloaded.
+func setCorsHeaders(w http.ResponseWriter) {
+	cors := Config().CorsConfig
+	w.Header().Set("Access-Control-Allow-Methods", cors.AllowMethods)
+	w.Header().Set("Access-Control-Allow-Credentials", strconv.FormatBool(cors.AllowCredentials))
+	w.Header().Set("Access-Control-Allow-Origin", cors.AllowOrigin)
+	w.Header().Set("Access-Control-Allow-Headers", cors.AllowHeaders)
+}
+
+// gatewayPath returns the path of an http endpoint mounted under the gateway url
+func gatewayPath(path string) string {
+	return strings.TrimSuffix(Config().ServerConfig.GatewayURL, "/") + path
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/infobloxopen/atlas-app-toolkit/server"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+// shutdownStage orders the shutdown hooks, every stage runs once the ones before it are done.
+type shutdownStage int
+
+const (
+	// stopServing drains the gRPC server and the gateway
+	stopServing shutdownStage = iota
+	// stopBackground stops the workers, the conversion pool and config reloading
+	stopBackground
+	// stopInternal stops the internal server, which serves health checks and metrics until then
+	stopInternal
+	// closeResources closes the database pool
+	closeResources
+)
+
+type shutdownHook struct {
+	stage shutdownStage
+	name  string
+	stop  func(ctx context.Context) error
+}
+
+// Lifecycle shuts ditto down in order when it is asked to stop. Readiness fails first so the load balancer stops
+// sending requests, after DrainDelay the servers are drained, the background work stopped and the database pool
+// closed, all within Timeout.
+type Lifecycle struct {
+	logger   *logrus.Logger
+	config   ShutdownConfig
+	draining int32
+	mu       sync.Mutex
+	hooks    []shutdownHook
+}
+
+func NewLifecycle(logger *logrus.Logger, config ShutdownConfig) *Lifecycle {
+	return &Lifecycle{logger: logger, config: config}
+}
+
+// OnShutdown registers stop to run in stage, hooks of a stage run in the order they were registered.
+func (l *Lifecycle) OnShutdown(stage shutdownStage, name string, stop func(ctx context.Context) error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, shutdownHook{stage: stage, name: name, stop: stop})
+}
+
+// Ready is a readiness check failing once shutdown started.
+func (l *Lifecycle) Ready() error {
+	if atomic.LoadInt32(&l.draining) == 1 {
+		return errors.New("shutting down")
+	}
+	return nil
+}
+
+// Shutdown runs the hooks stage by stage. A hook that fails, or doesn't return in time, is logged and shutdown
+// carries on with the next one.
+func (l *Lifecycle) Shutdown() error {
+	atomic.StoreInt32(&l.draining, 1)
+	l.logger.Infof("shutting down, draining for %v", l.config.DrainDelay)
+	time.Sleep(l.config.DrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.config.Timeout)
+	defer cancel()
+	l.mu.Lock()
+	hooks := append([]shutdownHook(nil), l.hooks...)
+	l.mu.Unlock()
+
+	var failed []string
+	for stage := stopServing; stage <= closeResources; stage++ {
+		for _, hook := range hooks {
+			if hook.stage != stage {
+				continue
+			}
+			if err := hook.stop(ctx); err != nil {
+				l.logger.Errorf("An error %v occurred while stopping %v", err, hook.name)
+				failed = append(failed, hook.name)
+				continue
+			}
+			l.logger.Infof("stopped %v", hook.name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("shutdown of %v failed", failed)
+	}
+	return nil
+}
+
+// serve serves s on the listeners until either fails or is stopped. Unlike server.Server's Serve it leaves the other
+// server running when one returns, so that the hooks of Lifecycle drain them in order.
+func serve(s *server.Server, grpcL net.Listener, httpL net.Listener) error {
+	errC := make(chan error, 2)
+	if httpL != nil {
+		go func() { errC <- s.HTTPServer.Serve(httpL) }()
+	}
+	if grpcL != nil {
+		go func() { errC <- s.GRPCServer.Serve(grpcL) }()
+	}
+	if err := <-errC; err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// gracefulStop waits for the rpcs in progress to finish, cutting them off when ctx is done first.
+func gracefulStop(ctx context.Context, grpcServer *grpc.Server) error {
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		grpcServer.Stop()
+		return ctx.Err()
+	}
+}
+
+// waitGroup waits for wg, giving up when ctx is done first.
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -2,10 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"database/sql"
+	"ditto/pkg/apierr"
+	"ditto/pkg/conversion"
+	"ditto/pkg/handler"
+	"ditto/pkg/interceptor"
+	"ditto/pkg/repository"
+	"ditto/pkg/secrets"
+	"ditto/pkg/svc"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/golang/protobuf/proto"
-	grpcPrometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
 	"github.com/infobloxopen/atlas-app-toolkit/gateway"
 	"github.com/infobloxopen/atlas-app-toolkit/gorm/resource"
@@ -15,12 +24,18 @@ import (
 	"github.com/kutty-kumar/ho_oh/ditto_v1"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 	_ "github.com/spf13/viper/remote"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"io"
 	"log"
+	"math"
 	"net"
 	"net/http"
-	"strings"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 )
 
@@ -28,28 +43,115 @@ var (
 	configProviderKey    = "CONFIG_PROVIDER"
 	configSvcEndpointKey = "CONFIG_ENDPOINT"
 	configPathKey        = "CONFIG_PATH"
+	metricPrefixKey      = "PROM_METRIC_NAME_PREFIX"
 )
 
 func main() {
-	doneC := make(chan error)
-	logger := NewLogger()
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(RunConfigCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	config, err := LoadConfig(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Fatalf("%v", err)
+	}
+	resource.RegisterApplication(config.App.Id)
+	resource.SetPlural()
+
+	doneC := make(chan error, 2)
+	logger := NewLogger(config.LoggingConfig)
+	resolver, err := NewSecretResolver(logger, config.SecretsConfig)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	secretResolver = resolver
+	rateLimiter.SetLimits(config.RateLimitConfig.RequestsPerSecond, config.RateLimitConfig.Burst)
 
-	if viper.GetBool("server_config.internal_enable") {
-		go func() { doneC <- ServeInternal(logger) }()
+	lifecycle := NewLifecycle(logger, config.ShutdownConfig)
+	reloader := NewConfigReloader(logger)
+	reloader.OnReload(func(config *PikachuConfig) {
+		setLogLevel(logger, config.LoggingConfig.LogLevel)
+		rateLimiter.SetLimits(config.RateLimitConfig.RequestsPerSecond, config.RateLimitConfig.Burst)
+	})
+	if config.ReloadConfig.Enable {
+		reloadCtx, stopReloading := context.WithCancel(context.Background())
+		go reloader.Watch(reloadCtx)
+		lifecycle.OnShutdown(stopBackground, "config reloading", func(ctx context.Context) error {
+			stopReloading()
+			return nil
+		})
 	}
 
-	go func() { doneC <- ServeExternal(logger) }()
+	tracerProvider, err := NewTracerProvider(context.Background(), config.TracingConfig)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+	lifecycle.OnShutdown(closeResources, "tracing", tracerProvider.Shutdown)
 
-	if err := <-doneC; err != nil {
-		logger.Fatal(err)
+	replicas := NewReplicaRouting(logger, config.DatabaseConfig)
+	db, err := NewDB(config, replicas)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		logger.Fatalln(err)
+	}
+	registerMetrics(sqlDB, config.MetricsConfig.NamePrefix)
+	lifecycle.OnShutdown(closeResources, "database pool", func(ctx context.Context) error {
+		for _, pool := range replicaPools(replicas) {
+			pool.Close()
+		}
+		return sqlDB.Close()
+	})
+	reloader.OnReload(func(config *PikachuConfig) {
+		for _, pool := range append([]*sql.DB{sqlDB}, replicaPools(replicas)...) {
+			configurePool(pool, config.DatabaseConfig)
+		}
+		replicas.SetMaxLag(config.DatabaseConfig.ReplicaMaxLag)
+	})
+	secretResolver.OnRotate(func(rotated []secrets.Reference) {
+		// idle connections were opened with the old credentials, the ones opened from now on use the rotated ones
+		for _, pool := range append([]*sql.DB{sqlDB}, replicaPools(replicas)...) {
+			pool.SetMaxIdleConns(0)
+			pool.SetMaxIdleConns(Config().DatabaseConfig.MaxIdleConns)
+		}
+	})
+
+	if config.ServerConfig.InternalEnable {
+		go func() { doneC <- ServeInternal(logger, config, sqlDB, reloader, lifecycle) }()
+	}
+
+	go func() { doneC <- ServeExternal(logger, config, db, replicas, lifecycle) }()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	var serveErr error
+	select {
+	case received := <-signals:
+		logger.Infof("received %v", received)
+	case serveErr = <-doneC:
+	}
+	if err := lifecycle.Shutdown(); err != nil {
+		logger.Error(err)
+	}
+	if serveErr != nil {
+		logger.Fatal(serveErr)
 	}
 }
 
-func NewLogger() *logrus.Logger {
+func NewLogger(config LoggingConfig) *logrus.Logger {
 	logger := logrus.StandardLogger()
 	logrus.SetFormatter(&logrus.JSONFormatter{})
 
-	// Set the log level on the default logger based on command line flag
+	setLogLevel(logger, config.LogLevel)
+	return logger
+}
+
+// setLogLevel sets the log level of the default logger, it is called again whenever the config is reloaded.
+func setLogLevel(logger *logrus.Logger, name string) {
 	logLevels := map[string]logrus.Level{
 		"debug":   logrus.DebugLevel,
 		"info":    logrus.InfoLevel,
@@ -58,26 +160,24 @@ func NewLogger() *logrus.Logger {
 		"fatal":   logrus.FatalLevel,
 		"panic":   logrus.PanicLevel,
 	}
-	if level, ok := logLevels[viper.GetString("logging_config.log_level")]; !ok {
-		logger.Errorf("Invalid %q provided for log level", viper.GetString("logging_config.log_level"))
+	if level, ok := logLevels[name]; !ok {
+		logger.Errorf("Invalid %q provided for log level", name)
 		logger.SetLevel(logrus.InfoLevel)
 	} else {
 		logger.SetLevel(level)
 	}
-
-	return logger
 }
 
 // ServeInternal builds and runs the server that listens on InternalAddress
-func ServeInternal(logger *logrus.Logger) error {
+func ServeInternal(logger *logrus.Logger, config *PikachuConfig, db *sql.DB, reloader *ConfigReloader, lifecycle *Lifecycle) error {
+	internalAddress := net.JoinHostPort(config.ServerConfig.InternalAddress, config.ServerConfig.InternalPort)
 	healthChecker := health.NewChecksHandler(
-		viper.GetString("server_config.internal_health"),
-		viper.GetString("server_config.internal_readiness"),
-	)
-	healthChecker.AddReadiness("DB ready check", dbReady)
-	healthChecker.AddLiveness("ping", health.HTTPGetCheck(
-		fmt.Sprint("http://", viper.GetString("server_config.internal_address"), ":", viper.GetString("server_config.internal_port"), "/ping"), time.Minute),
+		config.ServerConfig.InternalHealth,
+		config.ServerConfig.InternalReadiness,
 	)
+	healthChecker.AddReadiness("shutdown", lifecycle.Ready)
+	healthChecker.AddReadiness("DB ready check", dbReady(db, config.DatabaseConfig.PingTimeout))
+	healthChecker.AddLiveness("ping", health.HTTPGetCheck(fmt.Sprint("http://", internalAddress, "/ping"), time.Minute))
 
 	s, err := server.NewServer(
 		// register our health checks
@@ -88,117 +188,226 @@ func ServeInternal(logger *logrus.Logger) error {
 			w.Write([]byte("pong"))
 		})),
 		// register metrics
-		server.WithHandler("/metrics", promhttp.Handler()),
+		server.WithHandler("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{})),
+		// the version and hash of the config in effect
+		server.WithHandler("/config/version", reloader),
 	)
 	if err != nil {
 		return err
 	}
-	l, err := net.Listen("tcp", fmt.Sprintf("%s:%s", viper.GetString("server_config.internal_address"), viper.GetString("server_config.internal_port")))
-	log.Printf("%s:%s", viper.GetString("server_config.internal_address"), viper.GetString("server_config.internal_port"))
+	l, err := net.Listen("tcp", internalAddress)
 	if err != nil {
-		log.Fatalf("%v", err)
 		return err
 	}
 
-	logger.Debugf("serving internal http at %q", fmt.Sprintf("%s:%s", viper.GetString("server_config.internal_address"), viper.GetString("server_config.internal_port")))
-	return s.Serve(nil, l)
+	logger.Debugf("serving internal http at %q", internalAddress)
+	lifecycle.OnShutdown(stopInternal, "internal server", s.HTTPServer.Shutdown)
+	return serve(s, nil, l)
 }
 
 // ServeExternal builds and runs the server that listens on ServerAddress and GatewayAddress
-func ServeExternal(logger *logrus.Logger) error {
+func ServeExternal(logger *logrus.Logger, config *PikachuConfig, db *gorm.DB, replicas *repository.ReplicaRouting, lifecycle *Lifecycle) error {
+	repositories := NewRepositories(db, logger, config)
+	documentStore, err := NewDocumentStore(logger, config.StorageConfig)
+	if err != nil {
+		return err
+	}
+	backgroundCtx, stopBackgroundWork := context.WithCancel(context.Background())
+	background := StartWorkers(backgroundCtx, logger, config, repositories, documentStore, replicas)
+	lifecycle.OnShutdown(stopBackground, "workers", func(ctx context.Context) error {
+		stopBackgroundWork()
+		return waitGroup(ctx, background)
+	})
 
-	if viper.GetString("database_config.dsn") == "" {
-		setDBConnection()
+	connectorSvc := svc.NewConnectorSvc(repositories.Connector, repositories.PrintJob, repositories.Printer, repositories.ProductCatalog(),
+		documentStore, logger, svc.ConnectorOptions{
+			DispatchInterval: config.ConnectorConfig.DispatchInterval,
+			MaxInFlight:      config.ConnectorConfig.MaxInFlight,
+			ChunkBytes:       config.ConnectorConfig.ChunkBytes,
+		})
+	printerSvc := NewPrinterSvc(repositories)
+	grpcServer, err := NewGRPCServer(logger, config, repositories, printerSvc, connectorSvc)
+	if err != nil {
+		return err
 	}
-	grpcServer, err := NewGRPCServer(logger)
+
+	receiptSigningKey, err := resolveSecret(config.PrivacyConfig.ReceiptSigningKey)
 	if err != nil {
-		logger.Fatalln(err)
+		return err
 	}
-	grpcPrometheus.Register(grpcServer)
+	userDataHandler := handler.NewUserDataHandler(svc.NewUserDataSvc(repositories.UserData, repositories.Document, documentStore,
+		logger, receiptSigningKey))
+	bulkPrinterHandler := handler.NewBulkPrinterHandler(svc.NewBulkPrinterSvc(repositories.Printer, repositories.ProductCatalog()))
+	printerSearchHandler := handler.NewPrinterSearchHandler(svc.NewPrinterSearchSvc(repositories.Search))
+	locationHandler := handler.NewLocationHandler(svc.NewLocationSvc(repositories.Location), gatewayPath("/v1/locations/"))
+	printerGroupHandler := handler.NewPrinterGroupHandler(svc.NewPrinterGroupSvc(repositories.Group), gatewayPath("/v1/printer-groups/"))
+	conversionPool := conversion.NewPool(config.ConversionConfig.Workers, config.ConversionConfig.QueueSize)
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		conversionPool.Run(backgroundCtx)
+	}()
+	printDocumentSvc := svc.NewPrintDocumentSvc(repositories.PrintJob, repositories.Document, repositories.Printer, repositories.Model, documentStore,
+		conversion.NewDefaultRegistry(config.ConversionConfig.GhostscriptPath, config.ConversionConfig.RasterResolution),
+		conversionPool, logger, svc.PrintDocumentLimits{
+			MaxDocumentBytes:  config.ConversionConfig.MaxDocumentBytes,
+			MaxConvertedBytes: config.ConversionConfig.MaxOutputBytes,
+			UploadTtl:         config.StorageConfig.UploadTtl,
+			ConversionTimeout: config.ConversionConfig.Timeout,
+		})
+	releaseHandler := handler.NewReleaseHandler(svc.NewReleaseSvc(repositories.Release, repositories.PrintJob, repositories.Printer,
+		repositories.Group, repositories.Model, config.ReleaseConfig.MaxPinAttempts, config.ReleaseConfig.MaxBadgeAttempts,
+		config.ReleaseConfig.Lockout),
+		gatewayPath("/v1/release-credentials/"))
+	connectorHandler := handler.NewConnectorHandler(connectorSvc, gatewayPath("/v1/connectors/"))
+	documentUploadHandler := handler.NewDocumentUploadHandler(printDocumentSvc, gatewayPath("/v1/document-uploads/"))
+	printJobHandler := handler.NewPrintJobHandler(svc.NewPrintJobSvc(repositories.PrintJob, repositories.Printer, repositories.Group,
+		config.PoolConfig.OnlineWindow), printDocumentSvc, gatewayPath("/v1/print-jobs/"))
+	printerModelHandler := handler.NewPrinterModelHandler(svc.NewPrinterModelSvc(repositories.Model, repositories.Printer), gatewayPath("/v1/printer-models/"))
+	ca, err := NewCertificateAuthority(logger, config.EnrollmentConfig)
+	if err != nil {
+		return err
+	}
+	enrollmentSvc := svc.NewEnrollmentSvc(repositories.Enrollment, repositories.Printer, repositories.ProductCatalog(), ca, logger,
+		svc.EnrollmentOptions{
+			ClaimCodeTtl:   config.EnrollmentConfig.ClaimCodeTtl,
+			CertificateTtl: config.EnrollmentConfig.CertificateTtl,
+		})
+	enrollmentHandler := handler.NewEnrollmentHandler(enrollmentSvc, gatewayPath("/v1/device-enrollments/"))
+	deviceCertificateHandler := handler.NewDeviceCertificateHandler(enrollmentSvc, gatewayPath("/v1/device-certificates/"))
+	tenantHandler := handler.NewTenantHandler(svc.NewTenantSvc(repositories.Tenant), gatewayPath("/v1/tenants/"))
+	deletedPrinterHandler := handler.NewDeletedPrinterHandler(printerSvc, gatewayPath("/v1/deleted-printers/"))
+	batchPrinterHandler := handler.NewBatchPrinterHandler(svc.NewBatchPrinterSvc(repositories.Printer, repositories.ProductCatalog(),
+		config.BatchConfig.ChunkSize, config.BatchConfig.MaxItems))
 
+	grpcAddress := net.JoinHostPort(config.ServerConfig.Address, config.ServerConfig.Port)
+	httpAddress := net.JoinHostPort(config.ServerConfig.GatewayAddress, config.ServerConfig.GatewayPort)
 	s, err := server.NewServer(
 		server.WithGrpcServer(grpcServer),
 		server.WithGateway(
 			gateway.WithGatewayOptions(
 				runtime.WithForwardResponseOption(forwardResponseOption),
 				runtime.WithIncomingHeaderMatcher(gateway.ExtendedDefaultHeaderMatcher(
-					requestid.DefaultRequestIDKey)),
+					requestid.DefaultRequestIDKey, interceptor.IdempotencyKeyHeader, "traceparent", "tracestate", "baggage")),
 				runtime.WithProtoErrorHandler(defaultProtoErrorHandler),
 			),
-			gateway.WithServerAddress(fmt.Sprintf("%s:%s", viper.GetString("server_config.address"), viper.GetString("server_config.port"))),
-			gateway.WithEndpointRegistration(viper.GetString("server_config.gateway_url"), ditto_v1.RegisterPrinterServiceHandlerFromEndpoint),
+			gateway.WithServerAddress(grpcAddress),
+			gateway.WithEndpointRegistration(config.ServerConfig.GatewayURL, ditto_v1.RegisterPrinterServiceHandlerFromEndpoint),
 		),
+		server.WithHandler(gatewayPath("/v1/user-data/export"), AuthHandler(http.HandlerFunc(userDataHandler.ExportUserData))),
+		server.WithHandler(gatewayPath("/v1/user-data"), AuthHandler(http.HandlerFunc(userDataHandler.EraseUserData))),
+		server.WithHandler(gatewayPath("/v1/erasure-receipt-verifications"), AuthHandler(http.HandlerFunc(userDataHandler.VerifyReceipt))),
+		server.WithHandler(gatewayPath("/v1/printers/import"), AuthHandler(http.HandlerFunc(bulkPrinterHandler.ImportPrinters))),
+		server.WithHandler(gatewayPath("/v1/printers/export"), AuthHandler(http.HandlerFunc(bulkPrinterHandler.ExportPrinters))),
+		server.WithHandler(gatewayPath("/v1/printers/search"), AuthHandler(http.HandlerFunc(printerSearchHandler.SearchPrinters))),
+		server.WithHandler(gatewayPath("/v1/printers/batch-create"), AuthHandler(http.HandlerFunc(batchPrinterHandler.BatchCreatePrinters))),
+		server.WithHandler(gatewayPath("/v1/printers/batch-update"), AuthHandler(http.HandlerFunc(batchPrinterHandler.BatchUpdatePrinters))),
+		server.WithHandler(gatewayPath("/v1/deleted-printers/"), AuthHandler(deletedPrinterHandler)),
+		server.WithHandler(gatewayPath("/v1/printer-purges"), AuthHandler(http.HandlerFunc(deletedPrinterHandler.PurgePrinter))),
+		server.WithHandler(gatewayPath("/v1/locations/"), AuthHandler(locationHandler)),
+		server.WithHandler(gatewayPath("/v1/nearby-printers"), AuthHandler(http.HandlerFunc(locationHandler.GetPrintersNear))),
+		server.WithHandler(gatewayPath("/v1/printer-locations"), AuthHandler(http.HandlerFunc(locationHandler.AssignPrinter))),
+		server.WithHandler(gatewayPath("/v1/printer-groups/"), AuthHandler(printerGroupHandler)),
+		server.WithHandler(gatewayPath("/v1/print-jobs/"), AuthHandler(printJobHandler)),
+		server.WithHandler(gatewayPath("/v1/document-uploads/"), AuthHandler(documentUploadHandler)),
+		server.WithHandler(gatewayPath("/v1/release-credentials/"), AuthHandler(releaseHandler)),
+		server.WithHandler(gatewayPath("/v1/job-releases"), AuthHandler(http.HandlerFunc(releaseHandler.ReleaseJobs))),
+		server.WithHandler(gatewayPath("/v1/connectors/"), AuthHandler(connectorHandler)),
+		server.WithHandler(gatewayPath("/v1/printer-models/"), AuthHandler(printerModelHandler)),
+		server.WithHandler(gatewayPath("/v1/printer-capabilities"), AuthHandler(http.HandlerFunc(printerModelHandler.GetCapabilities))),
+		server.WithHandler(gatewayPath("/v1/printer-heartbeats"), AuthHandler(http.HandlerFunc(printJobHandler.Heartbeat))),
+		server.WithHandler(gatewayPath("/v1/tenants/"), AuthHandler(tenantHandler)),
+		server.WithHandler(gatewayPath("/v1/device-enrollments/"), enrollmentHandler),
+		server.WithHandler(gatewayPath("/v1/device-claims"), AuthHandler(http.HandlerFunc(enrollmentHandler.ClaimDevice))),
+		server.WithHandler(gatewayPath("/v1/device-certificates/"), AuthHandler(deviceCertificateHandler)),
+		server.WithHandler(gatewayPath("/v1/device/heartbeat"), DeviceAuthHandler(enrollmentSvc.AuthenticateDevice, http.HandlerFunc(enrollmentHandler.DeviceHeartbeat))),
+		server.WithHandler(gatewayPath("/v1/device/certificate"), DeviceAuthHandler(enrollmentSvc.AuthenticateDevice, http.HandlerFunc(enrollmentHandler.RenewCertificate))),
 	)
 	if err != nil {
-		logger.Fatalln(err)
+		return err
 	}
 
-	grpcL, err := net.Listen("tcp", fmt.Sprintf("%s:%s", viper.GetString("server_config.address"), viper.GetString("server_config.port")))
+	grpcL, err := net.Listen("tcp", grpcAddress)
 	if err != nil {
-		logger.Fatalln(err)
+		return err
 	}
 
-	httpL, err := net.Listen("tcp", fmt.Sprintf("%s:%s", viper.GetString("server_config.gateway_address"), viper.GetString("server_config.gateway_port")))
+	httpL, err := net.Listen("tcp", httpAddress)
 	if err != nil {
-		logger.Fatalln(err)
+		grpcL.Close()
+		return err
 	}
 
-	logger.Printf("serving gRPC at %s:%s", viper.GetString("server_config.address"), viper.GetString("server_config.port"))
-	logger.Printf("serving http at %s:%s", viper.GetString("server_config.gateway_address"), viper.GetString("server_config.gateway_port"))
+	if certFile := config.EnrollmentConfig.TlsCertFile; certFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, config.EnrollmentConfig.TlsKeyFile)
+		if err != nil {
+			grpcL.Close()
+			httpL.Close()
+			return err
+		}
+		// client certificates are optional, only the device endpoints require one
+		httpL = tls.NewListener(httpL, &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			ClientCAs:    ca.Pool(),
+			ClientAuth:   tls.VerifyClientCertIfGiven,
+			NextProtos:   []string{"http/1.1"},
+		})
+	} else {
+		logger.Warn("enrollment_config.tls_cert_file is not set, device endpoints can't authenticate devices without TLS")
+	}
 
-	return s.Serve(grpcL, httpL)
-}
+	logger.Printf("serving gRPC at %s", grpcAddress)
+	logger.Printf("serving http at %s", httpAddress)
 
-func init() {
-	viper.AutomaticEnv()
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-	err := viper.AddRemoteProvider(viper.GetString(configProviderKey), viper.GetString(configSvcEndpointKey), viper.GetString(configPathKey))
-	if err != nil {
-		log.Fatalf("An error %v occurred while fetching config form %v", err, viper.GetString(configProviderKey))
-	}
-	viper.SetConfigType("json") // Need to explicitly set this to json
-	err = viper.ReadRemoteConfig()
-	if err != nil {
-		log.Fatalf("An error %v occurred while reading config", err)
-	}
-	resource.RegisterApplication(viper.GetString("app.id"))
-	resource.SetPlural()
+	// the gateway goes first as the requests it is still serving are forwarded to the gRPC server
+	lifecycle.OnShutdown(stopServing, "gateway", s.HTTPServer.Shutdown)
+	lifecycle.OnShutdown(stopServing, "connector streams", func(ctx context.Context) error {
+		connectorSvc.DisconnectAll()
+		return nil
+	})
+	lifecycle.OnShutdown(stopServing, "gRPC server", func(ctx context.Context) error {
+		return gracefulStop(ctx, s.GRPCServer)
+	})
+	return serve(s, grpcL, httpL)
 }
 
 func forwardResponseOption(ctx context.Context, w http.ResponseWriter, resp proto.Message) error {
 	w.Header().Set("Cache-Control", "no-cache, no-store, max-age=0, must-revalidate")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, HEAD, OPTIONS, PATCH")
-	w.Header().Set("Access-Control-Allow-Credentials", "true")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Cache-Control", "no-cache, no-store, max-age=0, must-revalidate")
-	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+	setCorsHeaders(w)
 	return nil
 }
 
+// fallbackErrorBody is written when the status of an error can't be marshalled.
+const fallbackErrorBody = `{"code": 13, "message": "failed to marshal error message"}`
+
+// defaultProtoErrorHandler writes the grpc status of e as the http status the code maps to, with the status and its
+// details as the JSON body, e.g. {"code": 5, "message": "printer p1 not found", "details": [...]}. Statuses asking
+// clients to retry later set Retry-After too.
 func defaultProtoErrorHandler(ctx context.Context, sMux *runtime.ServeMux, marshaller runtime.Marshaler, w http.ResponseWriter, r *http.Request, e error) {
 	w.Header().Set("Cache-Control", "no-cache, no-store, max-age=0, must-revalidate")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, HEAD, OPTIONS, PATCH")
-	w.Header().Set("Access-Control-Allow-Credentials", "true")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-}
-
-func dbReady() error {
-	if viper.GetString("database_config.dsn") == "" {
-		setDBConnection()
+	setCorsHeaders(w)
+	s := status.Convert(e)
+	w.Header().Set("Content-Type", marshaller.ContentType())
+	if retryDelay, ok := apierr.RetryDelay(s); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryDelay.Seconds()))))
 	}
-	db, err := sql.Open(viper.GetString("database_config.type"), viper.GetString("database_config.dsn"))
+	body, err := marshaller.Marshal(s.Proto())
 	if err != nil {
-		return err
+		logrus.Errorf("An error %v occurred while marshalling the error %v", err, e)
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, fallbackErrorBody)
+		return
 	}
-	defer db.Close()
-	return db.Ping()
+	w.WriteHeader(runtime.HTTPStatusFromCode(s.Code()))
+	w.Write(body)
 }
 
-// setDBConnection sets the db connection string
-func setDBConnection() {
-	viper.Set("database_config.dsn", fmt.Sprintf("host=%s port=%s user=%s password=%s sslmode=%s dbname=%s",
-		viper.GetString("database_config.host_name"), viper.GetString("database_config.port"),
-		viper.GetString("database_config.user_name"), viper.GetString("database_config.password"),
-		viper.GetString("database_config.ssl"), viper.GetString("database_config.name")))
+// dbReady pings the database through the shared pool, so probes neither open connections of their own nor
+// succeed while the pool is exhausted.
+func dbReady(db *sql.DB, timeout time.Duration) health.Check {
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return db.PingContext(ctx)
+	}
 }
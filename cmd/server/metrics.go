@@ -0,0 +1,24 @@
+package main
+
+import (
+	"database/sql"
+	"ditto/pkg/metrics"
+
+	grpcPrometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// reg is the registry /metrics serves
+	reg         = prometheus.NewRegistry()
+	grpcMetrics = grpcPrometheus.NewServerMetrics()
+)
+
+// registerMetrics registers ditto's metrics on reg, their names prefixed with prefix. The go runtime and process
+// metrics keep their usual names.
+func registerMetrics(db *sql.DB, prefix string) {
+	prefixed := prometheus.WrapRegistererWithPrefix(prefix, reg)
+	prefixed.MustRegister(grpcMetrics, configReloadMetric, newDBStatsCollector(db))
+	prefixed.MustRegister(metrics.Collectors()...)
+	reg.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+}
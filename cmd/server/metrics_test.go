@@ -0,0 +1,34 @@
+package main
+
+import (
+	"database/sql"
+	"ditto/pkg/domain"
+	"ditto/pkg/metrics"
+	"testing"
+)
+
+func TestRegisterMetrics(t *testing.T) {
+	db, err := sql.Open("mysql", "root@tcp(127.0.0.1:3306)/ditto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	registerMetrics(db, "ditto_")
+	metrics.PrinterCreated(nil)
+	metrics.JobEntered(domain.JobStateQueued)
+	configReloadMetric.WithLabelValues("file", "applied").Inc()
+
+	values := gathered(t, reg)
+	served := []string{"ditto_printers_created_total", "ditto_print_jobs_total", "ditto_config_reloads_total",
+		"ditto_db_open_connections", "go_goroutines", "process_open_fds"}
+	for _, name := range served {
+		if _, ok := values[name]; !ok {
+			t.Errorf("%v isn't served", name)
+		}
+	}
+	for _, name := range []string{"printers_created_total", "user_service_create_user_success_count"} {
+		if _, ok := values[name]; ok {
+			t.Errorf("%v is served", name)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"ditto/pkg/secrets"
+	"net/http"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// secretResolver resolves the settings holding references to secrets, it reads local files until main configures Vault.
+var secretResolver = secrets.NewResolver(map[string]secrets.Provider{"file": secrets.NewFileProvider()}, logrus.StandardLogger())
+
+// NewSecretResolver registers the providers configured in secrets_config, falling back to the VAULT_ADDR and
+// VAULT_TOKEN variables Vault's own tooling reads.
+func NewSecretResolver(logger *logrus.Logger, config SecretsConfig) (*secrets.Resolver, error) {
+	providers := map[string]secrets.Provider{"file": secrets.NewFileProvider()}
+	address := config.VaultAddress
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address != "" {
+		token := config.VaultToken
+		if token == "" {
+			token = os.Getenv("VAULT_TOKEN")
+		}
+		vault, err := secrets.NewVaultProvider(secrets.VaultConfig{
+			Address:   address,
+			Token:     token,
+			TokenFile: config.VaultTokenFile,
+			KvMounts:  config.VaultKvMounts,
+		}, &http.Client{Timeout: config.VaultTimeout})
+		if err != nil {
+			return nil, err
+		}
+		providers["vault"] = vault
+	}
+	return secrets.NewResolver(providers, logger), nil
+}
+
+// resolveSecret resolves setting when it refers to a secret, returning it as it is otherwise. Settings resolved on
+// every use pick up rotated secrets and reloaded references.
+func resolveSecret(setting string) (string, error) {
+	return secretResolver.Resolve(context.Background(), setting)
+}
@@ -0,0 +1,148 @@
+// Package apierr builds the grpc status errors the api returns, with the errdetails clients need to act on them, and
+// maps the errors of the storage layer to them so that none reaches a client as Unknown.
+package apierr
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/golang/protobuf/proto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"gorm.io/gorm"
+)
+
+// mysqlDuplicateEntry is the error number of MySQL's ER_DUP_ENTRY.
+const mysqlDuplicateEntry = 1062
+
+// storageRetryDelay is how long clients are told to wait before retrying a call the database was unavailable for.
+const storageRetryDelay = time.Second
+
+// FieldViolation describes why the value of a field of a request is invalid, Field being its path, e.g. request.name.
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// NotFound reports that the resource of resourceType identified by name doesn't exist, or isn't the caller's.
+func NotFound(resourceType string, name string) error {
+	return withDetails(status.New(codes.NotFound, resourceMessage(resourceType, name, "not found")),
+		&errdetails.ResourceInfo{ResourceType: resourceType, ResourceName: name})
+}
+
+// AlreadyExists reports that a resource of resourceType identified by name exists already, description telling why
+// it conflicts.
+func AlreadyExists(resourceType string, name string, description string) error {
+	return withDetails(status.New(codes.AlreadyExists, description),
+		&errdetails.ResourceInfo{ResourceType: resourceType, ResourceName: name, Description: description})
+}
+
+// InvalidArgument reports the fields of a request that are invalid, its message is that of the first violation.
+func InvalidArgument(violations ...FieldViolation) error {
+	badRequest := &errdetails.BadRequest{}
+	message := "invalid request"
+	for i, violation := range violations {
+		if i == 0 {
+			message = fmt.Sprintf("%v: %v", violation.Field, violation.Description)
+		}
+		badRequest.FieldViolations = append(badRequest.FieldViolations,
+			&errdetails.BadRequest_FieldViolation{Field: violation.Field, Description: violation.Description})
+	}
+	return withDetails(status.New(codes.InvalidArgument, message), badRequest)
+}
+
+// InvalidField reports that field of a request is invalid.
+func InvalidField(field string, description string) error {
+	return InvalidArgument(FieldViolation{Field: field, Description: description})
+}
+
+// ResourceExhausted reports that the caller ran out of quota, and may retry after retryDelay.
+func ResourceExhausted(message string, retryDelay time.Duration) error {
+	return withRetryInfo(status.New(codes.ResourceExhausted, message), retryDelay)
+}
+
+// Unavailable reports that a dependency of the api is unavailable, and that the call may be retried after retryDelay.
+func Unavailable(message string, retryDelay time.Duration) error {
+	return withRetryInfo(status.New(codes.Unavailable, message), retryDelay)
+}
+
+// Unauthenticated reports that the caller's credentials are missing or invalid.
+func Unauthenticated(message string) error {
+	return status.Error(codes.Unauthenticated, message)
+}
+
+// PermissionDenied reports that the caller is authenticated but isn't allowed to make the call.
+func PermissionDenied(message string) error {
+	return status.Error(codes.PermissionDenied, message)
+}
+
+// FromStorage maps an error of the storage layer met while working on the resource of resourceType identified by
+// name to the status the api returns for it. Errors carrying a status already are returned as they are, the ones the
+// client can't act on become Internal and are logged.
+func FromStorage(err error, resourceType string, name string) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var mysqlErr *mysql.MySQLError
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return NotFound(resourceType, name)
+	case errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry:
+		return AlreadyExists(resourceType, name, resourceMessage(resourceType, name, "already exists"))
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "deadline exceeded")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "call canceled")
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, mysql.ErrInvalidConn):
+		return Unavailable("database unavailable", storageRetryDelay)
+	}
+	return Internal(err)
+}
+
+// Internal reports an error the client can't act on. err is logged rather than returned, as it may tell about the
+// internals of the api.
+func Internal(err error) error {
+	logrus.Errorf("An error %v occurred while serving a call", err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+// RetryDelay returns the delay the RetryInfo of s asks clients to wait before retrying, false when s has none.
+func RetryDelay(s *status.Status) (time.Duration, bool) {
+	for _, detail := range s.Details() {
+		if retryInfo, ok := detail.(*errdetails.RetryInfo); ok && retryInfo.RetryDelay != nil {
+			return retryInfo.RetryDelay.AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+// resourceMessage says what happened to the resource, naming it when a name is known.
+func resourceMessage(resourceType string, name string, what string) string {
+	if name == "" {
+		return fmt.Sprintf("%v %v", resourceType, what)
+	}
+	return fmt.Sprintf("%v %v %v", resourceType, name, what)
+}
+
+func withRetryInfo(s *status.Status, retryDelay time.Duration) error {
+	return withDetails(s, &errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)})
+}
+
+// withDetails attaches details to s, falling back to s alone in the unlikely case they can't be marshalled.
+func withDetails(s *status.Status, details ...proto.Message) error {
+	detailed, err := s.WithDetails(details...)
+	if err != nil {
+		return s.Err()
+	}
+	return detailed.Err()
+}
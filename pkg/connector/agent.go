@@ -0,0 +1,304 @@
+package connector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Printer is a device driven by an Agent.
+type Printer interface {
+	Info() PrinterInfo
+	// Print prints the job's document, the returned error is reported as the reason the job failed.
+	Print(ctx context.Context, job *Job, document *os.File) error
+	Telemetry() Telemetry
+}
+
+type AgentOptions struct {
+	// TelemetryInterval is how often the condition of every printer is reported.
+	TelemetryInterval time.Duration
+	// MinBackoff and MaxBackoff bound the randomized, exponentially growing wait between reconnects. The wait starts
+	// over once a stream stayed up for longer than MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// SpoolDir holds documents while they are received and printed, the system temporary directory when empty.
+	SpoolDir string
+}
+
+// Agent keeps a stream to ditto open on behalf of a connector, registering its printers, printing the jobs it is
+// handed and reporting their outcome along with printer telemetry. Outcomes that can't be delivered because the
+// stream broke are kept and delivered once it is reopened.
+type Agent struct {
+	conn        *grpc.ClientConn
+	connectorId string
+	secret      string
+	printers    []Printer
+	logger      *logrus.Logger
+	options     AgentOptions
+
+	mu      sync.Mutex
+	current *agentSession
+	pending []*JobState
+}
+
+func NewAgent(conn *grpc.ClientConn, connectorId string, secret string, printers []Printer, logger *logrus.Logger, options AgentOptions) *Agent {
+	if options.MinBackoff <= 0 {
+		options.MinBackoff = time.Second
+	}
+	if options.MaxBackoff < options.MinBackoff {
+		options.MaxBackoff = options.MinBackoff
+	}
+	if options.TelemetryInterval <= 0 {
+		options.TelemetryInterval = time.Minute
+	}
+	return &Agent{
+		conn:        conn,
+		connectorId: connectorId,
+		secret:      secret,
+		printers:    printers,
+		logger:      logger,
+		options:     options,
+	}
+}
+
+// Run keeps the stream open, reconnecting with backoff whenever it breaks, until ctx is cancelled.
+func (a *Agent) Run(ctx context.Context) error {
+	backoff := a.options.MinBackoff
+	for {
+		started := time.Now()
+		err := a.session(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if time.Since(started) > a.options.MaxBackoff {
+			backoff = a.options.MinBackoff
+		}
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		a.logger.Warnf("connector stream ended: %v, reconnecting in %v", err, wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		if backoff *= 2; backoff > a.options.MaxBackoff {
+			backoff = a.options.MaxBackoff
+		}
+	}
+}
+
+// session runs one stream from registration until it breaks. Jobs being printed outlive the session, their outcome
+// is delivered on a later one.
+func (a *Agent) session(ctx context.Context) error {
+	printCtx := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := Connect(metadata.AppendToOutgoingContext(ctx, MetadataConnectorId, a.connectorId, MetadataConnectorSecret, a.secret), a.conn)
+	if err != nil {
+		return err
+	}
+	s := &agentSession{stream: stream, jobs: map[string]*incomingJob{}}
+	defer s.discard()
+	register := &Register{}
+	printers := make(map[string]Printer, len(a.printers))
+	for _, printer := range a.printers {
+		info := printer.Info()
+		register.Printers = append(register.Printers, info)
+		printers[info.SerialNumber] = printer
+	}
+	if err := s.send(&ConnectorMessage{Register: register}); err != nil {
+		return err
+	}
+	message, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if message.Registered == nil {
+		return errors.New("stream didn't start with a registration")
+	}
+	for _, rejected := range message.Registered.Rejected {
+		a.logger.Errorf("printer %v was rejected: %v", rejected.SerialNumber, rejected.Reason)
+	}
+	a.logger.Infof("connected, %d printers registered", len(message.Registered.Printers))
+
+	a.mu.Lock()
+	a.current = s
+	a.flushLocked()
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		if a.current == s {
+			a.current = nil
+		}
+		a.mu.Unlock()
+	}()
+
+	go a.reportTelemetry(ctx, s)
+	for {
+		message, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		switch {
+		case message.Job != nil:
+			if err := s.startJob(message.Job, a.options.SpoolDir); err != nil {
+				a.report(&JobState{JobId: message.Job.JobId, State: JobStateFailed, Error: err.Error()})
+			}
+		case message.JobData != nil:
+			if _, ok := s.jobs[message.JobData.JobId]; !ok {
+				// the rest of a job already reported failed
+				continue
+			}
+			job, err := s.receive(message.JobData)
+			if err != nil {
+				a.report(&JobState{JobId: message.JobData.JobId, State: JobStateFailed, Error: err.Error()})
+				continue
+			}
+			if job == nil {
+				continue
+			}
+			printer, ok := printers[job.job.SerialNumber]
+			if !ok {
+				job.close()
+				a.report(&JobState{JobId: job.job.JobId, State: JobStateFailed, Error: fmt.Sprintf("no printer with serial number %v", job.job.SerialNumber)})
+				continue
+			}
+			// the acknowledgement must go out on the stream that delivered the job, ditto queues the job again for
+			// another attempt when it doesn't arrive
+			if err := s.send(&ConnectorMessage{JobState: &JobState{JobId: job.job.JobId, State: JobStateProcessing}}); err != nil {
+				job.close()
+				return err
+			}
+			go a.print(printCtx, printer, job)
+		}
+	}
+}
+
+func (a *Agent) print(ctx context.Context, printer Printer, job *incomingJob) {
+	defer job.close()
+	if _, err := job.file.Seek(0, 0); err != nil {
+		a.report(&JobState{JobId: job.job.JobId, State: JobStateFailed, Error: err.Error()})
+		return
+	}
+	if err := printer.Print(ctx, job.job, job.file); err != nil {
+		a.report(&JobState{JobId: job.job.JobId, State: JobStateFailed, Error: err.Error()})
+		return
+	}
+	a.report(&JobState{JobId: job.job.JobId, State: JobStateCompleted})
+}
+
+// report delivers the state of a job, or keeps it for the next stream when none is open.
+func (a *Agent) report(state *JobState) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pending = append(a.pending, state)
+	a.flushLocked()
+}
+
+func (a *Agent) flushLocked() {
+	for a.current != nil && len(a.pending) > 0 {
+		if err := a.current.send(&ConnectorMessage{JobState: a.pending[0]}); err != nil {
+			return
+		}
+		a.pending = a.pending[1:]
+	}
+}
+
+func (a *Agent) reportTelemetry(ctx context.Context, s *agentSession) {
+	ticker := time.NewTicker(a.options.TelemetryInterval)
+	defer ticker.Stop()
+	for {
+		for _, printer := range a.printers {
+			telemetry := printer.Telemetry()
+			if err := s.send(&ConnectorMessage{Telemetry: &telemetry}); err != nil {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// agentSession is an open stream, sends are serialized as a stream doesn't allow concurrent ones.
+type agentSession struct {
+	stream ConnectClient
+	sendMu sync.Mutex
+	jobs   map[string]*incomingJob
+}
+
+func (s *agentSession) send(message *ConnectorMessage) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	return s.stream.Send(message)
+}
+
+// incomingJob is a job whose document is being spooled.
+type incomingJob struct {
+	job      *Job
+	file     *os.File
+	digest   hash.Hash
+	received int64
+}
+
+func (s *agentSession) startJob(job *Job, spoolDir string) error {
+	file, err := ioutil.TempFile(spoolDir, "ditto-job-*")
+	if err != nil {
+		return err
+	}
+	s.jobs[job.JobId] = &incomingJob{job: job, file: file, digest: sha256.New()}
+	return nil
+}
+
+// receive spools a chunk of a document, returning the job once its document is complete and intact. A job whose
+// document ditto failed to send is dropped.
+func (s *agentSession) receive(data *JobData) (*incomingJob, error) {
+	job := s.jobs[data.JobId]
+	if data.Error != "" {
+		delete(s.jobs, data.JobId)
+		job.close()
+		return nil, nil
+	}
+	if _, err := job.file.Write(data.Data); err != nil {
+		delete(s.jobs, data.JobId)
+		job.close()
+		return nil, err
+	}
+	job.digest.Write(data.Data)
+	job.received += int64(len(data.Data))
+	if !data.Last {
+		return nil, nil
+	}
+	delete(s.jobs, data.JobId)
+	if job.received != job.job.Size || hex.EncodeToString(job.digest.Sum(nil)) != job.job.Sha256 {
+		job.close()
+		return nil, errors.New("document was corrupted in transit")
+	}
+	return job, nil
+}
+
+// discard drops the documents of jobs the stream broke off.
+func (s *agentSession) discard() {
+	for jobId, job := range s.jobs {
+		job.close()
+		delete(s.jobs, jobId)
+	}
+}
+
+func (j *incomingJob) close() {
+	j.file.Close()
+	os.Remove(j.file.Name())
+}
@@ -0,0 +1,250 @@
+package connector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fakeDitto serves connector streams, handing every stream the jobs queued in jobs and passing on what the
+// connector sends.
+type fakeDitto struct {
+	jobs      []fakeJob
+	registers chan *Register
+	messages  chan *ConnectorMessage
+}
+
+// fakeJob is a job and its document, which is broken off with an error frame when aborted.
+type fakeJob struct {
+	job      Job
+	document []byte
+	aborted  bool
+}
+
+func newFakeJob(jobId string, serialNumber string, document string) fakeJob {
+	digest := sha256.Sum256([]byte(document))
+	return fakeJob{
+		job: Job{
+			JobId:        jobId,
+			SerialNumber: serialNumber,
+			Format:       "pdf",
+			Copies:       1,
+			Size:         int64(len(document)),
+			Sha256:       hex.EncodeToString(digest[:]),
+		},
+		document: []byte(document),
+	}
+}
+
+func (f *fakeDitto) Connect(stream ConnectServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	if ids := md.Get(MetadataConnectorId); len(ids) != 1 || ids[0] != "connector-1" {
+		return nil
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	f.registers <- first.Register
+	registered := &Registered{}
+	for _, info := range first.Register.Printers {
+		registered.Printers = append(registered.Printers, RegisteredPrinter{SerialNumber: info.SerialNumber, PrinterId: "printer-" + info.SerialNumber})
+	}
+	if err := stream.Send(&ServerMessage{Registered: registered}); err != nil {
+		return err
+	}
+	for _, job := range f.jobs {
+		job := job
+		if err := stream.Send(&ServerMessage{Job: &job.job}); err != nil {
+			return err
+		}
+		// the document goes out in two chunks to exercise spooling
+		half := len(job.document) / 2
+		if err := stream.Send(&ServerMessage{JobData: &JobData{JobId: job.job.JobId, Data: job.document[:half]}}); err != nil {
+			return err
+		}
+		last := &JobData{JobId: job.job.JobId, Data: job.document[half:], Last: true}
+		if job.aborted {
+			last = &JobData{JobId: job.job.JobId, Last: true, Error: "document unreadable"}
+		}
+		if err := stream.Send(&ServerMessage{JobData: last}); err != nil {
+			return err
+		}
+	}
+	for {
+		message, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		select {
+		case f.messages <- message:
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// startAgent runs an agent for printers against ditto, the returned function stops both.
+func startAgent(t *testing.T, ditto *fakeDitto, printers ...Printer) func() {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.ForceServerCodec(ServerCodec()))
+	RegisterConnectorServer(server, ditto)
+	go server.Serve(listener)
+	conn, err := grpc.Dial("bufnet", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+			return listener.Dial()
+		}))
+	if err != nil {
+		server.Stop()
+		t.Fatalf("Dial: %v", err)
+	}
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	agent := NewAgent(conn, "connector-1", "secret", printers, logger, AgentOptions{
+		TelemetryInterval: time.Hour,
+		MinBackoff:        10 * time.Millisecond,
+		MaxBackoff:        10 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		agent.Run(ctx)
+		close(stopped)
+	}()
+	return func() {
+		cancel()
+		<-stopped
+		conn.Close()
+		server.Stop()
+	}
+}
+
+// nextMessage waits for the next message of the connector that matches, skipping others.
+func nextMessage(t *testing.T, ditto *fakeDitto, matches func(message *ConnectorMessage) bool) *ConnectorMessage {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case message := <-ditto.messages:
+			if matches(message) {
+				return message
+			}
+		case <-timeout:
+			t.Fatal("the connector didn't send the expected message")
+		}
+	}
+}
+
+// jobStates collects the states the connector reports until count of them arrived, by job.
+func jobStates(t *testing.T, ditto *fakeDitto, count int) map[string][]string {
+	t.Helper()
+	states := map[string][]string{}
+	for i := 0; i < count; i++ {
+		state := nextMessage(t, ditto, func(message *ConnectorMessage) bool { return message.JobState != nil }).JobState
+		states[state.JobId] = append(states[state.JobId], state.State)
+	}
+	return states
+}
+
+func TestAgentPrintsJobs(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "ditto-connector-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outputDir)
+	printer := NewFakePrinter(PrinterInfo{SerialNumber: "SN1", ProductNumber: "P1"}, FakePrinterOptions{OutputDir: outputDir})
+	document := "%PDF-1.4 /Type /Pages /Type /Page /Type /Page"
+	corrupted := newFakeJob("job-corrupted", "SN1", "intact")
+	corrupted.document = []byte("altered")
+	aborted := newFakeJob("job-aborted", "SN1", "unreadable")
+	aborted.aborted = true
+	ditto := &fakeDitto{
+		jobs: []fakeJob{
+			aborted,
+			newFakeJob("job-1", "SN1", document),
+			newFakeJob("job-unknown-printer", "SN2", "text"),
+			corrupted,
+		},
+		registers: make(chan *Register, 1),
+		messages:  make(chan *ConnectorMessage),
+	}
+	stop := startAgent(t, ditto, printer)
+	defer stop()
+
+	select {
+	case register := <-ditto.registers:
+		if len(register.Printers) != 1 || register.Printers[0].SerialNumber != "SN1" || register.Printers[0].ProductNumber != "P1" {
+			t.Errorf("the connector registered %+v", register.Printers)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the connector didn't register")
+	}
+
+	states := jobStates(t, ditto, 4)
+	want := map[string]string{
+		"job-1":               JobStateProcessing + "," + JobStateCompleted,
+		"job-unknown-printer": JobStateFailed,
+		"job-corrupted":       JobStateFailed,
+		// ditto fails the jobs it aborts itself
+		"job-aborted": "",
+	}
+	for jobId, want := range want {
+		if got := strings.Join(states[jobId], ","); got != want {
+			t.Errorf("%v was reported %v, want %v", jobId, got, want)
+		}
+	}
+	printed, err := ioutil.ReadFile(filepath.Join(outputDir, "job-1"))
+	if err != nil || string(printed) != document {
+		t.Errorf("the printer printed %q, %v, want %q", printed, err, document)
+	}
+	if telemetry := printer.Telemetry(); telemetry.PagesPrinted != 2 || telemetry.State != "idle" {
+		t.Errorf("the printer reports %d pages printed in state %v, want 2 in idle", telemetry.PagesPrinted, telemetry.State)
+	}
+}
+
+func TestAgentReportsTelemetry(t *testing.T) {
+	printer := NewFakePrinter(PrinterInfo{SerialNumber: "SN1"}, FakePrinterOptions{})
+	ditto := &fakeDitto{registers: make(chan *Register, 1), messages: make(chan *ConnectorMessage)}
+	stop := startAgent(t, ditto, printer)
+	defer stop()
+
+	telemetry := nextMessage(t, ditto, func(message *ConnectorMessage) bool { return message.Telemetry != nil }).Telemetry
+	if telemetry.SerialNumber != "SN1" || telemetry.State != "idle" || telemetry.Supplies["black"] != 100 {
+		t.Errorf("the connector reported %+v", telemetry)
+	}
+}
+
+func TestServerCodec(t *testing.T) {
+	if encoding.GetCodec(codecName) != nil {
+		t.Error("the connector's json codec is registered for every service")
+	}
+	codec := ServerCodec()
+	encoded, err := codec.Marshal(&ServerMessage{JobData: &JobData{JobId: "job-1", Last: true}})
+	if err != nil || string(encoded) != `{"job_data":{"job_id":"job-1","last":true}}` {
+		t.Errorf("encoded a connector message as %s, %v, want json", encoded, err)
+	}
+	message := &ConnectorMessage{}
+	if err := codec.Unmarshal([]byte(`{"job_state":{"job_id":"job-1","state":"completed"}}`), message); err != nil || message.JobState.State != JobStateCompleted {
+		t.Errorf("decoded %+v, %v", message.JobState, err)
+	}
+	encoded, err = codec.Marshal(&wrapperspb.StringValue{Value: "printer-1"})
+	if err != nil || string(encoded) != "\n\tprinter-1" {
+		t.Errorf("encoded a protobuf message as %q, %v, want protobuf", encoded, err)
+	}
+}
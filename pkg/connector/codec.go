@@ -0,0 +1,63 @@
+package connector
+
+import (
+	"encoding/json"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/proto"
+)
+
+// codecName is the content subtype the connector service is spoken in, its messages are plain Go structs encoded
+// as JSON rather than generated protobuf types.
+const codecName = "json"
+
+// jsonCodec encodes connector messages. It isn't registered with grpc, which would make it the codec of every json
+// call in the process, clients force it on their streams and servers get it through ServerCodec.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return codecName
+}
+
+// ServerCodec is the codec of a server serving the connector service next to protobuf services, to be set with
+// grpc.ForceServerCodec. Connector messages are encoded as JSON, every other message by the protobuf codec.
+func ServerCodec() encoding.Codec {
+	return serverCodec{proto: encoding.GetCodec(proto.Name)}
+}
+
+type serverCodec struct {
+	proto encoding.Codec
+}
+
+func (s serverCodec) Marshal(v interface{}) ([]byte, error) {
+	if isConnectorMessage(v) {
+		return jsonCodec{}.Marshal(v)
+	}
+	return s.proto.Marshal(v)
+}
+
+func (s serverCodec) Unmarshal(data []byte, v interface{}) error {
+	if isConnectorMessage(v) {
+		return jsonCodec{}.Unmarshal(data, v)
+	}
+	return s.proto.Unmarshal(data, v)
+}
+
+func (s serverCodec) Name() string {
+	return s.proto.Name()
+}
+
+func isConnectorMessage(v interface{}) bool {
+	switch v.(type) {
+	case *ConnectorMessage, *ServerMessage:
+		return true
+	}
+	return false
+}
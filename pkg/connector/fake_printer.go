@@ -0,0 +1,116 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FakePrinterOptions shape the behaviour of a FakePrinter.
+type FakePrinterOptions struct {
+	// PageDuration is how long printing a page takes.
+	PageDuration time.Duration
+	// OutputDir receives a copy of every printed document when set.
+	OutputDir string
+	// FailureRate is the probability, between 0 and 1, of a job failing with a paper jam.
+	FailureRate float64
+}
+
+// FakePrinter stands in for a real device behind a connector. It prints one job at a time, taking PageDuration per
+// page and copy, and wears its toner down as it goes.
+type FakePrinter struct {
+	info    PrinterInfo
+	options FakePrinterOptions
+
+	printMu sync.Mutex
+	mu      sync.Mutex
+	state   string
+	pages   int64
+	toner   int
+	alerts  []string
+}
+
+func NewFakePrinter(info PrinterInfo, options FakePrinterOptions) *FakePrinter {
+	return &FakePrinter{info: info, options: options, state: "idle", toner: 100}
+}
+
+func (f *FakePrinter) Info() PrinterInfo {
+	return f.info
+}
+
+func (f *FakePrinter) Print(ctx context.Context, job *Job, document *os.File) error {
+	f.printMu.Lock()
+	defer f.printMu.Unlock()
+	content, err := ioutil.ReadAll(document)
+	if err != nil {
+		return err
+	}
+	if f.options.OutputDir != "" {
+		if err := ioutil.WriteFile(filepath.Join(f.options.OutputDir, job.JobId), content, 0600); err != nil {
+			return err
+		}
+	}
+	copies := job.Copies
+	if copies < 1 {
+		copies = 1
+	}
+	pages := countPages(content) * int64(copies)
+	f.setState("printing", nil)
+	select {
+	case <-ctx.Done():
+		f.setState("idle", nil)
+		return ctx.Err()
+	case <-time.After(time.Duration(pages) * f.options.PageDuration):
+	}
+	if rand.Float64() < f.options.FailureRate {
+		f.setState("stopped", []string{"paper jam"})
+		return errors.New("paper jam")
+	}
+	f.mu.Lock()
+	f.pages += pages
+	if f.toner = 100 - int(f.pages/50); f.toner < 0 {
+		f.toner = 0
+	}
+	f.mu.Unlock()
+	f.setState("idle", nil)
+	return nil
+}
+
+func (f *FakePrinter) setState(state string, alerts []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.state = state
+	f.alerts = alerts
+}
+
+func (f *FakePrinter) Telemetry() Telemetry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	alerts := append([]string(nil), f.alerts...)
+	if f.toner < 10 {
+		alerts = append(alerts, fmt.Sprintf("toner low (%d%%)", f.toner))
+	}
+	return Telemetry{
+		SerialNumber: f.info.SerialNumber,
+		State:        f.state,
+		PagesPrinted: f.pages,
+		Supplies:     map[string]int{"black": f.toner},
+		Alerts:       alerts,
+	}
+}
+
+// countPages counts the pages of a PDF document, anything else is taken to be a single page.
+func countPages(content []byte) int64 {
+	pages := bytes.Count(content, []byte("/Type /Page")) - bytes.Count(content, []byte("/Type /Pages"))
+	if pages < 1 {
+		return 1
+	}
+	return int64(pages)
+}
@@ -0,0 +1,96 @@
+package connector
+
+// Metadata keys carrying the credentials a connector opens its stream with.
+const (
+	MetadataConnectorId     = "x-connector-id"
+	MetadataConnectorSecret = "x-connector-secret"
+)
+
+// ConnectorMessage is sent by a connector, exactly one field is set. The first message of a stream must be a
+// Register, later ones may register again when the connector's printers change.
+type ConnectorMessage struct {
+	Register  *Register  `json:"register,omitempty"`
+	JobState  *JobState  `json:"job_state,omitempty"`
+	Telemetry *Telemetry `json:"telemetry,omitempty"`
+}
+
+// ServerMessage is sent by ditto, exactly one field is set. A Job is followed by the JobData chunks of its document,
+// the last one flagged.
+type ServerMessage struct {
+	Registered *Registered `json:"registered,omitempty"`
+	Job        *Job        `json:"job,omitempty"`
+	JobData    *JobData    `json:"job_data,omitempty"`
+}
+
+// Register lists the printers a connector fronts, they are created for the connector's owner when unknown.
+type Register struct {
+	Printers []PrinterInfo `json:"printers"`
+}
+
+type PrinterInfo struct {
+	SerialNumber  string `json:"serial_number"`
+	ProductNumber string `json:"product_number,omitempty"`
+	Name          string `json:"name,omitempty"`
+}
+
+// Registered answers a Register with the ids of the accepted printers and the reasons others were rejected.
+type Registered struct {
+	Printers []RegisteredPrinter `json:"printers"`
+	Rejected []RejectedPrinter   `json:"rejected,omitempty"`
+}
+
+type RegisteredPrinter struct {
+	SerialNumber string `json:"serial_number"`
+	PrinterId    string `json:"printer_id"`
+}
+
+type RejectedPrinter struct {
+	SerialNumber string `json:"serial_number"`
+	Reason       string `json:"reason"`
+}
+
+// Job hands a job to the connector for the printer with the given serial number.
+type Job struct {
+	JobId        string `json:"job_id"`
+	PrinterId    string `json:"printer_id"`
+	SerialNumber string `json:"serial_number"`
+	DocumentName string `json:"document_name"`
+	Format       string `json:"format"`
+	Copies       int    `json:"copies"`
+	Size         int64  `json:"size"`
+	Sha256       string `json:"sha256"`
+}
+
+// JobData is a chunk of the document of a job. Error is set, on the last chunk, when ditto failed to read the rest
+// of the document, the connector then drops the job, which ditto has failed already.
+type JobData struct {
+	JobId string `json:"job_id"`
+	Data  []byte `json:"data,omitempty"`
+	Last  bool   `json:"last,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Job states a connector reports. A job is acknowledged with processing once its document was received in full,
+// jobs not acknowledged when a stream ends are queued again.
+const (
+	JobStateProcessing = "processing"
+	JobStateCompleted  = "completed"
+	JobStateFailed     = "failed"
+	JobStateCanceled   = "canceled"
+)
+
+// JobState reports the progress of a job, Error explains a failed job.
+type JobState struct {
+	JobId string `json:"job_id"`
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// Telemetry reports the condition of a printer, Supplies maps supply names to their remaining level in percent.
+type Telemetry struct {
+	SerialNumber string         `json:"serial_number"`
+	State        string         `json:"state"`
+	PagesPrinted int64          `json:"pages_printed"`
+	Supplies     map[string]int `json:"supplies,omitempty"`
+	Alerts       []string       `json:"alerts,omitempty"`
+}
@@ -0,0 +1,93 @@
+package connector
+
+import (
+	"context"
+	"google.golang.org/grpc"
+)
+
+// ServiceName is the fully qualified name of the connector service, Connect being its only method.
+const ServiceName = "ditto_v1.ConnectorService"
+
+// ConnectorServer is implemented by ditto to serve connector streams.
+type ConnectorServer interface {
+	Connect(stream ConnectServer) error
+}
+
+// ConnectServer is the server side of a connector stream.
+type ConnectServer interface {
+	Send(message *ServerMessage) error
+	Recv() (*ConnectorMessage, error)
+	grpc.ServerStream
+}
+
+// ConnectClient is the connector side of a connector stream.
+type ConnectClient interface {
+	Send(message *ConnectorMessage) error
+	Recv() (*ServerMessage, error)
+	grpc.ClientStream
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*ConnectorServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Connect",
+			Handler:       connectHandler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+// RegisterConnectorServer registers the connector service, server must be created with the grpc.ForceServerCodec
+// option of ServerCodec.
+func RegisterConnectorServer(server *grpc.Server, connectorServer ConnectorServer) {
+	server.RegisterService(&serviceDesc, connectorServer)
+}
+
+func connectHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ConnectorServer).Connect(&connectServer{stream})
+}
+
+type connectServer struct {
+	grpc.ServerStream
+}
+
+func (c *connectServer) Send(message *ServerMessage) error {
+	return c.ServerStream.SendMsg(message)
+}
+
+func (c *connectServer) Recv() (*ConnectorMessage, error) {
+	message := &ConnectorMessage{}
+	if err := c.ServerStream.RecvMsg(message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// Connect opens a connector stream on conn, ctx should carry the connector's credentials as outgoing metadata.
+func Connect(ctx context.Context, conn *grpc.ClientConn, opts ...grpc.CallOption) (ConnectClient, error) {
+	opts = append(opts, grpc.ForceCodec(jsonCodec{}))
+	stream, err := conn.NewStream(ctx, &serviceDesc.Streams[0], "/"+ServiceName+"/Connect", opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &connectClient{stream}, nil
+}
+
+type connectClient struct {
+	grpc.ClientStream
+}
+
+func (c *connectClient) Send(message *ConnectorMessage) error {
+	return c.ClientStream.SendMsg(message)
+}
+
+func (c *connectClient) Recv() (*ServerMessage, error) {
+	message := &ServerMessage{}
+	if err := c.ClientStream.RecvMsg(message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
@@ -0,0 +1,140 @@
+package conversion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	FormatPdf       = "application/pdf"
+	FormatText      = "text/plain"
+	FormatJpeg      = "image/jpeg"
+	FormatPng       = "image/png"
+	FormatPwgRaster = "image/pwg-raster"
+	FormatUrf       = "image/urf"
+)
+
+// Converter turns documents of one format into another.
+type Converter interface {
+	From() string
+	To() string
+	Convert(ctx context.Context, in io.Reader, out io.Writer) error
+}
+
+// Registry holds the converters a Pipeline can be planned from.
+type Registry struct {
+	converters []Converter
+}
+
+func NewRegistry(converters ...Converter) *Registry {
+	return &Registry{converters: converters}
+}
+
+func (r *Registry) Register(converter Converter) {
+	r.converters = append(r.converters, converter)
+}
+
+// Plan finds the shortest chain of converters from source to one of the accepted formats, accepted formats are
+// tried in order so the printer's preferred format wins between chains of the same length. An empty pipeline means
+// the document can be sent as is.
+func (r *Registry) Plan(source string, accepted []string) (*Pipeline, error) {
+	for _, format := range accepted {
+		if format == source {
+			return &Pipeline{Source: source, Target: source}, nil
+		}
+	}
+	// breadth first search over formats, via records the converter that first reached each format
+	via := map[string]Converter{source: nil}
+	frontier := []string{source}
+	for len(frontier) > 0 {
+		var next []string
+		for _, format := range frontier {
+			for _, converter := range r.converters {
+				if converter.From() != format {
+					continue
+				}
+				if _, seen := via[converter.To()]; seen {
+					continue
+				}
+				via[converter.To()] = converter
+				next = append(next, converter.To())
+			}
+		}
+		for _, format := range accepted {
+			if _, reached := via[format]; reached {
+				pipeline := &Pipeline{Source: source, Target: format}
+				for current := format; current != source; current = via[current].From() {
+					pipeline.Steps = append([]Converter{via[current]}, pipeline.Steps...)
+				}
+				return pipeline, nil
+			}
+		}
+		frontier = next
+	}
+	return nil, fmt.Errorf("no conversion from %v to any of %v", source, accepted)
+}
+
+// Pipeline is a planned chain of conversions.
+type Pipeline struct {
+	Source string
+	Target string
+	Steps  []Converter
+}
+
+// Run converts in through every step, each step streams into the next one through a pipe. A step failing fails the
+// steps after it too, through their input, so the error of the earliest failed step is the one returned.
+func (p *Pipeline) Run(ctx context.Context, in io.Reader, out io.Writer) error {
+	if len(p.Steps) == 0 {
+		_, err := io.Copy(out, in)
+		return err
+	}
+	errs := make([]error, len(p.Steps))
+	var wg sync.WaitGroup
+	for i, step := range p.Steps[:len(p.Steps)-1] {
+		reader, writer := io.Pipe()
+		wg.Add(1)
+		go func(i int, step Converter, in io.Reader) {
+			defer wg.Done()
+			errs[i] = step.Convert(ctx, in, writer)
+			writer.CloseWithError(errs[i])
+		}(i, step, in)
+		in = reader
+	}
+	last := len(p.Steps) - 1
+	errs[last] = p.Steps[last].Convert(ctx, in, out)
+	if closer, ok := in.(io.Closer); ok {
+		// unblocks earlier steps when the last one gave up before draining its input
+		closer.Close()
+	}
+	wg.Wait()
+	failed := -1
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		// a step failing to write to the step after it only fails because the latter gave up
+		if failed < 0 || (errors.Is(errs[failed], io.ErrClosedPipe) && !errors.Is(err, io.ErrClosedPipe)) {
+			failed = i
+		}
+	}
+	if failed < 0 {
+		return nil
+	}
+	return fmt.Errorf("%v to %v: %v", p.Steps[failed].From(), p.Steps[failed].To(), errs[failed])
+}
+
+// NewDefaultRegistry registers the built in converters, the raster ones only when ghostscript is installed.
+func NewDefaultRegistry(ghostscript string, rasterResolution int) *Registry {
+	registry := NewRegistry(
+		ImageToPdf{Format: FormatJpeg},
+		ImageToPdf{Format: FormatPng},
+		TextToPdf{},
+	)
+	for _, converter := range NewPdfToRaster(ghostscript, rasterResolution) {
+		registry.Register(converter)
+	}
+	return registry
+}
@@ -0,0 +1,151 @@
+package conversion
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// tagConverter converts by appending its target format to the document, or fails with err without reading it.
+type tagConverter struct {
+	from string
+	to   string
+	err  error
+}
+
+func (t tagConverter) From() string {
+	return t.from
+}
+
+func (t tagConverter) To() string {
+	return t.to
+}
+
+func (t tagConverter) Convert(ctx context.Context, in io.Reader, out io.Writer) error {
+	if t.err != nil {
+		return t.err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, ">"+t.to)
+	return err
+}
+
+func steps(pipeline *Pipeline) []string {
+	var formats []string
+	for _, step := range pipeline.Steps {
+		formats = append(formats, step.From()+">"+step.To())
+	}
+	return formats
+}
+
+func TestRegistryPlan(t *testing.T) {
+	registry := NewRegistry(
+		tagConverter{from: "text", to: "pdf"},
+		tagConverter{from: "jpeg", to: "pdf"},
+		tagConverter{from: "pdf", to: "pwg"},
+		tagConverter{from: "pdf", to: "urf"},
+		tagConverter{from: "pwg", to: "ps"},
+		tagConverter{from: "text", to: "ps"},
+	)
+	tests := []struct {
+		name     string
+		source   string
+		accepted []string
+		target   string
+		steps    []string
+		err      bool
+	}{
+		{name: "accepted as is", source: "pdf", accepted: []string{"pwg", "pdf"}, target: "pdf"},
+		{name: "single step", source: "jpeg", accepted: []string{"pdf"}, target: "pdf", steps: []string{"jpeg>pdf"}},
+		{name: "two steps", source: "jpeg", accepted: []string{"urf"}, target: "urf", steps: []string{"jpeg>pdf", "pdf>urf"}},
+		{name: "preferred format wins at equal length", source: "jpeg", accepted: []string{"urf", "pwg"}, target: "urf",
+			steps: []string{"jpeg>pdf", "pdf>urf"}},
+		{name: "shorter chain wins over preference", source: "jpeg", accepted: []string{"urf", "pdf"}, target: "pdf",
+			steps: []string{"jpeg>pdf"}},
+		{name: "shortest chain", source: "text", accepted: []string{"ps"}, target: "ps", steps: []string{"text>ps"}},
+		{name: "unreachable", source: "png", accepted: []string{"pdf"}, err: true},
+		{name: "nothing accepted", source: "text", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pipeline, err := registry.Plan(test.source, test.accepted)
+			if test.err {
+				if err == nil {
+					t.Fatalf("Plan planned %v, want an error", steps(pipeline))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Plan: %v", err)
+			}
+			if pipeline.Source != test.source || pipeline.Target != test.target {
+				t.Errorf("planned %v to %v, want %v to %v", pipeline.Source, pipeline.Target, test.source, test.target)
+			}
+			if got := strings.Join(steps(pipeline), ","); got != strings.Join(test.steps, ",") {
+				t.Errorf("planned steps %v, want %v", got, strings.Join(test.steps, ","))
+			}
+		})
+	}
+}
+
+func TestPipelineRun(t *testing.T) {
+	failure := errors.New("broken")
+	tests := []struct {
+		name   string
+		steps  []Converter
+		output string
+		err    string
+	}{
+		{name: "no steps", output: "doc"},
+		{name: "one step", steps: []Converter{tagConverter{from: "a", to: "b"}}, output: "doc>b"},
+		{name: "steps run in order",
+			steps:  []Converter{tagConverter{from: "a", to: "b"}, tagConverter{from: "b", to: "c"}, tagConverter{from: "c", to: "d"}},
+			output: "doc>b>c>d"},
+		{name: "first step fails",
+			steps: []Converter{tagConverter{from: "a", to: "b", err: failure}, tagConverter{from: "b", to: "c"}},
+			err:   "a to b: broken"},
+		{name: "last step fails without reading its input",
+			steps: []Converter{tagConverter{from: "a", to: "b"}, tagConverter{from: "b", to: "c", err: failure}},
+			err:   "b to c: broken"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pipeline := &Pipeline{Steps: test.steps}
+			out := &bytes.Buffer{}
+			err := pipeline.Run(context.Background(), strings.NewReader("doc"), out)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("Run returned %v, want %v", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if out.String() != test.output {
+				t.Errorf("Run wrote %q, want %q", out.String(), test.output)
+			}
+		})
+	}
+}
+
+func TestTextToPdf(t *testing.T) {
+	pipeline, err := NewDefaultRegistry("", 300).Plan(FormatText, []string{FormatPdf})
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	out := &bytes.Buffer{}
+	if err := pipeline.Run(context.Background(), strings.NewReader("hello\nworld"), out); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	document, _ := ioutil.ReadAll(out)
+	if !bytes.HasPrefix(document, []byte("%PDF-")) {
+		t.Errorf("converted document isn't a pdf: %q", document)
+	}
+}
@@ -0,0 +1,60 @@
+package conversion
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// ghostscriptDevices are the raster output devices used for each target format, both need ghostscript 9.53 or later.
+var ghostscriptDevices = map[string]string{
+	FormatPwgRaster: "pwgraster",
+	FormatUrf:       "appleraster",
+}
+
+// PdfToRaster renders PDFs into the raster formats of IPP Everywhere (PWG raster) and AirPrint (URF) by running
+// ghostscript.
+type PdfToRaster struct {
+	Format     string
+	Command    string
+	Resolution int
+}
+
+// NewPdfToRaster returns the raster converters for every format ghostscript can produce, none when command can't be
+// found.
+func NewPdfToRaster(command string, resolution int) []Converter {
+	if _, err := exec.LookPath(command); err != nil {
+		return nil
+	}
+	return []Converter{
+		PdfToRaster{Format: FormatPwgRaster, Command: command, Resolution: resolution},
+		PdfToRaster{Format: FormatUrf, Command: command, Resolution: resolution},
+	}
+}
+
+func (p PdfToRaster) From() string {
+	return FormatPdf
+}
+
+func (p PdfToRaster) To() string {
+	return p.Format
+}
+
+func (p PdfToRaster) Convert(ctx context.Context, in io.Reader, out io.Writer) error {
+	cmd := exec.CommandContext(ctx, p.Command, "-q", "-dSAFER", "-dBATCH", "-dNOPAUSE",
+		"-sDEVICE="+ghostscriptDevices[p.Format], fmt.Sprintf("-r%d", p.Resolution), "-sOutputFile=-", "-")
+	var stderr bytes.Buffer
+	cmd.Stdin = in
+	cmd.Stdout = out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("%v: %v", err, message)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package conversion
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+)
+
+// ImageToPdf places an image on a single A4 page, scaled down to fit within the margins. JPEGs are embedded as they
+// are, other images are stored as deflated RGB.
+type ImageToPdf struct {
+	Format string
+}
+
+func (i ImageToPdf) From() string {
+	return i.Format
+}
+
+func (i ImageToPdf) To() string {
+	return FormatPdf
+}
+
+func (i ImageToPdf) Convert(ctx context.Context, in io.Reader, out io.Writer) error {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("unreadable image: %v", err)
+	}
+	var dictionary string
+	var stream []byte
+	if colorSpace, ok := jpegColorSpaces[config.ColorModel]; ok && i.Format == FormatJpeg {
+		dictionary = fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %v /BitsPerComponent 8 /Filter /DCTDecode",
+			config.Width, config.Height, colorSpace)
+		stream = data
+	} else {
+		decoded, err := decodeImage(i.Format, data)
+		if err != nil {
+			return fmt.Errorf("unreadable image: %v", err)
+		}
+		if stream, err = deflateRgb(ctx, decoded); err != nil {
+			return err
+		}
+		dictionary = fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode",
+			config.Width, config.Height)
+	}
+
+	width, height := float64(config.Width), float64(config.Height)
+	scale := 1.0
+	if fit := (pageWidth - 2*pageMargin) / width; fit < scale {
+		scale = fit
+	}
+	if fit := (pageHeight - 2*pageMargin) / height; fit < scale {
+		scale = fit
+	}
+	width, height = width*scale, height*scale
+	x, y := (pageWidth-width)/2, (pageHeight-height)/2
+
+	writer := &pdfWriter{}
+	imageId := writer.addStream(dictionary, stream)
+	writer.addPage(fmt.Sprintf("<< /XObject << /Im0 %d 0 R >> >>", imageId),
+		[]byte(fmt.Sprintf("q %.2f 0 0 %.2f %.2f %.2f cm /Im0 Do Q", width, height, x, y)))
+	return writer.Close(out)
+}
+
+// jpegColorSpaces are the JPEG color models PDF readers decode natively, CMYK JPEGs are re-encoded as their
+// inversion convention varies between writers.
+var jpegColorSpaces = map[color.Model]string{
+	color.GrayModel:  "/DeviceGray",
+	color.YCbCrModel: "/DeviceRGB",
+}
+
+func decodeImage(format string, data []byte) (image.Image, error) {
+	if format == FormatPng {
+		return png.Decode(bytes.NewReader(data))
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	return decoded, err
+}
+
+func deflateRgb(ctx context.Context, decoded image.Image) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := zlib.NewWriter(&buffer)
+	bounds := decoded.Bounds()
+	row := make([]byte, 0, bounds.Dx()*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		row = row[:0]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := decoded.At(x, y).RGBA()
+			row = append(row, byte(r>>8), byte(g>>8), byte(b>>8))
+		}
+		if _, err := writer.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,89 @@
+package conversion
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// A4 in points, the page size of every generated document.
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+	pageMargin = 36.0
+)
+
+// pdfWriter assembles a minimal PDF 1.4 file, objects are numbered in the order they are added and written out
+// with their cross-reference table by Close.
+type pdfWriter struct {
+	objects [][]byte
+	pages   []int
+}
+
+// reserve allocates an object number whose body is set later.
+func (p *pdfWriter) reserve() int {
+	p.objects = append(p.objects, nil)
+	return len(p.objects)
+}
+
+func (p *pdfWriter) set(id int, body string) {
+	p.objects[id-1] = []byte(body)
+}
+
+func (p *pdfWriter) add(body string) int {
+	id := p.reserve()
+	p.set(id, body)
+	return id
+}
+
+func (p *pdfWriter) addStream(dictionary string, data []byte) int {
+	id := p.reserve()
+	var body bytes.Buffer
+	if dictionary != "" {
+		dictionary += " "
+	}
+	fmt.Fprintf(&body, "<< %v/Length %d >>\nstream\n", dictionary, len(data))
+	body.Write(data)
+	body.WriteString("\nendstream")
+	p.objects[id-1] = body.Bytes()
+	return id
+}
+
+// addPage adds a page drawing content with the given resources dictionary, the parent is filled in by Close.
+func (p *pdfWriter) addPage(resources string, content []byte) {
+	contentId := p.addStream("", content)
+	p.pages = append(p.pages, p.add(fmt.Sprintf("<< /Type /Page /Parent %%PAGES%% /MediaBox [0 0 %.0f %.0f] /Resources %v /Contents %d 0 R >>",
+		pageWidth, pageHeight, resources, contentId)))
+}
+
+func (p *pdfWriter) Close(w io.Writer) error {
+	if len(p.pages) == 0 {
+		return fmt.Errorf("document has no pages")
+	}
+	pagesId := p.reserve()
+	kids := ""
+	for _, page := range p.pages {
+		kids += fmt.Sprintf("%d 0 R ", page)
+		p.objects[page-1] = bytes.Replace(p.objects[page-1], []byte("%PAGES%"), []byte(fmt.Sprintf("%d 0 R", pagesId)), 1)
+	}
+	p.set(pagesId, fmt.Sprintf("<< /Type /Pages /Kids [%v] /Count %d >>", kids, len(p.pages)))
+	catalogId := p.add(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesId))
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(p.objects))
+	for i, object := range p.objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n", i+1)
+		out.Write(object)
+		out.WriteString("\nendobj\n")
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(p.objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(p.objects)+1, catalogId, xref)
+	_, err := out.WriteTo(w)
+	return err
+}
@@ -0,0 +1,62 @@
+package conversion
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrPoolFull is returned by Submit when every worker is busy and the queue is full.
+var ErrPoolFull = errors.New("conversion queue is full")
+
+// Pool runs conversions on a fixed number of workers, tasks wait in a bounded queue.
+type Pool struct {
+	workers int
+	tasks   chan func(ctx context.Context)
+	wg      sync.WaitGroup
+}
+
+func NewPool(workers int, queueSize int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Pool{workers: workers, tasks: make(chan func(ctx context.Context), queueSize)}
+}
+
+// Submit queues task without blocking.
+func (p *Pool) Submit(task func(ctx context.Context)) error {
+	select {
+	case p.tasks <- task:
+		return nil
+	default:
+		return ErrPoolFull
+	}
+}
+
+// Run starts the workers and blocks until ctx is done and the running tasks have returned. Tasks still queued at that
+// point are handed the done ctx, so that they can record that they didn't run.
+func (p *Pool) Run(ctx context.Context) {
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case task := <-p.tasks:
+					task(ctx)
+				}
+			}
+		}()
+	}
+	p.wg.Wait()
+	for {
+		select {
+		case task := <-p.tasks:
+			task(ctx)
+		default:
+			return
+		}
+	}
+}
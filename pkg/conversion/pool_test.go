@@ -0,0 +1,69 @@
+package conversion
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPoolRunsTasks(t *testing.T) {
+	pool := NewPool(2, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		pool.Run(ctx)
+		close(stopped)
+	}()
+
+	done := make(chan int, 4)
+	for i := 0; i < 4; i++ {
+		i := i
+		if err := pool.Submit(func(ctx context.Context) { done <- i }); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("task didn't run")
+		}
+	}
+	cancel()
+	<-stopped
+}
+
+func TestPoolFullQueue(t *testing.T) {
+	pool := NewPool(1, 1)
+	if err := pool.Submit(func(ctx context.Context) {}); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if err := pool.Submit(func(ctx context.Context) {}); err != ErrPoolFull {
+		t.Fatalf("Submit to a full queue returned %v, want %v", err, ErrPoolFull)
+	}
+}
+
+func TestPoolHandsQueuedTasksTheDoneContext(t *testing.T) {
+	pool := NewPool(1, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		if err := pool.Submit(func(ctx context.Context) { errs <- ctx.Err() }); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+	pool.Run(ctx)
+	close(errs)
+	count := 0
+	for err := range errs {
+		count++
+		if err != context.Canceled {
+			t.Errorf("queued task was handed a context with error %v, want %v", err, context.Canceled)
+		}
+	}
+	if count != 2 {
+		t.Errorf("%d of 2 queued tasks were handed the context", count)
+	}
+}
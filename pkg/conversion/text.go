@@ -0,0 +1,107 @@
+package conversion
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	textFontSize     = 10.0
+	textLineHeight   = 12.0
+	textColumns      = 90
+	textLinesPerPage = 64 // (pageHeight - 2*pageMargin) / textLineHeight
+	textTabWidth     = 8
+)
+
+// TextToPdf typesets plain UTF-8 text in Courier, wrapping long lines. Characters outside Latin-1 are printed as '?'
+// since only the standard fonts are available.
+type TextToPdf struct{}
+
+func (t TextToPdf) From() string {
+	return FormatText
+}
+
+func (t TextToPdf) To() string {
+	return FormatPdf
+}
+
+func (t TextToPdf) Convert(ctx context.Context, in io.Reader, out io.Writer) error {
+	writer := &pdfWriter{}
+	fontId := writer.add("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	resources := fmt.Sprintf("<< /Font << /F0 %d 0 R >> >>", fontId)
+
+	var page bytes.Buffer
+	lines := 0
+	flush := func() {
+		page.WriteString("ET")
+		writer.addPage(resources, page.Bytes())
+		page.Reset()
+		lines = 0
+	}
+	writeLine := func(line string) {
+		if lines == 0 {
+			fmt.Fprintf(&page, "BT /F0 %.0f Tf %.0f TL %.0f %.0f Td\n", textFontSize, textLineHeight, pageMargin, pageHeight-pageMargin-textFontSize)
+		}
+		fmt.Fprintf(&page, "(%v) '\n", escapeText(line))
+		lines++
+		if lines == textLinesPerPage {
+			flush()
+		}
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line := []rune(strings.Replace(strings.TrimRight(scanner.Text(), "\r"), "\t", strings.Repeat(" ", textTabWidth), -1))
+		// a form feed starts a new page
+		if len(line) == 1 && line[0] == '\f' {
+			if lines > 0 {
+				flush()
+			}
+			continue
+		}
+		for len(line) > textColumns {
+			writeLine(string(line[:textColumns]))
+			line = line[textColumns:]
+		}
+		writeLine(string(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if lines > 0 || len(writer.pages) == 0 {
+		if lines == 0 {
+			writeLine("")
+		}
+		flush()
+	}
+	return writer.Close(out)
+}
+
+// escapeText renders a line as the body of a PDF literal string in WinAnsi encoding.
+func escapeText(line string) string {
+	var escaped strings.Builder
+	for _, r := range line {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			escaped.WriteByte('\\')
+			escaped.WriteRune(r)
+		case r < 0x20:
+			escaped.WriteByte(' ')
+		case r < 0x80:
+			escaped.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&escaped, "\\%03o", r)
+		default:
+			escaped.WriteByte('?')
+		}
+	}
+	return escaped.String()
+}
@@ -0,0 +1,46 @@
+package domain
+
+import "time"
+
+// Connector is an on-premise agent fronting printers ditto can't reach. It authenticates its stream with a secret of
+// which only the SHA-256 digest is kept, the printers it registers belong to its owner.
+type Connector struct {
+	Id              uint64 `gorm:"primaryKey"`
+	ConnectorId     string `gorm:"type:varchar(100);uniqueIndex"`
+	UserId          string `gorm:"type:varchar(100);index"`
+	Name            string
+	SecretDigest    string `gorm:"type:varchar(64)"`
+	CreatedAt       *time.Time
+	LastConnectedAt *time.Time
+	TenantId        string `gorm:"type:varchar(100);index"`
+}
+
+// ConnectorPrinter places a printer behind a connector along with the telemetry it last reported.
+type ConnectorPrinter struct {
+	Id          uint64 `gorm:"primaryKey"`
+	ConnectorId string `gorm:"type:varchar(100);index"`
+	PrinterId   string `gorm:"type:varchar(100);uniqueIndex"`
+	State       string
+	Telemetry   string `gorm:"type:text"`
+	ReportedAt  *time.Time
+}
+
+type ConnectorDto struct {
+	ConnectorId     string     `json:"connector_id"`
+	UserId          string     `json:"user_id"`
+	Name            string     `json:"name"`
+	Secret          string     `json:"secret,omitempty"`
+	CreatedAt       *time.Time `json:"created_at,omitempty"`
+	LastConnectedAt *time.Time `json:"last_connected_at,omitempty"`
+	PrinterIds      []string   `json:"printer_ids,omitempty"`
+}
+
+func (c *Connector) ToDto() ConnectorDto {
+	return ConnectorDto{
+		ConnectorId:     c.ConnectorId,
+		UserId:          c.UserId,
+		Name:            c.Name,
+		CreatedAt:       c.CreatedAt,
+		LastConnectedAt: c.LastConnectedAt,
+	}
+}
@@ -0,0 +1,92 @@
+package domain
+
+import "time"
+
+type EnrollmentState int
+
+const (
+	EnrollmentStateUnknown EnrollmentState = iota
+	// EnrollmentStatePending enrollments wait for a user to enter their claim code
+	EnrollmentStatePending
+	// EnrollmentStateClaimed enrollments were bound to a printer, their certificate waits for the device to fetch it
+	EnrollmentStateClaimed
+)
+
+var enrollmentStateNames = map[EnrollmentState]string{
+	EnrollmentStatePending: "pending",
+	EnrollmentStateClaimed: "claimed",
+}
+
+func (e EnrollmentState) String() string {
+	return enrollmentStateNames[e]
+}
+
+// DeviceEnrollment is a device's request to be bound to an account. The device polls it with a token of which only
+// the SHA-256 digest is kept, the user claims it with the short claim code the device displays.
+type DeviceEnrollment struct {
+	Id              uint64 `gorm:"primaryKey"`
+	EnrollmentId    string `gorm:"type:varchar(100);uniqueIndex"`
+	ClaimCode       string `gorm:"type:varchar(16);index"`
+	PollTokenDigest string `gorm:"type:varchar(64)"`
+	SerialNumber    string
+	ProductNumber   string
+	Name            string
+	Csr             string `gorm:"type:text"`
+	State           int
+	UserId          string `gorm:"type:varchar(100)"`
+	PrinterId       string `gorm:"type:varchar(100)"`
+	Certificate     string `gorm:"type:text"`
+	CreatedAt       *time.Time
+	ExpiresAt       time.Time `gorm:"index"`
+	TenantId        string    `gorm:"type:varchar(100);index"`
+}
+
+type DeviceEnrollmentDto struct {
+	EnrollmentId  string    `json:"enrollment_id"`
+	ClaimCode     string    `json:"claim_code,omitempty"`
+	PollToken     string    `json:"poll_token,omitempty"`
+	State         string    `json:"state"`
+	PrinterId     string    `json:"printer_id,omitempty"`
+	Certificate   string    `json:"certificate,omitempty"`
+	CaCertificate string    `json:"ca_certificate,omitempty"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+func (d *DeviceEnrollment) ToDto() DeviceEnrollmentDto {
+	return DeviceEnrollmentDto{
+		EnrollmentId: d.EnrollmentId,
+		State:        EnrollmentState(d.State).String(),
+		PrinterId:    d.PrinterId,
+		Certificate:  d.Certificate,
+		ExpiresAt:    d.ExpiresAt,
+	}
+}
+
+// DeviceCertificate records a client certificate issued to a printer so it can be listed and revoked.
+type DeviceCertificate struct {
+	Id        uint64 `gorm:"primaryKey"`
+	Serial    string `gorm:"type:varchar(64);uniqueIndex"`
+	PrinterId string `gorm:"type:varchar(100);index"`
+	NotAfter  time.Time
+	RevokedAt *time.Time
+	CreatedAt *time.Time
+	TenantId  string `gorm:"type:varchar(100);index"`
+}
+
+type DeviceCertificateDto struct {
+	Serial    string     `json:"serial"`
+	PrinterId string     `json:"printer_id"`
+	NotAfter  time.Time  `json:"not_after"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+func (d *DeviceCertificate) ToDto() DeviceCertificateDto {
+	return DeviceCertificateDto{
+		Serial:    d.Serial,
+		PrinterId: d.PrinterId,
+		NotAfter:  d.NotAfter,
+		RevokedAt: d.RevokedAt,
+		CreatedAt: d.CreatedAt,
+	}
+}
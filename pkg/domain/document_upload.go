@@ -0,0 +1,47 @@
+package domain
+
+import "time"
+
+// DocumentUpload is a resumable upload of the source document of a print job. Chunks are appended in order, Received
+// being the number of bytes received so far and so the offset of the next chunk.
+type DocumentUpload struct {
+	Id             uint64 `gorm:"primaryKey"`
+	UploadId       string `gorm:"type:varchar(100);uniqueIndex"`
+	JobId          string `gorm:"type:varchar(100);index"`
+	UserId         string `gorm:"type:varchar(100);index"`
+	Format         string
+	ExpectedDigest string `gorm:"type:varchar(64)"`
+	Received       int64
+	CreatedAt      *time.Time
+	ExpiresAt      time.Time `gorm:"index"`
+	TenantId       string    `gorm:"type:varchar(100);index"`
+}
+
+// DocumentUploadChunk is a chunk of an upload, its content lives in the document store under Digest.
+type DocumentUploadChunk struct {
+	Id       uint64 `gorm:"primaryKey"`
+	UploadId string `gorm:"type:varchar(100);uniqueIndex:uix_document_upload_chunks_position"`
+	Position int64  `gorm:"uniqueIndex:uix_document_upload_chunks_position"`
+	Size     int64
+	Digest   string `gorm:"type:varchar(64);index"`
+}
+
+type DocumentUploadDto struct {
+	UploadId       string    `json:"upload_id"`
+	JobId          string    `json:"job_id"`
+	Format         string    `json:"format"`
+	ExpectedDigest string    `json:"sha256,omitempty"`
+	Offset         int64     `json:"offset"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+func (d *DocumentUpload) ToDto() DocumentUploadDto {
+	return DocumentUploadDto{
+		UploadId:       d.UploadId,
+		JobId:          d.JobId,
+		Format:         d.Format,
+		ExpectedDigest: d.ExpectedDigest,
+		Offset:         d.Received,
+		ExpiresAt:      d.ExpiresAt,
+	}
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErasureReceipt is handed to a user once everything ditto holds about them has been erased. Erased counts the
+// records erased by kind, printers included.
+type ErasureReceipt struct {
+	UserId         string           `json:"user_id"`
+	ErasedPrinters int64            `json:"erased_printers"`
+	Erased         map[string]int64 `json:"erased"`
+	ErasedAt       time.Time        `json:"erased_at"`
+	Signature      string           `json:"signature"`
+}
+
+// Payload is the canonical representation of the receipt that gets signed.
+func (e *ErasureReceipt) Payload() string {
+	kinds := make([]string, 0, len(e.Erased))
+	for kind := range e.Erased {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	erased := make([]string, len(kinds))
+	for i, kind := range kinds {
+		erased[i] = fmt.Sprintf("%v=%v", kind, e.Erased[kind])
+	}
+	return fmt.Sprintf("%v|%v|%v|%v", e.UserId, e.ErasedPrinters, strings.Join(erased, ","), e.ErasedAt.UTC().Format(time.RFC3339Nano))
+}
+
+func (e *ErasureReceipt) ToJson() (string, error) {
+	jsonBytes, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// IdempotencyRecord remembers the response of a mutation so retries carrying the same idempotency key can be
+// replayed instead of executed again.
+type IdempotencyRecord struct {
+	Id           uint64 `gorm:"primaryKey"`
+	Principal    string `gorm:"type:varchar(100);uniqueIndex:uix_idempotency_records_key"`
+	Method       string `gorm:"type:varchar(255);uniqueIndex:uix_idempotency_records_key"`
+	Key          string `gorm:"type:varchar(255);uniqueIndex:uix_idempotency_records_key"`
+	RequestHash  string `gorm:"type:varchar(64)"`
+	ResponseType string
+	Response     []byte
+	Completed    bool
+	CreatedAt    *time.Time
+	ExpiresAt    time.Time `gorm:"index"`
+	TenantId     string    `gorm:"type:varchar(100);index"`
+}
+
+func (i *IdempotencyRecord) Expired(now time.Time) bool {
+	return !now.Before(i.ExpiresAt)
+}
@@ -0,0 +1,150 @@
+package domain
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/kutty-kumar/charminder/pkg"
+)
+
+type LocationKind int
+
+const (
+	LocationKindUnknown LocationKind = iota
+	LocationKindOrganization
+	LocationKindSite
+	LocationKindBuilding
+	LocationKindFloor
+	LocationKindRoom
+)
+
+var locationKindNames = map[LocationKind]string{
+	LocationKindOrganization: "organization",
+	LocationKindSite:         "site",
+	LocationKindBuilding:     "building",
+	LocationKindFloor:        "floor",
+	LocationKindRoom:         "room",
+}
+
+func (l LocationKind) String() string {
+	return locationKindNames[l]
+}
+
+func LocationKindFromString(name string) LocationKind {
+	for kind, kindName := range locationKindNames {
+		if kindName == name {
+			return kind
+		}
+	}
+	return LocationKindUnknown
+}
+
+// Location is a node of the organization > site > building > floor > room hierarchy. Path holds the external ids
+// of the location and all its ancestors, e.g. /org/site/building/, so a subtree is a prefix match.
+type Location struct {
+	pkg.BaseDomain
+	Name        string
+	Description string
+	Kind        int
+	ParentId    string `gorm:"type:varchar(100);index"`
+	Path        string `gorm:"type:varchar(512);index"`
+	Latitude    *float64
+	Longitude   *float64
+	TenantId    string `gorm:"type:varchar(100);index"`
+}
+
+type LocationDto struct {
+	ExternalId  string   `json:"external_id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Kind        string   `json:"kind"`
+	ParentId    string   `json:"parent_id,omitempty"`
+	Latitude    *float64 `json:"latitude,omitempty"`
+	Longitude   *float64 `json:"longitude,omitempty"`
+}
+
+func (l *Location) MarshalBinary() ([]byte, error) {
+	return json.Marshal(l.ToDto())
+}
+
+func (l *Location) UnmarshalBinary(buffer []byte) error {
+	dto := LocationDto{}
+	if err := json.Unmarshal(buffer, &dto); err != nil {
+		return err
+	}
+	l.FillProperties(&dto)
+	return nil
+}
+
+func (l *Location) GetName() pkg.DomainName {
+	return "locations"
+}
+
+func (l *Location) ToDto() interface{} {
+	return LocationDto{
+		ExternalId:  l.ExternalId,
+		Name:        l.Name,
+		Description: l.Description,
+		Kind:        LocationKind(l.Kind).String(),
+		ParentId:    l.ParentId,
+		Latitude:    l.Latitude,
+		Longitude:   l.Longitude,
+	}
+}
+
+func (l *Location) FillProperties(dto interface{}) pkg.Base {
+	locationDto := dto.(*LocationDto)
+	l.Name = locationDto.Name
+	l.Description = locationDto.Description
+	l.Kind = int(LocationKindFromString(locationDto.Kind))
+	l.ParentId = locationDto.ParentId
+	l.Latitude = locationDto.Latitude
+	l.Longitude = locationDto.Longitude
+	return l
+}
+
+// HasCoordinates reports whether the location has been placed on a map.
+func (l *Location) HasCoordinates() bool {
+	return l.Latitude != nil && l.Longitude != nil
+}
+
+func (l *Location) Merge(other interface{}) {
+	otherLocation := other.(*Location)
+	if otherLocation.Name != "" {
+		l.Name = otherLocation.Name
+	}
+	if otherLocation.Description != "" {
+		l.Description = otherLocation.Description
+	}
+	if otherLocation.HasCoordinates() {
+		l.Latitude = otherLocation.Latitude
+		l.Longitude = otherLocation.Longitude
+	}
+	if otherLocation.Status != 0 {
+		l.Status = otherLocation.Status
+	}
+}
+
+func (l *Location) FromSqlRow(rows *sql.Rows) (pkg.Base, error) {
+	err := rows.Scan(&l.ExternalId, &l.Id, &l.CreatedAt, &l.UpdatedAt, &l.DeletedAt, &l.Status, &l.Name, &l.Description, &l.Kind, &l.ParentId, &l.Path, &l.Latitude, &l.Longitude, &l.TenantId)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Location) SetExternalId(externalId string) {
+	l.ExternalId = externalId
+}
+
+func (l *Location) ToJson() (string, error) {
+	jsonBytes, err := json.Marshal(l)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func (l *Location) String() string {
+	return fmt.Sprintf("{\"name\": \"%v\",\"kind\": \"%v\", \"path\":\"%v\"}", l.Name, LocationKind(l.Kind), l.Path)
+}
@@ -0,0 +1,168 @@
+package domain
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/kutty-kumar/charminder/pkg"
+)
+
+type JobState int
+
+const (
+	JobStateUnknown JobState = iota
+	JobStateQueued
+	JobStateProcessing
+	JobStateCompleted
+	JobStateFailed
+	JobStateCanceled
+	// JobStateConverting jobs are having their document converted to a format their printer accepts
+	JobStateConverting
+	// JobStateHeld jobs wait for their owner to release them at a printer
+	JobStateHeld
+)
+
+var jobStateNames = map[JobState]string{
+	JobStateQueued:     "queued",
+	JobStateProcessing: "processing",
+	JobStateCompleted:  "completed",
+	JobStateFailed:     "failed",
+	JobStateCanceled:   "canceled",
+	JobStateConverting: "converting",
+	JobStateHeld:       "held",
+}
+
+func (j JobState) String() string {
+	return jobStateNames[j]
+}
+
+// Pending reports whether a job in this state still occupies its printer's queue, held jobs don't until released.
+func (j JobState) Pending() bool {
+	return j == JobStateQueued || j == JobStateConverting || j == JobStateProcessing
+}
+
+// Finished reports whether a job in this state is done with, successfully or not.
+func (j JobState) Finished() bool {
+	return j == JobStateCompleted || j == JobStateFailed || j == JobStateCanceled
+}
+
+// PendingJobStates are the states counted towards a printer's queue depth.
+var PendingJobStates = []int{int(JobStateQueued), int(JobStateConverting), int(JobStateProcessing)}
+
+// PrintJob is a document queued on a printer, GroupId is set when the printer was picked from a group. Secure jobs
+// are held until their owner releases them at the printer, or at any compatible printer of their group.
+type PrintJob struct {
+	pkg.BaseDomain
+	UserId         string `gorm:"type:varchar(100);index"`
+	PrinterId      string `gorm:"type:varchar(100);index"`
+	GroupId        string `gorm:"type:varchar(100)"`
+	DocumentName   string
+	DocumentFormat string
+	Copies         int
+	State          int `gorm:"index"`
+	Error          string
+	PrintFormat    string
+	Secure         bool
+	TenantId       string `gorm:"type:varchar(100);index"`
+}
+
+type PrintJobDto struct {
+	ExternalId     string `json:"external_id"`
+	UserId         string `json:"user_id"`
+	PrinterId      string `json:"printer_id,omitempty"`
+	GroupId        string `json:"group_id,omitempty"`
+	DocumentName   string `json:"document_name"`
+	DocumentFormat string `json:"document_format,omitempty"`
+	Copies         int    `json:"copies"`
+	State          string `json:"state"`
+	Error          string `json:"error,omitempty"`
+	PrintFormat    string `json:"print_format,omitempty"`
+	Secure         bool   `json:"secure,omitempty"`
+}
+
+func (j *PrintJob) MarshalBinary() ([]byte, error) {
+	return json.Marshal(j.ToDto())
+}
+
+func (j *PrintJob) UnmarshalBinary(buffer []byte) error {
+	dto := PrintJobDto{}
+	if err := json.Unmarshal(buffer, &dto); err != nil {
+		return err
+	}
+	j.FillProperties(&dto)
+	return nil
+}
+
+func (j *PrintJob) GetName() pkg.DomainName {
+	return "print_jobs"
+}
+
+func (j *PrintJob) ToDto() interface{} {
+	return PrintJobDto{
+		ExternalId:     j.ExternalId,
+		UserId:         j.UserId,
+		PrinterId:      j.PrinterId,
+		GroupId:        j.GroupId,
+		DocumentName:   j.DocumentName,
+		DocumentFormat: j.DocumentFormat,
+		Copies:         j.Copies,
+		State:          JobState(j.State).String(),
+		Error:          j.Error,
+		PrintFormat:    j.PrintFormat,
+		Secure:         j.Secure,
+	}
+}
+
+func (j *PrintJob) FillProperties(dto interface{}) pkg.Base {
+	jobDto := dto.(*PrintJobDto)
+	j.PrinterId = jobDto.PrinterId
+	j.GroupId = jobDto.GroupId
+	j.DocumentName = jobDto.DocumentName
+	j.DocumentFormat = jobDto.DocumentFormat
+	j.Copies = jobDto.Copies
+	j.Secure = jobDto.Secure
+	return j
+}
+
+func (j *PrintJob) Merge(other interface{}) {
+	otherJob := other.(*PrintJob)
+	if otherJob.State != 0 {
+		j.State = otherJob.State
+	}
+	if otherJob.Error != "" {
+		j.Error = otherJob.Error
+	}
+	if otherJob.DocumentFormat != "" {
+		j.DocumentFormat = otherJob.DocumentFormat
+	}
+	if otherJob.PrintFormat != "" {
+		j.PrintFormat = otherJob.PrintFormat
+	}
+	if otherJob.Status != 0 {
+		j.Status = otherJob.Status
+	}
+}
+
+func (j *PrintJob) FromSqlRow(rows *sql.Rows) (pkg.Base, error) {
+	err := rows.Scan(&j.ExternalId, &j.Id, &j.CreatedAt, &j.UpdatedAt, &j.DeletedAt, &j.Status, &j.UserId, &j.PrinterId, &j.GroupId, &j.DocumentName, &j.DocumentFormat, &j.Copies, &j.State, &j.Error, &j.PrintFormat, &j.Secure, &j.TenantId)
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *PrintJob) SetExternalId(externalId string) {
+	j.ExternalId = externalId
+}
+
+func (j *PrintJob) ToJson() (string, error) {
+	jsonBytes, err := json.Marshal(j)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func (j *PrintJob) String() string {
+	return fmt.Sprintf("{\"document_name\": \"%v\",\"printer_id\": \"%v\", \"state\":\"%v\"}", j.DocumentName, j.PrinterId, JobState(j.State))
+}
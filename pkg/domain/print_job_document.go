@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+const (
+	// DocumentKindSource is the document as uploaded by the user
+	DocumentKindSource = "source"
+	// DocumentKindPrint is the document converted to the format sent to the printer
+	DocumentKindPrint = "print"
+)
+
+// PrintJobDocument is a document of a print job, every job has at most one document of each kind. The content lives
+// in the document store under Digest, the hex SHA-256 of the content.
+type PrintJobDocument struct {
+	Id        uint64 `gorm:"primaryKey"`
+	JobId     string `gorm:"type:varchar(100);uniqueIndex:uix_print_job_documents_kind"`
+	Kind      string `gorm:"type:varchar(20);uniqueIndex:uix_print_job_documents_kind"`
+	Format    string
+	Digest    string `gorm:"type:varchar(64);index"`
+	Size      int64
+	CreatedAt *time.Time
+}
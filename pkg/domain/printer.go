@@ -8,6 +8,7 @@ import (
 	"github.com/kutty-kumar/charminder/pkg"
 	"github.com/kutty-kumar/ho_oh/core_v1"
 	ditto "github.com/kutty-kumar/ho_oh/ditto_v1"
+	"time"
 )
 
 type Printer struct {
@@ -18,6 +19,9 @@ type Printer struct {
 	ProductNumber string
 	Description   string
 	Status        int
+	LocationId    string `gorm:"type:varchar(100);index"`
+	LastSeenAt    *time.Time
+	TenantId      string `gorm:"type:varchar(100);index"`
 }
 
 func (p *Printer) MarshalBinary() ([]byte, error) {
@@ -79,13 +83,18 @@ func (p *Printer) Merge(other interface{}) {
 }
 
 func (p *Printer) FromSqlRow(rows *sql.Rows) (pkg.Base, error) {
-	err := rows.Scan(&p.ExternalId, &p.Id, &p.CreatedAt, &p.UpdatedAt, &p.DeletedAt, &p.Status, &p.Name, &p.UserId, &p.SerialNumber, &p.ProductNumber, &p.Description)
+	err := rows.Scan(&p.ExternalId, &p.Id, &p.CreatedAt, &p.UpdatedAt, &p.DeletedAt, &p.Status, &p.Name, &p.UserId, &p.SerialNumber, &p.ProductNumber, &p.Description, &p.LocationId, &p.LastSeenAt, &p.TenantId)
 	if err != nil {
 		return nil, err
 	}
 	return p, nil
 }
 
+// Online reports whether the printer is active and has been seen within window.
+func (p *Printer) Online(now time.Time, window time.Duration) bool {
+	return p.Status == int(core_v1.Status_active) && p.LastSeenAt != nil && now.Sub(*p.LastSeenAt) <= window
+}
+
 func (p *Printer) SetExternalId(externalId string) {
 	p.ExternalId = externalId
 }
@@ -0,0 +1,161 @@
+package domain
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/kutty-kumar/charminder/pkg"
+	"strings"
+)
+
+type GroupMembership int
+
+const (
+	GroupMembershipUnknown GroupMembership = iota
+	// GroupMembershipStatic groups hold the printers explicitly added to them
+	GroupMembershipStatic
+	// GroupMembershipRule groups hold every active printer matching their product numbers and location
+	GroupMembershipRule
+)
+
+var groupMembershipNames = map[GroupMembership]string{
+	GroupMembershipStatic: "static",
+	GroupMembershipRule:   "rule",
+}
+
+func (g GroupMembership) String() string {
+	return groupMembershipNames[g]
+}
+
+func GroupMembershipFromString(name string) GroupMembership {
+	for membership, membershipName := range groupMembershipNames {
+		if membershipName == name {
+			return membership
+		}
+	}
+	return GroupMembershipUnknown
+}
+
+// PrinterGroup is a named set of printers. Jobs sent to a group in pool mode are routed to one of its members.
+type PrinterGroup struct {
+	pkg.BaseDomain
+	Name               string
+	Description        string
+	UserId             string `gorm:"type:varchar(100);index"`
+	Membership         int
+	Pool               bool
+	RuleProductNumbers string
+	RuleLocationId     string `gorm:"type:varchar(100)"`
+	TenantId           string `gorm:"type:varchar(100);index"`
+}
+
+// PrinterGroupMember is the static membership of a printer in a group.
+type PrinterGroupMember struct {
+	Id        uint64 `gorm:"primaryKey"`
+	GroupId   string `gorm:"type:varchar(100);uniqueIndex:uix_printer_group_members_member"`
+	PrinterId string `gorm:"type:varchar(100);uniqueIndex:uix_printer_group_members_member;index"`
+	TenantId  string `gorm:"type:varchar(100);index"`
+}
+
+type PrinterGroupDto struct {
+	ExternalId         string   `json:"external_id"`
+	Name               string   `json:"name"`
+	Description        string   `json:"description,omitempty"`
+	UserId             string   `json:"user_id"`
+	Membership         string   `json:"membership"`
+	Pool               bool     `json:"pool"`
+	RuleProductNumbers []string `json:"rule_product_numbers,omitempty"`
+	RuleLocationId     string   `json:"rule_location_id,omitempty"`
+}
+
+// ProductNumbers returns the product numbers a rule group matches.
+func (g *PrinterGroup) ProductNumbers() []string {
+	if g.RuleProductNumbers == "" {
+		return nil
+	}
+	return strings.Split(g.RuleProductNumbers, ",")
+}
+
+func (g *PrinterGroup) MarshalBinary() ([]byte, error) {
+	return json.Marshal(g.ToDto())
+}
+
+func (g *PrinterGroup) UnmarshalBinary(buffer []byte) error {
+	dto := PrinterGroupDto{}
+	if err := json.Unmarshal(buffer, &dto); err != nil {
+		return err
+	}
+	g.FillProperties(&dto)
+	return nil
+}
+
+func (g *PrinterGroup) GetName() pkg.DomainName {
+	return "printer_groups"
+}
+
+func (g *PrinterGroup) ToDto() interface{} {
+	return PrinterGroupDto{
+		ExternalId:         g.ExternalId,
+		Name:               g.Name,
+		Description:        g.Description,
+		UserId:             g.UserId,
+		Membership:         GroupMembership(g.Membership).String(),
+		Pool:               g.Pool,
+		RuleProductNumbers: g.ProductNumbers(),
+		RuleLocationId:     g.RuleLocationId,
+	}
+}
+
+func (g *PrinterGroup) FillProperties(dto interface{}) pkg.Base {
+	groupDto := dto.(*PrinterGroupDto)
+	g.Name = groupDto.Name
+	g.Description = groupDto.Description
+	g.Membership = int(GroupMembershipFromString(groupDto.Membership))
+	g.Pool = groupDto.Pool
+	g.RuleProductNumbers = strings.Join(groupDto.RuleProductNumbers, ",")
+	g.RuleLocationId = groupDto.RuleLocationId
+	return g
+}
+
+func (g *PrinterGroup) Merge(other interface{}) {
+	otherGroup := other.(*PrinterGroup)
+	if otherGroup.Name != "" {
+		g.Name = otherGroup.Name
+	}
+	if otherGroup.Description != "" {
+		g.Description = otherGroup.Description
+	}
+	if otherGroup.RuleProductNumbers != "" {
+		g.RuleProductNumbers = otherGroup.RuleProductNumbers
+	}
+	if otherGroup.RuleLocationId != "" {
+		g.RuleLocationId = otherGroup.RuleLocationId
+	}
+	if otherGroup.Status != 0 {
+		g.Status = otherGroup.Status
+	}
+}
+
+func (g *PrinterGroup) FromSqlRow(rows *sql.Rows) (pkg.Base, error) {
+	err := rows.Scan(&g.ExternalId, &g.Id, &g.CreatedAt, &g.UpdatedAt, &g.DeletedAt, &g.Status, &g.Name, &g.Description, &g.UserId, &g.Membership, &g.Pool, &g.RuleProductNumbers, &g.RuleLocationId, &g.TenantId)
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *PrinterGroup) SetExternalId(externalId string) {
+	g.ExternalId = externalId
+}
+
+func (g *PrinterGroup) ToJson() (string, error) {
+	jsonBytes, err := json.Marshal(g)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func (g *PrinterGroup) String() string {
+	return fmt.Sprintf("{\"name\": \"%v\",\"membership\": \"%v\", \"pool\":\"%v\"}", g.Name, GroupMembership(g.Membership), g.Pool)
+}
@@ -0,0 +1,152 @@
+package domain
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/kutty-kumar/charminder/pkg"
+	"strings"
+)
+
+// PrinterModel describes what every printer with a given product number can do. Paper sizes use PWG self describing
+// names (iso_a4_210x297mm), resolutions are written as 600x600dpi and document formats are MIME types.
+type PrinterModel struct {
+	pkg.BaseDomain
+	ProductNumber   string `gorm:"type:varchar(100);uniqueIndex"`
+	Manufacturer    string
+	ModelName       string
+	Color           bool
+	Duplex          bool
+	PaperSizes      string
+	Resolutions     string
+	DocumentFormats string
+	PpdName         string
+	IppAttributes   string `gorm:"type:text"`
+}
+
+type PrinterModelDto struct {
+	ProductNumber   string            `json:"product_number"`
+	Manufacturer    string            `json:"manufacturer"`
+	ModelName       string            `json:"model_name"`
+	Color           bool              `json:"color"`
+	Duplex          bool              `json:"duplex"`
+	PaperSizes      []string          `json:"paper_sizes,omitempty"`
+	Resolutions     []string          `json:"resolutions,omitempty"`
+	DocumentFormats []string          `json:"document_formats,omitempty"`
+	PpdName         string            `json:"ppd_name,omitempty"`
+	IppAttributes   map[string]string `json:"ipp_attributes,omitempty"`
+}
+
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+// Supports reports whether the model accepts documents of the given MIME type.
+func (m *PrinterModel) Supports(documentFormat string) bool {
+	for _, format := range splitList(m.DocumentFormats) {
+		if format == documentFormat {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *PrinterModel) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m.ToDto())
+}
+
+func (m *PrinterModel) UnmarshalBinary(buffer []byte) error {
+	dto := PrinterModelDto{}
+	if err := json.Unmarshal(buffer, &dto); err != nil {
+		return err
+	}
+	m.FillProperties(&dto)
+	return nil
+}
+
+func (m *PrinterModel) GetName() pkg.DomainName {
+	return "printer_models"
+}
+
+func (m *PrinterModel) ToDto() interface{} {
+	var ippAttributes map[string]string
+	if m.IppAttributes != "" {
+		// the column is only ever written by FillProperties, so it always holds a valid object
+		_ = json.Unmarshal([]byte(m.IppAttributes), &ippAttributes)
+	}
+	return PrinterModelDto{
+		ProductNumber:   m.ProductNumber,
+		Manufacturer:    m.Manufacturer,
+		ModelName:       m.ModelName,
+		Color:           m.Color,
+		Duplex:          m.Duplex,
+		PaperSizes:      splitList(m.PaperSizes),
+		Resolutions:     splitList(m.Resolutions),
+		DocumentFormats: splitList(m.DocumentFormats),
+		PpdName:         m.PpdName,
+		IppAttributes:   ippAttributes,
+	}
+}
+
+func (m *PrinterModel) FillProperties(dto interface{}) pkg.Base {
+	modelDto := dto.(*PrinterModelDto)
+	m.ProductNumber = modelDto.ProductNumber
+	m.Manufacturer = modelDto.Manufacturer
+	m.ModelName = modelDto.ModelName
+	m.Color = modelDto.Color
+	m.Duplex = modelDto.Duplex
+	m.PaperSizes = strings.Join(modelDto.PaperSizes, ",")
+	m.Resolutions = strings.Join(modelDto.Resolutions, ",")
+	m.DocumentFormats = strings.Join(modelDto.DocumentFormats, ",")
+	m.PpdName = modelDto.PpdName
+	m.IppAttributes = ""
+	if len(modelDto.IppAttributes) > 0 {
+		ippAttributes, _ := json.Marshal(modelDto.IppAttributes)
+		m.IppAttributes = string(ippAttributes)
+	}
+	return m
+}
+
+// Merge replaces every capability of the model, a catalog entry is always written as a whole.
+func (m *PrinterModel) Merge(other interface{}) {
+	otherModel := other.(*PrinterModel)
+	m.Manufacturer = otherModel.Manufacturer
+	m.ModelName = otherModel.ModelName
+	m.Color = otherModel.Color
+	m.Duplex = otherModel.Duplex
+	m.PaperSizes = otherModel.PaperSizes
+	m.Resolutions = otherModel.Resolutions
+	m.DocumentFormats = otherModel.DocumentFormats
+	m.PpdName = otherModel.PpdName
+	m.IppAttributes = otherModel.IppAttributes
+	if otherModel.Status != 0 {
+		m.Status = otherModel.Status
+	}
+}
+
+func (m *PrinterModel) FromSqlRow(rows *sql.Rows) (pkg.Base, error) {
+	err := rows.Scan(&m.ExternalId, &m.Id, &m.CreatedAt, &m.UpdatedAt, &m.DeletedAt, &m.Status, &m.ProductNumber, &m.Manufacturer, &m.ModelName, &m.Color, &m.Duplex, &m.PaperSizes, &m.Resolutions, &m.DocumentFormats, &m.PpdName, &m.IppAttributes)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *PrinterModel) SetExternalId(externalId string) {
+	m.ExternalId = externalId
+}
+
+func (m *PrinterModel) ToJson() (string, error) {
+	jsonBytes, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func (m *PrinterModel) String() string {
+	return fmt.Sprintf("{\"product_number\": \"%v\",\"manufacturer\": \"%v\", \"model_name\":\"%v\"}", m.ProductNumber, m.Manufacturer, m.ModelName)
+}
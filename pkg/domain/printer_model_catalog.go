@@ -0,0 +1,107 @@
+package domain
+
+var (
+	isoA4       = "iso_a4_210x297mm"
+	isoA5       = "iso_a5_148x210mm"
+	naLetter    = "na_letter_8.5x11in"
+	naLegal     = "na_legal_8.5x14in"
+	isoA3       = "iso_a3_297x420mm"
+	naLedger    = "na_ledger_11x17in"
+	officePaper = []string{isoA4, isoA5, naLetter, naLegal}
+)
+
+// PrinterModelCatalog is the seed dataset loaded into an empty catalog, entries already present are left untouched so
+// admin edits survive restarts.
+var PrinterModelCatalog = []PrinterModelDto{
+	{
+		ProductNumber:   "W1A53A",
+		Manufacturer:    "HP",
+		ModelName:       "LaserJet Pro M404dn",
+		Duplex:          true,
+		PaperSizes:      officePaper,
+		Resolutions:     []string{"600x600dpi", "1200x1200dpi"},
+		DocumentFormats: []string{"application/pdf", "application/postscript", "application/vnd.hp-PCL", "image/pwg-raster", "image/urf"},
+		PpdName:         "hp-laserjet_pro_m404-m405-ps.ppd",
+		IppAttributes: map[string]string{
+			"printer-make-and-model": "HP LaserJet Pro M404dn",
+			"ipp-versions-supported": "1.0,1.1,2.0",
+			"sides-supported":        "one-sided,two-sided-long-edge,two-sided-short-edge",
+		},
+	},
+	{
+		ProductNumber:   "W1Y45A",
+		Manufacturer:    "HP",
+		ModelName:       "Color LaserJet Pro M454dw",
+		Color:           true,
+		Duplex:          true,
+		PaperSizes:      officePaper,
+		Resolutions:     []string{"600x600dpi"},
+		DocumentFormats: []string{"application/pdf", "application/postscript", "application/vnd.hp-PCL", "image/pwg-raster", "image/urf"},
+		PpdName:         "hp-color_laserjet_pro_m453-4-ps.ppd",
+		IppAttributes: map[string]string{
+			"printer-make-and-model": "HP Color LaserJet Pro M454dw",
+			"ipp-versions-supported": "1.0,1.1,2.0",
+			"sides-supported":        "one-sided,two-sided-long-edge,two-sided-short-edge",
+		},
+	},
+	{
+		ProductNumber:   "1PV87A",
+		Manufacturer:    "HP",
+		ModelName:       "LaserJet Enterprise M507dn",
+		Duplex:          true,
+		PaperSizes:      officePaper,
+		Resolutions:     []string{"600x600dpi", "1200x1200dpi"},
+		DocumentFormats: []string{"application/pdf", "application/postscript", "application/vnd.hp-PCL", "image/pwg-raster", "image/urf"},
+		PpdName:         "hp-laserjet_enterprise_m507-ps.ppd",
+		IppAttributes: map[string]string{
+			"printer-make-and-model": "HP LaserJet Enterprise M507",
+			"ipp-versions-supported": "1.0,1.1,2.0",
+			"sides-supported":        "one-sided,two-sided-long-edge,two-sided-short-edge",
+		},
+	},
+	{
+		ProductNumber:   "1KR57B",
+		Manufacturer:    "HP",
+		ModelName:       "OfficeJet Pro 9025",
+		Color:           true,
+		Duplex:          true,
+		PaperSizes:      officePaper,
+		Resolutions:     []string{"600x600dpi", "1200x1200dpi"},
+		DocumentFormats: []string{"application/pdf", "image/jpeg", "image/pwg-raster", "image/urf"},
+		IppAttributes: map[string]string{
+			"printer-make-and-model": "HP OfficeJet Pro 9020 series",
+			"ipp-versions-supported": "1.0,1.1,2.0",
+			"sides-supported":        "one-sided,two-sided-long-edge,two-sided-short-edge",
+		},
+	},
+	{
+		ProductNumber:   "3XV17B",
+		Manufacturer:    "HP",
+		ModelName:       "DeskJet 2755",
+		Color:           true,
+		PaperSizes:      []string{isoA4, isoA5, naLetter},
+		Resolutions:     []string{"300x300dpi", "600x600dpi"},
+		DocumentFormats: []string{"image/jpeg", "image/pwg-raster", "image/urf"},
+		IppAttributes: map[string]string{
+			"printer-make-and-model": "HP DeskJet 2700 series",
+			"ipp-versions-supported": "1.0,1.1,2.0",
+			"sides-supported":        "one-sided",
+		},
+	},
+	{
+		ProductNumber:   "4PZ47A",
+		Manufacturer:    "HP",
+		ModelName:       "Color LaserJet Enterprise MFP M776dn",
+		Color:           true,
+		Duplex:          true,
+		PaperSizes:      append([]string{isoA3, naLedger}, officePaper...),
+		Resolutions:     []string{"600x600dpi", "1200x1200dpi"},
+		DocumentFormats: []string{"application/pdf", "application/postscript", "application/vnd.hp-PCL", "image/pwg-raster", "image/urf"},
+		PpdName:         "hp-color_laserjet_enterprise_mfp_m776-ps.ppd",
+		IppAttributes: map[string]string{
+			"printer-make-and-model": "HP Color LaserJet Enterprise MFP M776",
+			"ipp-versions-supported": "1.0,1.1,2.0",
+			"sides-supported":        "one-sided,two-sided-long-edge,two-sided-short-edge",
+		},
+	},
+}
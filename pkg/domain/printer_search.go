@@ -0,0 +1,30 @@
+package domain
+
+// PrinterQuery describes a full text printer search along with the facet filters to apply.
+type PrinterQuery struct {
+	Text           string
+	ProductNumbers []string
+	Statuses       []int
+	UserIds        []string
+	LocationIds    []string
+	Limit          int
+	Offset         int
+}
+
+type PrinterHit struct {
+	Printer Printer
+	Score   float64
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// PrinterSearchResult holds one page of hits ordered by relevance, the total number of matches and the facet counts
+// over every match.
+type PrinterSearchResult struct {
+	Hits   []PrinterHit
+	Total  int64
+	Facets map[string][]FacetCount
+}
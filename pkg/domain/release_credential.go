@@ -0,0 +1,55 @@
+package domain
+
+import "time"
+
+// ReleaseCredential holds what a user authenticates with at a printer to release their held jobs: a bcrypt hash of
+// their PIN and the SHA-256 digest of their badge id. Failed PIN attempts lock the credential for a while.
+type ReleaseCredential struct {
+	Id             uint64  `gorm:"primaryKey"`
+	UserId         string  `gorm:"type:varchar(100);uniqueIndex"`
+	PinHash        string  `gorm:"type:varchar(100)"`
+	BadgeDigest    *string `gorm:"type:varchar(64);uniqueIndex"`
+	FailedAttempts int
+	LockedUntil    *time.Time
+	UpdatedAt      *time.Time
+	TenantId       string `gorm:"type:varchar(100);index"`
+}
+
+// BadgeAttempts counts the unknown badges presented at a printer. Badge ids can be guessed without knowing whose they
+// are, so failed badge attempts lock badge release at the printer for a while rather than any one credential.
+type BadgeAttempts struct {
+	Id             uint64 `gorm:"primaryKey"`
+	PrinterId      string `gorm:"type:varchar(100);uniqueIndex"`
+	FailedAttempts int
+	LockedUntil    *time.Time
+	UpdatedAt      *time.Time
+	TenantId       string `gorm:"type:varchar(100);index"`
+}
+
+// Locked reports whether too many unknown badges lock badge release at the printer at now.
+func (b *BadgeAttempts) Locked(now time.Time) bool {
+	return b.LockedUntil != nil && now.Before(*b.LockedUntil)
+}
+
+type ReleaseCredentialDto struct {
+	UserId   string     `json:"user_id"`
+	HasPin   bool       `json:"has_pin"`
+	HasBadge bool       `json:"has_badge"`
+	Locked   bool       `json:"locked,omitempty"`
+	Updated  *time.Time `json:"updated_at,omitempty"`
+}
+
+// Locked reports whether too many failed attempts lock the credential at now.
+func (r *ReleaseCredential) Locked(now time.Time) bool {
+	return r.LockedUntil != nil && now.Before(*r.LockedUntil)
+}
+
+func (r *ReleaseCredential) ToDto() ReleaseCredentialDto {
+	return ReleaseCredentialDto{
+		UserId:   r.UserId,
+		HasPin:   r.PinHash != "",
+		HasBadge: r.BadgeDigest != nil,
+		Locked:   r.Locked(time.Now()),
+		Updated:  r.UpdatedAt,
+	}
+}
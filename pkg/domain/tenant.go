@@ -0,0 +1,30 @@
+package domain
+
+import "time"
+
+// Tenant is an organization whose printers, locations, groups, jobs and connectors are isolated from every other
+// organization's. Users belong to the tenant named by the tenant_id claim of their token.
+type Tenant struct {
+	Id        uint64 `gorm:"primaryKey"`
+	TenantId  string `gorm:"type:varchar(100);uniqueIndex"`
+	Name      string
+	CreatedAt *time.Time
+	UpdatedAt *time.Time
+}
+
+type TenantDto struct {
+	TenantId     string     `json:"tenant_id"`
+	Name         string     `json:"name"`
+	PrinterCount int64      `json:"printer_count"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+}
+
+func (t *Tenant) ToDto() TenantDto {
+	return TenantDto{
+		TenantId:  t.TenantId,
+		Name:      t.Name,
+		CreatedAt: t.CreatedAt,
+		UpdatedAt: t.UpdatedAt,
+	}
+}
@@ -0,0 +1,41 @@
+package domain
+
+import "time"
+
+// UserData is everything ditto holds about a user.
+type UserData struct {
+	Printers           []Printer
+	PrintJobs          []PrintJob
+	PrinterGroups      []PrinterGroup
+	Connectors         []Connector
+	DeviceEnrollments  []DeviceEnrollment
+	DocumentUploads    []DocumentUpload
+	ReleaseCredentials []ReleaseCredential
+	IdempotencyRecords []IdempotencyRecord
+}
+
+// UserDataErasure tells how many records of each kind the erasure of a user removed, and the digests of the
+// documents it dereferenced, whose content is released from the document store once the erasure committed.
+type UserDataErasure struct {
+	Erased  map[string]int64
+	Digests []string
+}
+
+// IdempotencyRecordDto describes a stored idempotency key without the response it replays.
+type IdempotencyRecordDto struct {
+	Method    string     `json:"method"`
+	Key       string     `json:"key"`
+	Completed bool       `json:"completed"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	ExpiresAt time.Time  `json:"expires_at"`
+}
+
+func (i *IdempotencyRecord) ToDto() IdempotencyRecordDto {
+	return IdempotencyRecordDto{
+		Method:    i.Method,
+		Key:       i.Key,
+		Completed: i.Completed,
+		CreatedAt: i.CreatedAt,
+		ExpiresAt: i.ExpiresAt,
+	}
+}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"ditto/pkg/svc"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	ditto "github.com/kutty-kumar/ho_oh/ditto_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"net/http"
+)
+
+type batchItemResponse struct {
+	Index    int             `json:"index"`
+	Code     string          `json:"code"`
+	Message  string          `json:"message,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+type BatchPrinterHandler struct {
+	svc *svc.BatchPrinterSvc
+}
+
+func NewBatchPrinterHandler(batchPrinterSvc *svc.BatchPrinterSvc) *BatchPrinterHandler {
+	return &BatchPrinterHandler{svc: batchPrinterSvc}
+}
+
+// BatchCreatePrinters accepts {"items": [CreatePrinterRequest...]} and responds with the status of every item. The
+// items are decoded as they are written, a chunk at a time. A malformed item ends the batch: the items before it are
+// written and it is reported as the last, failed, item.
+func (b *BatchPrinterHandler) BatchCreatePrinters(w http.ResponseWriter, r *http.Request) {
+	items, ok := newBatchItems(w, r)
+	if !ok {
+		return
+	}
+	results, err := b.svc.BatchCreatePrintersFromStream(&createPrinterItems{ctx: r.Context(), items: items})
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeBatchResults(w, results)
+}
+
+// BatchUpdatePrinters accepts {"items": [UpdatePrinterRequest...]} and responds with the status of every item, decoding
+// the items the same way as BatchCreatePrinters.
+func (b *BatchPrinterHandler) BatchUpdatePrinters(w http.ResponseWriter, r *http.Request) {
+	items, ok := newBatchItems(w, r)
+	if !ok {
+		return
+	}
+	results, err := b.svc.BatchUpdatePrintersFromStream(&updatePrinterItems{ctx: r.Context(), items: items})
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeBatchResults(w, results)
+}
+
+// batchItems decodes the items of a {"items": [...]} body one at a time.
+type batchItems struct {
+	decoder *json.Decoder
+	opened  bool
+	done    bool
+	index   int
+}
+
+func newBatchItems(w http.ResponseWriter, r *http.Request) (*batchItems, bool) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return nil, false
+	}
+	return &batchItems{decoder: json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportBytes))}, true
+}
+
+// next decodes the next item into item, returning io.EOF once the items are exhausted.
+func (b *batchItems) next(item proto.Message) error {
+	if !b.opened {
+		b.opened = true
+		if err := b.open(); err != nil {
+			b.done = true
+			return status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+	}
+	if b.done || !b.decoder.More() {
+		b.done = true
+		return io.EOF
+	}
+	raw := json.RawMessage{}
+	if err := b.decoder.Decode(&raw); err != nil {
+		b.done = true
+		return status.Errorf(codes.InvalidArgument, "item %d: %v", b.index, err)
+	}
+	if err := jsonpb.Unmarshal(bytes.NewReader(raw), item); err != nil {
+		b.done = true
+		return status.Errorf(codes.InvalidArgument, "item %d: %v", b.index, err)
+	}
+	b.index++
+	return nil
+}
+
+// open reads the body up to the first item, skipping any field other than items. A body without items holds none.
+func (b *batchItems) open() error {
+	if err := b.expectDelim('{'); err != nil {
+		return err
+	}
+	for b.decoder.More() {
+		token, err := b.decoder.Token()
+		if err != nil {
+			return err
+		}
+		if token == "items" {
+			return b.expectDelim('[')
+		}
+		skipped := json.RawMessage{}
+		if err := b.decoder.Decode(&skipped); err != nil {
+			return err
+		}
+	}
+	b.done = true
+	return nil
+}
+
+func (b *batchItems) expectDelim(delim json.Delim) error {
+	token, err := b.decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %v, found %v", delim, token)
+	}
+	return nil
+}
+
+type createPrinterItems struct {
+	ctx   context.Context
+	items *batchItems
+}
+
+func (c *createPrinterItems) Context() context.Context {
+	return c.ctx
+}
+
+func (c *createPrinterItems) Recv() (*ditto.CreatePrinterRequest, error) {
+	request := &ditto.CreatePrinterRequest{}
+	if err := c.items.next(request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type updatePrinterItems struct {
+	ctx   context.Context
+	items *batchItems
+}
+
+func (u *updatePrinterItems) Context() context.Context {
+	return u.ctx
+}
+
+func (u *updatePrinterItems) Recv() (*ditto.UpdatePrinterRequest, error) {
+	request := &ditto.UpdatePrinterRequest{}
+	if err := u.items.next(request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func writeBatchResults(w http.ResponseWriter, results []svc.BatchItemResult) {
+	response := make([]batchItemResponse, len(results))
+	for i, result := range results {
+		response[i] = batchItemResponse{
+			Index:   result.Index,
+			Code:    result.Status.Code().String(),
+			Message: result.Status.Message(),
+		}
+		if result.Response != nil {
+			dto, err := dtoMarshaler.MarshalToString(result.Response)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			response[i].Response = json.RawMessage(dto)
+		}
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"results": response})
+}
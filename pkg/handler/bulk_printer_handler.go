@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"ditto/pkg/svc"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+const maxImportBytes = 32 << 20
+
+var contentTypeFormats = map[string]string{
+	"text/csv":             svc.BulkFormatCsv,
+	"application/json":     svc.BulkFormatJson,
+	"application/x-ndjson": svc.BulkFormatNdJson,
+	"application/ndjson":   svc.BulkFormatNdJson,
+}
+
+var formatContentTypes = map[string]string{
+	svc.BulkFormatCsv:    "text/csv",
+	svc.BulkFormatJson:   "application/json",
+	svc.BulkFormatNdJson: "application/x-ndjson",
+}
+
+type BulkPrinterHandler struct {
+	svc *svc.BulkPrinterSvc
+}
+
+func NewBulkPrinterHandler(bulkPrinterSvc *svc.BulkPrinterSvc) *BulkPrinterHandler {
+	return &BulkPrinterHandler{svc: bulkPrinterSvc}
+}
+
+// ImportPrinters upserts the printers in the request body, the format is taken from ?format= or the Content-Type
+// header and ?dry_run=true validates the payload without writing.
+func (b *BulkPrinterHandler) ImportPrinters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	format := requestFormat(r, r.Header.Get("Content-Type"))
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid dry_run %v", value))
+			return
+		}
+		dryRun = parsed
+	}
+	summary, err := b.svc.ImportPrinters(r.Context(), userId(r), format, http.MaxBytesReader(w, r.Body, maxImportBytes), dryRun)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, summary)
+}
+
+// ExportPrinters streams the caller's printers in the format given by ?format= or the Accept header.
+func (b *BulkPrinterHandler) ExportPrinters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	format := requestFormat(r, r.Header.Get("Accept"))
+	contentType, ok := formatContentTypes[format]
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unsupported format %v", format))
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"printers.%v\"", format))
+	tw := &trackingWriter{ResponseWriter: w}
+	if err := b.svc.ExportPrinters(r.Context(), userId(r), format, tw); err != nil {
+		if tw.written {
+			// the status line is already on the wire, abort so the client sees a truncated response
+			panic(http.ErrAbortHandler)
+		}
+		writeStatusError(w, err)
+	}
+}
+
+// trackingWriter records whether any part of the response body has been written.
+type trackingWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (t *trackingWriter) Write(b []byte) (int, error) {
+	t.written = true
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *trackingWriter) Flush() {
+	if flusher, ok := t.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func requestFormat(r *http.Request, contentType string) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		if format, ok := contentTypeFormats[mediaType]; ok {
+			return format
+		}
+	}
+	return svc.BulkFormatJson
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"ditto/pkg/svc"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type ConnectorHandler struct {
+	svc    *svc.ConnectorSvc
+	prefix string
+}
+
+// NewConnectorHandler serves the connector endpoints mounted at prefix, which must end with a slash.
+func NewConnectorHandler(connectorSvc *svc.ConnectorSvc, prefix string) *ConnectorHandler {
+	return &ConnectorHandler{svc: connectorSvc, prefix: prefix}
+}
+
+// ServeHTTP routes
+//
+//	GET, POST     {prefix}
+//	GET, DELETE   {prefix}{connector_id}
+//	POST          {prefix}{connector_id}/secret
+func (c *ConnectorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, c.prefix), "/"), "/")
+	switch {
+	case parts[0] == "" && r.Method == http.MethodGet:
+		c.listConnectors(w, r)
+	case parts[0] == "" && r.Method == http.MethodPost:
+		c.createConnector(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		c.getConnector(w, r, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		c.deleteConnector(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "secret" && r.Method == http.MethodPost:
+		c.rotateSecret(w, r, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %v %v", r.Method, r.URL.Path))
+	}
+}
+
+func (c *ConnectorHandler) listConnectors(w http.ResponseWriter, r *http.Request) {
+	connectors, err := c.svc.ListConnectors(r.Context())
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"connectors": connectors})
+}
+
+// createConnector takes {"name": ""} and responds with the connector's secret, which can't be read back later.
+func (c *ConnectorHandler) createConnector(w http.ResponseWriter, r *http.Request) {
+	request := struct {
+		Name string `json:"name"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	created, err := c.svc.CreateConnector(r.Context(), request.Name)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusCreated, created)
+}
+
+func (c *ConnectorHandler) getConnector(w http.ResponseWriter, r *http.Request, connectorId string) {
+	found, err := c.svc.GetConnector(r.Context(), connectorId)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, found)
+}
+
+func (c *ConnectorHandler) deleteConnector(w http.ResponseWriter, r *http.Request, connectorId string) {
+	if err := c.svc.DeleteConnector(r.Context(), connectorId); err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]string{"connector_id": connectorId})
+}
+
+func (c *ConnectorHandler) rotateSecret(w http.ResponseWriter, r *http.Request, connectorId string) {
+	rotated, err := c.svc.RotateSecret(r.Context(), connectorId)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, rotated)
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"ditto/pkg/svc"
+	"encoding/json"
+	"fmt"
+	ditto "github.com/kutty-kumar/ho_oh/ditto_v1"
+	"net/http"
+	"strings"
+)
+
+// DeletedPrinterHandler serves the restore, listing and purge of soft-deleted printers, which the printer service
+// doesn't declare rpcs for.
+type DeletedPrinterHandler struct {
+	svc    *svc.PrinterSvc
+	prefix string
+}
+
+// NewDeletedPrinterHandler serves the deleted printer endpoints mounted at prefix, which must end with a slash.
+func NewDeletedPrinterHandler(printerSvc *svc.PrinterSvc, prefix string) *DeletedPrinterHandler {
+	return &DeletedPrinterHandler{svc: printerSvc, prefix: prefix}
+}
+
+// ServeHTTP routes
+//
+//	GET    {prefix}
+//	POST   {prefix}{printer_id}/restore
+func (h *DeletedPrinterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, h.prefix), "/"), "/")
+	switch {
+	case parts[0] == "" && r.Method == http.MethodGet:
+		h.listDeletedPrinters(w, r)
+	case len(parts) == 2 && parts[1] == "restore" && r.Method == http.MethodPost:
+		h.restorePrinter(w, r, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %v %v", r.Method, r.URL.Path))
+	}
+}
+
+func (h *DeletedPrinterHandler) listDeletedPrinters(w http.ResponseWriter, r *http.Request) {
+	response, err := h.svc.ListDeletedPrinters(r.Context(), &ditto.NoOpRequest{})
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeProto(w, http.StatusOK, response)
+}
+
+func (h *DeletedPrinterHandler) restorePrinter(w http.ResponseWriter, r *http.Request, printerId string) {
+	response, err := h.svc.RestorePrinter(r.Context(), &ditto.GetPrinterByExternalIdRequest{PrinterId: printerId})
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeProto(w, http.StatusOK, response)
+}
+
+// PurgePrinter serves POST {"printer_id": ""}, permanently deleting the printer, deleted or not, and its dependent
+// records. It is restricted to tenant admins.
+func (h *DeletedPrinterHandler) PurgePrinter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	request := struct {
+		PrinterId string `json:"printer_id"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	response, err := h.svc.PurgePrinter(r.Context(), &ditto.DeletePrinterRequest{PrinterId: request.PrinterId})
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeProto(w, http.StatusOK, response)
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"ditto/pkg/svc"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// uploadOffsetHeader carries the offset a chunk of a resumable upload starts at, and the offset reached after it.
+const uploadOffsetHeader = "Upload-Offset"
+
+type DocumentUploadHandler struct {
+	svc    *svc.PrintDocumentSvc
+	prefix string
+}
+
+// NewDocumentUploadHandler serves the resumable document upload endpoints mounted at prefix, which must end with a
+// slash.
+func NewDocumentUploadHandler(documentSvc *svc.PrintDocumentSvc, prefix string) *DocumentUploadHandler {
+	return &DocumentUploadHandler{svc: documentSvc, prefix: prefix}
+}
+
+// ServeHTTP routes
+//
+//	POST                 {prefix}
+//	GET, PATCH, DELETE   {prefix}{upload_id}
+//	POST                 {prefix}{upload_id}/complete
+func (d *DocumentUploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, d.prefix), "/"), "/")
+	switch {
+	case parts[0] == "" && r.Method == http.MethodPost:
+		d.createUpload(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		d.getUpload(w, r, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodPatch:
+		d.appendChunk(w, r, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		d.abortUpload(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "complete" && r.Method == http.MethodPost:
+		d.completeUpload(w, r, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %v %v", r.Method, r.URL.Path))
+	}
+}
+
+// createUpload takes {"job_id": "", "format": "", "sha256": ""}, sha256 being optional.
+func (d *DocumentUploadHandler) createUpload(w http.ResponseWriter, r *http.Request) {
+	request := struct {
+		JobId  string `json:"job_id"`
+		Format string `json:"format"`
+		Sha256 string `json:"sha256"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	upload, err := d.svc.CreateUpload(r.Context(), request.JobId, request.Format, request.Sha256)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusCreated, upload)
+}
+
+func (d *DocumentUploadHandler) getUpload(w http.ResponseWriter, r *http.Request, uploadId string) {
+	upload, err := d.svc.GetUpload(r.Context(), uploadId)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	w.Header().Set(uploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+	writeJson(w, http.StatusOK, upload)
+}
+
+// appendChunk takes the raw chunk as the body, the Upload-Offset header naming the offset it starts at.
+func (d *DocumentUploadHandler) appendChunk(w http.ResponseWriter, r *http.Request, uploadId string) {
+	offset, err := strconv.ParseInt(r.Header.Get(uploadOffsetHeader), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %v header: %v", uploadOffsetHeader, err))
+		return
+	}
+	received, err := d.svc.AppendChunk(r.Context(), uploadId, offset, r.Body)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	w.Header().Set(uploadOffsetHeader, strconv.FormatInt(received, 10))
+	writeJson(w, http.StatusOK, map[string]interface{}{"upload_id": uploadId, "offset": received})
+}
+
+func (d *DocumentUploadHandler) completeUpload(w http.ResponseWriter, r *http.Request, uploadId string) {
+	job, err := d.svc.CompleteUpload(r.Context(), uploadId)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusAccepted, job)
+}
+
+func (d *DocumentUploadHandler) abortUpload(w http.ResponseWriter, r *http.Request, uploadId string) {
+	if err := d.svc.AbortUpload(r.Context(), uploadId); err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]string{"upload_id": uploadId})
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"ditto/pkg/svc"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// pollTokenHeader carries the token a device polls its enrollment with.
+const pollTokenHeader = "X-Poll-Token"
+
+const maxEnrollmentBytes = 64 << 10
+
+type EnrollmentHandler struct {
+	svc    *svc.EnrollmentSvc
+	prefix string
+}
+
+// NewEnrollmentHandler serves the device enrollment endpoints mounted at prefix, which must end with a slash.
+// They are called by devices that don't have credentials yet, so they must not be mounted behind AuthHandler.
+func NewEnrollmentHandler(enrollmentSvc *svc.EnrollmentSvc, prefix string) *EnrollmentHandler {
+	return &EnrollmentHandler{svc: enrollmentSvc, prefix: prefix}
+}
+
+// ServeHTTP routes
+//
+//	POST   {prefix}
+//	GET    {prefix}{enrollment_id}
+func (h *EnrollmentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, h.prefix), "/"), "/")
+	switch {
+	case parts[0] == "" && r.Method == http.MethodPost:
+		h.requestEnrollment(w, r)
+	case len(parts) == 1 && parts[0] != "" && r.Method == http.MethodGet:
+		h.pollEnrollment(w, r, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %v %v", r.Method, r.URL.Path))
+	}
+}
+
+// requestEnrollment takes {"serial_number": "", "product_number": "", "name": "", "csr": ""} and responds with the
+// claim code to display and the poll token, neither of which can be read back later.
+func (h *EnrollmentHandler) requestEnrollment(w http.ResponseWriter, r *http.Request) {
+	request := &svc.EnrollmentRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEnrollmentBytes)).Decode(request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	enrollment, err := h.svc.RequestEnrollment(r.Context(), request)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusCreated, enrollment)
+}
+
+func (h *EnrollmentHandler) pollEnrollment(w http.ResponseWriter, r *http.Request, enrollmentId string) {
+	enrollment, err := h.svc.PollEnrollment(r.Context(), enrollmentId, r.Header.Get(pollTokenHeader))
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, enrollment)
+}
+
+// ClaimDevice serves POST {"claim_code": ""}, binding the device displaying the code to the caller's account.
+func (h *EnrollmentHandler) ClaimDevice(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	request := struct {
+		ClaimCode string `json:"claim_code"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	enrollment, err := h.svc.ClaimDevice(r.Context(), request.ClaimCode)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, enrollment)
+}
+
+// DeviceHeartbeat serves POST from devices authenticated by their client certificate.
+func (h *EnrollmentHandler) DeviceHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	if err := h.svc.DeviceHeartbeat(r.Context()); err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RenewCertificate serves POST {"csr": ""} from devices authenticated by their client certificate, responding with
+// a new certificate for the key in csr.
+func (h *EnrollmentHandler) RenewCertificate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	request := struct {
+		Csr string `json:"csr"`
+	}{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEnrollmentBytes)).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	renewed, err := h.svc.RenewCertificate(r.Context(), request.Csr)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, renewed)
+}
+
+type DeviceCertificateHandler struct {
+	svc    *svc.EnrollmentSvc
+	prefix string
+}
+
+// NewDeviceCertificateHandler serves the device certificate endpoints mounted at prefix, which must end with a slash.
+func NewDeviceCertificateHandler(enrollmentSvc *svc.EnrollmentSvc, prefix string) *DeviceCertificateHandler {
+	return &DeviceCertificateHandler{svc: enrollmentSvc, prefix: prefix}
+}
+
+// ServeHTTP routes
+//
+//	GET      {prefix}?printer_id=
+//	DELETE   {prefix}{serial}
+func (h *DeviceCertificateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, h.prefix), "/"), "/")
+	switch {
+	case parts[0] == "" && r.Method == http.MethodGet:
+		h.listCertificates(w, r)
+	case len(parts) == 1 && parts[0] != "" && r.Method == http.MethodDelete:
+		h.revokeCertificate(w, r, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %v %v", r.Method, r.URL.Path))
+	}
+}
+
+func (h *DeviceCertificateHandler) listCertificates(w http.ResponseWriter, r *http.Request) {
+	printerId := r.URL.Query().Get("printer_id")
+	if printerId == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("printer_id is required"))
+		return
+	}
+	certificates, err := h.svc.ListCertificates(r.Context(), printerId)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"certificates": certificates})
+}
+
+func (h *DeviceCertificateHandler) revokeCertificate(w http.ResponseWriter, r *http.Request, serial string) {
+	if err := h.svc.RevokeCertificate(r.Context(), serial); err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]string{"serial": serial})
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"ditto/pkg/apierr"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// errorMarshaler renders statuses the way the gateway renders the errors of rpcs.
+var errorMarshaler = &runtime.JSONPb{OrigName: true}
+
+// fallbackErrorBody is written when a status can't be marshalled.
+const fallbackErrorBody = `{"code": 13, "message": "failed to marshal error message"}`
+
+// httpCodes are the grpc codes of the errors handlers write with an http status of their choosing.
+var httpCodes = map[int]codes.Code{
+	http.StatusBadRequest:       codes.InvalidArgument,
+	http.StatusUnauthorized:     codes.Unauthenticated,
+	http.StatusForbidden:        codes.PermissionDenied,
+	http.StatusNotFound:         codes.NotFound,
+	http.StatusMethodNotAllowed: codes.Unimplemented,
+	http.StatusConflict:         codes.AlreadyExists,
+	http.StatusTooManyRequests:  codes.ResourceExhausted,
+}
+
+// WriteStatusError writes err the way the gateway writes the errors of rpcs, for the handlers wrapping the ones of
+// this package.
+func WriteStatusError(w http.ResponseWriter, err error) {
+	writeStatusError(w, err)
+}
+
+// writeStatusError maps the grpc status carried by err to the http status the gateway would have used. Errors without
+// a status are mapped by apierr.FromStorage.
+func writeStatusError(w http.ResponseWriter, err error) {
+	s := status.Convert(apierr.FromStorage(err, "resource", ""))
+	writeStatus(w, runtime.HTTPStatusFromCode(s.Code()), s)
+}
+
+// writeError writes err with the http status code. Errors without a grpc status get the code matching the http
+// status, server errors are mapped by apierr.FromStorage.
+func writeError(w http.ResponseWriter, code int, err error) {
+	if _, ok := status.FromError(err); !ok {
+		if grpcCode, ok := httpCodes[code]; ok {
+			err = status.Error(grpcCode, err.Error())
+		} else {
+			err = apierr.FromStorage(err, "resource", "")
+		}
+	}
+	writeStatus(w, code, status.Convert(err))
+}
+
+// writeStatus writes s as its JSON body, e.g. {"code": 5, "message": "printer p1 not found", "details": [...]}.
+// Statuses asking clients to retry later set Retry-After too.
+func writeStatus(w http.ResponseWriter, code int, s *status.Status) {
+	w.Header().Set("Content-Type", errorMarshaler.ContentType())
+	if retryDelay, ok := apierr.RetryDelay(s); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryDelay.Seconds()))))
+	}
+	body, err := errorMarshaler.Marshal(s.Proto())
+	if err != nil {
+		logrus.Errorf("An error %v occurred while marshalling the error %v", err, s.Err())
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, fallbackErrorBody)
+		return
+	}
+	w.WriteHeader(code)
+	w.Write(body)
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"ditto/pkg/apierr"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// errorBody is the JSON rendering of a grpc status.
+type errorBody struct {
+	Code    codes.Code        `json:"code"`
+	Message string            `json:"message"`
+	Details []json.RawMessage `json:"details"`
+}
+
+func TestWriteErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		write      func(w http.ResponseWriter)
+		httpStatus int
+		code       codes.Code
+		message    string
+		details    int
+		retryAfter string
+	}{
+		{name: "status",
+			write:      func(w http.ResponseWriter) { writeStatusError(w, apierr.NotFound("printer", "p1")) },
+			httpStatus: http.StatusNotFound, code: codes.NotFound, message: "printer p1 not found", details: 1},
+		{name: "retry later",
+			write: func(w http.ResponseWriter) {
+				writeStatusError(w, apierr.ResourceExhausted("slow down", 1500*time.Millisecond))
+			},
+			httpStatus: http.StatusTooManyRequests, code: codes.ResourceExhausted, message: "slow down", details: 1, retryAfter: "2"},
+		{name: "storage error",
+			write:      func(w http.ResponseWriter) { writeStatusError(w, gorm.ErrRecordNotFound) },
+			httpStatus: http.StatusNotFound, code: codes.NotFound, message: "resource not found", details: 1},
+		{name: "internal error",
+			write: func(w http.ResponseWriter) {
+				writeStatusError(w, errors.New("dial tcp 10.0.0.5:3306: connection refused"))
+			},
+			httpStatus: http.StatusInternalServerError, code: codes.Internal, message: "internal error"},
+		{name: "bad request",
+			write:      func(w http.ResponseWriter) { writeError(w, http.StatusBadRequest, errors.New("invalid dry_run x")) },
+			httpStatus: http.StatusBadRequest, code: codes.InvalidArgument, message: "invalid dry_run x"},
+		{name: "method not allowed",
+			write: func(w http.ResponseWriter) {
+				writeError(w, http.StatusMethodNotAllowed, errors.New("method PUT not allowed"))
+			},
+			httpStatus: http.StatusMethodNotAllowed, code: codes.Unimplemented, message: "method PUT not allowed"},
+		{name: "server error",
+			write: func(w http.ResponseWriter) {
+				writeError(w, http.StatusInternalServerError, errors.New("json: unsupported value"))
+			},
+			httpStatus: http.StatusInternalServerError, code: codes.Internal, message: "internal error"},
+		{name: "status with an http status of its own",
+			write: func(w http.ResponseWriter) {
+				writeError(w, http.StatusBadRequest, status.Error(codes.FailedPrecondition, "printer p1 is deleted"))
+			},
+			httpStatus: http.StatusBadRequest, code: codes.FailedPrecondition, message: "printer p1 is deleted"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			test.write(recorder)
+			if recorder.Code != test.httpStatus {
+				t.Errorf("wrote http status %d, want %d", recorder.Code, test.httpStatus)
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("wrote Content-Type %q, want application/json", contentType)
+			}
+			if retryAfter := recorder.Header().Get("Retry-After"); retryAfter != test.retryAfter {
+				t.Errorf("wrote Retry-After %q, want %q", retryAfter, test.retryAfter)
+			}
+			body := errorBody{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("wrote %q: %v", recorder.Body.String(), err)
+			}
+			if body.Code != test.code || body.Message != test.message || len(body.Details) != test.details {
+				t.Errorf("wrote %s, want code %d, message %q and %d details", recorder.Body.String(), test.code, test.message, test.details)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"ditto/pkg/domain"
+	"encoding/json"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	ditto "github.com/kutty-kumar/ho_oh/ditto_v1"
+	"net/http"
+)
+
+var dtoMarshaler = jsonpb.Marshaler{OrigName: true}
+
+func writeJson(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeProto renders message the way the gateway renders its responses.
+func writeProto(w http.ResponseWriter, code int, message proto.Message) {
+	body, err := dtoMarshaler.MarshalToString(message)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, code, json.RawMessage(body))
+}
+
+// printerJson renders the printer the same way the gateway renders a PrinterDto.
+func printerJson(printer *domain.Printer) (json.RawMessage, error) {
+	dto := printer.ToDto().(ditto.PrinterDto)
+	printerJson, err := dtoMarshaler.MarshalToString(&dto)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(printerJson), nil
+}
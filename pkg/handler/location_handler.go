@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"ditto/pkg/domain"
+	"ditto/pkg/svc"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type locatedPrinterResponse struct {
+	Printer        json.RawMessage     `json:"printer"`
+	LocationId     string              `json:"location_id,omitempty"`
+	Location       *domain.LocationDto `json:"location,omitempty"`
+	DistanceMeters *float64            `json:"distance_meters,omitempty"`
+}
+
+type LocationHandler struct {
+	svc    *svc.LocationSvc
+	prefix string
+}
+
+// NewLocationHandler serves the location endpoints mounted at prefix, which must end with a slash.
+func NewLocationHandler(locationSvc *svc.LocationSvc, prefix string) *LocationHandler {
+	return &LocationHandler{svc: locationSvc, prefix: prefix}
+}
+
+// ServeHTTP routes
+//
+//	GET, POST            {prefix}
+//	GET, PATCH, DELETE   {prefix}{location_id}
+//	GET                  {prefix}{location_id}/printers
+func (l *LocationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, l.prefix), "/"), "/")
+	switch {
+	case parts[0] == "" && r.Method == http.MethodGet:
+		l.listLocations(w, r)
+	case parts[0] == "" && r.Method == http.MethodPost:
+		l.createLocation(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		l.getLocation(w, r, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodPatch:
+		l.updateLocation(w, r, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		l.deleteLocation(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "printers" && r.Method == http.MethodGet:
+		l.getPrintersInLocation(w, r, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %v %v", r.Method, r.URL.Path))
+	}
+}
+
+func (l *LocationHandler) listLocations(w http.ResponseWriter, r *http.Request) {
+	locations, err := l.svc.ListLocations(r.Context(), r.URL.Query().Get("parent_id"))
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"locations": locations})
+}
+
+func (l *LocationHandler) createLocation(w http.ResponseWriter, r *http.Request) {
+	dto := &domain.LocationDto{}
+	if err := json.NewDecoder(r.Body).Decode(dto); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	created, err := l.svc.CreateLocation(r.Context(), dto)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, created)
+}
+
+func (l *LocationHandler) getLocation(w http.ResponseWriter, r *http.Request, locationId string) {
+	location, err := l.svc.GetLocation(r.Context(), locationId)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, location)
+}
+
+func (l *LocationHandler) updateLocation(w http.ResponseWriter, r *http.Request, locationId string) {
+	dto := &domain.LocationDto{}
+	if err := json.NewDecoder(r.Body).Decode(dto); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	updated, err := l.svc.UpdateLocation(r.Context(), locationId, dto)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, updated)
+}
+
+func (l *LocationHandler) deleteLocation(w http.ResponseWriter, r *http.Request, locationId string) {
+	if err := l.svc.DeleteLocation(r.Context(), locationId); err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]string{"external_id": locationId})
+}
+
+func (l *LocationHandler) getPrintersInLocation(w http.ResponseWriter, r *http.Request, locationId string) {
+	printers, err := l.svc.GetPrintersInLocation(r.Context(), locationId)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	response := make([]locatedPrinterResponse, 0, len(printers))
+	for i := range printers {
+		printer, err := printerJson(&printers[i])
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		response = append(response, locatedPrinterResponse{Printer: printer, LocationId: printers[i].LocationId})
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"printers": response})
+}
+
+// GetPrintersNear serves GET ?latitude=&longitude=&radius_meters=&limit=
+func (l *LocationHandler) GetPrintersNear(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	params := r.URL.Query()
+	var values [3]float64
+	for i, name := range []string{"latitude", "longitude", "radius_meters"} {
+		value, err := strconv.ParseFloat(params.Get(name), 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %v: %v", name, err))
+			return
+		}
+		values[i] = value
+	}
+	limit, err := intParam(params.Get("limit"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %v", err))
+		return
+	}
+	nearby, err := l.svc.GetPrintersNear(r.Context(), values[0], values[1], values[2], limit)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	response := make([]locatedPrinterResponse, 0, len(nearby))
+	for i := range nearby {
+		printer, err := printerJson(&nearby[i].Printer)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		location := nearby[i].Location.ToDto().(domain.LocationDto)
+		response = append(response, locatedPrinterResponse{
+			Printer:        printer,
+			LocationId:     nearby[i].Printer.LocationId,
+			Location:       &location,
+			DistanceMeters: &nearby[i].DistanceMeters,
+		})
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"printers": response})
+}
+
+// AssignPrinter serves POST {"printer_id": "", "location_id": ""}, an empty location id unassigns the printer.
+func (l *LocationHandler) AssignPrinter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	request := struct {
+		PrinterId  string `json:"printer_id"`
+		LocationId string `json:"location_id"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	printer, err := l.svc.AssignPrinter(r.Context(), request.PrinterId, request.LocationId)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	printerBody, err := printerJson(printer)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, http.StatusOK, locatedPrinterResponse{Printer: printerBody, LocationId: printer.LocationId})
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"ditto/pkg/domain"
+	"ditto/pkg/svc"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// contentSha256Header carries the hex SHA-256 digest of a document.
+const contentSha256Header = "X-Content-Sha256"
+
+type PrintJobHandler struct {
+	svc         *svc.PrintJobSvc
+	documentSvc *svc.PrintDocumentSvc
+	prefix      string
+}
+
+// NewPrintJobHandler serves the print job endpoints mounted at prefix, which must end with a slash.
+func NewPrintJobHandler(jobSvc *svc.PrintJobSvc, documentSvc *svc.PrintDocumentSvc, prefix string) *PrintJobHandler {
+	return &PrintJobHandler{svc: jobSvc, documentSvc: documentSvc, prefix: prefix}
+}
+
+// ServeHTTP routes
+//
+//	GET, POST   {prefix}
+//	GET         {prefix}{job_id}
+//	GET, PUT    {prefix}{job_id}/document
+func (p *PrintJobHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, p.prefix), "/"), "/")
+	switch {
+	case parts[0] == "" && r.Method == http.MethodGet:
+		p.listJobs(w, r)
+	case parts[0] == "" && r.Method == http.MethodPost:
+		p.submitJob(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		p.getJob(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "document" && r.Method == http.MethodPut:
+		p.uploadDocument(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "document" && r.Method == http.MethodGet:
+		p.getDocument(w, r, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %v %v", r.Method, r.URL.Path))
+	}
+}
+
+func (p *PrintJobHandler) listJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := p.svc.ListJobs(r.Context())
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"jobs": jobs})
+}
+
+func (p *PrintJobHandler) submitJob(w http.ResponseWriter, r *http.Request) {
+	dto := &domain.PrintJobDto{}
+	if err := json.NewDecoder(r.Body).Decode(dto); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	job, err := p.svc.SubmitJob(r.Context(), dto)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, job)
+}
+
+func (p *PrintJobHandler) getJob(w http.ResponseWriter, r *http.Request, jobId string) {
+	job, err := p.svc.GetJob(r.Context(), jobId)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, job)
+}
+
+// uploadDocument takes the raw document as the body, its Content-Type naming the document format. An optional
+// X-Content-Sha256 header carries the hex SHA-256 digest the document must match.
+func (p *PrintJobHandler) uploadDocument(w http.ResponseWriter, r *http.Request, jobId string) {
+	format, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid content type: %v", err))
+		return
+	}
+	job, err := p.documentSvc.UploadDocument(r.Context(), jobId, format, r.Header.Get(contentSha256Header), r.Body)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusAccepted, job)
+}
+
+// getDocument serves ?kind=source|print, the converted document by default.
+func (p *PrintJobHandler) getDocument(w http.ResponseWriter, r *http.Request, jobId string) {
+	kind := r.URL.Query().Get("kind")
+	if kind == "" {
+		kind = domain.DocumentKindPrint
+	}
+	document, content, err := p.documentSvc.OpenDocument(r.Context(), jobId, kind)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	defer content.Close()
+	w.Header().Set("Content-Type", document.Format)
+	w.Header().Set("Content-Length", strconv.FormatInt(document.Size, 10))
+	w.Header().Set(contentSha256Header, document.Digest)
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, content)
+}
+
+// Heartbeat serves POST {"printer_id": ""}, marking the printer online for job routing.
+func (p *PrintJobHandler) Heartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	request := struct {
+		PrinterId string `json:"printer_id"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := p.svc.Heartbeat(r.Context(), request.PrinterId); err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]string{"printer_id": request.PrinterId})
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"ditto/pkg/domain"
+	"ditto/pkg/svc"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type PrinterGroupHandler struct {
+	svc    *svc.PrinterGroupSvc
+	prefix string
+}
+
+// NewPrinterGroupHandler serves the printer group endpoints mounted at prefix, which must end with a slash.
+func NewPrinterGroupHandler(groupSvc *svc.PrinterGroupSvc, prefix string) *PrinterGroupHandler {
+	return &PrinterGroupHandler{svc: groupSvc, prefix: prefix}
+}
+
+// ServeHTTP routes
+//
+//	GET, POST            {prefix}
+//	GET, PATCH, DELETE   {prefix}{group_id}
+//	GET, POST            {prefix}{group_id}/members
+//	DELETE               {prefix}{group_id}/members/{printer_id}
+func (p *PrinterGroupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, p.prefix), "/"), "/")
+	switch {
+	case parts[0] == "" && r.Method == http.MethodGet:
+		p.listGroups(w, r)
+	case parts[0] == "" && r.Method == http.MethodPost:
+		p.createGroup(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		p.getGroup(w, r, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodPatch:
+		p.updateGroup(w, r, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		p.deleteGroup(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "members" && r.Method == http.MethodGet:
+		p.getMembers(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "members" && r.Method == http.MethodPost:
+		p.addMember(w, r, parts[0])
+	case len(parts) == 3 && parts[1] == "members" && r.Method == http.MethodDelete:
+		p.removeMember(w, r, parts[0], parts[2])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %v %v", r.Method, r.URL.Path))
+	}
+}
+
+func (p *PrinterGroupHandler) listGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := p.svc.ListGroups(r.Context())
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"groups": groups})
+}
+
+func (p *PrinterGroupHandler) createGroup(w http.ResponseWriter, r *http.Request) {
+	dto := &domain.PrinterGroupDto{}
+	if err := json.NewDecoder(r.Body).Decode(dto); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	created, err := p.svc.CreateGroup(r.Context(), dto)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, created)
+}
+
+func (p *PrinterGroupHandler) getGroup(w http.ResponseWriter, r *http.Request, groupId string) {
+	group, err := p.svc.GetGroup(r.Context(), groupId)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, group)
+}
+
+func (p *PrinterGroupHandler) updateGroup(w http.ResponseWriter, r *http.Request, groupId string) {
+	dto := &domain.PrinterGroupDto{}
+	if err := json.NewDecoder(r.Body).Decode(dto); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	updated, err := p.svc.UpdateGroup(r.Context(), groupId, dto)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, updated)
+}
+
+func (p *PrinterGroupHandler) deleteGroup(w http.ResponseWriter, r *http.Request, groupId string) {
+	if err := p.svc.DeleteGroup(r.Context(), groupId); err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]string{"external_id": groupId})
+}
+
+func (p *PrinterGroupHandler) getMembers(w http.ResponseWriter, r *http.Request, groupId string) {
+	members, err := p.svc.GetMembers(r.Context(), groupId)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	response := make([]json.RawMessage, 0, len(members))
+	for i := range members {
+		printer, err := printerJson(&members[i])
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		response = append(response, printer)
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"printers": response})
+}
+
+func (p *PrinterGroupHandler) addMember(w http.ResponseWriter, r *http.Request, groupId string) {
+	request := struct {
+		PrinterId string `json:"printer_id"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := p.svc.AddMember(r.Context(), groupId, request.PrinterId); err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]string{"group_id": groupId, "printer_id": request.PrinterId})
+}
+
+func (p *PrinterGroupHandler) removeMember(w http.ResponseWriter, r *http.Request, groupId string, printerId string) {
+	if err := p.svc.RemoveMember(r.Context(), groupId, printerId); err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]string{"group_id": groupId, "printer_id": printerId})
+}
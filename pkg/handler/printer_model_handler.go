@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"ditto/pkg/domain"
+	"ditto/pkg/svc"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type printerCapabilitiesResponse struct {
+	Printer json.RawMessage         `json:"printer"`
+	Model   *domain.PrinterModelDto `json:"model"`
+}
+
+type PrinterModelHandler struct {
+	svc    *svc.PrinterModelSvc
+	prefix string
+}
+
+// NewPrinterModelHandler serves the printer model catalog endpoints mounted at prefix, which must end with a slash.
+func NewPrinterModelHandler(modelSvc *svc.PrinterModelSvc, prefix string) *PrinterModelHandler {
+	return &PrinterModelHandler{svc: modelSvc, prefix: prefix}
+}
+
+// ServeHTTP routes
+//
+//	GET, POST           {prefix}
+//	GET, PUT, DELETE    {prefix}{product_number}
+func (p *PrinterModelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, p.prefix), "/"), "/")
+	switch {
+	case parts[0] == "" && r.Method == http.MethodGet:
+		p.listModels(w, r)
+	case parts[0] == "" && r.Method == http.MethodPost:
+		p.createModel(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		p.getModel(w, r, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		p.updateModel(w, r, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		p.deleteModel(w, r, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %v %v", r.Method, r.URL.Path))
+	}
+}
+
+func (p *PrinterModelHandler) listModels(w http.ResponseWriter, r *http.Request) {
+	models, err := p.svc.ListModels(r.Context())
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"models": models})
+}
+
+func (p *PrinterModelHandler) createModel(w http.ResponseWriter, r *http.Request) {
+	dto := &domain.PrinterModelDto{}
+	if err := json.NewDecoder(r.Body).Decode(dto); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	created, err := p.svc.CreateModel(r.Context(), dto)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, created)
+}
+
+func (p *PrinterModelHandler) getModel(w http.ResponseWriter, r *http.Request, productNumber string) {
+	model, err := p.svc.GetModel(r.Context(), productNumber)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, model)
+}
+
+func (p *PrinterModelHandler) updateModel(w http.ResponseWriter, r *http.Request, productNumber string) {
+	dto := &domain.PrinterModelDto{}
+	if err := json.NewDecoder(r.Body).Decode(dto); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	updated, err := p.svc.UpdateModel(r.Context(), productNumber, dto)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, updated)
+}
+
+func (p *PrinterModelHandler) deleteModel(w http.ResponseWriter, r *http.Request, productNumber string) {
+	if err := p.svc.DeleteModel(r.Context(), productNumber); err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]string{"product_number": productNumber})
+}
+
+// GetCapabilities serves GET ?printer_id=&printer_id=, rendering each printer with the catalog entry of its model.
+func (p *PrinterModelHandler) GetCapabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	capabilities, err := p.svc.GetCapabilities(r.Context(), r.URL.Query()["printer_id"])
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	response := make([]printerCapabilitiesResponse, 0, len(capabilities))
+	for _, capability := range capabilities {
+		printer, err := printerJson(capability.Printer)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		response = append(response, printerCapabilitiesResponse{Printer: printer, Model: capability.Model})
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"printers": response})
+}
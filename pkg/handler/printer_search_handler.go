@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"ditto/pkg/domain"
+	"ditto/pkg/svc"
+	"encoding/json"
+	"fmt"
+	"github.com/kutty-kumar/ho_oh/core_v1"
+	"net/http"
+	"strconv"
+)
+
+type printerHitResponse struct {
+	Score   float64         `json:"score"`
+	Printer json.RawMessage `json:"printer"`
+}
+
+type PrinterSearchHandler struct {
+	svc *svc.PrinterSearchSvc
+}
+
+func NewPrinterSearchHandler(printerSearchSvc *svc.PrinterSearchSvc) *PrinterSearchHandler {
+	return &PrinterSearchHandler{svc: printerSearchSvc}
+}
+
+// SearchPrinters serves GET ?q=&product_number=&status=&owner=&location=&limit=&offset=, the facet parameters may be repeated.
+func (p *PrinterSearchHandler) SearchPrinters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	params := r.URL.Query()
+	query := domain.PrinterQuery{
+		Text:           params.Get("q"),
+		ProductNumbers: params["product_number"],
+		UserIds:        params["owner"],
+		LocationIds:    params["location"],
+	}
+	for _, name := range params["status"] {
+		value, ok := core_v1.Status_value[name]
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("unknown status %v", name))
+			return
+		}
+		query.Statuses = append(query.Statuses, int(value))
+	}
+	var err error
+	if query.Limit, err = intParam(params.Get("limit")); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %v", err))
+		return
+	}
+	if query.Offset, err = intParam(params.Get("offset")); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid offset: %v", err))
+		return
+	}
+
+	result, err := p.svc.SearchPrinters(r.Context(), query)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	hits := make([]printerHitResponse, 0, len(result.Hits))
+	for i := range result.Hits {
+		printer, err := printerJson(&result.Hits[i].Printer)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		hits = append(hits, printerHitResponse{Score: result.Hits[i].Score, Printer: printer})
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{
+		"total":  result.Total,
+		"hits":   hits,
+		"facets": result.Facets,
+	})
+}
+
+func intParam(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"ditto/pkg/svc"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type ReleaseHandler struct {
+	svc    *svc.ReleaseSvc
+	prefix string
+}
+
+// NewReleaseHandler serves the release credential endpoints mounted at prefix, which must end with a slash.
+func NewReleaseHandler(releaseSvc *svc.ReleaseSvc, prefix string) *ReleaseHandler {
+	return &ReleaseHandler{svc: releaseSvc, prefix: prefix}
+}
+
+// ServeHTTP routes
+//
+//	GET, PUT, DELETE   {prefix}
+//	GET, PUT, DELETE   {prefix}{user_id}
+//
+// the first managing the caller's own credential.
+func (h *ReleaseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, h.prefix), "/"), "/")
+	if len(parts) > 1 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %v %v", r.Method, r.URL.Path))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		h.getCredential(w, r, parts[0])
+	case http.MethodPut:
+		h.setCredential(w, r, parts[0])
+	case http.MethodDelete:
+		h.deleteCredential(w, r, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %v %v", r.Method, r.URL.Path))
+	}
+}
+
+func (h *ReleaseHandler) getCredential(w http.ResponseWriter, r *http.Request, userId string) {
+	credential, err := h.svc.GetCredential(r.Context(), userId)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, credential)
+}
+
+// setCredential takes {"pin": "", "badge_id": ""}, either may be left out.
+func (h *ReleaseHandler) setCredential(w http.ResponseWriter, r *http.Request, userId string) {
+	request := struct {
+		Pin     string `json:"pin"`
+		BadgeId string `json:"badge_id"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	credential, err := h.svc.SetCredential(r.Context(), userId, request.Pin, request.BadgeId)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, credential)
+}
+
+func (h *ReleaseHandler) deleteCredential(w http.ResponseWriter, r *http.Request, userId string) {
+	if err := h.svc.DeleteCredential(r.Context(), userId); err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]string{"user_id": userId})
+}
+
+// ReleaseJobs serves POST {"printer_id": "", "badge_id": ""} or {"printer_id": "", "user_id": "", "pin": ""},
+// responding with the jobs released at the printer.
+func (h *ReleaseHandler) ReleaseJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	request := &svc.ReleaseRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	jobs, err := h.svc.ReleaseJobs(r.Context(), request)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"jobs": jobs})
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"ditto/pkg/svc"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type TenantHandler struct {
+	svc    *svc.TenantSvc
+	prefix string
+}
+
+// NewTenantHandler serves the tenant admin endpoints mounted at prefix, which must end with a slash.
+func NewTenantHandler(tenantSvc *svc.TenantSvc, prefix string) *TenantHandler {
+	return &TenantHandler{svc: tenantSvc, prefix: prefix}
+}
+
+// ServeHTTP routes
+//
+//	GET, POST          {prefix}
+//	GET, PUT, DELETE   {prefix}{tenant_id}
+func (h *TenantHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, h.prefix), "/"), "/")
+	switch {
+	case parts[0] == "" && r.Method == http.MethodGet:
+		h.listTenants(w, r)
+	case parts[0] == "" && r.Method == http.MethodPost:
+		h.createTenant(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		h.getTenant(w, r, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		h.renameTenant(w, r, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		h.deleteTenant(w, r, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %v %v", r.Method, r.URL.Path))
+	}
+}
+
+func (h *TenantHandler) listTenants(w http.ResponseWriter, r *http.Request) {
+	tenants, err := h.svc.ListTenants(r.Context())
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"tenants": tenants})
+}
+
+// createTenant takes {"tenant_id": "", "name": ""}, tenant_id being what tokens name the tenant by.
+func (h *TenantHandler) createTenant(w http.ResponseWriter, r *http.Request) {
+	request := struct {
+		TenantId string `json:"tenant_id"`
+		Name     string `json:"name"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	tenant, err := h.svc.CreateTenant(r.Context(), request.TenantId, request.Name)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusCreated, tenant)
+}
+
+func (h *TenantHandler) getTenant(w http.ResponseWriter, r *http.Request, tenantId string) {
+	tenant, err := h.svc.GetTenant(r.Context(), tenantId)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, tenant)
+}
+
+// renameTenant takes {"name": ""}.
+func (h *TenantHandler) renameTenant(w http.ResponseWriter, r *http.Request, tenantId string) {
+	request := struct {
+		Name string `json:"name"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	tenant, err := h.svc.RenameTenant(r.Context(), tenantId, request.Name)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, tenant)
+}
+
+func (h *TenantHandler) deleteTenant(w http.ResponseWriter, r *http.Request, tenantId string) {
+	if err := h.svc.DeleteTenant(r.Context(), tenantId); err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]string{"tenant_id": tenantId})
+}
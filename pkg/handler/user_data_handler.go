@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"ditto/pkg/domain"
+	"ditto/pkg/svc"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// UserDataHandler serves the user data export and erasure endpoints over plain http, archives can't be expressed as
+// gateway responses.
+type UserDataHandler struct {
+	svc *svc.UserDataSvc
+}
+
+func NewUserDataHandler(userDataSvc *svc.UserDataSvc) *UserDataHandler {
+	return &UserDataHandler{svc: userDataSvc}
+}
+
+// ExportUserData writes the caller's data as json or, with ?format=zip, as a zip archive.
+func (u *UserDataHandler) ExportUserData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	format := r.URL.Query().Get("format")
+	archive, err := u.svc.ExportUserData(r.Context(), userId(r), format)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	if format == svc.ExportFormatZip {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"ditto-export.zip\"")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+// EraseUserData erases the caller's data and responds with the signed erasure receipt.
+func (u *UserDataHandler) EraseUserData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	receipt, err := u.svc.EraseUserData(r.Context(), userId(r))
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, receipt)
+}
+
+// VerifyReceipt serves POST with an erasure receipt as the body, responding with {"valid": true} when ditto issued it
+// and it wasn't tampered with.
+func (u *UserDataHandler) VerifyReceipt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	receipt := &domain.ErasureReceipt{}
+	if err := json.NewDecoder(r.Body).Decode(receipt); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]bool{"valid": u.svc.VerifyReceipt(receipt)})
+}
+
+func userId(r *http.Request) string {
+	user, ok := r.Context().Value("user").(map[string]string)
+	if !ok {
+		return ""
+	}
+	return user["user_id"]
+}
@@ -0,0 +1,143 @@
+package interceptor
+
+import (
+	"context"
+	"crypto/sha256"
+	"ditto/pkg/apierr"
+	"ditto/pkg/domain"
+	"ditto/pkg/repository"
+	"encoding/hex"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"reflect"
+	"time"
+)
+
+// IdempotencyKeyHeader carries the client chosen key, the gateway forwards the http header of the same name.
+const IdempotencyKeyHeader = "idempotency-key"
+
+// idempotencyWriteTimeout bounds the release of a key or the storing of a response, which run once the call is
+// done and so must not depend on the call's context, canceled as soon as the client goes away.
+const idempotencyWriteTimeout = 5 * time.Second
+
+// IdempotencyUnaryServerInterceptor replays the stored response of the first successful call made with a given
+// idempotency key for the same principal and method, as long as it hasn't expired. A key reused with a different
+// payload is rejected. A call holds its key for lease, so the key of a call that never finished, e.g. as the server
+// crashed, can be taken over by a retry once lease has passed. Only the given unary methods honour the key, and the
+// interceptor must run after authentication. The http batch and bulk endpoints are served outside of grpc and ignore
+// the key.
+func IdempotencyUnaryServerInterceptor(repository repository.IdempotencyRepository, logger *logrus.Logger, ttl time.Duration, lease time.Duration, methods ...string) grpc.UnaryServerInterceptor {
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	if lease <= 0 {
+		lease = time.Minute
+	}
+	idempotentMethods := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		idempotentMethods[method] = true
+	}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !idempotentMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		key := idempotencyKey(ctx)
+		message, ok := req.(proto.Message)
+		if key == "" || !ok {
+			return handler(ctx, req)
+		}
+		user, _ := ctx.Value("user").(map[string]string)
+		requestHash, err := hashRequest(message)
+		if err != nil {
+			return nil, apierr.Internal(fmt.Errorf("hashing request: %v", err))
+		}
+		record, reserved, err := repository.Reserve(ctx, &domain.IdempotencyRecord{
+			Principal:   user["user_id"],
+			Method:      info.FullMethod,
+			Key:         key,
+			RequestHash: requestHash,
+			ExpiresAt:   time.Now().Add(lease),
+		})
+		if err != nil {
+			return nil, apierr.Internal(fmt.Errorf("reserving idempotency key %v: %v", key, err))
+		}
+		if !reserved {
+			return replay(record, requestHash)
+		}
+
+		resp, err := handler(ctx, req)
+		// the record is written even when the call was cancelled, as the caller so that it stays in the caller's tenant
+		writeCtx, cancel := context.WithTimeout(context.WithValue(context.Background(), "user", ctx.Value("user")), idempotencyWriteTimeout)
+		defer cancel()
+		if err != nil {
+			if releaseErr := repository.Release(writeCtx, record); releaseErr != nil {
+				logger.Errorf("An error %v occurred while releasing idempotency key %v", releaseErr, key)
+			}
+			return resp, err
+		}
+		record.ExpiresAt = time.Now().Add(ttl)
+		if err := store(writeCtx, repository, record, resp); err != nil {
+			logger.Errorf("An error %v occurred while storing the response for idempotency key %v", err, key)
+		}
+		return resp, nil
+	}
+}
+
+func idempotencyKey(ctx context.Context) string {
+	headers, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := headers.Get(IdempotencyKeyHeader)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func hashRequest(message proto.Message) (string, error) {
+	buffer := proto.NewBuffer(nil)
+	buffer.SetDeterministic(true)
+	if err := buffer.Marshal(message); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buffer.Bytes())
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func replay(record *domain.IdempotencyRecord, requestHash string) (interface{}, error) {
+	if record.RequestHash != requestHash {
+		return nil, status.Errorf(codes.FailedPrecondition, "idempotency key %v was already used with a different request", record.Key)
+	}
+	if !record.Completed {
+		return nil, status.Errorf(codes.Aborted, "a request with idempotency key %v is still in progress", record.Key)
+	}
+	responseType := proto.MessageType(record.ResponseType)
+	if responseType == nil {
+		return nil, apierr.Internal(fmt.Errorf("unknown response type %v", record.ResponseType))
+	}
+	response := reflect.New(responseType.Elem()).Interface().(proto.Message)
+	if err := proto.Unmarshal(record.Response, response); err != nil {
+		return nil, apierr.Internal(fmt.Errorf("decoding stored response: %v", err))
+	}
+	return response, nil
+}
+
+func store(ctx context.Context, repository repository.IdempotencyRepository, record *domain.IdempotencyRecord, resp interface{}) error {
+	message, ok := resp.(proto.Message)
+	if !ok {
+		return repository.Release(ctx, record)
+	}
+	response, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+	record.ResponseType = proto.MessageName(message)
+	record.Response = response
+	return repository.Complete(ctx, record)
+}
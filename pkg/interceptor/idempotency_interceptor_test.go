@@ -0,0 +1,184 @@
+package interceptor
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	ditto "github.com/kutty-kumar/ho_oh/ditto_v1"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const createPrinter = "/ditto_v1.PrinterService/CreatePrinter"
+
+// memoryIdempotencyRepository keeps idempotency records in memory, by principal, method and key.
+type memoryIdempotencyRepository struct {
+	mu      sync.Mutex
+	records map[string]domain.IdempotencyRecord
+}
+
+func newMemoryIdempotencyRepository() *memoryIdempotencyRepository {
+	return &memoryIdempotencyRepository{records: map[string]domain.IdempotencyRecord{}}
+}
+
+func recordId(record *domain.IdempotencyRecord) string {
+	return record.Principal + " " + record.Method + " " + record.Key
+}
+
+func (m *memoryIdempotencyRepository) Reserve(ctx context.Context, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.records[recordId(record)]; ok && !existing.Expired(time.Now()) {
+		return &existing, false, nil
+	}
+	m.records[recordId(record)] = *record
+	return record, true, nil
+}
+
+func (m *memoryIdempotencyRepository) Complete(ctx context.Context, record *domain.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record.Completed = true
+	m.records[recordId(record)] = *record
+	return nil
+}
+
+func (m *memoryIdempotencyRepository) Release(ctx context.Context, record *domain.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, recordId(record))
+	return nil
+}
+
+func (m *memoryIdempotencyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *memoryIdempotencyRepository) record(key string) (domain.IdempotencyRecord, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[recordId(&domain.IdempotencyRecord{Principal: "user-1", Method: createPrinter, Key: key})]
+	return record, ok
+}
+
+func idempotentContext(key string) context.Context {
+	ctx := context.WithValue(context.Background(), "user", map[string]string{"user_id": "user-1"})
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(IdempotencyKeyHeader, key))
+}
+
+func createRequest(name string) *ditto.CreatePrinterRequest {
+	return &ditto.CreatePrinterRequest{Request: &ditto.PrinterDto{Name: name}}
+}
+
+// countingHandler creates printers named after the request, counting its calls.
+type countingHandler struct {
+	calls int
+	err   error
+}
+
+func (c *countingHandler) handle(ctx context.Context, req interface{}) (interface{}, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &ditto.CreatePrinterResponse{Response: &ditto.PrinterDto{Name: req.(*ditto.CreatePrinterRequest).Request.Name}}, nil
+}
+
+func newTestIdempotencyInterceptor(repository *memoryIdempotencyRepository) grpc.UnaryServerInterceptor {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	return IdempotencyUnaryServerInterceptor(repository, logger, time.Hour, time.Minute, createPrinter)
+}
+
+func TestIdempotencyReplaysTheFirstResponse(t *testing.T) {
+	repository := newMemoryIdempotencyRepository()
+	intercept := newTestIdempotencyInterceptor(repository)
+	handler := &countingHandler{}
+	info := &grpc.UnaryServerInfo{FullMethod: createPrinter}
+
+	for i := 0; i < 2; i++ {
+		resp, err := intercept(idempotentContext("k1"), createRequest("printer-1"), info, handler.handle)
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		if name := resp.(*ditto.CreatePrinterResponse).Response.Name; name != "printer-1" {
+			t.Errorf("call %d returned printer %v, want printer-1", i, name)
+		}
+	}
+	if handler.calls != 1 {
+		t.Errorf("the handler ran %d times, want once", handler.calls)
+	}
+	record, _ := repository.record("k1")
+	if expiresIn := time.Until(record.ExpiresAt); !record.Completed || expiresIn < 59*time.Minute {
+		t.Errorf("the response is kept for %v, want the ttl of an hour", expiresIn)
+	}
+
+	if _, err := intercept(idempotentContext("k1"), createRequest("printer-2"), info, handler.handle); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("reusing the key with another request returned %v, want %v", err, codes.FailedPrecondition)
+	}
+	if _, err := intercept(idempotentContext("k2"), createRequest("printer-2"), info, handler.handle); err != nil || handler.calls != 2 {
+		t.Errorf("a call with another key returned %v after %d calls, want it handled", err, handler.calls)
+	}
+}
+
+func TestIdempotencyKeyInProgress(t *testing.T) {
+	repository := newMemoryIdempotencyRepository()
+	intercept := newTestIdempotencyInterceptor(repository)
+	info := &grpc.UnaryServerInfo{FullMethod: createPrinter}
+
+	var retryErr error
+	inProgress := func(ctx context.Context, req interface{}) (interface{}, error) {
+		record, _ := repository.record("k1")
+		if expiresIn := time.Until(record.ExpiresAt); record.Completed || expiresIn > time.Minute {
+			t.Errorf("the key is held for %v while the call runs, want the lease of a minute", expiresIn)
+		}
+		_, retryErr = intercept(idempotentContext("k1"), req, info, (&countingHandler{}).handle)
+		return (&countingHandler{}).handle(ctx, req)
+	}
+	if _, err := intercept(idempotentContext("k1"), createRequest("printer-1"), info, inProgress); err != nil {
+		t.Fatalf("CreatePrinter: %v", err)
+	}
+	if status.Code(retryErr) != codes.Aborted {
+		t.Errorf("a retry while the call runs returned %v, want %v", retryErr, codes.Aborted)
+	}
+}
+
+func TestIdempotencyKeyOfAnAbandonedCallIsTakenOver(t *testing.T) {
+	repository := newMemoryIdempotencyRepository()
+	intercept := newTestIdempotencyInterceptor(repository)
+	handler := &countingHandler{}
+	info := &grpc.UnaryServerInfo{FullMethod: createPrinter}
+	// a call that reserved the key and crashed before completing it, its lease lapsed
+	abandoned := &domain.IdempotencyRecord{Principal: "user-1", Method: createPrinter, Key: "k1", ExpiresAt: time.Now().Add(-time.Second)}
+	if _, _, err := repository.Reserve(context.Background(), abandoned); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if _, err := intercept(idempotentContext("k1"), createRequest("printer-1"), info, handler.handle); err != nil || handler.calls != 1 {
+		t.Errorf("a retry after the lease lapsed returned %v after %d calls, want it handled", err, handler.calls)
+	}
+}
+
+func TestIdempotencyKeyIsReleasedOnFailure(t *testing.T) {
+	repository := newMemoryIdempotencyRepository()
+	intercept := newTestIdempotencyInterceptor(repository)
+	handler := &countingHandler{err: errors.New("printer service unavailable")}
+	info := &grpc.UnaryServerInfo{FullMethod: createPrinter}
+	if _, err := intercept(idempotentContext("k1"), createRequest("printer-1"), info, handler.handle); err == nil {
+		t.Fatal("the failing call succeeded")
+	}
+	if _, ok := repository.record("k1"); ok {
+		t.Error("the key of a failed call is still held")
+	}
+	handler.err = nil
+	if _, err := intercept(idempotentContext("k1"), createRequest("printer-1"), info, handler.handle); err != nil || handler.calls != 2 {
+		t.Errorf("the retry of a failed call returned %v after %d calls, want it handled", err, handler.calls)
+	}
+}
@@ -0,0 +1,116 @@
+package interceptor
+
+import (
+	"context"
+	"ditto/pkg/apierr"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// RateLimiter throttles every caller with a token bucket of their own, refilled at a rate of requests per second up
+// to burst requests. Its limits can be changed while it is in use, a rate of zero lets every request through.
+type RateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{rate: rate, burst: burst, buckets: make(map[string]*bucket), swept: time.Now()}
+}
+
+// SetLimits changes the limits, callers keep the tokens they have left up to the new burst.
+func (r *RateLimiter) SetLimits(rate float64, burst int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rate, r.burst = rate, burst
+}
+
+// Allow takes a token from the caller's bucket, reporting false when it is empty.
+func (r *RateLimiter) Allow(caller string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rate <= 0 {
+		return true
+	}
+	r.sweep(now)
+	b, ok := r.buckets[caller]
+	if !ok {
+		b = &bucket{tokens: float64(r.burst), updated: now}
+		r.buckets[caller] = b
+	}
+	b.tokens += now.Sub(b.updated).Seconds() * r.rate
+	if b.tokens > float64(r.burst) {
+		b.tokens = float64(r.burst)
+	}
+	b.updated = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep forgets the buckets that refilled completely, once a minute at most.
+func (r *RateLimiter) sweep(now time.Time) {
+	if now.Sub(r.swept) < time.Minute {
+		return
+	}
+	refill := time.Duration(float64(r.burst) / r.rate * float64(time.Second))
+	for caller, b := range r.buckets {
+		if now.Sub(b.updated) >= refill {
+			delete(r.buckets, caller)
+		}
+	}
+	r.swept = now
+}
+
+// AllowCaller takes a token from the bucket of the caller ctx belongs to.
+func (r *RateLimiter) AllowCaller(ctx context.Context) bool {
+	return r.Allow(caller(ctx), time.Now())
+}
+
+// RetryDelay is how long a caller that ran out of tokens waits for the next one.
+func (r *RateLimiter) RetryDelay() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / r.rate)
+}
+
+// UnaryServerInterceptor rejects calls over the limit with ResourceExhausted, telling callers when to retry.
+// Authenticated callers are limited by user, others by address, so it must run after authentication.
+func (r *RateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !r.AllowCaller(ctx) {
+			return nil, apierr.ResourceExhausted("rate limit exceeded", r.RetryDelay())
+		}
+		return handler(ctx, req)
+	}
+}
+
+func caller(ctx context.Context) string {
+	if user, ok := ctx.Value("user").(map[string]string); ok && user["user_id"] != "" {
+		return "user:" + user["user_id"]
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return "addr:" + host
+		}
+		return "addr:" + p.Addr.String()
+	}
+	return ""
+}
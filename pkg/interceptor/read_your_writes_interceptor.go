@@ -0,0 +1,16 @@
+package interceptor
+
+import (
+	"context"
+	"ditto/pkg/repository"
+
+	"google.golang.org/grpc"
+)
+
+// ReadYourWritesUnaryServerInterceptor tracks the writes of every call, so that the reads a call makes after writing
+// go to the primary rather than to a replica that may not have caught up yet.
+func ReadYourWritesUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(repository.TrackWrites(ctx), req)
+	}
+}
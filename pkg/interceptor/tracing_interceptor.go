@@ -0,0 +1,79 @@
+package interceptor
+
+import (
+	"context"
+	"strings"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/logrus/ctxlogrus"
+	"github.com/infobloxopen/atlas-app-toolkit/requestid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelCodes "go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TracingUnaryServerInterceptor runs every call in a span, continuing the trace whose context the caller sent in the
+// metadata, the gateway forwarding it from the http headers. The span carries the request id and the call's log
+// entries the trace id, so the interceptor must follow the request id and logging interceptors.
+func TracingUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	tracer := otel.Tracer("ditto/pkg/interceptor")
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+		service, method := splitMethod(info.FullMethod)
+		ctx, span := tracer.Start(ctx, service+"/"+method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.RPCSystemKey.String("grpc"), semconv.RPCService(service), semconv.RPCMethod(method)),
+		)
+		defer span.End()
+		if id, ok := requestid.FromContext(ctx); ok {
+			span.SetAttributes(attribute.String("request_id", id))
+		}
+		ctxlogrus.AddFields(ctx, logrus.Fields{"trace_id": span.SpanContext().TraceID().String()})
+
+		resp, err := handler(ctx, req)
+		code := status.Code(err)
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+		if err != nil {
+			span.SetStatus(otelCodes.Error, status.Convert(err).Message())
+		}
+		return resp, err
+	}
+}
+
+// splitMethod splits /package.Service/Method into the service and the method.
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return fullMethod, ""
+}
+
+// metadataCarrier lets the propagator read trace context from grpc metadata.
+type metadataCarrier metadata.MD
+
+func (m metadataCarrier) Get(key string) string {
+	values := metadata.MD(m).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (m metadataCarrier) Set(key string, value string) {
+	metadata.MD(m).Set(key, value)
+}
+
+func (m metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
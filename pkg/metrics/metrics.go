@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"ditto/pkg/domain"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// PrintersCreated counts the printers created through the api by the grpc status of their creation.
+	PrintersCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "printers_created_total",
+		Help: "total number of printers created, by status",
+	}, []string{"status"})
+	// PrintersDeleted counts the printers deleted or purged through the api by the grpc status of their deletion, and
+	// the ones the retention worker purged.
+	PrintersDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "printers_deleted_total",
+		Help: "total number of printers deleted, by how and status",
+	}, []string{"operation", "status"})
+	// ActivePrinters is the number of active printers of every tenant, as of the last refresh of the MetricsWorker.
+	ActivePrinters = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "active_printers",
+		Help: "number of active printers, by tenant",
+	}, []string{"tenant"})
+	// PrintJobs counts the print jobs submitted and the ones that finished, by the state they were submitted in or
+	// finished in, held jobs that were never released finishing as expired.
+	PrintJobs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "print_jobs_total",
+		Help: "total number of print jobs submitted and finished, by state",
+	}, []string{"state"})
+	// RepositoryLatency is the time database statements take, by table and operation.
+	RepositoryLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "repository_query_duration_seconds",
+		Help:    "time taken by database statements, by table and operation",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"table", "operation"})
+)
+
+// Collectors are ditto's domain metrics.
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{PrintersCreated, PrintersDeleted, ActivePrinters, PrintJobs, RepositoryLatency}
+}
+
+// PrinterCreated counts a printer creation that ended with err.
+func PrinterCreated(err error) {
+	PrintersCreated.WithLabelValues(status.Code(err).String()).Inc()
+}
+
+// PrinterDeleted counts a printer deletion, operation being delete or purge, that ended with err.
+func PrinterDeleted(operation string, err error) {
+	PrintersDeleted.WithLabelValues(operation, status.Code(err).String()).Inc()
+}
+
+// JobEntered counts a print job entering state, when it is submitted or finishes.
+func JobEntered(state domain.JobState) {
+	PrintJobs.WithLabelValues(state.String()).Inc()
+}
@@ -0,0 +1,223 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// deviceUriPrefix prefixes the printer id in the URI SAN of device certificates.
+const deviceUriPrefix = "urn:ditto:printer:"
+
+var (
+	// ErrInvalidCsr is returned for certificate requests that don't parse, aren't self signed or use a weak key.
+	ErrInvalidCsr = errors.New("invalid certificate request")
+	// ErrNotDeviceCertificate is returned for client certificates that don't name a printer.
+	ErrNotDeviceCertificate = errors.New("not a device certificate")
+)
+
+// CertificateAuthority issues the client certificates devices authenticate with.
+type CertificateAuthority struct {
+	certificate *x509.Certificate
+	certPem     []byte
+	key         crypto.Signer
+}
+
+// LoadCertificateAuthority reads a CA from its PEM encoded certificate and PKCS#8, PKCS#1 or SEC 1 private key.
+func LoadCertificateAuthority(certPem []byte, keyPem []byte) (*CertificateAuthority, error) {
+	certBlock, _ := pem.Decode(certPem)
+	if certBlock == nil || certBlock.Type != "CERTIFICATE" {
+		return nil, errors.New("no certificate in CA certificate PEM")
+	}
+	certificate, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if !certificate.IsCA {
+		return nil, errors.New("CA certificate isn't a CA")
+	}
+	keyBlock, _ := pem.Decode(keyPem)
+	if keyBlock == nil {
+		return nil, errors.New("no key in CA key PEM")
+	}
+	key, err := parsePrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &CertificateAuthority{certificate: certificate, certPem: certPem, key: key}, nil
+}
+
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unsupported CA key")
+}
+
+// NewEphemeralCertificateAuthority generates a CA that lives as long as the process, certificates it issued stop
+// verifying on restart.
+func NewEphemeralCertificateAuthority() (*CertificateAuthority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "ditto device CA", Organization: []string{"ditto"}},
+		NotBefore:             time.Now().Add(-5 * time.Minute),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return &CertificateAuthority{certificate: certificate, certPem: certPem, key: key}, nil
+}
+
+// CertificatePem returns the PEM encoded CA certificate devices chain up to.
+func (c *CertificateAuthority) CertificatePem() []byte {
+	return c.certPem
+}
+
+// Pool returns a pool holding the CA certificate, for verifying client certificates.
+func (c *CertificateAuthority) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.certificate)
+	return pool
+}
+
+// IssuedCertificate is a device certificate along with the details kept to revoke it.
+type IssuedCertificate struct {
+	Pem      []byte
+	Serial   string
+	NotAfter time.Time
+}
+
+// IssueDeviceCertificate signs the public key of a PEM encoded certificate request into a client certificate for the
+// printer. The request's subject is ignored, the certificate names the printer in its common name and URI SAN.
+func (c *CertificateAuthority) IssueDeviceCertificate(csrPem []byte, printerId string, ttl time.Duration) (*IssuedCertificate, error) {
+	csr, err := ParseCertificateRequest(csrPem)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	uri, err := url.Parse(deviceUriPrefix + printerId)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	notAfter := now.Add(ttl)
+	if notAfter.After(c.certificate.NotAfter) {
+		notAfter = c.certificate.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: printerId, Organization: []string{"ditto devices"}},
+		URIs:         []*url.URL{uri},
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, c.certificate, csr.PublicKey, c.key)
+	if err != nil {
+		return nil, err
+	}
+	return &IssuedCertificate{
+		Pem:      pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Serial:   SerialString(serial),
+		NotAfter: notAfter,
+	}, nil
+}
+
+// ParseCertificateRequest parses a PEM encoded certificate request, checking its signature and key.
+func ParseCertificateRequest(csrPem []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(csrPem)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("%w: no certificate request in PEM", ErrInvalidCsr)
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCsr, err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCsr, err)
+	}
+	if err := checkKey(csr.PublicKey); err != nil {
+		return nil, err
+	}
+	return csr, nil
+}
+
+func checkKey(key interface{}) error {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < 2048 {
+			return fmt.Errorf("%w: RSA keys must have at least 2048 bits", ErrInvalidCsr)
+		}
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() && key.Curve != elliptic.P384() {
+			return fmt.Errorf("%w: ECDSA keys must use P-256 or P-384", ErrInvalidCsr)
+		}
+	case ed25519.PublicKey:
+	default:
+		return fmt.Errorf("%w: unsupported key type", ErrInvalidCsr)
+	}
+	return nil
+}
+
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// SerialString formats a certificate serial number the way it is stored.
+func SerialString(serial *big.Int) string {
+	return hex.EncodeToString(serial.Bytes())
+}
+
+// DevicePrinterId returns the printer a verified client certificate was issued to.
+func DevicePrinterId(certificate *x509.Certificate) (string, error) {
+	for _, uri := range certificate.URIs {
+		if value := uri.String(); strings.HasPrefix(value, deviceUriPrefix) {
+			return strings.TrimPrefix(value, deviceUriPrefix), nil
+		}
+	}
+	return "", ErrNotDeviceCertificate
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type ConnectorRepository interface {
+	CreateConnector(ctx context.Context, connector *domain.Connector) error
+	GetConnector(ctx context.Context, connectorId string) (*domain.Connector, error)
+	GetConnectorOfAnyTenant(ctx context.Context, connectorId string) (*domain.Connector, error)
+	GetConnectorsByUserId(ctx context.Context, userId string) ([]domain.Connector, error)
+	DeleteConnector(ctx context.Context, connectorId string) error
+	UpdateSecret(ctx context.Context, connectorId string, secretDigest string) error
+	TouchConnector(ctx context.Context, connectorId string, connectedAt time.Time) error
+	AttachPrinter(ctx context.Context, connectorId string, printerId string) error
+	GetPrinterIds(ctx context.Context, connectorId string) ([]string, error)
+	TouchPrinters(ctx context.Context, printerIds []string, seenAt time.Time) error
+	RecordTelemetry(ctx context.Context, connectorId string, printerId string, state string, telemetry string, reportedAt time.Time) error
+}
+
+func NewConnectorGORMRepository(db *gorm.DB) ConnectorRepository {
+	return &ConnectorGORMRepository{db: db}
+}
+
+type ConnectorGORMRepository struct {
+	db *gorm.DB
+}
+
+func (c *ConnectorGORMRepository) CreateConnector(ctx context.Context, connector *domain.Connector) error {
+	return c.db.WithContext(ctx).Create(connector).Error
+}
+
+func (c *ConnectorGORMRepository) GetConnector(ctx context.Context, connectorId string) (*domain.Connector, error) {
+	connector := &domain.Connector{}
+	if err := c.db.WithContext(ctx).Where("connector_id = ?", connectorId).First(connector).Error; err != nil {
+		return nil, err
+	}
+	return connector, nil
+}
+
+// GetConnectorOfAnyTenant looks up the connector a stream was opened as, whatever its tenant, to authenticate the
+// stream before its tenant is known.
+func (c *ConnectorGORMRepository) GetConnectorOfAnyTenant(ctx context.Context, connectorId string) (*domain.Connector, error) {
+	return c.GetConnector(withoutTenantScope(ctx), connectorId)
+}
+
+func (c *ConnectorGORMRepository) GetConnectorsByUserId(ctx context.Context, userId string) ([]domain.Connector, error) {
+	var connectors []domain.Connector
+	if err := c.db.WithContext(ctx).Where("user_id = ?", userId).Order("id").Find(&connectors).Error; err != nil {
+		return nil, err
+	}
+	return connectors, nil
+}
+
+// DeleteConnector removes the connector and detaches its printers, which stay with their owner.
+func (c *ConnectorGORMRepository) DeleteConnector(ctx context.Context, connectorId string) error {
+	return c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("connector_id = ?", connectorId).Delete(&domain.ConnectorPrinter{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("connector_id = ?", connectorId).Delete(&domain.Connector{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+func (c *ConnectorGORMRepository) UpdateSecret(ctx context.Context, connectorId string, secretDigest string) error {
+	result := c.db.WithContext(ctx).Model(&domain.Connector{}).Where("connector_id = ?", connectorId).Update("secret_digest", secretDigest)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (c *ConnectorGORMRepository) TouchConnector(ctx context.Context, connectorId string, connectedAt time.Time) error {
+	return c.db.WithContext(ctx).Model(&domain.Connector{}).Where("connector_id = ?", connectorId).Update("last_connected_at", connectedAt).Error
+}
+
+// AttachPrinter places the printer behind the connector, moving it away from any other connector.
+func (c *ConnectorGORMRepository) AttachPrinter(ctx context.Context, connectorId string, printerId string) error {
+	return c.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "printer_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"connector_id"}),
+	}).Create(&domain.ConnectorPrinter{ConnectorId: connectorId, PrinterId: printerId}).Error
+}
+
+func (c *ConnectorGORMRepository) GetPrinterIds(ctx context.Context, connectorId string) ([]string, error) {
+	var printerIds []string
+	if err := c.db.WithContext(ctx).Model(&domain.ConnectorPrinter{}).Where("connector_id = ?", connectorId).Pluck("printer_id", &printerIds).Error; err != nil {
+		return nil, err
+	}
+	return printerIds, nil
+}
+
+// TouchPrinters records that the printers were seen online at seenAt.
+func (c *ConnectorGORMRepository) TouchPrinters(ctx context.Context, printerIds []string, seenAt time.Time) error {
+	if len(printerIds) == 0 {
+		return nil
+	}
+	return c.db.WithContext(ctx).Model(&domain.Printer{}).Where("external_id IN (?)", printerIds).Update("last_seen_at", seenAt).Error
+}
+
+func (c *ConnectorGORMRepository) RecordTelemetry(ctx context.Context, connectorId string, printerId string, state string, telemetry string, reportedAt time.Time) error {
+	return c.db.WithContext(ctx).Model(&domain.ConnectorPrinter{}).
+		Where("connector_id = ? AND printer_id = ?", connectorId, printerId).
+		Updates(map[string]interface{}{"state": state, "telemetry": telemetry, "reported_at": reportedAt}).Error
+}
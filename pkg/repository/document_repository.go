@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"time"
+)
+
+// DocumentRepository tracks resumable uploads and the documents due to expire from the document store.
+type DocumentRepository interface {
+	CreateUpload(ctx context.Context, upload *domain.DocumentUpload) error
+	GetUpload(ctx context.Context, userId string, uploadId string) (*domain.DocumentUpload, error)
+	AppendChunk(ctx context.Context, uploadId string, chunk *domain.DocumentUploadChunk) (int64, error)
+	GetChunks(ctx context.Context, uploadId string) ([]domain.DocumentUploadChunk, error)
+	DeleteUpload(ctx context.Context, uploadId string) error
+	GetExpiredUploads(ctx context.Context, now time.Time, limit int) ([]domain.DocumentUpload, error)
+	GetExpiredDocuments(ctx context.Context, finishedBefore time.Time, limit int) ([]domain.PrintJobDocument, error)
+	DeleteDocument(ctx context.Context, id uint64) error
+	DigestReferenced(ctx context.Context, digest string) (bool, error)
+}
+
+func NewDocumentGORMRepository(db *gorm.DB) DocumentRepository {
+	return &DocumentGORMRepository{db: db}
+}
+
+type DocumentGORMRepository struct {
+	db *gorm.DB
+}
+
+func (d *DocumentGORMRepository) CreateUpload(ctx context.Context, upload *domain.DocumentUpload) error {
+	return d.db.WithContext(ctx).Create(upload).Error
+}
+
+func (d *DocumentGORMRepository) GetUpload(ctx context.Context, userId string, uploadId string) (*domain.DocumentUpload, error) {
+	upload := &domain.DocumentUpload{}
+	if err := d.db.WithContext(ctx).Where("upload_id = ? AND user_id = ?", uploadId, userId).First(upload).Error; err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// AppendChunk records the chunk at the end of the upload and returns the new offset. The chunk's position must match
+// the bytes received so far, so a chunk resent after a lost response is rejected rather than appended twice.
+func (d *DocumentGORMRepository) AppendChunk(ctx context.Context, uploadId string, chunk *domain.DocumentUploadChunk) (int64, error) {
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&domain.DocumentUpload{}).
+			Where("upload_id = ? AND received = ?", uploadId, chunk.Position).
+			Update("received", gorm.Expr("received + ?", chunk.Size))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return status.Errorf(codes.FailedPrecondition, "chunk offset %d doesn't match the upload", chunk.Position)
+		}
+		chunk.UploadId = uploadId
+		return tx.Create(chunk).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return chunk.Position + chunk.Size, nil
+}
+
+func (d *DocumentGORMRepository) GetChunks(ctx context.Context, uploadId string) ([]domain.DocumentUploadChunk, error) {
+	var chunks []domain.DocumentUploadChunk
+	if err := d.db.WithContext(ctx).Where("upload_id = ?", uploadId).Order("position").Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// DeleteUpload deletes an upload along with its chunks whatever its tenant, uploads are deleted once the caller is
+// done with them or once they expired.
+func (d *DocumentGORMRepository) DeleteUpload(ctx context.Context, uploadId string) error {
+	return d.db.WithContext(withoutTenantScope(ctx)).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("upload_id = ?", uploadId).Delete(&domain.DocumentUploadChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("upload_id = ?", uploadId).Delete(&domain.DocumentUpload{}).Error
+	})
+}
+
+func (d *DocumentGORMRepository) GetExpiredUploads(ctx context.Context, now time.Time, limit int) ([]domain.DocumentUpload, error) {
+	var uploads []domain.DocumentUpload
+	if err := d.db.WithContext(withoutTenantScope(ctx)).Where("expires_at <= ?", now).Limit(limit).Find(&uploads).Error; err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+// GetExpiredDocuments returns documents, of every tenant, whose job finished before finishedBefore or no longer exists.
+func (d *DocumentGORMRepository) GetExpiredDocuments(ctx context.Context, finishedBefore time.Time, limit int) ([]domain.PrintJobDocument, error) {
+	finished := []int{int(domain.JobStateCompleted), int(domain.JobStateFailed), int(domain.JobStateCanceled)}
+	var documents []domain.PrintJobDocument
+	db := d.db.WithContext(withoutTenantScope(ctx))
+	err := db.
+		Where("job_id NOT IN (?) OR job_id IN (?)",
+			db.Model(&domain.PrintJob{}).Select("external_id"),
+			db.Model(&domain.PrintJob{}).Select("external_id").Where("state IN (?) AND updated_at < ?", finished, finishedBefore)).
+		Limit(limit).
+		Find(&documents).Error
+	if err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+func (d *DocumentGORMRepository) DeleteDocument(ctx context.Context, id uint64) error {
+	return d.db.WithContext(ctx).Where("id = ?", id).Delete(&domain.PrintJobDocument{}).Error
+}
+
+// DigestReferenced reports whether any document or upload chunk still refers to the content with the given digest.
+func (d *DocumentGORMRepository) DigestReferenced(ctx context.Context, digest string) (bool, error) {
+	var documents, chunks int64
+	db := d.db.WithContext(ctx)
+	if err := db.Model(&domain.PrintJobDocument{}).Where("digest = ?", digest).Count(&documents).Error; err != nil {
+		return false, err
+	}
+	if err := db.Model(&domain.DocumentUploadChunk{}).Where("digest = ?", digest).Count(&chunks).Error; err != nil {
+		return false, err
+	}
+	return documents+chunks > 0, nil
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"gorm.io/gorm"
+	"time"
+)
+
+type EnrollmentRepository interface {
+	CreateEnrollment(ctx context.Context, enrollment *domain.DeviceEnrollment) error
+	GetEnrollment(ctx context.Context, enrollmentId string) (*domain.DeviceEnrollment, error)
+	GetPendingEnrollmentByClaimCode(ctx context.Context, claimCode string, now time.Time) (*domain.DeviceEnrollment, error)
+	ClaimEnrollment(ctx context.Context, enrollmentId string, userId string) (bool, error)
+	ReleaseEnrollment(ctx context.Context, enrollmentId string) error
+	CompleteEnrollment(ctx context.Context, enrollment *domain.DeviceEnrollment, certificate *domain.DeviceCertificate) error
+	DeleteExpiredEnrollments(ctx context.Context, now time.Time) (int64, error)
+	CreateCertificate(ctx context.Context, certificate *domain.DeviceCertificate) error
+	GetCertificate(ctx context.Context, serial string) (*domain.DeviceCertificate, error)
+	GetCertificateOfAnyTenant(ctx context.Context, serial string) (*domain.DeviceCertificate, error)
+	GetCertificatesByPrinterId(ctx context.Context, printerId string) ([]domain.DeviceCertificate, error)
+	RevokeCertificate(ctx context.Context, serial string, revokedAt time.Time) error
+}
+
+func NewEnrollmentGORMRepository(db *gorm.DB) EnrollmentRepository {
+	return &EnrollmentGORMRepository{db: db}
+}
+
+type EnrollmentGORMRepository struct {
+	db *gorm.DB
+}
+
+// CreateEnrollment stores the enrollment a device requested. A pending enrollment belongs to no tenant until a user
+// claims it, so the calls of the device and the lookup of its claim code reach enrollments of every tenant.
+func (e *EnrollmentGORMRepository) CreateEnrollment(ctx context.Context, enrollment *domain.DeviceEnrollment) error {
+	return e.db.WithContext(withoutTenantScope(ctx)).Create(enrollment).Error
+}
+
+func (e *EnrollmentGORMRepository) GetEnrollment(ctx context.Context, enrollmentId string) (*domain.DeviceEnrollment, error) {
+	enrollment := &domain.DeviceEnrollment{}
+	if err := e.db.WithContext(withoutTenantScope(ctx)).Where("enrollment_id = ?", enrollmentId).First(enrollment).Error; err != nil {
+		return nil, err
+	}
+	return enrollment, nil
+}
+
+func (e *EnrollmentGORMRepository) GetPendingEnrollmentByClaimCode(ctx context.Context, claimCode string, now time.Time) (*domain.DeviceEnrollment, error) {
+	enrollment := &domain.DeviceEnrollment{}
+	err := e.db.WithContext(withoutTenantScope(ctx)).
+		Where("claim_code = ? AND state = ? AND expires_at > ?", claimCode, int(domain.EnrollmentStatePending), now).
+		First(enrollment).Error
+	if err != nil {
+		return nil, err
+	}
+	return enrollment, nil
+}
+
+// ClaimEnrollment reserves a pending enrollment for the user, moving it into the caller's tenant, and reports false
+// when someone else claimed it first.
+func (e *EnrollmentGORMRepository) ClaimEnrollment(ctx context.Context, enrollmentId string, userId string) (bool, error) {
+	tenantId, err := callerTenant(ctx)
+	if err != nil {
+		return false, err
+	}
+	result := e.db.WithContext(withoutTenantScope(ctx)).Model(&domain.DeviceEnrollment{}).
+		Where("enrollment_id = ? AND state = ?", enrollmentId, int(domain.EnrollmentStatePending)).
+		Updates(map[string]interface{}{"state": int(domain.EnrollmentStateClaimed), "user_id": userId, "tenant_id": tenantId})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ReleaseEnrollment returns a claimed enrollment to pending, and out of the tenant, when binding it failed.
+func (e *EnrollmentGORMRepository) ReleaseEnrollment(ctx context.Context, enrollmentId string) error {
+	return e.db.WithContext(withoutTenantScope(ctx)).Model(&domain.DeviceEnrollment{}).
+		Where("enrollment_id = ? AND state = ? AND printer_id = ?", enrollmentId, int(domain.EnrollmentStateClaimed), "").
+		Updates(map[string]interface{}{"state": int(domain.EnrollmentStatePending), "user_id": "", "tenant_id": ""}).Error
+}
+
+// CompleteEnrollment stores the printer and certificate of a claimed enrollment for the device to fetch, recording
+// the certificate so it can be revoked.
+func (e *EnrollmentGORMRepository) CompleteEnrollment(ctx context.Context, enrollment *domain.DeviceEnrollment, certificate *domain.DeviceCertificate) error {
+	return e.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&domain.DeviceEnrollment{}).
+			Where("enrollment_id = ?", enrollment.EnrollmentId).
+			Updates(map[string]interface{}{
+				"printer_id":  enrollment.PrinterId,
+				"certificate": enrollment.Certificate,
+				"expires_at":  enrollment.ExpiresAt,
+			}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(certificate).Error
+	})
+}
+
+// DeleteExpiredEnrollments deletes the expired enrollments of every tenant.
+func (e *EnrollmentGORMRepository) DeleteExpiredEnrollments(ctx context.Context, now time.Time) (int64, error) {
+	result := e.db.WithContext(withoutTenantScope(ctx)).Where("expires_at <= ?", now).Delete(&domain.DeviceEnrollment{})
+	return result.RowsAffected, result.Error
+}
+
+func (e *EnrollmentGORMRepository) CreateCertificate(ctx context.Context, certificate *domain.DeviceCertificate) error {
+	return e.db.WithContext(ctx).Create(certificate).Error
+}
+
+func (e *EnrollmentGORMRepository) GetCertificate(ctx context.Context, serial string) (*domain.DeviceCertificate, error) {
+	certificate := &domain.DeviceCertificate{}
+	if err := e.db.WithContext(ctx).Where("serial = ?", serial).First(certificate).Error; err != nil {
+		return nil, err
+	}
+	return certificate, nil
+}
+
+// GetCertificateOfAnyTenant looks up the certificate a device presents, whatever its tenant, to authenticate the
+// device before its tenant is known.
+func (e *EnrollmentGORMRepository) GetCertificateOfAnyTenant(ctx context.Context, serial string) (*domain.DeviceCertificate, error) {
+	return e.GetCertificate(withoutTenantScope(ctx), serial)
+}
+
+func (e *EnrollmentGORMRepository) GetCertificatesByPrinterId(ctx context.Context, printerId string) ([]domain.DeviceCertificate, error) {
+	var certificates []domain.DeviceCertificate
+	if err := e.db.WithContext(ctx).Where("printer_id = ?", printerId).Order("id DESC").Find(&certificates).Error; err != nil {
+		return nil, err
+	}
+	return certificates, nil
+}
+
+func (e *EnrollmentGORMRepository) RevokeCertificate(ctx context.Context, serial string, revokedAt time.Time) error {
+	result := e.db.WithContext(ctx).Model(&domain.DeviceCertificate{}).
+		Where("serial = ? AND revoked_at IS NULL", serial).
+		Update("revoked_at", revokedAt)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+type IdempotencyRepository interface {
+	Reserve(ctx context.Context, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, record *domain.IdempotencyRecord) error
+	Release(ctx context.Context, record *domain.IdempotencyRecord) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+func NewIdempotencyGORMRepository(db *gorm.DB) IdempotencyRepository {
+	return &IdempotencyGORMRepository{db: db}
+}
+
+type IdempotencyGORMRepository struct {
+	db *gorm.DB
+}
+
+// Reserve stores record as pending until its ExpiresAt, the lease of the call holding it, unless a live record already
+// exists for the same principal, method and key, in which case that record is returned. A record past its ExpiresAt,
+// either expired once completed or pending with its lease lapsed, is taken over. The flag reports whether record was
+// reserved.
+func (i *IdempotencyGORMRepository) Reserve(ctx context.Context, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, bool, error) {
+	existing, err := i.find(ctx, record)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+	if err == nil {
+		now := time.Now()
+		if !existing.Expired(now) {
+			return existing, false, nil
+		}
+		// the record is only deleted while still expired, a call completing it in between keeps it
+		if err := i.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(existing).Error; err != nil {
+			return nil, false, err
+		}
+	}
+	if err := i.db.WithContext(ctx).Create(record).Error; err != nil {
+		// a concurrent retry may have reserved the key in between, the unique index rejects the insert
+		if existing, findErr := i.find(ctx, record); findErr == nil {
+			return existing, false, nil
+		}
+		return nil, false, err
+	}
+	return record, true, nil
+}
+
+func (i *IdempotencyGORMRepository) find(ctx context.Context, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+	existing := &domain.IdempotencyRecord{}
+	if err := i.db.WithContext(ctx).Where("principal = ? AND method = ? AND `key` = ?", record.Principal, record.Method, record.Key).First(existing).Error; err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// Complete stores the response of record, which is kept until its ExpiresAt.
+func (i *IdempotencyGORMRepository) Complete(ctx context.Context, record *domain.IdempotencyRecord) error {
+	record.Completed = true
+	return i.db.WithContext(ctx).Model(record).Select("response_type", "response", "completed", "expires_at").Updates(record).Error
+}
+
+// Release forgets a pending record so the request can be retried after it failed.
+func (i *IdempotencyGORMRepository) Release(ctx context.Context, record *domain.IdempotencyRecord) error {
+	return i.db.WithContext(ctx).Delete(record).Error
+}
+
+// DeleteExpired deletes the expired records of every tenant.
+func (i *IdempotencyGORMRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result := i.db.WithContext(withoutTenantScope(ctx)).Where("expires_at <= ?", now).Delete(&domain.IdempotencyRecord{})
+	return result.RowsAffected, result.Error
+}
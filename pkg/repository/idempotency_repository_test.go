@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"ditto/pkg/domain"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReserveTakesOverALapsedReservation(t *testing.T) {
+	db, recorder := newRecordingDB(t)
+	recorder.answer("FROM `idempotency_records`", []string{"id", "principal", "method", "key", "completed", "expires_at"},
+		[]driver.Value{int64(7), "user-1", "/m", "k1", false, time.Now().Add(-time.Second)})
+	record := &domain.IdempotencyRecord{Principal: "user-1", Method: "/m", Key: "k1", ExpiresAt: time.Now().Add(time.Minute)}
+
+	_, reserved, err := NewIdempotencyGORMRepository(db).Reserve(context.Background(), record)
+	if err != nil || !reserved {
+		t.Fatalf("Reserve returned %v, %v, want the lapsed reservation taken over", reserved, err)
+	}
+	queries := recorder.queries()
+	if len(queries) != 3 || queries[1] != "DELETE FROM `idempotency_records` WHERE expires_at <= ? AND `idempotency_records`.`id` = ?" ||
+		!strings.HasPrefix(queries[2], "INSERT INTO `idempotency_records`") {
+		t.Errorf("reserved with %v, want the lapsed record deleted while still expired and the key reserved again", queries)
+	}
+}
+
+func TestReserveKeepsALiveReservation(t *testing.T) {
+	db, recorder := newRecordingDB(t)
+	recorder.answer("FROM `idempotency_records`", []string{"id", "principal", "method", "key", "completed", "expires_at"},
+		[]driver.Value{int64(7), "user-1", "/m", "k1", false, time.Now().Add(time.Minute)})
+	record := &domain.IdempotencyRecord{Principal: "user-1", Method: "/m", Key: "k1", ExpiresAt: time.Now().Add(time.Minute)}
+
+	existing, reserved, err := NewIdempotencyGORMRepository(db).Reserve(context.Background(), record)
+	if err != nil || reserved || existing.Id != 7 {
+		t.Fatalf("Reserve returned %v, %v, %v, want the live reservation", existing, reserved, err)
+	}
+	if queries := recorder.queries(); len(queries) != 1 {
+		t.Errorf("reserved with %v, want only the lookup", queries)
+	}
+}
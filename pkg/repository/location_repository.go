@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"github.com/kutty-kumar/charminder/pkg"
+	"github.com/kutty-kumar/ho_oh/core_v1"
+	uuid "github.com/satori/go.uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"math"
+	"sort"
+	"strings"
+)
+
+const earthRadiusMeters = 6371000
+
+type LocationRepository interface {
+	CreateLocation(ctx context.Context, location *domain.Location) (*domain.Location, error)
+	GetLocation(ctx context.Context, locationId string) (*domain.Location, error)
+	GetChildLocations(ctx context.Context, parentId string) ([]domain.Location, error)
+	UpdateLocation(ctx context.Context, locationId string, location *domain.Location) (*domain.Location, error)
+	DeleteLocation(ctx context.Context, locationId string) error
+	AssignPrinter(ctx context.Context, userId string, printerId string, locationId string) (*domain.Printer, error)
+	GetPrintersInLocation(ctx context.Context, locationId string) ([]domain.Printer, error)
+	GetPrintersNear(ctx context.Context, latitude float64, longitude float64, radiusMeters float64, limit int) ([]NearbyPrinter, error)
+}
+
+// NearbyPrinter is an active printer along with its distance from the point that was searched around.
+type NearbyPrinter struct {
+	Printer        domain.Printer
+	Location       domain.Location
+	DistanceMeters float64
+}
+
+func NewLocationGORMRepository(dao pkg.BaseDao) LocationRepository {
+	return &LocationGORMRepository{
+		dao,
+	}
+}
+
+type LocationGORMRepository struct {
+	pkg.BaseDao
+}
+
+// CreateLocation places the location under its parent, organizations are the only locations without one and every
+// other kind must sit directly below the kind above it.
+func (l *LocationGORMRepository) CreateLocation(ctx context.Context, location *domain.Location) (*domain.Location, error) {
+	kind := domain.LocationKind(location.Kind)
+	if kind == domain.LocationKindUnknown {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown location kind")
+	}
+	parentPath := "/"
+	if kind == domain.LocationKindOrganization {
+		if location.ParentId != "" {
+			return nil, status.Errorf(codes.InvalidArgument, "an organization can't have a parent")
+		}
+	} else {
+		parent, err := l.GetLocation(ctx, location.ParentId)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "parent %v not found", location.ParentId)
+		}
+		if domain.LocationKind(parent.Kind) != kind-1 {
+			return nil, status.Errorf(codes.InvalidArgument, "a %v must be placed in a %v, not a %v", kind, kind-1, domain.LocationKind(parent.Kind))
+		}
+		parentPath = parent.Path
+	}
+	location.Status = int(core_v1.Status_active)
+	// the external id is part of the path, so it is assigned here rather than by Create
+	location.SetExternalId(uuid.NewV4().String())
+	location.Path = parentPath + location.ExternalId + "/"
+	err, created := l.Create(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	return created.(*domain.Location), nil
+}
+
+func (l *LocationGORMRepository) GetLocation(ctx context.Context, locationId string) (*domain.Location, error) {
+	err, location := l.GetByExternalId(ctx, locationId)
+	if err != nil {
+		return nil, err
+	}
+	return location.(*domain.Location), nil
+}
+
+// GetChildLocations returns the locations directly below parentId, or the organizations when parentId is empty.
+func (l *LocationGORMRepository) GetChildLocations(ctx context.Context, parentId string) ([]domain.Location, error) {
+	var locations []domain.Location
+	if err := l.GetDb().WithContext(ctx).Where("parent_id = ?", parentId).Order("name").Find(&locations).Error; err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+func (l *LocationGORMRepository) UpdateLocation(ctx context.Context, locationId string, location *domain.Location) (*domain.Location, error) {
+	err, updated := l.Update(ctx, locationId, location)
+	if err != nil {
+		return nil, err
+	}
+	return updated.(*domain.Location), nil
+}
+
+// DeleteLocation removes a location that has neither child locations nor printers assigned to it.
+func (l *LocationGORMRepository) DeleteLocation(ctx context.Context, locationId string) error {
+	return l.GetDb().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var children, printers int64
+		if err := tx.Model(&domain.Location{}).Where("parent_id = ?", locationId).Count(&children).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&domain.Printer{}).Where("location_id = ?", locationId).Count(&printers).Error; err != nil {
+			return err
+		}
+		if children > 0 || printers > 0 {
+			return status.Errorf(codes.FailedPrecondition, "location %v still holds %d locations and %d printers", locationId, children, printers)
+		}
+		result := tx.Where("external_id = ?", locationId).Delete(&domain.Location{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// AssignPrinter moves one of the user's printers to the location, an empty locationId unassigns it.
+func (l *LocationGORMRepository) AssignPrinter(ctx context.Context, userId string, printerId string, locationId string) (*domain.Printer, error) {
+	if locationId != "" {
+		if _, err := l.GetLocation(ctx, locationId); err != nil {
+			return nil, err
+		}
+	}
+	printer := &domain.Printer{}
+	db := l.GetDb().WithContext(ctx)
+	if err := db.Where("external_id = ? AND user_id = ?", printerId, userId).First(printer).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(printer).Update("location_id", locationId).Error; err != nil {
+		return nil, err
+	}
+	printer.LocationId = locationId
+	return printer, nil
+}
+
+// GetPrintersInLocation returns the active printers assigned to the location or anywhere below it.
+func (l *LocationGORMRepository) GetPrintersInLocation(ctx context.Context, locationId string) ([]domain.Printer, error) {
+	location, err := l.GetLocation(ctx, locationId)
+	if err != nil {
+		return nil, err
+	}
+	var printers []domain.Printer
+	db := l.GetDb().WithContext(ctx)
+	if err := db.
+		Where("status = ? AND location_id IN (?)", int(core_v1.Status_active),
+			db.Model(&domain.Location{}).Select("external_id").Where("path LIKE ?", location.Path+"%")).
+		Find(&printers).Error; err != nil {
+		return nil, err
+	}
+	return printers, nil
+}
+
+// GetPrintersNear returns active printers within radiusMeters of the point, closest first. A printer is positioned at
+// its location or, when that location has no coordinates, at its closest ancestor that has.
+func (l *LocationGORMRepository) GetPrintersNear(ctx context.Context, latitude float64, longitude float64, radiusMeters float64, limit int) ([]NearbyPrinter, error) {
+	db := l.GetDb().WithContext(ctx)
+	latitudeDelta := radiusMeters / earthRadiusMeters * 180 / math.Pi
+	longitudeDelta := latitudeDelta / math.Max(math.Cos(latitude*math.Pi/180), 1e-6)
+	var candidates []domain.Location
+	if err := db.Where("latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?",
+		latitude-latitudeDelta, latitude+latitudeDelta, longitude-longitudeDelta, longitude+longitudeDelta).
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	anchors := make(map[string]domain.Location)
+	distances := make(map[string]float64)
+	for _, candidate := range candidates {
+		distance := haversine(latitude, longitude, *candidate.Latitude, *candidate.Longitude)
+		if distance <= radiusMeters {
+			anchors[candidate.ExternalId] = candidate
+			distances[candidate.ExternalId] = distance
+		}
+	}
+	if len(anchors) == 0 {
+		return []NearbyPrinter{}, nil
+	}
+
+	var located []struct {
+		domain.Printer
+		LocationPath string
+	}
+	subtrees := db.Table("printers").
+		Select("printers.*, locations.path AS location_path").
+		Joins("JOIN locations ON locations.external_id = printers.location_id").
+		Where("printers.status = ?", int(core_v1.Status_active))
+	var conditions []string
+	var args []interface{}
+	for _, anchor := range anchors {
+		conditions = append(conditions, "locations.path LIKE ?")
+		args = append(args, anchor.Path+"%")
+	}
+	if err := subtrees.Where(strings.Join(conditions, " OR "), args...).Scan(&located).Error; err != nil {
+		return nil, err
+	}
+
+	// a deeper location with coordinates outside the radius pins the printer there, so find the deepest location with
+	// coordinates on every printer's path before trusting an anchor
+	segments := make(map[string]bool)
+	for _, printer := range located {
+		for _, segment := range pathSegments(printer.LocationPath) {
+			segments[segment] = true
+		}
+	}
+	var segmentIds []string
+	for segment := range segments {
+		segmentIds = append(segmentIds, segment)
+	}
+	var positioned []string
+	if err := db.Model(&domain.Location{}).
+		Where("external_id IN (?) AND latitude IS NOT NULL AND longitude IS NOT NULL", segmentIds).
+		Pluck("external_id", &positioned).Error; err != nil {
+		return nil, err
+	}
+	hasCoordinates := make(map[string]bool, len(positioned))
+	for _, locationId := range positioned {
+		hasCoordinates[locationId] = true
+	}
+
+	result := make([]NearbyPrinter, 0, len(located))
+	for _, printer := range located {
+		path := pathSegments(printer.LocationPath)
+		for i := len(path) - 1; i >= 0; i-- {
+			if !hasCoordinates[path[i]] {
+				continue
+			}
+			if anchor, ok := anchors[path[i]]; ok {
+				result = append(result, NearbyPrinter{Printer: printer.Printer, Location: anchor, DistanceMeters: distances[path[i]]})
+			}
+			break
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DistanceMeters < result[j].DistanceMeters
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func pathSegments(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+}
+
+// haversine returns the great circle distance in meters between two points given in degrees.
+func haversine(lat1 float64, lng1 float64, lat2 float64, lng2 float64) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLat := toRadians(lat2 - lat1)
+	dLng := toRadians(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
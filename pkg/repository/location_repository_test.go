@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"ditto/pkg/domain"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/kutty-kumar/charminder/pkg"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+func newTestLocationRepository(db *gorm.DB) LocationRepository {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	return NewLocationGORMRepository(pkg.NewBaseGORMDao(pkg.WithDb(db), pkg.WithLogger(logger),
+		pkg.WithCreator(func() pkg.Base { return &domain.Location{} }),
+		pkg.WithExternalIdSetter(func(externalId string, base pkg.Base) pkg.Base {
+			base.SetExternalId(externalId)
+			return base
+		})))
+}
+
+func TestCreateLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		location domain.Location
+		code     codes.Code
+	}{
+		{name: "organization", location: domain.Location{Kind: int(domain.LocationKindOrganization)}},
+		{name: "site in its organization", location: domain.Location{Kind: int(domain.LocationKindSite), ParentId: "org-1"}},
+		{name: "organization with a parent", location: domain.Location{Kind: int(domain.LocationKindOrganization), ParentId: "org-1"},
+			code: codes.InvalidArgument},
+		{name: "building skipping the site", location: domain.Location{Kind: int(domain.LocationKindBuilding), ParentId: "org-1"},
+			code: codes.InvalidArgument},
+		{name: "unknown kind", location: domain.Location{}, code: codes.InvalidArgument},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, recorder := newRecordingDB(t)
+			recorder.answer("FROM `locations`", []string{"external_id", "kind", "path"},
+				[]driver.Value{"org-1", int64(domain.LocationKindOrganization), "/org-1/"})
+			created, err := newTestLocationRepository(db).CreateLocation(context.Background(), &test.location)
+			if status.Code(err) != test.code {
+				t.Fatalf("CreateLocation returned %v, want code %v", err, test.code)
+			}
+			if err != nil {
+				return
+			}
+			parentPath := "/"
+			if test.location.ParentId != "" {
+				parentPath = "/org-1/"
+			}
+			if want := parentPath + created.ExternalId + "/"; created.Path != want || created.ExternalId == "" {
+				t.Errorf("created the location at %v, want %v", created.Path, want)
+			}
+			if queries := recorder.queries(); !strings.HasPrefix(queries[len(queries)-1], "INSERT INTO `locations`") {
+				t.Errorf("created the location with %v", queries)
+			}
+		})
+	}
+}
+
+func TestHaversine(t *testing.T) {
+	// the Eiffel Tower and the Arc de Triomphe are about 1.7 km apart
+	distance := haversine(48.8584, 2.2945, 48.8738, 2.2950)
+	if math.Abs(distance-1713) > 10 {
+		t.Errorf("haversine returned %.0f meters, want about 1713", distance)
+	}
+	if distance := haversine(48.8584, 2.2945, 48.8584, 2.2945); distance != 0 {
+		t.Errorf("haversine of a point to itself returned %v", distance)
+	}
+}
@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"ditto/pkg/metrics"
+	"github.com/kutty-kumar/charminder/pkg"
+	"github.com/kutty-kumar/ho_oh/core_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type PrintJobRepository interface {
+	CreateJob(ctx context.Context, job *domain.PrintJob) (*domain.PrintJob, error)
+	GetJob(ctx context.Context, userId string, jobId string) (*domain.PrintJob, error)
+	GetJobsByUserId(ctx context.Context, userId string) ([]domain.PrintJob, error)
+	GetQueueDepths(ctx context.Context, printerIds []string) (map[string]int64, error)
+	UpdateJobState(ctx context.Context, jobId string, state domain.JobState, jobError string) (*domain.PrintJob, error)
+	StartConversion(ctx context.Context, jobId string, source *domain.PrintJobDocument) error
+	CompleteConversion(ctx context.Context, jobId string, converted *domain.PrintJobDocument) error
+	GetDocument(ctx context.Context, jobId string, kind string) (*domain.PrintJobDocument, error)
+	GetHeldJobs(ctx context.Context, userId string) ([]domain.PrintJob, error)
+	ReleaseJob(ctx context.Context, jobId string, printerId string) (bool, error)
+	DeleteExpiredHeldJobs(ctx context.Context, heldBefore time.Time) (int64, error)
+	FailAbandonedConversions(ctx context.Context, startedBefore time.Time, jobError string) (int64, error)
+	GetDispatchableJobs(ctx context.Context, printerIds []string, limit int) ([]domain.PrintJob, error)
+	ClaimJob(ctx context.Context, jobId string) (bool, error)
+	RequeueJob(ctx context.Context, jobId string) error
+	UpdateDispatchedJobState(ctx context.Context, jobId string, printerIds []string, state domain.JobState, jobError string) (bool, error)
+}
+
+func NewPrintJobGORMRepository(dao pkg.BaseDao) PrintJobRepository {
+	return &PrintJobGORMRepository{
+		dao,
+	}
+}
+
+type PrintJobGORMRepository struct {
+	pkg.BaseDao
+}
+
+func (p *PrintJobGORMRepository) CreateJob(ctx context.Context, job *domain.PrintJob) (*domain.PrintJob, error) {
+	job.Status = int(core_v1.Status_active)
+	err, created := p.Create(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	metrics.JobEntered(domain.JobState(job.State))
+	return created.(*domain.PrintJob), nil
+}
+
+func (p *PrintJobGORMRepository) GetJob(ctx context.Context, userId string, jobId string) (*domain.PrintJob, error) {
+	job := &domain.PrintJob{}
+	if err := p.GetDb().WithContext(ctx).Where("external_id = ? AND user_id = ?", jobId, userId).First(job).Error; err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (p *PrintJobGORMRepository) GetJobsByUserId(ctx context.Context, userId string) ([]domain.PrintJob, error) {
+	var jobs []domain.PrintJob
+	if err := p.GetDb().WithContext(ctx).Where("user_id = ?", userId).Order("id DESC").Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// GetQueueDepths counts the queued and processing jobs of every given printer, printers without any are left out.
+func (p *PrintJobGORMRepository) GetQueueDepths(ctx context.Context, printerIds []string) (map[string]int64, error) {
+	var counts []struct {
+		PrinterId string
+		Depth     int64
+	}
+	if err := p.GetDb().WithContext(ctx).Model(&domain.PrintJob{}).
+		Select("printer_id, COUNT(*) AS depth").
+		Where("printer_id IN (?) AND state IN (?)", printerIds, domain.PendingJobStates).
+		Group("printer_id").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	depths := make(map[string]int64, len(counts))
+	for _, count := range counts {
+		depths[count.PrinterId] = count.Depth
+	}
+	return depths, nil
+}
+
+func (p *PrintJobGORMRepository) UpdateJobState(ctx context.Context, jobId string, state domain.JobState, jobError string) (*domain.PrintJob, error) {
+	err, updated := p.Update(ctx, jobId, &domain.PrintJob{State: int(state), Error: jobError})
+	if err != nil {
+		return nil, err
+	}
+	if state.Finished() {
+		metrics.JobEntered(state)
+	}
+	return updated.(*domain.PrintJob), nil
+}
+
+// StartConversion stores the uploaded document of a queued or held job and moves the job to converting, failing if
+// another upload got there first.
+func (p *PrintJobGORMRepository) StartConversion(ctx context.Context, jobId string, source *domain.PrintJobDocument) error {
+	return p.GetDb().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&domain.PrintJob{}).
+			Where("external_id = ? AND state IN (?) AND print_format = ?", jobId, []int{int(domain.JobStateQueued), int(domain.JobStateHeld)}, "").
+			Updates(map[string]interface{}{"state": int(domain.JobStateConverting), "document_format": source.Format})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return status.Errorf(codes.FailedPrecondition, "job %v already has a document", jobId)
+		}
+		source.JobId = jobId
+		source.Kind = domain.DocumentKindSource
+		return saveDocument(tx, source)
+	})
+}
+
+// CompleteConversion stores the converted document and queues the job for printing, or holds it for release when it
+// is secure.
+func (p *PrintJobGORMRepository) CompleteConversion(ctx context.Context, jobId string, converted *domain.PrintJobDocument) error {
+	return p.GetDb().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		converted.JobId = jobId
+		converted.Kind = domain.DocumentKindPrint
+		if err := saveDocument(tx, converted); err != nil {
+			return err
+		}
+		return tx.Model(&domain.PrintJob{}).
+			Where("external_id = ? AND state = ?", jobId, int(domain.JobStateConverting)).
+			Updates(map[string]interface{}{
+				"state":        gorm.Expr("CASE WHEN secure THEN ? ELSE ? END", int(domain.JobStateHeld), int(domain.JobStateQueued)),
+				"print_format": converted.Format,
+			}).Error
+	})
+}
+
+func saveDocument(tx *gorm.DB, document *domain.PrintJobDocument) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "job_id"}, {Name: "kind"}},
+		DoUpdates: clause.AssignmentColumns([]string{"format", "digest", "size"}),
+	}).Create(document).Error
+}
+
+func (p *PrintJobGORMRepository) GetDocument(ctx context.Context, jobId string, kind string) (*domain.PrintJobDocument, error) {
+	document := &domain.PrintJobDocument{}
+	if err := p.GetDb().WithContext(ctx).Where("job_id = ? AND kind = ?", jobId, kind).First(document).Error; err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// GetHeldJobs returns the user's held jobs that have a document ready to print, oldest first.
+func (p *PrintJobGORMRepository) GetHeldJobs(ctx context.Context, userId string) ([]domain.PrintJob, error) {
+	var jobs []domain.PrintJob
+	err := p.GetDb().WithContext(ctx).
+		Where("user_id = ? AND state = ? AND print_format <> ?", userId, int(domain.JobStateHeld), "").
+		Order("id").
+		Find(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// ReleaseJob queues a held job on the printer it is released at, reporting false when the job is no longer held.
+func (p *PrintJobGORMRepository) ReleaseJob(ctx context.Context, jobId string, printerId string) (bool, error) {
+	result := p.GetDb().WithContext(ctx).Model(&domain.PrintJob{}).
+		Where("external_id = ? AND state = ?", jobId, int(domain.JobStateHeld)).
+		Updates(map[string]interface{}{"state": int(domain.JobStateQueued), "printer_id": printerId})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteExpiredHeldJobs hard deletes the jobs of every tenant submitted before heldBefore that are still held, their
+// documents are left to the document expiry worker.
+func (p *PrintJobGORMRepository) DeleteExpiredHeldJobs(ctx context.Context, heldBefore time.Time) (int64, error) {
+	result := p.GetDb().WithContext(withoutTenantScope(ctx)).
+		Where("state = ? AND created_at < ?", int(domain.JobStateHeld), heldBefore).
+		Delete(&domain.PrintJob{})
+	metrics.PrintJobs.WithLabelValues("expired").Add(float64(result.RowsAffected))
+	return result.RowsAffected, result.Error
+}
+
+// FailAbandonedConversions fails the jobs of every tenant that entered converting before startedBefore and are
+// converting still, their conversion having been lost to a crash or a shutdown.
+func (p *PrintJobGORMRepository) FailAbandonedConversions(ctx context.Context, startedBefore time.Time, jobError string) (int64, error) {
+	result := p.GetDb().WithContext(withoutTenantScope(ctx)).Model(&domain.PrintJob{}).
+		Where("state = ? AND updated_at < ?", int(domain.JobStateConverting), startedBefore).
+		Updates(map[string]interface{}{"state": int(domain.JobStateFailed), "error": jobError})
+	metrics.PrintJobs.WithLabelValues(domain.JobStateFailed.String()).Add(float64(result.RowsAffected))
+	return result.RowsAffected, result.Error
+}
+
+// GetDispatchableJobs returns the queued jobs of the printers whose document is ready to print, oldest first.
+func (p *PrintJobGORMRepository) GetDispatchableJobs(ctx context.Context, printerIds []string, limit int) ([]domain.PrintJob, error) {
+	var jobs []domain.PrintJob
+	if len(printerIds) == 0 {
+		return jobs, nil
+	}
+	err := p.GetDb().WithContext(ctx).
+		Where("printer_id IN (?) AND state = ? AND print_format <> ?", printerIds, int(domain.JobStateQueued), "").
+		Order("id").
+		Limit(limit).
+		Find(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// ClaimJob moves a queued job to processing, reporting false when another dispatcher claimed it first.
+func (p *PrintJobGORMRepository) ClaimJob(ctx context.Context, jobId string) (bool, error) {
+	result := p.GetDb().WithContext(ctx).Model(&domain.PrintJob{}).
+		Where("external_id = ? AND state = ?", jobId, int(domain.JobStateQueued)).
+		Update("state", int(domain.JobStateProcessing))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// RequeueJob moves a claimed job back to queued.
+func (p *PrintJobGORMRepository) RequeueJob(ctx context.Context, jobId string) error {
+	return p.GetDb().WithContext(ctx).Model(&domain.PrintJob{}).
+		Where("external_id = ? AND state = ?", jobId, int(domain.JobStateProcessing)).
+		Update("state", int(domain.JobStateQueued)).Error
+}
+
+// UpdateDispatchedJobState records the outcome of a processing job on one of the printers, reporting false when
+// the job isn't processing on any of them.
+func (p *PrintJobGORMRepository) UpdateDispatchedJobState(ctx context.Context, jobId string, printerIds []string, state domain.JobState, jobError string) (bool, error) {
+	result := p.GetDb().WithContext(ctx).Model(&domain.PrintJob{}).
+		Where("external_id = ? AND printer_id IN (?) AND state = ?", jobId, printerIds, int(domain.JobStateProcessing)).
+		Updates(map[string]interface{}{"state": int(state), "error": jobError})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 && state.Finished() {
+		metrics.JobEntered(state)
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"errors"
+	"github.com/kutty-kumar/charminder/pkg"
+	"github.com/kutty-kumar/ho_oh/core_v1"
+	"gorm.io/gorm"
+)
+
+type PrinterGroupRepository interface {
+	CreateGroup(ctx context.Context, group *domain.PrinterGroup) (*domain.PrinterGroup, error)
+	GetGroup(ctx context.Context, groupId string) (*domain.PrinterGroup, error)
+	GetGroups(ctx context.Context) ([]domain.PrinterGroup, error)
+	UpdateGroup(ctx context.Context, groupId string, group *domain.PrinterGroup) (*domain.PrinterGroup, error)
+	DeleteGroup(ctx context.Context, groupId string) error
+	AddMember(ctx context.Context, groupId string, printerId string) error
+	RemoveMember(ctx context.Context, groupId string, printerId string) error
+	GetMembers(ctx context.Context, group *domain.PrinterGroup) ([]domain.Printer, error)
+}
+
+func NewPrinterGroupGORMRepository(dao pkg.BaseDao) PrinterGroupRepository {
+	return &PrinterGroupGORMRepository{
+		dao,
+	}
+}
+
+type PrinterGroupGORMRepository struct {
+	pkg.BaseDao
+}
+
+func (p *PrinterGroupGORMRepository) CreateGroup(ctx context.Context, group *domain.PrinterGroup) (*domain.PrinterGroup, error) {
+	group.Status = int(core_v1.Status_active)
+	err, created := p.Create(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	return created.(*domain.PrinterGroup), nil
+}
+
+func (p *PrinterGroupGORMRepository) GetGroup(ctx context.Context, groupId string) (*domain.PrinterGroup, error) {
+	err, group := p.GetByExternalId(ctx, groupId)
+	if err != nil {
+		return nil, err
+	}
+	return group.(*domain.PrinterGroup), nil
+}
+
+func (p *PrinterGroupGORMRepository) GetGroups(ctx context.Context) ([]domain.PrinterGroup, error) {
+	var groups []domain.PrinterGroup
+	if err := p.GetDb().WithContext(ctx).Order("name").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (p *PrinterGroupGORMRepository) UpdateGroup(ctx context.Context, groupId string, group *domain.PrinterGroup) (*domain.PrinterGroup, error) {
+	err, updated := p.Update(ctx, groupId, group)
+	if err != nil {
+		return nil, err
+	}
+	return updated.(*domain.PrinterGroup), nil
+}
+
+// DeleteGroup removes the group along with its static memberships.
+func (p *PrinterGroupGORMRepository) DeleteGroup(ctx context.Context, groupId string) error {
+	return p.GetDb().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", groupId).Delete(&domain.PrinterGroupMember{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("external_id = ?", groupId).Delete(&domain.PrinterGroup{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+func (p *PrinterGroupGORMRepository) AddMember(ctx context.Context, groupId string, printerId string) error {
+	db := p.GetDb().WithContext(ctx)
+	if err := db.Where("external_id = ?", printerId).First(&domain.Printer{}).Error; err != nil {
+		return err
+	}
+	member := &domain.PrinterGroupMember{}
+	err := db.Where("group_id = ? AND printer_id = ?", groupId, printerId).First(member).Error
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return db.Create(&domain.PrinterGroupMember{GroupId: groupId, PrinterId: printerId}).Error
+}
+
+func (p *PrinterGroupGORMRepository) RemoveMember(ctx context.Context, groupId string, printerId string) error {
+	return p.GetDb().WithContext(ctx).Where("group_id = ? AND printer_id = ?", groupId, printerId).Delete(&domain.PrinterGroupMember{}).Error
+}
+
+// GetMembers resolves the active printers of a group, either its static members or the printers matching its rule.
+func (p *PrinterGroupGORMRepository) GetMembers(ctx context.Context, group *domain.PrinterGroup) ([]domain.Printer, error) {
+	session := p.GetDb().WithContext(ctx)
+	db := session.Where("status = ?", int(core_v1.Status_active))
+	switch domain.GroupMembership(group.Membership) {
+	case domain.GroupMembershipStatic:
+		db = db.Where("external_id IN (?)", session.Model(&domain.PrinterGroupMember{}).Select("printer_id").Where("group_id = ?", group.ExternalId))
+	case domain.GroupMembershipRule:
+		if productNumbers := group.ProductNumbers(); len(productNumbers) > 0 {
+			db = db.Where("product_number IN (?)", productNumbers)
+		}
+		if group.RuleLocationId != "" {
+			location := &domain.Location{}
+			if err := session.Where("external_id = ?", group.RuleLocationId).First(location).Error; err != nil {
+				return nil, err
+			}
+			db = db.Where("location_id IN (?)", session.Model(&domain.Location{}).Select("external_id").Where("path LIKE ?", location.Path+"%"))
+		}
+	default:
+		return nil, nil
+	}
+	var printers []domain.Printer
+	if err := db.Find(&printers).Error; err != nil {
+		return nil, err
+	}
+	return printers, nil
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"ditto/pkg/domain"
+	"io/ioutil"
+	"testing"
+
+	"github.com/kutty-kumar/charminder/pkg"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+func newTestPrinterGroupRepository(db *gorm.DB) PrinterGroupRepository {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	return NewPrinterGroupGORMRepository(pkg.NewBaseGORMDao(pkg.WithDb(db), pkg.WithLogger(logger),
+		pkg.WithCreator(func() pkg.Base { return &domain.PrinterGroup{} }),
+		pkg.WithExternalIdSetter(func(externalId string, base pkg.Base) pkg.Base {
+			base.SetExternalId(externalId)
+			return base
+		})))
+}
+
+func TestGetMembers(t *testing.T) {
+	tests := []struct {
+		name  string
+		group domain.PrinterGroup
+		query string
+		args  []driver.Value
+	}{
+		{name: "static",
+			group: domain.PrinterGroup{BaseDomain: pkg.BaseDomain{ExternalId: "g1"}, Membership: int(domain.GroupMembershipStatic)},
+			query: "SELECT * FROM `printers` WHERE status = ? AND external_id IN (SELECT `printer_id` FROM `printer_group_members` WHERE group_id = ?)",
+			args:  []driver.Value{int64(1), "g1"}},
+		{name: "rule",
+			group: domain.PrinterGroup{Membership: int(domain.GroupMembershipRule), RuleProductNumbers: "M404,M479", RuleLocationId: "floor-1"},
+			query: "SELECT * FROM `printers` WHERE status = ? AND product_number IN (?,?) AND location_id IN (SELECT `external_id` FROM `locations` WHERE path LIKE ?)",
+			args:  []driver.Value{int64(1), "M404", "M479", "/site-1/floor-1/%"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, recorder := newRecordingDB(t)
+			recorder.answer("FROM `locations` WHERE external_id", []string{"external_id", "path"}, []driver.Value{"floor-1", "/site-1/floor-1/"})
+			if _, err := newTestPrinterGroupRepository(db).GetMembers(context.Background(), &test.group); err != nil {
+				t.Fatalf("GetMembers: %v", err)
+			}
+			statements := recorder.recorded()
+			members := statements[len(statements)-1]
+			if members.query != test.query || len(members.args) != len(test.args) {
+				t.Fatalf("resolved the members with %v, want %v %v", members, test.query, test.args)
+			}
+			for i, arg := range test.args {
+				if members.args[i] != arg {
+					t.Errorf("resolved the members with %v, want %v", members.args, test.args)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"github.com/kutty-kumar/charminder/pkg"
+	"github.com/kutty-kumar/ho_oh/core_v1"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+// PrinterModelRepository is the catalog of printer models, entries are addressed by product number rather than
+// external id.
+type PrinterModelRepository interface {
+	CreateModel(ctx context.Context, model *domain.PrinterModel) (*domain.PrinterModel, error)
+	GetModel(ctx context.Context, productNumber string) (*domain.PrinterModel, error)
+	GetModels(ctx context.Context) ([]domain.PrinterModel, error)
+	GetModelsByProductNumber(ctx context.Context, productNumbers []string) (map[string]domain.PrinterModel, error)
+	UpdateModel(ctx context.Context, productNumber string, model *domain.PrinterModel) (*domain.PrinterModel, error)
+	DeleteModel(ctx context.Context, productNumber string) error
+}
+
+func NewPrinterModelGORMRepository(dao pkg.BaseDao) PrinterModelRepository {
+	return &PrinterModelGORMRepository{
+		dao,
+	}
+}
+
+type PrinterModelGORMRepository struct {
+	pkg.BaseDao
+}
+
+func (p *PrinterModelGORMRepository) CreateModel(ctx context.Context, model *domain.PrinterModel) (*domain.PrinterModel, error) {
+	model.Status = int(core_v1.Status_active)
+	err, created := p.Create(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	return created.(*domain.PrinterModel), nil
+}
+
+func (p *PrinterModelGORMRepository) GetModel(ctx context.Context, productNumber string) (*domain.PrinterModel, error) {
+	model := &domain.PrinterModel{}
+	if err := p.GetDb().WithContext(ctx).Where("product_number = ?", productNumber).First(model).Error; err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+func (p *PrinterModelGORMRepository) GetModels(ctx context.Context) ([]domain.PrinterModel, error) {
+	var models []domain.PrinterModel
+	if err := p.GetDb().WithContext(ctx).Order("manufacturer, model_name").Find(&models).Error; err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+// GetModelsByProductNumber returns the catalog entries for the given product numbers, unknown ones are left out.
+func (p *PrinterModelGORMRepository) GetModelsByProductNumber(ctx context.Context, productNumbers []string) (map[string]domain.PrinterModel, error) {
+	models := make(map[string]domain.PrinterModel)
+	if len(productNumbers) == 0 {
+		return models, nil
+	}
+	var found []domain.PrinterModel
+	if err := p.GetDb().WithContext(ctx).Where("product_number IN (?)", productNumbers).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	for _, model := range found {
+		models[model.ProductNumber] = model
+	}
+	return models, nil
+}
+
+// UpdateModel replaces the capabilities of a catalog entry. Columns are listed explicitly as Updates would otherwise
+// skip capabilities being switched off.
+func (p *PrinterModelGORMRepository) UpdateModel(ctx context.Context, productNumber string, model *domain.PrinterModel) (*domain.PrinterModel, error) {
+	existing, err := p.GetModel(ctx, productNumber)
+	if err != nil {
+		return nil, err
+	}
+	existing.Merge(model)
+	err = p.GetDb().WithContext(ctx).Model(existing).
+		Select("manufacturer", "model_name", "color", "duplex", "paper_sizes", "resolutions", "document_formats", "ppd_name", "ipp_attributes", "status").
+		Updates(existing).Error
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (p *PrinterModelGORMRepository) DeleteModel(ctx context.Context, productNumber string) error {
+	result := p.GetDb().WithContext(ctx).Where("product_number = ?", productNumber).Delete(&domain.PrinterModel{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SeedPrinterModels adds the catalog entries whose product numbers are not known yet.
+func SeedPrinterModels(db *gorm.DB, catalog []domain.PrinterModelDto) error {
+	var known []string
+	if err := db.Model(&domain.PrinterModel{}).Pluck("product_number", &known).Error; err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(known))
+	for _, productNumber := range known {
+		seen[productNumber] = true
+	}
+	var missing []*domain.PrinterModel
+	for i := range catalog {
+		if seen[catalog[i].ProductNumber] {
+			continue
+		}
+		model := &domain.PrinterModel{}
+		model.FillProperties(&catalog[i])
+		model.SetExternalId(uuid.NewV4().String())
+		model.Status = int(core_v1.Status_active)
+		missing = append(missing, model)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return db.Create(missing).Error
+}
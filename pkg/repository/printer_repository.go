@@ -3,13 +3,33 @@ package repository
 import (
 	"context"
 	"ditto/pkg/domain"
+	"fmt"
 	"github.com/kutty-kumar/charminder/pkg"
 	"github.com/kutty-kumar/ho_oh/core_v1"
+	uuid "github.com/satori/go.uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
 )
 
 type PrinterRepository interface {
 	GetPrintersByUserId(ctx context.Context, userId string) ([]domain.Printer, error)
 	DeletePrinter(ctx context.Context, userId string, printerId string) (*domain.Printer, error)
+	GetDeletedPrintersByUserId(ctx context.Context, userId string) ([]domain.Printer, error)
+	RestorePrinter(ctx context.Context, userId string, printerId string) (*domain.Printer, error)
+	PurgePrinter(ctx context.Context, printerId string) (*domain.Printer, error)
+	PurgeInactivePrinters(ctx context.Context, inactiveSince time.Time) (int64, error)
+	GetPrinterBySerialNumber(ctx context.Context, serialNumber string) (*domain.Printer, error)
+	UpsertPrinter(ctx context.Context, printer *domain.Printer) (*domain.Printer, bool, error)
+	StreamPrintersByUserId(ctx context.Context, userId string, consume func(printer *domain.Printer) error) error
+	BatchCreatePrinters(ctx context.Context, printers []*domain.Printer, chunkSize int) []error
+	BatchUpdatePrinters(ctx context.Context, userId string, printers []*domain.Printer, chunkSize int) ([]*domain.Printer, []error)
+	TouchPrinter(ctx context.Context, userId string, printerId string, seenAt time.Time) error
+	GetPrinter(ctx context.Context, printerId string) (*domain.Printer, error)
+	CountActivePrintersByTenant(ctx context.Context) (map[string]int64, error)
 }
 
 func NewPrinterGORMRepository(dao pkg.BaseDao) PrinterRepository {
@@ -42,3 +62,305 @@ func (p *PrinterGORMRepository) DeletePrinter(ctx context.Context, userId string
 	}
 	return updatedPrinter.(*domain.Printer), nil
 }
+
+func (p *PrinterGORMRepository) GetDeletedPrintersByUserId(ctx context.Context, userId string) ([]domain.Printer, error) {
+	var printers []domain.Printer
+	if err := p.GetDb().WithContext(ctx).Table("printers").Where("user_id = ? AND status = ?", userId, int(core_v1.Status_inactive)).Scan(&printers).Error; err != nil {
+		return nil, err
+	}
+	return printers, nil
+}
+
+func (p *PrinterGORMRepository) RestorePrinter(ctx context.Context, userId string, printerId string) (*domain.Printer, error) {
+	printer := &domain.Printer{}
+	if err := p.GetDb().WithContext(ctx).Where("external_id = ? AND user_id = ? AND status = ?", printerId, userId, int(core_v1.Status_inactive)).First(printer).Error; err != nil {
+		return nil, err
+	}
+	printer.Status = int(core_v1.Status_active)
+	err, updatedPrinter := p.Update(ctx, printerId, printer)
+	if err != nil {
+		return nil, err
+	}
+	return updatedPrinter.(*domain.Printer), nil
+}
+
+// PurgePrinter permanently removes a printer and its dependent records, regardless of owner.
+func (p *PrinterGORMRepository) PurgePrinter(ctx context.Context, printerId string) (*domain.Printer, error) {
+	printer := &domain.Printer{}
+	err := p.GetDb().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("external_id = ?", printerId).First(printer).Error; err != nil {
+			return err
+		}
+		return purgePrinters(tx, []string{printerId})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return printer, nil
+}
+
+// PurgeInactivePrinters permanently removes the printers of every tenant that have been inactive since before
+// inactiveSince.
+func (p *PrinterGORMRepository) PurgeInactivePrinters(ctx context.Context, inactiveSince time.Time) (int64, error) {
+	var printerIds []string
+	err := p.GetDb().WithContext(withoutTenantScope(ctx)).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.Printer{}).Where("status = ? AND updated_at < ?", int(core_v1.Status_inactive), inactiveSince).Pluck("external_id", &printerIds).Error; err != nil {
+			return err
+		}
+		if len(printerIds) == 0 {
+			return nil
+		}
+		return purgePrinters(tx, printerIds)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(printerIds)), nil
+}
+
+func (p *PrinterGORMRepository) GetPrinterBySerialNumber(ctx context.Context, serialNumber string) (*domain.Printer, error) {
+	printer := &domain.Printer{}
+	if err := p.GetDb().WithContext(ctx).Where("serial_number = ?", serialNumber).First(printer).Error; err != nil {
+		return nil, err
+	}
+	return printer, nil
+}
+
+// UpsertPrinter creates the printer or, when the tenant already has one with the same serial number, updates it in
+// place. It is a single INSERT ... ON DUPLICATE KEY UPDATE on the index of CreatePrinterSerialIndex, so concurrent
+// upserts of a serial number neither create duplicates nor lose updates. The update only applies to a printer of the
+// same user, the printer of another user is left untouched and reported as AlreadyExists. The returned flag reports
+// whether the printer was created.
+func (p *PrinterGORMRepository) UpsertPrinter(ctx context.Context, printer *domain.Printer) (*domain.Printer, bool, error) {
+	if printer.ExternalId == "" {
+		printer.SetExternalId(uuid.NewV4().String())
+	}
+	result := p.GetDb().WithContext(ctx).Clauses(clause.OnConflict{DoUpdates: []clause.Assignment{
+		ownedUpdate("name", "VALUES(name) <> ''"),
+		ownedUpdate("description", "VALUES(description) <> ''"),
+		ownedUpdate("product_number", "VALUES(product_number) <> ''"),
+		ownedUpdate("status", "VALUES(status) <> 0"),
+		ownedUpdate("updated_at", "VALUES(updated_at) IS NOT NULL"),
+	}}).Create(printer)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	// MySQL reports one affected row for an insert, two for an update and none when nothing changed
+	if result.RowsAffected == 1 {
+		return printer, true, nil
+	}
+	existing, err := p.GetPrinterBySerialNumber(ctx, printer.SerialNumber)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing.UserId != printer.UserId {
+		return nil, false, status.Errorf(codes.AlreadyExists, "printer with serial number %v belongs to another user", printer.SerialNumber)
+	}
+	return existing, false, nil
+}
+
+// ownedUpdate assigns the inserted value of column on a duplicate key when condition holds and the existing printer
+// belongs to the same user.
+func ownedUpdate(column string, condition string) clause.Assignment {
+	return clause.Assignment{
+		Column: clause.Column{Name: column},
+		Value:  gorm.Expr(fmt.Sprintf("IF(user_id = VALUES(user_id) AND %v, VALUES(%v), %v)", condition, column, column)),
+	}
+}
+
+// printerSerialIndex is the unique index on serial numbers UpsertPrinter relies on.
+const printerSerialIndex = "uix_printers_tenant_serial_number"
+
+// CreatePrinterSerialIndex creates the unique index on serial numbers that UpsertPrinter relies on, per tenant when
+// printers have a tenant. Printers without a serial number aren't indexed, which takes a functional key part and so
+// MySQL 8.0.13 or later. It is a no-op on databases other than MySQL or when the index already exists, and fails on
+// older MySQL versions, on MariaDB or while duplicate serial numbers exist.
+func CreatePrinterSerialIndex(db *gorm.DB) error {
+	if db.Dialector.Name() != "mysql" {
+		return nil
+	}
+	db = db.WithContext(withoutTenantScope(context.Background()))
+	if db.Migrator().HasIndex(&domain.Printer{}, printerSerialIndex) {
+		return nil
+	}
+	var version string
+	if err := db.Raw("SELECT VERSION()").Row().Scan(&version); err != nil {
+		return err
+	}
+	if !supportsFunctionalIndexes(version) {
+		return fmt.Errorf("the printer serial number index needs MySQL 8.0.13 or later, found %v", version)
+	}
+	columns := "(CAST(NULLIF(serial_number, '') AS CHAR(255)))"
+	if db.Migrator().HasColumn(&domain.Printer{}, "tenant_id") {
+		columns = "tenant_id, " + columns
+	}
+	return db.Exec(fmt.Sprintf("CREATE UNIQUE INDEX %v ON printers (%v)", printerSerialIndex, columns)).Error
+}
+
+// supportsFunctionalIndexes reports whether the MySQL server of version, e.g. 8.0.26 or 8.0.26-log, supports
+// functional key parts.
+func supportsFunctionalIndexes(version string) bool {
+	if strings.Contains(version, "MariaDB") {
+		return false
+	}
+	var major, minor, patch int
+	if _, err := fmt.Sscanf(version, "%d.%d.%d", &major, &minor, &patch); err != nil {
+		return false
+	}
+	if major != 8 {
+		return major > 8
+	}
+	if minor != 0 {
+		return minor > 0
+	}
+	return patch >= 13
+}
+
+// StreamPrintersByUserId hands the user's active printers to consume one row at a time.
+func (p *PrinterGORMRepository) StreamPrintersByUserId(ctx context.Context, userId string, consume func(printer *domain.Printer) error) error {
+	db := p.GetDb().WithContext(ctx)
+	rows, err := db.Model(&domain.Printer{}).Where("user_id = ? AND status = ?", userId, int(core_v1.Status_active)).Order("id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		printer := &domain.Printer{}
+		if err := db.ScanRows(rows, printer); err != nil {
+			return err
+		}
+		if err := consume(printer); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// BatchCreatePrinters inserts the printers in transactions of chunkSize printers. Every printer is written behind its
+// own savepoint so a failing printer doesn't roll back the rest of its chunk, errs[i] is the outcome of printers[i].
+func (p *PrinterGORMRepository) BatchCreatePrinters(ctx context.Context, printers []*domain.Printer, chunkSize int) []error {
+	errs := make([]error, len(printers))
+	p.inChunks(ctx, len(printers), chunkSize, errs, func(tx *gorm.DB, i int) error {
+		if printers[i].ExternalId == "" {
+			printers[i].SetExternalId(uuid.NewV4().String())
+		}
+		return tx.Create(printers[i]).Error
+	})
+	return errs
+}
+
+// BatchUpdatePrinters merges each printer into the user's printer with the same external id, chunked the same way
+// as BatchCreatePrinters.
+func (p *PrinterGORMRepository) BatchUpdatePrinters(ctx context.Context, userId string, printers []*domain.Printer, chunkSize int) ([]*domain.Printer, []error) {
+	updated := make([]*domain.Printer, len(printers))
+	errs := make([]error, len(printers))
+	p.inChunks(ctx, len(printers), chunkSize, errs, func(tx *gorm.DB, i int) error {
+		existing := &domain.Printer{}
+		if err := tx.Where("external_id = ? AND user_id = ?", printers[i].ExternalId, userId).First(existing).Error; err != nil {
+			return err
+		}
+		existing.Merge(printers[i])
+		if err := tx.Model(existing).Updates(existing).Error; err != nil {
+			return err
+		}
+		updated[i] = existing
+		return nil
+	})
+	return updated, errs
+}
+
+// inChunks runs write for items [0, count) in one transaction per chunk, recording per item errors in errs. When a
+// chunk's transaction can't be committed every item of the chunk is marked failed.
+func (p *PrinterGORMRepository) inChunks(ctx context.Context, count int, chunkSize int, errs []error, write func(tx *gorm.DB, i int) error) {
+	if chunkSize <= 0 {
+		chunkSize = count
+	}
+	for start := 0; start < count; start += chunkSize {
+		end := start + chunkSize
+		if end > count {
+			end = count
+		}
+		err := p.GetDb().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for i := start; i < end; i++ {
+				errs[i] = tx.Transaction(func(sp *gorm.DB) error {
+					return write(sp, i)
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			for i := start; i < end; i++ {
+				if errs[i] == nil {
+					errs[i] = err
+				}
+			}
+		}
+	}
+}
+
+// TouchPrinter records that the printer was seen online at seenAt.
+func (p *PrinterGORMRepository) TouchPrinter(ctx context.Context, userId string, printerId string, seenAt time.Time) error {
+	result := p.GetDb().WithContext(ctx).Model(&domain.Printer{}).Where("external_id = ? AND user_id = ?", printerId, userId).Update("last_seen_at", seenAt)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (p *PrinterGORMRepository) GetPrinter(ctx context.Context, printerId string) (*domain.Printer, error) {
+	err, printer := p.GetByExternalId(ctx, printerId)
+	if err != nil {
+		return nil, err
+	}
+	return printer.(*domain.Printer), nil
+}
+
+// CountActivePrintersByTenant counts the active printers of every tenant that has any.
+func (p *PrinterGORMRepository) CountActivePrintersByTenant(ctx context.Context) (map[string]int64, error) {
+	var counts []struct {
+		TenantId string
+		Printers int64
+	}
+	if err := p.GetDb().WithContext(withoutTenantScope(ctx)).Model(&domain.Printer{}).
+		Select("tenant_id, COUNT(*) AS printers").
+		Where("status = ?", int(core_v1.Status_active)).
+		Group("tenant_id").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	printers := make(map[string]int64, len(counts))
+	for _, count := range counts {
+		printers[count.TenantId] = count.Printers
+	}
+	return printers, nil
+}
+
+// purgePrinters hard deletes the given printers along with every record that references them.
+// It must be called within a transaction.
+func purgePrinters(tx *gorm.DB, printerIds []string) error {
+	if err := deleteJobs(tx, "printer_id IN (?)", printerIds); err != nil {
+		return err
+	}
+	records := []interface{}{
+		&domain.PrinterGroupMember{},
+		&domain.BadgeAttempts{},
+		&domain.ConnectorPrinter{},
+		&domain.DeviceEnrollment{},
+		&domain.DeviceCertificate{},
+	}
+	for _, record := range records {
+		if err := tx.Where("printer_id IN (?)", printerIds).Delete(record).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Where("external_id IN (?)", printerIds).Delete(&domain.Printer{}).Error
+}
+
+// deleteJobs hard deletes the jobs matching the condition. Their documents and uploads are left to the document
+// expiry worker, which removes them from the document store too.
+func deleteJobs(tx *gorm.DB, query string, args ...interface{}) error {
+	return tx.Where(query, args...).Delete(&domain.PrintJob{}).Error
+}
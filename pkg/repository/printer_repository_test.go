@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"ditto/pkg/domain"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kutty-kumar/charminder/pkg"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+func newTestPrinterRepository(db *gorm.DB) *PrinterGORMRepository {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	return &PrinterGORMRepository{pkg.NewBaseGORMDao(pkg.WithDb(db), pkg.WithLogger(logger),
+		pkg.WithCreator(func() pkg.Base { return &domain.Printer{} }),
+		pkg.WithExternalIdSetter(func(externalId string, base pkg.Base) pkg.Base {
+			base.SetExternalId(externalId)
+			return base
+		}))}
+}
+
+// purgeCascade are the statements purging two printers runs, in order and within one transaction.
+var purgeCascade = []string{
+	"BEGIN",
+	"DELETE FROM `print_jobs` WHERE printer_id IN (?,?)",
+	"DELETE FROM `printer_group_members` WHERE printer_id IN (?,?)",
+	"DELETE FROM `badge_attempts` WHERE printer_id IN (?,?)",
+	"DELETE FROM `connector_printers` WHERE printer_id IN (?,?)",
+	"DELETE FROM `device_enrollments` WHERE printer_id IN (?,?)",
+	"DELETE FROM `device_certificates` WHERE printer_id IN (?,?)",
+	"DELETE FROM `printers` WHERE external_id IN (?,?)",
+	"COMMIT",
+}
+
+func TestPurgeInactivePrinters(t *testing.T) {
+	db, recorder := newRecordingDB(t)
+	recorder.answer("SELECT `external_id` FROM `printers`", []string{"external_id"}, []driver.Value{"p1"}, []driver.Value{"p2"})
+	repository := newTestPrinterRepository(db)
+	inactiveSince := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	purged, err := repository.PurgeInactivePrinters(context.Background(), inactiveSince)
+	if err != nil {
+		t.Fatalf("PurgeInactivePrinters: %v", err)
+	}
+	if purged != 2 {
+		t.Errorf("purged %d printers, want 2", purged)
+	}
+	statements := recorder.recorded()
+	if len(statements) != len(purgeCascade)+1 {
+		t.Fatalf("ran %v, want the selection of the printers within %v", statements, purgeCascade)
+	}
+	selection := statements[1]
+	if !strings.Contains(selection.query, "status = ? AND updated_at < ?") || selection.args[0] != int64(2) || selection.args[1] != inactiveSince {
+		t.Errorf("selected the printers to purge with %v, want the printers inactive since before %v", selection, inactiveSince)
+	}
+	deletes := append(statements[:1:1], statements[2:]...)
+	for i, want := range purgeCascade {
+		if deletes[i].query != want {
+			t.Errorf("statement %d is %v, want %v", i, deletes[i].query, want)
+		}
+		if strings.Contains(want, "IN (?,?)") && (len(deletes[i].args) != 2 || deletes[i].args[0] != "p1" || deletes[i].args[1] != "p2") {
+			t.Errorf("%v deletes %v, want p1 and p2", want, deletes[i].args)
+		}
+	}
+}
+
+func TestPurgeInactivePrintersWithoutExpiredPrinters(t *testing.T) {
+	db, recorder := newRecordingDB(t)
+	purged, err := newTestPrinterRepository(db).PurgeInactivePrinters(context.Background(), time.Now())
+	if err != nil || purged != 0 {
+		t.Fatalf("PurgeInactivePrinters returned %d, %v, want 0", purged, err)
+	}
+	for _, query := range recorder.queries() {
+		if strings.HasPrefix(query, "DELETE") {
+			t.Errorf("deleted with %v while no printer expired", query)
+		}
+	}
+}
+
+func TestPurgePrinterRollsBackOnFailure(t *testing.T) {
+	db, recorder := newRecordingDB(t)
+	recorder.answer("FROM `printers`", []string{"id", "external_id"}, []driver.Value{int64(1), "p1"})
+	recorder.fail("DELETE FROM `device_certificates`", errors.New("lock wait timeout exceeded"))
+	if _, err := newTestPrinterRepository(db).PurgePrinter(context.Background(), "p1"); err == nil {
+		t.Fatal("PurgePrinter succeeded while a delete failed")
+	}
+	queries := recorder.queries()
+	if last := queries[len(queries)-1]; last != "ROLLBACK" {
+		t.Errorf("the purge ended with %v, want ROLLBACK", last)
+	}
+	for _, query := range queries {
+		if strings.HasPrefix(query, "DELETE FROM `printers`") {
+			t.Error("the printer was deleted although deleting its certificates failed")
+		}
+	}
+}
+
+func TestUpsertPrinter(t *testing.T) {
+	tests := []struct {
+		name     string
+		affected int64
+		owner    string
+		created  bool
+		code     codes.Code
+	}{
+		{name: "new serial number", affected: 1, created: true},
+		{name: "printer of the same user", affected: 2, owner: "u1"},
+		{name: "unchanged printer of the same user", affected: 0, owner: "u1"},
+		{name: "printer of another user", affected: 0, owner: "u2", code: codes.AlreadyExists},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, recorder := newRecordingDB(t)
+			recorder.affected = test.affected
+			recorder.answer("FROM `printers`", []string{"external_id", "user_id", "serial_number"}, []driver.Value{"p1", test.owner, "SN-1"})
+
+			printer, created, err := newTestPrinterRepository(db).UpsertPrinter(context.Background(), &domain.Printer{UserId: "u1", SerialNumber: "SN-1"})
+			if status.Code(err) != test.code {
+				t.Fatalf("UpsertPrinter returned %v, want code %v", err, test.code)
+			}
+			if err == nil && (created != test.created || printer == nil) {
+				t.Errorf("UpsertPrinter returned %v, %v, want created %v", printer, created, test.created)
+			}
+			upsert := recorder.queries()[0]
+			if !strings.HasPrefix(upsert, "INSERT INTO `printers`") || !strings.Contains(upsert, "ON DUPLICATE KEY UPDATE `name`=IF(user_id = VALUES(user_id) AND VALUES(name) <> '', VALUES(name), name)") {
+				t.Errorf("upserted with %v, want an insert only updating printers of the same user", upsert)
+			}
+		})
+	}
+}
+
+func TestSupportsFunctionalIndexes(t *testing.T) {
+	versions := map[string]bool{
+		"8.0.13":                    true,
+		"8.0.26-log":                true,
+		"8.1.0":                     true,
+		"9.0.1":                     true,
+		"8.0.12":                    false,
+		"5.7.34":                    false,
+		"10.5.10-MariaDB-1:10.5.10": false,
+		"unknown":                   false,
+	}
+	for version, want := range versions {
+		if got := supportsFunctionalIndexes(version); got != want {
+			t.Errorf("supportsFunctionalIndexes(%q) = %v, want %v", version, got, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"github.com/kutty-kumar/ho_oh/core_v1"
+	"gorm.io/gorm"
+	"strings"
+	"unicode"
+)
+
+const (
+	FacetProductNumber = "product_number"
+	FacetStatus        = "status"
+	FacetOwner         = "owner"
+	FacetLocation      = "location"
+)
+
+var facetColumns = map[string]string{
+	FacetProductNumber: "product_number",
+	FacetStatus:        "status",
+	FacetOwner:         "user_id",
+	FacetLocation:      "location_id",
+}
+
+type PrinterSearchRepository interface {
+	Search(ctx context.Context, query domain.PrinterQuery) (*domain.PrinterSearchResult, error)
+}
+
+func NewPrinterSearchRepository(db *gorm.DB) PrinterSearchRepository {
+	return &PrinterFullTextRepository{db: db}
+}
+
+// Tokenize lower cases text and splits it on anything that isn't a letter or a digit.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// applyFilters restricts db to the active printers matching the facet filters of query.
+func applyFilters(db *gorm.DB, query domain.PrinterQuery) *gorm.DB {
+	db = db.Where("status <> ?", int(core_v1.Status_inactive))
+	if len(query.ProductNumbers) > 0 {
+		db = db.Where("product_number IN (?)", query.ProductNumbers)
+	}
+	if len(query.Statuses) > 0 {
+		db = db.Where("status IN (?)", query.Statuses)
+	}
+	if len(query.UserIds) > 0 {
+		db = db.Where("user_id IN (?)", query.UserIds)
+	}
+	if len(query.LocationIds) > 0 {
+		db = db.Where("location_id IN (?)", query.LocationIds)
+	}
+	return db
+}
+
+// PrinterFullTextRepository searches printers through the FULLTEXT index over name, description, serial number and
+// product number created by CreatePrinterSearchIndex. FULLTEXT only matches words by prefix and leaves out the ones
+// shorter than innodb_ft_min_token_size, so serial and product numbers are matched by fragment with LIKE as well, and
+// short tokens only with LIKE.
+type PrinterFullTextRepository struct {
+	db *gorm.DB
+}
+
+const fullTextMatch = "MATCH(name, description, serial_number, product_number) AGAINST (? IN BOOLEAN MODE)"
+
+// minFullTextToken is InnoDB's default innodb_ft_min_token_size, shorter tokens aren't indexed.
+const minFullTextToken = 3
+
+// CreatePrinterSearchIndex creates the FULLTEXT index used by PrinterFullTextRepository, it is a no-op on databases
+// other than MySQL or when the index already exists.
+func CreatePrinterSearchIndex(db *gorm.DB) error {
+	if db.Dialector.Name() != "mysql" {
+		return nil
+	}
+	db = db.WithContext(withoutTenantScope(context.Background()))
+	if db.Migrator().HasIndex(&domain.Printer{}, "idx_printers_search") {
+		return nil
+	}
+	return db.Exec("CREATE FULLTEXT INDEX idx_printers_search ON printers (name, description, serial_number, product_number)").Error
+}
+
+func (p *PrinterFullTextRepository) Search(ctx context.Context, query domain.PrinterQuery) (*domain.PrinterSearchResult, error) {
+	tokens := Tokenize(query.Text)
+	matches := func() *gorm.DB {
+		db := applyFilters(p.db.WithContext(ctx).Model(&domain.Printer{}), query)
+		for _, token := range tokens {
+			db = matchToken(db, token)
+		}
+		return db
+	}
+	result := &domain.PrinterSearchResult{Facets: make(map[string][]domain.FacetCount)}
+	if err := matches().Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+
+	type scoredPrinter struct {
+		domain.Printer
+		Score float64
+	}
+	var printers []scoredPrinter
+	page := matches()
+	if against := relevanceQuery(tokens); against != "" {
+		page = page.Select("printers.*, "+fullTextMatch+" AS score", against).Order("score DESC")
+	} else {
+		page = page.Select("printers.*, 0 AS score")
+	}
+	if err := page.Order("id").Limit(query.Limit).Offset(query.Offset).Scan(&printers).Error; err != nil {
+		return nil, err
+	}
+	for _, printer := range printers {
+		result.Hits = append(result.Hits, domain.PrinterHit{Printer: printer.Printer, Score: printer.Score})
+	}
+
+	for facet, column := range facetColumns {
+		var counts []domain.FacetCount
+		if err := matches().Select(column + " AS value, COUNT(*) AS count").Group(column).Order("count DESC").Scan(&counts).Error; err != nil {
+			return nil, err
+		}
+		result.Facets[facet] = counts
+	}
+	return result, nil
+}
+
+// matchToken restricts db to the printers with a word starting with token, or a serial or product number holding it.
+// Tokens too short for the FULLTEXT index are looked for in every column. Tokens are letters and digits only, so they
+// hold no LIKE wildcards.
+func matchToken(db *gorm.DB, token string) *gorm.DB {
+	fragment := "%" + token + "%"
+	if len([]rune(token)) < minFullTextToken {
+		return db.Where("name LIKE ? OR description LIKE ? OR serial_number LIKE ? OR product_number LIKE ?",
+			fragment, fragment, fragment, fragment)
+	}
+	return db.Where(fullTextMatch+" OR serial_number LIKE ? OR product_number LIKE ?", token+"*", fragment, fragment)
+}
+
+// relevanceQuery ranks printers by how many of the tokens long enough to be indexed they hold as word prefixes.
+func relevanceQuery(tokens []string) string {
+	var terms []string
+	for _, token := range tokens {
+		if len([]rune(token)) >= minFullTextToken {
+			terms = append(terms, token+"*")
+		}
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"ditto/pkg/domain"
+	"strings"
+	"testing"
+)
+
+func TestSearchMatching(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		where string
+		args  []driver.Value
+	}{
+		{name: "no text", text: "",
+			where: "WHERE status <> ?", args: []driver.Value{int64(2)}},
+		{name: "word", text: "Laser",
+			where: "WHERE status <> ? AND (" + fullTextMatch + " OR serial_number LIKE ? OR product_number LIKE ?)",
+			args:  []driver.Value{int64(2), "laser*", "%laser%", "%laser%"}},
+		{name: "serial number fragment", text: "CN-4711",
+			where: "WHERE status <> ? AND (name LIKE ? OR description LIKE ? OR serial_number LIKE ? OR product_number LIKE ?) AND (" +
+				fullTextMatch + " OR serial_number LIKE ? OR product_number LIKE ?)",
+			args: []driver.Value{int64(2), "%cn%", "%cn%", "%cn%", "%cn%", "4711*", "%4711%", "%4711%"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, recorder := newRecordingDB(t)
+			if _, err := NewPrinterSearchRepository(db).Search(context.Background(), domain.PrinterQuery{Text: test.text, Limit: 10}); err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			count := recorder.recorded()[0]
+			if !strings.HasSuffix(count.query, test.where) {
+				t.Fatalf("counted the matches with %v, want %v", count.query, test.where)
+			}
+			if len(count.args) != len(test.args) {
+				t.Fatalf("counted the matches with %v, want %v", count.args, test.args)
+			}
+			for i, arg := range test.args {
+				if count.args[i] != arg {
+					t.Errorf("counted the matches with %v, want %v", count.args, test.args)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestSearchRanksByIndexedTokens(t *testing.T) {
+	db, recorder := newRecordingDB(t)
+	if _, err := NewPrinterSearchRepository(db).Search(context.Background(), domain.PrinterQuery{Text: "hp laserjet", Limit: 10}); err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	page := recorder.recorded()[1]
+	if !strings.Contains(page.query, "ORDER BY score DESC") || page.args[0] != "laserjet*" {
+		t.Errorf("ranked the matches with %v, want their relevance to laserjet", page)
+	}
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"ditto/pkg/metrics"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const startKey = "ditto:started_at"
+
+// QueryMetrics is a gorm plugin timing every statement into the repository latency histogram.
+type QueryMetrics struct{}
+
+func NewQueryMetrics() *QueryMetrics {
+	return &QueryMetrics{}
+}
+
+func (q *QueryMetrics) Name() string {
+	return "ditto:query_metrics"
+}
+
+func (q *QueryMetrics) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("ditto:metrics_create", q.start); err != nil {
+		return err
+	}
+	if err := callbacks.Create().After("gorm:create").Register("ditto:metrics_create_end", q.observe("create")); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("ditto:metrics_query", q.start); err != nil {
+		return err
+	}
+	if err := callbacks.Query().After("gorm:query").Register("ditto:metrics_query_end", q.observe("query")); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("ditto:metrics_update", q.start); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("ditto:metrics_update_end", q.observe("update")); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("ditto:metrics_delete", q.start); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Register("ditto:metrics_delete_end", q.observe("delete")); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("ditto:metrics_row", q.start); err != nil {
+		return err
+	}
+	if err := callbacks.Row().After("gorm:row").Register("ditto:metrics_row_end", q.observe("row")); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().Before("gorm:raw").Register("ditto:metrics_raw", q.start); err != nil {
+		return err
+	}
+	return callbacks.Raw().After("gorm:raw").Register("ditto:metrics_raw_end", q.observe("raw"))
+}
+
+func (q *QueryMetrics) start(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+func (q *QueryMetrics) observe(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+		metrics.RepositoryLatency.WithLabelValues(db.Statement.Table, operation).Observe(time.Since(value.(time.Time)).Seconds())
+	}
+}
@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// statement is a statement run against a sqlRecorder, with its arguments.
+type statement struct {
+	query string
+	args  []driver.Value
+}
+
+func (s statement) String() string {
+	return fmt.Sprint(s.query, " ", s.args)
+}
+
+// fakeRows are the rows a sqlRecorder answers the queries containing match with.
+type fakeRows struct {
+	match   string
+	columns []string
+	values  [][]driver.Value
+}
+
+// sqlRecorder is a database/sql driver recording the statements run against it instead of running them. Queries are
+// answered with the first of rows that matches them, or no rows, statements containing a key of errs fail with its
+// error, and other statements affect affected rows.
+type sqlRecorder struct {
+	mu         sync.Mutex
+	statements []statement
+	rows       []fakeRows
+	errs       map[string]error
+	affected   int64
+}
+
+// newRecordingDB returns a gorm MySQL database recording its statements in the returned sqlRecorder.
+func newRecordingDB(t *testing.T) (*gorm.DB, *sqlRecorder) {
+	t.Helper()
+	recorder := &sqlRecorder{errs: map[string]error{}, affected: 1}
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sql.OpenDB(recorder), SkipInitializeWithVersion: true}),
+		&gorm.Config{SkipDefaultTransaction: true, Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("gorm.Open: %v", err)
+	}
+	return db, recorder
+}
+
+// answer makes queries containing match return the rows of values.
+func (s *sqlRecorder) answer(match string, columns []string, values ...[]driver.Value) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rows = append(s.rows, fakeRows{match: match, columns: columns, values: values})
+}
+
+// fail makes statements containing match fail with err.
+func (s *sqlRecorder) fail(match string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errs[match] = err
+}
+
+// recorded returns the statements run so far.
+func (s *sqlRecorder) recorded() []statement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]statement(nil), s.statements...)
+}
+
+// reset forgets the statements run so far.
+func (s *sqlRecorder) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statements = nil
+}
+
+// queries returns the text of the statements run so far.
+func (s *sqlRecorder) queries() []string {
+	var queries []string
+	for _, statement := range s.recorded() {
+		queries = append(queries, statement.query)
+	}
+	return queries
+}
+
+func (s *sqlRecorder) record(query string, args []driver.Value) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statements = append(s.statements, statement{query: query, args: args})
+	for match, err := range s.errs {
+		if strings.Contains(query, match) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlRecorder) Connect(ctx context.Context) (driver.Conn, error) {
+	return recorderConn{s}, nil
+}
+
+func (s *sqlRecorder) Driver() driver.Driver {
+	return recorderDriver{s}
+}
+
+type recorderDriver struct {
+	recorder *sqlRecorder
+}
+
+func (d recorderDriver) Open(name string) (driver.Conn, error) {
+	return recorderConn{d.recorder}, nil
+}
+
+type recorderConn struct {
+	recorder *sqlRecorder
+}
+
+func (c recorderConn) Prepare(query string) (driver.Stmt, error) {
+	return recorderStmt{recorder: c.recorder, query: query}, nil
+}
+
+func (c recorderConn) Close() error {
+	return nil
+}
+
+func (c recorderConn) Begin() (driver.Tx, error) {
+	return recorderTx{c.recorder}, c.recorder.record("BEGIN", nil)
+}
+
+type recorderTx struct {
+	recorder *sqlRecorder
+}
+
+func (t recorderTx) Commit() error {
+	return t.recorder.record("COMMIT", nil)
+}
+
+func (t recorderTx) Rollback() error {
+	return t.recorder.record("ROLLBACK", nil)
+}
+
+type recorderStmt struct {
+	recorder *sqlRecorder
+	query    string
+}
+
+func (s recorderStmt) Close() error {
+	return nil
+}
+
+func (s recorderStmt) NumInput() int {
+	return -1
+}
+
+func (s recorderStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.recorder.record(s.query, args); err != nil {
+		return nil, err
+	}
+	return recorderResult{s.recorder.affected}, nil
+}
+
+func (s recorderStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if err := s.recorder.record(s.query, args); err != nil {
+		return nil, err
+	}
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	for _, rows := range s.recorder.rows {
+		if strings.Contains(s.query, rows.match) {
+			return &recorderRows{columns: rows.columns, values: rows.values}, nil
+		}
+	}
+	return &recorderRows{}, nil
+}
+
+type recorderResult struct {
+	affected int64
+}
+
+func (r recorderResult) LastInsertId() (int64, error) {
+	return 1, nil
+}
+
+func (r recorderResult) RowsAffected() (int64, error) {
+	return r.affected, nil
+}
+
+type recorderRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *recorderRows) Columns() []string {
+	return r.columns
+}
+
+func (r *recorderRows) Close() error {
+	return nil
+}
+
+func (r *recorderRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"gorm.io/gorm"
+	"time"
+)
+
+type ReleaseCredentialRepository interface {
+	GetCredential(ctx context.Context, userId string) (*domain.ReleaseCredential, error)
+	GetCredentialByBadge(ctx context.Context, badgeDigest string) (*domain.ReleaseCredential, error)
+	SaveCredential(ctx context.Context, credential *domain.ReleaseCredential) error
+	DeleteCredential(ctx context.Context, userId string) error
+	RecordFailedAttempt(ctx context.Context, userId string, maxAttempts int, lockedUntil time.Time) error
+	ResetFailedAttempts(ctx context.Context, userId string) error
+	GetBadgeAttempts(ctx context.Context, printerId string) (*domain.BadgeAttempts, error)
+	RecordFailedBadge(ctx context.Context, printerId string, maxAttempts int, lockedUntil time.Time) error
+}
+
+// lockoutAssignments count a failed attempt, setting locked_until once maxAttempts are reached and starting the
+// count over. MySQL assigns in order, so locked_until must come first to see the count before it starts over.
+const lockoutAssignments = "locked_until = CASE WHEN failed_attempts + 1 >= ? THEN ? ELSE locked_until END, " +
+	"failed_attempts = CASE WHEN failed_attempts + 1 >= ? THEN 0 ELSE failed_attempts + 1 END"
+
+func NewReleaseCredentialGORMRepository(db *gorm.DB) ReleaseCredentialRepository {
+	return &ReleaseCredentialGORMRepository{db: db}
+}
+
+type ReleaseCredentialGORMRepository struct {
+	db *gorm.DB
+}
+
+func (r *ReleaseCredentialGORMRepository) GetCredential(ctx context.Context, userId string) (*domain.ReleaseCredential, error) {
+	credential := &domain.ReleaseCredential{}
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userId).First(credential).Error; err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+func (r *ReleaseCredentialGORMRepository) GetCredentialByBadge(ctx context.Context, badgeDigest string) (*domain.ReleaseCredential, error) {
+	credential := &domain.ReleaseCredential{}
+	if err := r.db.WithContext(ctx).Where("badge_digest = ?", badgeDigest).First(credential).Error; err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// SaveCredential creates the credential or, when it was loaded before, overwrites it.
+func (r *ReleaseCredentialGORMRepository) SaveCredential(ctx context.Context, credential *domain.ReleaseCredential) error {
+	return r.db.WithContext(ctx).Save(credential).Error
+}
+
+func (r *ReleaseCredentialGORMRepository) DeleteCredential(ctx context.Context, userId string) error {
+	result := r.db.WithContext(ctx).Where("user_id = ?", userId).Delete(&domain.ReleaseCredential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// RecordFailedAttempt counts a failed PIN attempt, locking the credential until lockedUntil once maxAttempts are
+// reached. The count starts over after the lock. Raw SQL isn't confined to the caller's tenant by TenantScoping, so
+// the statement names the tenant itself.
+func (r *ReleaseCredentialGORMRepository) RecordFailedAttempt(ctx context.Context, userId string, maxAttempts int, lockedUntil time.Time) error {
+	tenantId, err := callerTenant(ctx)
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(withoutTenantScope(ctx)).
+		Exec("UPDATE release_credentials SET "+lockoutAssignments+", updated_at = ? WHERE user_id = ? AND tenant_id = ?",
+			maxAttempts, lockedUntil, maxAttempts, time.Now(), userId, tenantId).Error
+}
+
+func (r *ReleaseCredentialGORMRepository) ResetFailedAttempts(ctx context.Context, userId string) error {
+	return r.db.WithContext(ctx).Model(&domain.ReleaseCredential{}).
+		Where("user_id = ? AND failed_attempts > 0", userId).
+		Update("failed_attempts", 0).Error
+}
+
+func (r *ReleaseCredentialGORMRepository) GetBadgeAttempts(ctx context.Context, printerId string) (*domain.BadgeAttempts, error) {
+	attempts := &domain.BadgeAttempts{}
+	if err := r.db.WithContext(ctx).Where("printer_id = ?", printerId).First(attempts).Error; err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+// RecordFailedBadge counts an unknown badge presented at the printer, locking badge release there until lockedUntil
+// once maxAttempts are reached. The count starts over after the lock. Like RecordFailedAttempt, the statement names
+// the caller's tenant itself.
+func (r *ReleaseCredentialGORMRepository) RecordFailedBadge(ctx context.Context, printerId string, maxAttempts int, lockedUntil time.Time) error {
+	tenantId, err := callerTenant(ctx)
+	if err != nil {
+		return err
+	}
+	failedAttempts, locked := 1, (*time.Time)(nil)
+	if maxAttempts <= 1 {
+		failedAttempts, locked = 0, &lockedUntil
+	}
+	return r.db.WithContext(withoutTenantScope(ctx)).
+		Exec("INSERT INTO badge_attempts (printer_id, failed_attempts, locked_until, updated_at, tenant_id) VALUES (?, ?, ?, ?, ?) "+
+			"ON DUPLICATE KEY UPDATE "+lockoutAssignments+", updated_at = VALUES(updated_at)",
+			printerId, failedAttempts, locked, time.Now(), tenantId, maxAttempts, lockedUntil, maxAttempts).Error
+}
@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type replicaKey struct{}
+
+type writesKey struct{}
+
+// FromReplica lets the reads run with ctx go to a replica, unless the request they belong to wrote already.
+func FromReplica(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaKey{}, true)
+}
+
+// TrackWrites remembers the writes run with ctx, or a context derived from it, so that the reads of a request that
+// follow its writes see them on the primary.
+func TrackWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, writesKey{}, new(int32))
+}
+
+func wrote(ctx context.Context) bool {
+	writes, ok := ctx.Value(writesKey{}).(*int32)
+	return ok && atomic.LoadInt32(writes) == 1
+}
+
+// Replica is a read replica of the database, Name identifying it in logs.
+type Replica struct {
+	Name    string
+	DB      *sql.DB
+	healthy int32
+}
+
+// ReplicaRouting is a gorm plugin sending the reads whose context comes from FromReplica to a replica, picked round
+// robin among those replicating within maxLag of the primary. Every other statement, the statements of transactions
+// and the reads of requests that wrote already go to the primary, as do all reads while no replica is healthy.
+// Replicas are taken out of rotation by CheckLag, they start out of it until it ran once.
+type ReplicaRouting struct {
+	logger   *logrus.Logger
+	replicas []*Replica
+	next     uint32
+	mu       sync.Mutex
+	maxLag   time.Duration
+}
+
+func NewReplicaRouting(logger *logrus.Logger, maxLag time.Duration, replicas ...*Replica) *ReplicaRouting {
+	return &ReplicaRouting{logger: logger, replicas: replicas, maxLag: maxLag}
+}
+
+func (r *ReplicaRouting) Name() string {
+	return "ditto:replica_routing"
+}
+
+func (r *ReplicaRouting) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Query().Before("gorm:query").Register("ditto:replica_query", r.route); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("ditto:replica_row", r.route); err != nil {
+		return err
+	}
+	if err := callbacks.Create().Before("gorm:create").Register("ditto:replica_create", r.trackWrite); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("ditto:replica_update", r.trackWrite); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("ditto:replica_delete", r.trackWrite); err != nil {
+		return err
+	}
+	return callbacks.Raw().Before("gorm:raw").Register("ditto:replica_raw", r.trackWrite)
+}
+
+// Replicas returns the replicas, in and out of rotation.
+func (r *ReplicaRouting) Replicas() []*Replica {
+	return r.replicas
+}
+
+// SetMaxLag changes how far behind the primary replicas may fall, it takes effect on the next CheckLag.
+func (r *ReplicaRouting) SetMaxLag(maxLag time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxLag = maxLag
+}
+
+// CheckLag puts the replicas replicating within maxLag of the primary in rotation and takes the others out of it.
+func (r *ReplicaRouting) CheckLag(ctx context.Context) {
+	r.mu.Lock()
+	maxLag := r.maxLag
+	r.mu.Unlock()
+	for _, replica := range r.replicas {
+		lag, err := replicationLag(ctx, replica.DB)
+		if err == nil && lag > maxLag {
+			err = fmt.Errorf("it is %v behind the primary", lag)
+		}
+		if err != nil {
+			if atomic.SwapInt32(&replica.healthy, 0) == 1 {
+				r.logger.Warnf("Reading from the primary instead of replica %v as %v", replica.Name, err)
+			}
+			continue
+		}
+		if atomic.SwapInt32(&replica.healthy, 1) == 0 {
+			r.logger.Infof("Reading from replica %v, %v behind the primary", replica.Name, lag)
+		}
+	}
+}
+
+// pick returns the next replica in rotation, nil when none is.
+func (r *ReplicaRouting) pick() *Replica {
+	for range r.replicas {
+		replica := r.replicas[int(atomic.AddUint32(&r.next, 1))%len(r.replicas)]
+		if atomic.LoadInt32(&replica.healthy) == 1 {
+			return replica
+		}
+	}
+	return nil
+}
+
+func (r *ReplicaRouting) route(db *gorm.DB) {
+	ctx := db.Statement.Context
+	if ctx == nil || ctx.Value(replicaKey{}) == nil || wrote(ctx) {
+		return
+	}
+	// transactions and prepared statements keep to the connection of the primary they hold
+	if _, ok := db.Statement.ConnPool.(*sql.DB); !ok {
+		return
+	}
+	if replica := r.pick(); replica != nil {
+		db.Statement.ConnPool = replica.DB
+	}
+}
+
+func (r *ReplicaRouting) trackWrite(db *gorm.DB) {
+	if db.Statement.Context == nil {
+		return
+	}
+	if writes, ok := db.Statement.Context.Value(writesKey{}).(*int32); ok {
+		atomic.StoreInt32(writes, 1)
+	}
+}
+
+// replicationLag returns how far behind its primary the replica db is, failing when it isn't replicating.
+func replicationLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	rows, err := db.QueryContext(ctx, "SHOW SLAVE STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("it isn't replicating")
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+	for i, column := range columns {
+		if column != "Seconds_Behind_Master" && column != "Seconds_Behind_Source" {
+			continue
+		}
+		if !values[i].Valid {
+			return 0, errors.New("its replication is stopped")
+		}
+		seconds, err := strconv.ParseInt(values[i].String, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, errors.New("it doesn't report its lag")
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"ditto/pkg/domain"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// newTestReplica returns a replica reporting it is lag seconds behind the primary, replicating stopped when lag is
+// nil, and the recorder of the statements run against it.
+func newTestReplica(name string, lag driver.Value) (*Replica, *sqlRecorder) {
+	recorder := &sqlRecorder{errs: map[string]error{}, affected: 1}
+	recorder.answer("SHOW SLAVE STATUS", []string{"Slave_IO_State", "Seconds_Behind_Master"}, []driver.Value{"", lag})
+	return &Replica{Name: name, DB: sql.OpenDB(recorder)}, recorder
+}
+
+// newRoutedDB returns a recording primary routing reads to replicas within 5s of it, after checking their lag.
+func newRoutedDB(t *testing.T, replicas ...*Replica) (*gorm.DB, *sqlRecorder) {
+	t.Helper()
+	db, primary := newRecordingDB(t)
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	routing := NewReplicaRouting(logger, 5*time.Second, replicas...)
+	if err := db.Use(routing); err != nil {
+		t.Fatalf("registering replica routing: %v", err)
+	}
+	routing.CheckLag(context.Background())
+	return db, primary
+}
+
+// printerReads counts the statements recorded other than the lag checks.
+func printerReads(recorder *sqlRecorder) int {
+	var reads int
+	for _, query := range recorder.queries() {
+		if query != "SHOW SLAVE STATUS" {
+			reads++
+		}
+	}
+	return reads
+}
+
+func TestReplicaRouting(t *testing.T) {
+	tests := []struct {
+		name string
+		lag  driver.Value
+		run  func(db *gorm.DB) error
+		// fromReplica is whether the read is expected on the replica rather than the primary
+		fromReplica bool
+	}{
+		{"read from a replica", int64(1), func(db *gorm.DB) error {
+			return db.WithContext(FromReplica(context.Background())).Find(&[]domain.Printer{}).Error
+		}, true},
+		{"read without asking for a replica", int64(1), func(db *gorm.DB) error {
+			return db.WithContext(context.Background()).Find(&[]domain.Printer{}).Error
+		}, false},
+		{"replica too far behind", int64(60), func(db *gorm.DB) error {
+			return db.WithContext(FromReplica(context.Background())).Find(&[]domain.Printer{}).Error
+		}, false},
+		{"replication stopped", nil, func(db *gorm.DB) error {
+			return db.WithContext(FromReplica(context.Background())).Find(&[]domain.Printer{}).Error
+		}, false},
+		{"read after the request wrote", int64(1), func(db *gorm.DB) error {
+			ctx := TrackWrites(context.Background())
+			if err := db.WithContext(ctx).Model(&domain.Printer{}).Where("id = ?", 1).Update("name", "p1").Error; err != nil {
+				return err
+			}
+			return db.WithContext(FromReplica(ctx)).Find(&[]domain.Printer{}).Error
+		}, false},
+		{"read within a transaction", int64(1), func(db *gorm.DB) error {
+			return db.WithContext(FromReplica(context.Background())).Transaction(func(tx *gorm.DB) error {
+				return tx.Find(&[]domain.Printer{}).Error
+			})
+		}, false},
+	}
+	for _, test := range tests {
+		replica, replicaRecorder := newTestReplica("replica-1", test.lag)
+		db, primary := newRoutedDB(t, replica)
+		if err := test.run(db); err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if got := printerReads(replicaRecorder) == 1; got != test.fromReplica {
+			t.Errorf("%v: the replica ran %v, the primary %v", test.name, replicaRecorder.queries(), primary.queries())
+		}
+	}
+}
+
+func TestReplicaRoutingSpreadsReads(t *testing.T) {
+	first, firstRecorder := newTestReplica("replica-1", int64(0))
+	second, secondRecorder := newTestReplica("replica-2", int64(0))
+	lagging, laggingRecorder := newTestReplica("replica-3", int64(60))
+	db, primary := newRoutedDB(t, first, second, lagging)
+	for i := 0; i < 4; i++ {
+		if err := db.WithContext(FromReplica(context.Background())).Find(&[]domain.Printer{}).Error; err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+	}
+	if printerReads(firstRecorder) != 2 || printerReads(secondRecorder) != 2 || printerReads(laggingRecorder) != 0 || printerReads(primary) != 0 {
+		t.Errorf("got %v, %v and %v reads from the replicas and %v from the primary, want the replicas in rotation to share them",
+			printerReads(firstRecorder), printerReads(secondRecorder), printerReads(laggingRecorder), printerReads(primary))
+	}
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+type TenantRepository interface {
+	CreateTenant(ctx context.Context, tenant *domain.Tenant) error
+	GetTenant(ctx context.Context, tenantId string) (*domain.Tenant, error)
+	GetTenants(ctx context.Context) ([]domain.Tenant, error)
+	UpdateTenant(ctx context.Context, tenant *domain.Tenant) error
+	DeleteTenant(ctx context.Context, tenantId string) error
+	CountPrinters(ctx context.Context, tenantId string) (int64, error)
+}
+
+func NewTenantGORMRepository(db *gorm.DB) TenantRepository {
+	return &TenantGORMRepository{db: db}
+}
+
+type TenantGORMRepository struct {
+	db *gorm.DB
+}
+
+func (t *TenantGORMRepository) CreateTenant(ctx context.Context, tenant *domain.Tenant) error {
+	return t.db.WithContext(ctx).Create(tenant).Error
+}
+
+func (t *TenantGORMRepository) GetTenant(ctx context.Context, tenantId string) (*domain.Tenant, error) {
+	tenant := &domain.Tenant{}
+	if err := t.db.WithContext(ctx).Where("tenant_id = ?", tenantId).First(tenant).Error; err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
+
+func (t *TenantGORMRepository) GetTenants(ctx context.Context) ([]domain.Tenant, error) {
+	var tenants []domain.Tenant
+	if err := t.db.WithContext(ctx).Order("tenant_id").Find(&tenants).Error; err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
+
+func (t *TenantGORMRepository) UpdateTenant(ctx context.Context, tenant *domain.Tenant) error {
+	return t.db.WithContext(ctx).Model(tenant).Updates(map[string]interface{}{"name": tenant.Name}).Error
+}
+
+// DeleteTenant deletes the tenant, failing while printers still belong to it.
+func (t *TenantGORMRepository) DeleteTenant(ctx context.Context, tenantId string) error {
+	return t.db.WithContext(withoutTenantScope(ctx)).Transaction(func(tx *gorm.DB) error {
+		var printers int64
+		if err := tx.Model(&domain.Printer{}).Where("tenant_id = ?", tenantId).Count(&printers).Error; err != nil {
+			return err
+		}
+		if printers > 0 {
+			return status.Errorf(codes.FailedPrecondition, "tenant %v still has %d printers", tenantId, printers)
+		}
+		result := tx.Where("tenant_id = ?", tenantId).Delete(&domain.Tenant{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// CountPrinters counts the printers of a tenant whatever the tenant of the caller.
+func (t *TenantGORMRepository) CountPrinters(ctx context.Context, tenantId string) (int64, error) {
+	var count int64
+	err := t.db.WithContext(withoutTenantScope(ctx)).Model(&domain.Printer{}).Where("tenant_id = ?", tenantId).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TenantTables are the tables whose rows belong to a tenant.
+var TenantTables = []string{"printers", "locations", "printer_groups", "printer_group_members", "print_jobs", "connectors",
+	"device_enrollments", "device_certificates", "document_uploads", "release_credentials", "badge_attempts",
+	"idempotency_records"}
+
+// ErrTenantRequired fails statements on tenant tables whose context neither names a tenant nor opts out of tenant
+// scoping.
+var ErrTenantRequired = errors.New("statement on a tenant table without a tenant")
+
+type unscopedKey struct{}
+
+// withoutTenantScope lets statements run with ctx reach the rows of every tenant, for platform wide operations and
+// for the lookups that authenticate a caller before its tenant is known.
+func withoutTenantScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey{}, true)
+}
+
+func unscoped(ctx context.Context) bool {
+	return ctx != nil && ctx.Value(unscopedKey{}) != nil
+}
+
+// callerTenant returns the tenant of the user, or of the device, authenticated in ctx.
+func callerTenant(ctx context.Context) (string, error) {
+	if ctx != nil {
+		if user, ok := ctx.Value("user").(map[string]string); ok {
+			return user["tenant_id"], nil
+		}
+		if device, ok := ctx.Value("device").(map[string]string); ok {
+			return device["tenant_id"], nil
+		}
+	}
+	return "", ErrTenantRequired
+}
+
+// TenantScoping is a gorm plugin confining statements on tenant tables to the tenant of the user or device
+// authenticated in the statement's context, and stamping that tenant on the rows they create. It fails closed:
+// statements on tenant tables whose context has no caller fail with ErrTenantRequired unless they opted out with
+// withoutTenantScope, and so do raw statements naming a tenant table, which can't be confined.
+type TenantScoping struct {
+	tables map[string]bool
+}
+
+func NewTenantScoping(tables ...string) *TenantScoping {
+	scoping := &TenantScoping{tables: map[string]bool{}}
+	for _, table := range tables {
+		scoping.tables[table] = true
+	}
+	return scoping
+}
+
+func (t *TenantScoping) Name() string {
+	return "ditto:tenant_scoping"
+}
+
+func (t *TenantScoping) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("ditto:tenant_create", t.stampTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("ditto:tenant_query", t.scopeTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("ditto:tenant_row", t.scopeTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().Before("gorm:raw").Register("ditto:tenant_raw", t.scopeTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("ditto:tenant_update", t.scopeTenant); err != nil {
+		return err
+	}
+	return callbacks.Delete().Before("gorm:delete").Register("ditto:tenant_delete", t.scopeTenant)
+}
+
+// tenant returns the tenant the statement is confined to, false when it isn't confined. It fails the statement when
+// it touches a tenant table without a tenant, or as raw SQL.
+func (t *TenantScoping) tenant(db *gorm.DB) (string, bool) {
+	ctx := db.Statement.Context
+	if unscoped(ctx) {
+		return "", false
+	}
+	if db.Statement.SQL.Len() > 0 {
+		if table := t.rawTable(db.Statement.SQL.String()); table != "" {
+			db.AddError(fmt.Errorf("raw SQL on tenant table %v can't be confined to a tenant", table))
+		}
+		return "", false
+	}
+	if !t.tables[db.Statement.Table] {
+		return "", false
+	}
+	tenantId, err := callerTenant(ctx)
+	if err != nil {
+		db.AddError(fmt.Errorf("%w: %v", err, db.Statement.Table))
+		return "", false
+	}
+	return tenantId, true
+}
+
+// rawTable returns the first tenant table named in sql.
+func (t *TenantScoping) rawTable(sql string) string {
+	words := strings.FieldsFunc(sql, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	for _, word := range words {
+		if t.tables[word] {
+			return word
+		}
+	}
+	return ""
+}
+
+func (t *TenantScoping) scopeTenant(db *gorm.DB) {
+	tenantId, ok := t.tenant(db)
+	if !ok {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "tenant_id"}, Value: tenantId},
+	}})
+}
+
+func (t *TenantScoping) stampTenant(db *gorm.DB) {
+	tenantId, ok := t.tenant(db)
+	if !ok || db.Statement.Schema == nil {
+		return
+	}
+	field := db.Statement.Schema.LookUpField("TenantId")
+	if field == nil {
+		return
+	}
+	value := db.Statement.ReflectValue
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := field.Set(reflect.Indirect(value.Index(i)), tenantId); err != nil {
+				db.AddError(err)
+			}
+		}
+	case reflect.Struct:
+		if err := field.Set(value, tenantId); err != nil {
+			db.AddError(err)
+		}
+	}
+}
+
+// Migrate migrates the schema of models. Migrations alter tenant tables as a whole, so they aren't confined to a
+// tenant.
+func Migrate(db *gorm.DB, models ...interface{}) error {
+	return db.WithContext(withoutTenantScope(context.Background())).AutoMigrate(models...)
+}
+
+// tenantBackfills name the record the rows of a tenant table belong to, whose tenant they take.
+var tenantBackfills = []struct {
+	table, column, parent string
+}{
+	{"printer_group_members", "group_id", "printer_groups"},
+	{"device_enrollments", "printer_id", "printers"},
+	{"device_certificates", "printer_id", "printers"},
+	{"badge_attempts", "printer_id", "printers"},
+	{"document_uploads", "job_id", "print_jobs"},
+}
+
+// BackfillTenants assigns the rows written before their table had a tenant, whose tenant_id is NULL, the tenant of
+// the record they belong to. The rest, such as the release credentials and idempotency records of users, are left
+// without a tenant. It is a no-op on databases other than MySQL.
+func BackfillTenants(db *gorm.DB) error {
+	if db.Dialector.Name() != "mysql" {
+		return nil
+	}
+	db = db.WithContext(withoutTenantScope(context.Background()))
+	for _, backfill := range tenantBackfills {
+		err := db.Exec(fmt.Sprintf("UPDATE %[1]v JOIN %[3]v ON %[3]v.external_id = %[1]v.%[2]v "+
+			"SET %[1]v.tenant_id = COALESCE(%[3]v.tenant_id, '') WHERE %[1]v.tenant_id IS NULL", backfill.table, backfill.column, backfill.parent)).Error
+		if err != nil {
+			return err
+		}
+	}
+	for _, table := range TenantTables {
+		if err := db.Exec(fmt.Sprintf("UPDATE %v SET tenant_id = '' WHERE tenant_id IS NULL", table)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"ditto/pkg/domain"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// newScopedDB returns a recording database confining statements on the tenant tables to the caller's tenant.
+func newScopedDB(t *testing.T) (*gorm.DB, *sqlRecorder) {
+	t.Helper()
+	db, recorder := newRecordingDB(t)
+	if err := db.Use(NewTenantScoping(TenantTables...)); err != nil {
+		t.Fatalf("registering tenant scoping: %v", err)
+	}
+	return db, recorder
+}
+
+func tenantContext(tenantId string) context.Context {
+	return context.WithValue(context.Background(), "user", map[string]string{"user_id": "user-1", "tenant_id": tenantId})
+}
+
+// hasArg reports whether the statement was run with value among its arguments.
+func hasArg(s statement, value string) bool {
+	for _, arg := range s.args {
+		if arg == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTenantScopingConfinesStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(ctx context.Context, db *gorm.DB) error
+		// confined are the tenant conditions the statements, subqueries included, must hold
+		confined []string
+	}{
+		{"get printer", func(ctx context.Context, db *gorm.DB) error {
+			_, err := newTestPrinterRepository(db).GetPrinter(ctx, "p1")
+			return err
+		}, []string{"`printers`.`tenant_id` = ?"}},
+		{"list printers", func(ctx context.Context, db *gorm.DB) error {
+			_, err := newTestPrinterRepository(db).GetPrintersByUserId(ctx, "user-1")
+			return err
+		}, []string{"`printers`.`tenant_id` = ?"}},
+		{"update printer", func(ctx context.Context, db *gorm.DB) error {
+			return newTestPrinterRepository(db).TouchPrinter(ctx, "user-1", "p1", time.Now())
+		}, []string{"`printers`.`tenant_id` = ?"}},
+		{"delete group", func(ctx context.Context, db *gorm.DB) error {
+			return newTestPrinterGroupRepository(db).DeleteGroup(ctx, "g1")
+		}, []string{"`printer_group_members`.`tenant_id` = ?", "`printer_groups`.`tenant_id` = ?"}},
+		{"group members", func(ctx context.Context, db *gorm.DB) error {
+			group := &domain.PrinterGroup{Membership: int(domain.GroupMembershipStatic)}
+			_, err := newTestPrinterGroupRepository(db).GetMembers(ctx, group)
+			return err
+		}, []string{"`printers`.`tenant_id` = ?", "`printer_group_members`.`tenant_id` = ?"}},
+		{"get certificate", func(ctx context.Context, db *gorm.DB) error {
+			_, err := NewEnrollmentGORMRepository(db).GetCertificate(ctx, "serial")
+			return err
+		}, []string{"`device_certificates`.`tenant_id` = ?"}},
+		{"revoke certificate", func(ctx context.Context, db *gorm.DB) error {
+			return NewEnrollmentGORMRepository(db).RevokeCertificate(ctx, "serial", time.Now())
+		}, []string{"`device_certificates`.`tenant_id` = ?"}},
+		{"get upload", func(ctx context.Context, db *gorm.DB) error {
+			_, err := NewDocumentGORMRepository(db).GetUpload(ctx, "user-1", "u1")
+			return err
+		}, []string{"`document_uploads`.`tenant_id` = ?"}},
+		{"delete credential", func(ctx context.Context, db *gorm.DB) error {
+			return NewReleaseCredentialGORMRepository(db).DeleteCredential(ctx, "user-1")
+		}, []string{"`release_credentials`.`tenant_id` = ?"}},
+		{"get badge attempts", func(ctx context.Context, db *gorm.DB) error {
+			_, err := NewReleaseCredentialGORMRepository(db).GetBadgeAttempts(ctx, "p1")
+			return err
+		}, []string{"`badge_attempts`.`tenant_id` = ?"}},
+		{"release idempotency record", func(ctx context.Context, db *gorm.DB) error {
+			return NewIdempotencyGORMRepository(db).Release(ctx, &domain.IdempotencyRecord{Id: 1})
+		}, []string{"`idempotency_records`.`tenant_id` = ?"}},
+		{"count failed pin attempt", func(ctx context.Context, db *gorm.DB) error {
+			return NewReleaseCredentialGORMRepository(db).RecordFailedAttempt(ctx, "user-1", 3, time.Now())
+		}, []string{"AND tenant_id = ?"}},
+	}
+	for _, test := range tests {
+		db, recorder := newScopedDB(t)
+		if err := test.run(tenantContext("tenant-1"), db); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		var statements int
+		for _, s := range recorder.recorded() {
+			if s.query == "BEGIN" || s.query == "COMMIT" {
+				continue
+			}
+			statements++
+			if !hasArg(s, "tenant-1") {
+				t.Errorf("%v: %v isn't confined to the caller's tenant", test.name, s)
+			}
+		}
+		if statements == 0 {
+			t.Errorf("%v ran no statements", test.name)
+		}
+		queries := strings.Join(recorder.queries(), "\n")
+		for _, condition := range test.confined {
+			if !strings.Contains(queries, condition) {
+				t.Errorf("%v: no statement holds %v in\n%v", test.name, condition, queries)
+			}
+		}
+	}
+}
+
+func TestTenantScopingStampsCreatedRows(t *testing.T) {
+	db, recorder := newScopedDB(t)
+	// a caller can't create rows in another tenant
+	group := &domain.PrinterGroup{Name: "floor 1", TenantId: "tenant-2"}
+	group.SetExternalId("g1")
+	if _, err := newTestPrinterGroupRepository(db).CreateGroup(tenantContext("tenant-1"), group); err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	recorder.answer("FROM `printers`", []string{"id"}, []driver.Value{int64(1)})
+	if err := newTestPrinterGroupRepository(db).AddMember(tenantContext("tenant-1"), "g1", "p1"); err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+	for _, s := range recorder.recorded() {
+		if strings.HasPrefix(s.query, "INSERT") && (!hasArg(s, "tenant-1") || hasArg(s, "tenant-2")) {
+			t.Errorf("%v isn't stamped with the caller's tenant", s)
+		}
+	}
+}
+
+func TestTenantScopingFailsClosed(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(db *gorm.DB) error
+	}{
+		{"get printer without a caller", func(db *gorm.DB) error {
+			_, err := newTestPrinterRepository(db).GetPrinter(context.Background(), "p1")
+			return err
+		}},
+		{"create enrollment certificate without a caller", func(db *gorm.DB) error {
+			return NewEnrollmentGORMRepository(db).CreateCertificate(context.Background(), &domain.DeviceCertificate{Serial: "serial"})
+		}},
+		{"store idempotency record without a caller", func(db *gorm.DB) error {
+			_, _, err := NewIdempotencyGORMRepository(db).Reserve(context.Background(), &domain.IdempotencyRecord{Key: "k"})
+			return err
+		}},
+		{"raw statement on a tenant table", func(db *gorm.DB) error {
+			return db.WithContext(tenantContext("tenant-1")).Exec("UPDATE `printers` SET name = ?", "x").Error
+		}},
+		{"raw query on a tenant table", func(db *gorm.DB) error {
+			var count int64
+			return db.WithContext(tenantContext("tenant-1")).Raw("SELECT COUNT(*) FROM connectors").Scan(&count).Error
+		}},
+		{"pin attempt without a caller", func(db *gorm.DB) error {
+			return NewReleaseCredentialGORMRepository(db).RecordFailedAttempt(context.Background(), "user-1", 3, time.Now())
+		}},
+	}
+	for _, test := range tests {
+		db, recorder := newScopedDB(t)
+		if err := test.run(db); err == nil || errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("%v returned %v, want it refused", test.name, err)
+		}
+		if queries := recorder.queries(); len(queries) != 0 {
+			t.Errorf("%v ran %v", test.name, queries)
+		}
+	}
+}
+
+func TestWithoutTenantScope(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(db *gorm.DB) error
+	}{
+		{"purge inactive printers", func(db *gorm.DB) error {
+			_, err := newTestPrinterRepository(db).PurgeInactivePrinters(context.Background(), time.Now())
+			return err
+		}},
+		{"delete expired enrollments", func(db *gorm.DB) error {
+			_, err := NewEnrollmentGORMRepository(db).DeleteExpiredEnrollments(context.Background(), time.Now())
+			return err
+		}},
+		{"authenticate a connector", func(db *gorm.DB) error {
+			_, err := NewConnectorGORMRepository(db).GetConnectorOfAnyTenant(context.Background(), "c1")
+			return err
+		}},
+		{"authenticate a device", func(db *gorm.DB) error {
+			_, err := NewEnrollmentGORMRepository(db).GetCertificateOfAnyTenant(context.Background(), "serial")
+			return err
+		}},
+		{"expire documents", func(db *gorm.DB) error {
+			_, err := NewDocumentGORMRepository(db).GetExpiredDocuments(context.Background(), time.Now(), 10)
+			return err
+		}},
+	}
+	for _, test := range tests {
+		db, recorder := newScopedDB(t)
+		if err := test.run(db); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("%v: %v", test.name, err)
+		}
+		queries := recorder.queries()
+		if len(queries) == 0 {
+			t.Errorf("%v ran no statements", test.name)
+		}
+		for _, query := range queries {
+			if strings.Contains(query, "tenant_id") {
+				t.Errorf("%v: %v is confined to a tenant", test.name, query)
+			}
+		}
+	}
+}
+
+func TestClaimEnrollmentMovesItIntoTheCallersTenant(t *testing.T) {
+	db, recorder := newScopedDB(t)
+	claimed, err := NewEnrollmentGORMRepository(db).ClaimEnrollment(tenantContext("tenant-1"), "e1", "user-1")
+	if err != nil || !claimed {
+		t.Fatalf("ClaimEnrollment returned %v, %v", claimed, err)
+	}
+	statements := recorder.recorded()
+	if len(statements) != 1 || !strings.Contains(statements[0].query, "`tenant_id`=?") || !hasArg(statements[0], "tenant-1") {
+		t.Errorf("got %v, want the pending enrollment of any tenant moved into tenant-1", statements)
+	}
+	if strings.Contains(statements[0].query, "WHERE") && strings.Contains(statements[0].query[strings.Index(statements[0].query, "WHERE"):], "tenant_id") {
+		t.Errorf("%v only claims enrollments of the caller's tenant", statements[0])
+	}
+}
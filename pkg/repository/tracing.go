@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"go.opentelemetry.io/otel"
+	otelCodes "go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const spanKey = "ditto:span"
+
+// Tracing is a gorm plugin running every statement in a span, child of the span in the statement's context.
+type Tracing struct {
+	tracer trace.Tracer
+}
+
+func NewTracing() *Tracing {
+	return &Tracing{tracer: otel.Tracer("ditto/pkg/repository")}
+}
+
+func (t *Tracing) Name() string {
+	return "ditto:tracing"
+}
+
+func (t *Tracing) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("ditto:trace_create", t.start("create")); err != nil {
+		return err
+	}
+	if err := callbacks.Create().After("gorm:create").Register("ditto:trace_create_end", t.end); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("ditto:trace_query", t.start("query")); err != nil {
+		return err
+	}
+	if err := callbacks.Query().After("gorm:query").Register("ditto:trace_query_end", t.end); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("ditto:trace_update", t.start("update")); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("ditto:trace_update_end", t.end); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("ditto:trace_delete", t.start("delete")); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Register("ditto:trace_delete_end", t.end); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("ditto:trace_row", t.start("row")); err != nil {
+		return err
+	}
+	if err := callbacks.Row().After("gorm:row").Register("ditto:trace_row_end", t.end); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().Before("gorm:raw").Register("ditto:trace_raw", t.start("raw")); err != nil {
+		return err
+	}
+	return callbacks.Raw().After("gorm:raw").Register("ditto:trace_raw_end", t.end)
+}
+
+func (t *Tracing) start(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Statement.Context == nil {
+			return
+		}
+		_, span := t.tracer.Start(db.Statement.Context, "gorm:"+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemMySQL, semconv.DBOperation(operation)),
+		)
+		db.InstanceSet(spanKey, span)
+	}
+}
+
+func (t *Tracing) end(db *gorm.DB) {
+	value, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	defer span.End()
+	span.SetAttributes(semconv.DBStatement(db.Statement.SQL.String()))
+	if db.Statement.Table != "" {
+		span.SetAttributes(semconv.DBSQLTable(db.Statement.Table))
+	}
+	if db.Error != nil && db.Error != gorm.ErrRecordNotFound {
+		span.RecordError(db.Error)
+		span.SetStatus(otelCodes.Error, db.Error.Error())
+	}
+}
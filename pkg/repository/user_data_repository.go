@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"gorm.io/gorm"
+)
+
+// UserDataRepository gathers and erases everything ditto holds about a user, across every table that names them.
+type UserDataRepository interface {
+	GetUserData(ctx context.Context, userId string) (*domain.UserData, error)
+	EraseUserData(ctx context.Context, userId string) (*domain.UserDataErasure, error)
+}
+
+func NewUserDataGORMRepository(db *gorm.DB) UserDataRepository {
+	return &UserDataGORMRepository{db: db}
+}
+
+type UserDataGORMRepository struct {
+	db *gorm.DB
+}
+
+func (u *UserDataGORMRepository) GetUserData(ctx context.Context, userId string) (*domain.UserData, error) {
+	data := &domain.UserData{}
+	db := u.db.WithContext(ctx)
+	queries := []struct {
+		column string
+		dest   interface{}
+	}{
+		{"user_id", &data.Printers},
+		{"user_id", &data.PrintJobs},
+		{"user_id", &data.PrinterGroups},
+		{"user_id", &data.Connectors},
+		{"user_id", &data.DeviceEnrollments},
+		{"user_id", &data.DocumentUploads},
+		{"user_id", &data.ReleaseCredentials},
+		{"principal", &data.IdempotencyRecords},
+	}
+	for _, query := range queries {
+		if err := db.Where(query.column+" = ?", userId).Order("id").Find(query.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// EraseUserData removes, in a single transaction, the user's printers and every record referencing them, the jobs
+// they submitted with their documents, their uploads, groups, connectors, enrollments, release credential and
+// idempotency records.
+func (u *UserDataGORMRepository) EraseUserData(ctx context.Context, userId string) (*domain.UserDataErasure, error) {
+	erasure := &domain.UserDataErasure{Erased: map[string]int64{}}
+	err := u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var printerIds, jobIds, uploadIds, groupIds, connectorIds []string
+		plucks := []struct {
+			model  interface{}
+			column string
+			dest   *[]string
+		}{
+			{&domain.Printer{}, "external_id", &printerIds},
+			{&domain.PrintJob{}, "external_id", &jobIds},
+			{&domain.DocumentUpload{}, "upload_id", &uploadIds},
+			{&domain.PrinterGroup{}, "external_id", &groupIds},
+			{&domain.Connector{}, "connector_id", &connectorIds},
+		}
+		for _, pluck := range plucks {
+			if err := tx.Model(pluck.model).Where("user_id = ?", userId).Pluck(pluck.column, pluck.dest).Error; err != nil {
+				return err
+			}
+		}
+
+		var digests []string
+		if err := tx.Model(&domain.PrintJobDocument{}).Where("job_id IN (?)", jobIds).Pluck("digest", &digests).Error; err != nil {
+			return err
+		}
+		var chunkDigests []string
+		if err := tx.Model(&domain.DocumentUploadChunk{}).Where("upload_id IN (?)", uploadIds).Pluck("digest", &chunkDigests).Error; err != nil {
+			return err
+		}
+		erasure.Digests = append(digests, chunkDigests...)
+
+		deletes := []struct {
+			kind  string
+			model interface{}
+			query string
+			args  interface{}
+		}{
+			{"", &domain.PrintJobDocument{}, "job_id IN (?)", jobIds},
+			{"", &domain.DocumentUploadChunk{}, "upload_id IN (?)", uploadIds},
+			{"document_uploads", &domain.DocumentUpload{}, "upload_id IN (?)", uploadIds},
+			{"print_jobs", &domain.PrintJob{}, "user_id = ?", userId},
+			{"", &domain.PrinterGroupMember{}, "group_id IN (?)", groupIds},
+			{"printer_groups", &domain.PrinterGroup{}, "external_id IN (?)", groupIds},
+			{"", &domain.ConnectorPrinter{}, "connector_id IN (?)", connectorIds},
+			{"connectors", &domain.Connector{}, "connector_id IN (?)", connectorIds},
+			{"device_enrollments", &domain.DeviceEnrollment{}, "user_id = ?", userId},
+			{"release_credentials", &domain.ReleaseCredential{}, "user_id = ?", userId},
+			{"idempotency_records", &domain.IdempotencyRecord{}, "principal = ?", userId},
+		}
+		for _, d := range deletes {
+			result := tx.Where(d.query, d.args).Delete(d.model)
+			if result.Error != nil {
+				return result.Error
+			}
+			if d.kind != "" {
+				erasure.Erased[d.kind] = result.RowsAffected
+			}
+		}
+		erasure.Erased["printers"] = int64(len(printerIds))
+		if len(printerIds) == 0 {
+			return nil
+		}
+		return purgePrinters(tx, printerIds)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return erasure, nil
+}
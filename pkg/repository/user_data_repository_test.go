@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+func TestEraseUserData(t *testing.T) {
+	db, recorder := newRecordingDB(t)
+	recorder.answer("SELECT `external_id` FROM `printers`", []string{"external_id"}, []driver.Value{"p1"})
+	recorder.answer("SELECT `digest` FROM `print_job_documents`", []string{"digest"}, []driver.Value{"d1"})
+
+	erasure, err := NewUserDataGORMRepository(db).EraseUserData(context.Background(), "u1")
+	if err != nil {
+		t.Fatalf("EraseUserData: %v", err)
+	}
+	if erasure.Erased["printers"] != 1 || len(erasure.Digests) != 1 || erasure.Digests[0] != "d1" {
+		t.Errorf("erased %v with digests %v, want printer p1 and digest d1", erasure.Erased, erasure.Digests)
+	}
+
+	queries := recorder.queries()
+	if queries[0] != "BEGIN" || queries[len(queries)-1] != "COMMIT" {
+		t.Errorf("erased with %v, want a single transaction", queries)
+	}
+	for _, table := range []string{"print_jobs", "release_credentials", "device_enrollments", "idempotency_records", "printers"} {
+		deleted := false
+		for _, query := range queries {
+			deleted = deleted || strings.HasPrefix(query, "DELETE FROM `"+table+"`")
+		}
+		if !deleted {
+			t.Errorf("%v of u1 weren't erased by %v", table, queries)
+		}
+	}
+	for _, statement := range recorder.recorded() {
+		if strings.HasPrefix(statement.query, "DELETE FROM `print_jobs` WHERE user_id") && statement.args[0] != "u1" {
+			t.Errorf("erased the jobs of %v, want u1", statement.args[0])
+		}
+	}
+}
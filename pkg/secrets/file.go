@@ -0,0 +1,47 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// FileProvider reads secrets from local files, such as docker or kubernetes secrets mounted into the container. A
+// file holding a JSON object is a secret with a value per key, any other file a secret with its content under the
+// empty key.
+type FileProvider struct{}
+
+func NewFileProvider() *FileProvider {
+	return &FileProvider{}
+}
+
+func (f *FileProvider) Read(ctx context.Context, path string) (*Secret, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]interface{}
+	if json.Unmarshal(content, &object) != nil {
+		return &Secret{Data: map[string]string{"": strings.TrimSpace(string(content))}}, nil
+	}
+	secret := &Secret{Data: make(map[string]string, len(object))}
+	for key, value := range object {
+		if s, ok := value.(string); ok {
+			secret.Data[key] = s
+		} else {
+			secret.Data[key] = fmt.Sprint(value)
+		}
+	}
+	return secret, nil
+}
+
+// Renew is never called, files aren't leased.
+func (f *FileProvider) Renew(ctx context.Context, secret *Secret) error {
+	return nil
+}
+
+func (f *FileProvider) Refresh(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,206 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Secret is what a provider read at a path, a set of values by key. Secrets that Vault leases, such as dynamic
+// database credentials, carry the lease they have to be renewed under.
+type Secret struct {
+	Data          map[string]string
+	LeaseId       string
+	LeaseDuration time.Duration
+	Renewable     bool
+}
+
+// Schemes are the schemes references to secrets are written with.
+var Schemes = []string{"vault", "file"}
+
+// Provider reads secrets from a backend.
+type Provider interface {
+	Read(ctx context.Context, path string) (*Secret, error)
+	// Renew extends the lease of secret, updating its LeaseDuration.
+	Renew(ctx context.Context, secret *Secret) error
+	// Refresh keeps the provider's own credentials valid, it is called before the secrets are refreshed.
+	Refresh(ctx context.Context) error
+}
+
+// Reference points at a value of a secret, written in config as scheme:path#key, as in vault:secret/ditto#db_password
+// or file:/run/secrets/db_password. The key may be left out for secrets holding a single value.
+type Reference struct {
+	Scheme string
+	Path   string
+	Key    string
+}
+
+// ParseReference parses value as a reference to a secret, reporting false for plain values.
+func ParseReference(value string) (Reference, bool) {
+	for _, scheme := range Schemes {
+		if !strings.HasPrefix(value, scheme+":") {
+			continue
+		}
+		path := strings.TrimPrefix(value, scheme+":")
+		key := ""
+		if i := strings.LastIndex(path, "#"); i >= 0 {
+			path, key = path[:i], path[i+1:]
+		}
+		return Reference{Scheme: scheme, Path: path, Key: key}, path != ""
+	}
+	return Reference{}, false
+}
+
+func (r Reference) String() string {
+	if r.Key == "" {
+		return r.Scheme + ":" + r.Path
+	}
+	return r.Scheme + ":" + r.Path + "#" + r.Key
+}
+
+// Resolver resolves references in config values through the providers registered for their schemes. Secrets are read
+// once and kept until Refresh re-reads them, or renews their leases, and tells the subscribers which ones rotated.
+type Resolver struct {
+	mu          sync.Mutex
+	providers   map[string]Provider
+	secrets     map[string]*Secret
+	reads       map[string]*secretRead
+	logger      *logrus.Logger
+	subscribers []func(rotated []Reference)
+}
+
+// secretRead is a read of a secret in progress, done is closed once secret or err is set.
+type secretRead struct {
+	done   chan struct{}
+	secret *Secret
+	err    error
+}
+
+func NewResolver(providers map[string]Provider, logger *logrus.Logger) *Resolver {
+	return &Resolver{providers: providers, secrets: make(map[string]*Secret), reads: make(map[string]*secretRead), logger: logger}
+}
+
+// Resolve returns the value value refers to, plain values are returned as they are.
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	reference, ok := ParseReference(value)
+	if !ok {
+		return value, nil
+	}
+	provider, ok := r.providers[reference.Scheme]
+	if !ok {
+		return "", fmt.Errorf("secret %v can't be read, no %v provider is configured", reference, reference.Scheme)
+	}
+	secret, err := r.secret(ctx, provider, reference)
+	if err != nil {
+		return "", fmt.Errorf("reading secret %v: %v", reference, err)
+	}
+	resolved, ok := secret.Data[reference.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %v has no key %q", reference, reference.Key)
+	}
+	return resolved, nil
+}
+
+// secret returns the cached secret reference points at, reading it when it isn't cached yet. The provider is called
+// without holding mu so a slow backend doesn't hold up secrets already cached, concurrent callers share one read.
+func (r *Resolver) secret(ctx context.Context, provider Provider, reference Reference) (*Secret, error) {
+	secretKey := reference.Scheme + ":" + reference.Path
+	r.mu.Lock()
+	if secret, ok := r.secrets[secretKey]; ok {
+		r.mu.Unlock()
+		return secret, nil
+	}
+	read, reading := r.reads[secretKey]
+	if !reading {
+		read = &secretRead{done: make(chan struct{})}
+		r.reads[secretKey] = read
+	}
+	r.mu.Unlock()
+
+	if reading {
+		select {
+		case <-read.done:
+			return read.secret, read.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	read.secret, read.err = provider.Read(ctx, reference.Path)
+	r.mu.Lock()
+	if read.err == nil {
+		r.secrets[secretKey] = read.secret
+	}
+	delete(r.reads, secretKey)
+	r.mu.Unlock()
+	close(read.done)
+	return read.secret, read.err
+}
+
+// OnRotate subscribes rotated to the references whose secrets changed on a refresh.
+func (r *Resolver) OnRotate(rotated func(rotated []Reference)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, rotated)
+}
+
+// Refresh renews the leases of renewable secrets and re-reads the others, so rotated secrets are picked up. A secret
+// whose lease can't be renewed is read again. Secrets that can't be read keep their last value.
+func (r *Resolver) Refresh(ctx context.Context) {
+	for _, provider := range r.providers {
+		if err := provider.Refresh(ctx); err != nil {
+			r.logger.Errorf("An error %v occurred while refreshing secrets provider credentials", err)
+		}
+	}
+	// the providers are called without holding mu so resolving cached secrets never waits on them
+	r.mu.Lock()
+	cached := make(map[string]*Secret, len(r.secrets))
+	for secretKey, secret := range r.secrets {
+		cached[secretKey] = secret
+	}
+	r.mu.Unlock()
+
+	var rotated []Reference
+	refreshed := make(map[string]*Secret, len(cached))
+	for secretKey, secret := range cached {
+		reference, _ := ParseReference(secretKey)
+		provider := r.providers[reference.Scheme]
+		if secret.Renewable {
+			renewed := *secret
+			err := provider.Renew(ctx, &renewed)
+			if err == nil {
+				refreshed[secretKey] = &renewed
+				continue
+			}
+			r.logger.Warnf("An error %v occurred while renewing the lease of secret %v, reading it again", err, reference)
+		}
+		fresh, err := provider.Read(ctx, reference.Path)
+		if err != nil {
+			r.logger.Errorf("An error %v occurred while reading secret %v", err, reference)
+			continue
+		}
+		if !reflect.DeepEqual(fresh.Data, secret.Data) {
+			rotated = append(rotated, reference)
+		}
+		refreshed[secretKey] = fresh
+	}
+
+	r.mu.Lock()
+	for secretKey, secret := range refreshed {
+		r.secrets[secretKey] = secret
+	}
+	subscribers := r.subscribers
+	r.mu.Unlock()
+
+	if len(rotated) == 0 {
+		return
+	}
+	r.logger.Infof("secrets %v rotated", rotated)
+	for _, subscriber := range subscribers {
+		subscriber(rotated)
+	}
+}
@@ -0,0 +1,173 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// blockingProvider serves secrets from memory, reads of paths in blocked wait until the channel is closed.
+type blockingProvider struct {
+	mu      sync.Mutex
+	secrets map[string]map[string]string
+	blocked map[string]chan struct{}
+	reads   map[string]int
+}
+
+func (b *blockingProvider) Read(ctx context.Context, path string) (*Secret, error) {
+	b.mu.Lock()
+	b.reads[path]++
+	release := b.blocked[path]
+	b.mu.Unlock()
+	if release != nil {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	data, ok := b.secrets[path]
+	if !ok {
+		return nil, errors.New("no such secret")
+	}
+	return &Secret{Data: data}, nil
+}
+
+func (b *blockingProvider) Renew(ctx context.Context, secret *Secret) error {
+	return nil
+}
+
+func (b *blockingProvider) Refresh(ctx context.Context) error {
+	return nil
+}
+
+func (b *blockingProvider) readCount(path string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.reads[path]
+}
+
+func newTestResolver(provider Provider) *Resolver {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	return NewResolver(map[string]Provider{"vault": provider}, logger)
+}
+
+func TestResolve(t *testing.T) {
+	provider := &blockingProvider{
+		secrets: map[string]map[string]string{"secret/ditto": {"db_password": "hunter2"}},
+		reads:   map[string]int{},
+	}
+	resolver := newTestResolver(provider)
+	ctx := context.Background()
+	tests := []struct {
+		value string
+		want  string
+		err   bool
+	}{
+		{value: "plain", want: "plain"},
+		{value: "vault:secret/ditto#db_password", want: "hunter2"},
+		{value: "vault:secret/ditto#missing", err: true},
+		{value: "vault:secret/missing#db_password", err: true},
+		{value: "file:/no/such/file", err: true},
+	}
+	for _, test := range tests {
+		resolved, err := resolver.Resolve(ctx, test.value)
+		if test.err {
+			if err == nil {
+				t.Errorf("Resolve(%q) returned %q, want an error", test.value, resolved)
+			}
+			continue
+		}
+		if err != nil || resolved != test.want {
+			t.Errorf("Resolve(%q) returned %q, %v, want %q", test.value, resolved, err, test.want)
+		}
+	}
+	if reads := provider.readCount("secret/ditto"); reads != 1 {
+		t.Errorf("secret/ditto was read %d times, want once", reads)
+	}
+}
+
+func TestResolveReadsOutsideTheLock(t *testing.T) {
+	release := make(chan struct{})
+	provider := &blockingProvider{
+		secrets: map[string]map[string]string{"secret/fast": {"key": "fast"}, "secret/slow": {"key": "slow"}},
+		blocked: map[string]chan struct{}{"secret/slow": release},
+		reads:   map[string]int{},
+	}
+	resolver := newTestResolver(provider)
+	ctx := context.Background()
+	if _, err := resolver.Resolve(ctx, "vault:secret/fast#key"); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	const readers = 3
+	results := make(chan string, readers)
+	for i := 0; i < readers; i++ {
+		go func() {
+			resolved, err := resolver.Resolve(ctx, "vault:secret/slow#key")
+			if err != nil {
+				resolved = err.Error()
+			}
+			results <- resolved
+		}()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for provider.readCount("secret/slow") == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	resolved := make(chan string, 1)
+	go func() {
+		value, _ := resolver.Resolve(ctx, "vault:secret/fast#key")
+		resolved <- value
+	}()
+	select {
+	case value := <-resolved:
+		if value != "fast" {
+			t.Errorf("resolved %q, want fast", value)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("resolving a cached secret waited on the read of another")
+	}
+
+	close(release)
+	for i := 0; i < readers; i++ {
+		if value := <-results; value != "slow" {
+			t.Errorf("resolved %q, want slow", value)
+		}
+	}
+	if reads := provider.readCount("secret/slow"); reads != 1 {
+		t.Errorf("concurrent resolves read secret/slow %d times, want once", reads)
+	}
+}
+
+func TestResolveGivesUpWithTheContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	provider := &blockingProvider{
+		secrets: map[string]map[string]string{},
+		blocked: map[string]chan struct{}{"secret/slow": release},
+		reads:   map[string]int{},
+	}
+	resolver := newTestResolver(provider)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := resolver.Resolve(ctx, "vault:secret/slow#key"); err == nil {
+		t.Error("Resolve succeeded past its deadline")
+	}
+	// failed reads aren't cached, every resolve reads again
+	for i := 0; i < 2; i++ {
+		if _, err := resolver.Resolve(context.Background(), "vault:secret/missing#key"); err == nil {
+			t.Error("Resolve of a missing secret succeeded")
+		}
+	}
+	if reads := provider.readCount("secret/missing"); reads != 2 {
+		t.Errorf("secret/missing was read %d times, want twice", reads)
+	}
+}
@@ -0,0 +1,188 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VaultConfig locates a Vault server. The token is read from TokenFile when set, which is re-read on every refresh so
+// a token rotated by a Vault agent is picked up. Paths under one of KvMounts are read as KV version 2 secrets, others,
+// such as database/creds/ditto, as leased secrets.
+type VaultConfig struct {
+	Address   string
+	Token     string
+	TokenFile string
+	KvMounts  []string
+}
+
+// VaultProvider reads secrets over Vault's HTTP API.
+type VaultProvider struct {
+	config  VaultConfig
+	address *url.URL
+	client  *http.Client
+	mu      sync.Mutex
+	token   string
+}
+
+func NewVaultProvider(config VaultConfig, client *http.Client) (*VaultProvider, error) {
+	address, err := url.Parse(config.Address)
+	if err != nil {
+		return nil, err
+	}
+	if address.Scheme == "" || address.Host == "" {
+		return nil, fmt.Errorf("vault address %q must be an absolute url", config.Address)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	v := &VaultProvider{config: config, address: address, client: client, token: config.Token}
+	if err := v.readTokenFile(); err != nil {
+		return nil, err
+	}
+	if v.token == "" {
+		return nil, fmt.Errorf("vault token is required")
+	}
+	return v, nil
+}
+
+func (v *VaultProvider) readTokenFile() error {
+	if v.config.TokenFile == "" {
+		return nil
+	}
+	token, err := ioutil.ReadFile(v.config.TokenFile)
+	if err != nil {
+		return err
+	}
+	v.mu.Lock()
+	v.token = strings.TrimSpace(string(token))
+	v.mu.Unlock()
+	return nil
+}
+
+// vaultResponse is the envelope of Vault's responses, KV version 2 secrets nest their values in data.data.
+type vaultResponse struct {
+	LeaseId       string                 `json:"lease_id"`
+	LeaseDuration int64                  `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Errors        []string               `json:"errors"`
+}
+
+func (v *VaultProvider) do(ctx context.Context, method string, path string, body interface{}) (*vaultResponse, error) {
+	var payload io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = bytes.NewReader(encoded)
+	}
+	requestUrl := *v.address
+	requestUrl.Path = strings.TrimSuffix(requestUrl.Path, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+	request, err := http.NewRequest(method, requestUrl.String(), payload)
+	if err != nil {
+		return nil, err
+	}
+	v.mu.Lock()
+	request.Header.Set("X-Vault-Token", v.token)
+	v.mu.Unlock()
+	response, err := v.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	decoded := &vaultResponse{}
+	if response.StatusCode == http.StatusNoContent {
+		return decoded, nil
+	}
+	if err := json.NewDecoder(response.Body).Decode(decoded); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("vault responded to %v with %v: %v", path, response.Status, err)
+	}
+	if response.StatusCode != http.StatusOK && len(decoded.Errors) > 0 {
+		return nil, fmt.Errorf("vault responded to %v with %v: %v", path, response.Status, strings.Join(decoded.Errors, ", "))
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault responded to %v with %v", path, response.Status)
+	}
+	return decoded, nil
+}
+
+// kvPath rewrites path to the data path of KV version 2, reporting false for paths outside the KV mounts.
+func (v *VaultProvider) kvPath(path string) (string, bool) {
+	path = strings.Trim(path, "/")
+	for _, mount := range v.config.KvMounts {
+		mount = strings.Trim(mount, "/")
+		if strings.HasPrefix(path, mount+"/") {
+			return mount + "/data/" + strings.TrimPrefix(path, mount+"/"), true
+		}
+	}
+	return path, false
+}
+
+func (v *VaultProvider) Read(ctx context.Context, path string) (*Secret, error) {
+	dataPath, kv := v.kvPath(path)
+	response, err := v.do(ctx, http.MethodGet, dataPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	data := response.Data
+	if kv {
+		data, _ = response.Data["data"].(map[string]interface{})
+	}
+	if data == nil {
+		return nil, fmt.Errorf("vault holds no secret at %v", path)
+	}
+	secret := &Secret{
+		Data:          make(map[string]string, len(data)),
+		LeaseId:       response.LeaseId,
+		LeaseDuration: time.Duration(response.LeaseDuration) * time.Second,
+		Renewable:     response.Renewable && response.LeaseId != "",
+	}
+	for key, value := range data {
+		if s, ok := value.(string); ok {
+			secret.Data[key] = s
+		} else {
+			secret.Data[key] = fmt.Sprint(value)
+		}
+	}
+	return secret, nil
+}
+
+func (v *VaultProvider) Renew(ctx context.Context, secret *Secret) error {
+	response, err := v.do(ctx, http.MethodPut, "sys/leases/renew", map[string]interface{}{
+		"lease_id":  secret.LeaseId,
+		"increment": int64(secret.LeaseDuration / time.Second),
+	})
+	if err != nil {
+		return err
+	}
+	secret.LeaseDuration = time.Duration(response.LeaseDuration) * time.Second
+	secret.Renewable = response.Renewable
+	return nil
+}
+
+// Refresh re-reads the token file and renews the token when it is renewable, root and periodic tokens of a Vault
+// agent aren't.
+func (v *VaultProvider) Refresh(ctx context.Context) error {
+	if err := v.readTokenFile(); err != nil {
+		return err
+	}
+	lookup, err := v.do(ctx, http.MethodGet, "auth/token/lookup-self", nil)
+	if err != nil {
+		return err
+	}
+	if renewable, _ := lookup.Data["renewable"].(bool); !renewable {
+		return nil
+	}
+	_, err = v.do(ctx, http.MethodPost, "auth/token/renew-self", map[string]interface{}{})
+	return err
+}
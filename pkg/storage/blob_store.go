@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrBlobNotFound is returned when no blob is stored under the requested key.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore keeps opaque blobs under slash separated keys.
+type BlobStore interface {
+	// Put stores the size bytes read from r under key, replacing any blob already there.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	// Delete removes the blob, deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
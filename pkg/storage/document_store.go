@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+var (
+	// ErrDigestMismatch is returned when content doesn't hash to the digest it was stored or expected under.
+	ErrDigestMismatch = errors.New("document digest mismatch")
+	// ErrTooLarge is returned by Put when the content exceeds the store's size limit.
+	ErrTooLarge = errors.New("document too large")
+)
+
+// DocumentStore is a content addressed store on top of a BlobStore, documents are named by the hex SHA-256 digest
+// of their content so identical uploads are stored once. Content is encrypted at rest when the store has a key, and
+// checked against its digest whenever it is read back.
+type DocumentStore struct {
+	blobs    BlobStore
+	key      []byte
+	spoolDir string
+}
+
+// NewDocumentStore returns a store writing to blobs, encryptionKey must be 32 bytes or empty to store plaintext.
+// Uploads are spooled to spoolDir, the system temporary directory when empty, while their digest is computed.
+func NewDocumentStore(blobs BlobStore, encryptionKey []byte, spoolDir string) (*DocumentStore, error) {
+	store := &DocumentStore{blobs: blobs, spoolDir: spoolDir}
+	if len(encryptionKey) > 0 {
+		if err := checkKey(encryptionKey); err != nil {
+			return nil, err
+		}
+		store.key = encryptionKey
+	}
+	return store, nil
+}
+
+// Encrypted reports whether documents are encrypted at rest.
+func (d *DocumentStore) Encrypted() bool {
+	return d.key != nil
+}
+
+// blobKey names the blob of a document. Encrypted and plaintext blobs live apart, so toggling encryption never
+// dedupes an upload against a blob stored the other way.
+func (d *DocumentStore) blobKey(digest string) string {
+	mode := "plain"
+	if d.key != nil {
+		mode = "aes-gcm"
+	}
+	return "documents/" + mode + "/" + digest[:2] + "/" + digest
+}
+
+func validDigest(digest string) bool {
+	decoded, err := hex.DecodeString(digest)
+	return err == nil && len(decoded) == sha256.Size
+}
+
+// Put stores the at most maxBytes of content read from r and returns its digest and size. When expectedDigest is set
+// the content must hash to it.
+func (d *DocumentStore) Put(ctx context.Context, r io.Reader, expectedDigest string, maxBytes int64) (string, int64, error) {
+	spool, err := ioutil.TempFile(d.spoolDir, "ditto-document-")
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hasher), io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return "", 0, err
+	}
+	if size > maxBytes {
+		return "", 0, ErrTooLarge
+	}
+	digest := hex.EncodeToString(hasher.Sum(nil))
+	if expectedDigest != "" && expectedDigest != digest {
+		return "", 0, ErrDigestMismatch
+	}
+	exists, err := d.blobs.Exists(ctx, d.blobKey(digest))
+	if err != nil {
+		return "", 0, err
+	}
+	if exists {
+		return digest, size, nil
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+	var content io.Reader = spool
+	storedSize := size
+	if d.key != nil {
+		if content, err = newEncryptingReader(d.key, spool); err != nil {
+			return "", 0, err
+		}
+		storedSize = encryptedSize(size)
+	}
+	if err := d.blobs.Put(ctx, d.blobKey(digest), content, storedSize); err != nil {
+		return "", 0, err
+	}
+	return digest, size, nil
+}
+
+// Open returns the content stored under digest. Reading it to the end fails with ErrDigestMismatch, or
+// ErrCorruptBlob for encrypted content, if it was altered in storage.
+func (d *DocumentStore) Open(ctx context.Context, digest string) (io.ReadCloser, error) {
+	if !validDigest(digest) {
+		return nil, fmt.Errorf("invalid document digest %q", digest)
+	}
+	blob, err := d.blobs.Get(ctx, d.blobKey(digest))
+	if err != nil {
+		return nil, err
+	}
+	var content io.Reader = blob
+	if d.key != nil {
+		if content, err = newDecryptingReader(d.key, blob); err != nil {
+			blob.Close()
+			return nil, err
+		}
+	}
+	return &verifyingReader{content: content, closer: blob, hasher: sha256.New(), digest: digest}, nil
+}
+
+// DeleteUnreferenced deletes the content stored under digest unless referenced reports it is still in use. A Put of
+// identical content racing the deletion may still be deduped against the blob being deleted, reading that document
+// back then fails with ErrBlobNotFound.
+func (d *DocumentStore) DeleteUnreferenced(ctx context.Context, digest string, referenced func(ctx context.Context, digest string) (bool, error)) error {
+	if !validDigest(digest) {
+		return fmt.Errorf("invalid document digest %q", digest)
+	}
+	inUse, err := referenced(ctx, digest)
+	if err != nil || inUse {
+		return err
+	}
+	return d.blobs.Delete(ctx, d.blobKey(digest))
+}
+
+// verifyingReader hashes the content as it is read and compares it with the expected digest at the end.
+type verifyingReader struct {
+	content io.Reader
+	closer  io.Closer
+	hasher  hash.Hash
+	digest  string
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.content.Read(p)
+	v.hasher.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(v.hasher.Sum(nil)) != v.digest {
+		return n, ErrDigestMismatch
+	}
+	return n, err
+}
+
+func (v *verifyingReader) Close() error {
+	return v.closer.Close()
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Encrypted blobs hold a magic number and a random salt followed by the plaintext sealed with AES-256-GCM in segments
+// of segmentSize bytes. Every blob is sealed with a key of its own, derived with HKDF-SHA256 from the store's key and
+// the salt, so nonces only have to be unique within a blob. Each segment's nonce is its index and its additional data
+// marks whether it is the last one, so segments can be neither reordered nor dropped.
+const (
+	encryptionMagic = "DTE1"
+	segmentSize     = 64 * 1024
+	gcmTagSize      = 16
+	saltSize        = 32
+	keySize         = 32
+	blobKeyInfo     = "ditto document blob"
+)
+
+var ErrCorruptBlob = errors.New("encrypted blob is corrupt")
+
+var (
+	lastSegment = []byte{1}
+	midSegment  = []byte{0}
+)
+
+func checkKey(key []byte) error {
+	if len(key) != keySize {
+		return fmt.Errorf("encryption key must be %d bytes, got %d", keySize, len(key))
+	}
+	return nil
+}
+
+// blobAead returns the cipher of the blob salted with salt.
+func blobAead(key []byte, salt []byte) (cipher.AEAD, error) {
+	blobKey := make([]byte, keySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, salt, []byte(blobKeyInfo)), blobKey); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(blobKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptedSize returns the size of the encrypted blob holding size bytes of plaintext.
+func encryptedSize(size int64) int64 {
+	segments := (size + segmentSize - 1) / segmentSize
+	if segments == 0 {
+		segments = 1
+	}
+	return int64(len(encryptionMagic)+saltSize) + size + segments*gcmTagSize
+}
+
+func segmentNonce(aead cipher.AEAD, index uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], index)
+	return nonce
+}
+
+// encryptingReader encrypts the plaintext read from source as it is read.
+type encryptingReader struct {
+	aead    cipher.AEAD
+	source  *bufio.Reader
+	index   uint64
+	plain   []byte
+	pending []byte
+	done    bool
+}
+
+func newEncryptingReader(key []byte, source io.Reader) (io.Reader, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := blobAead(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptingReader{
+		aead:    aead,
+		source:  bufio.NewReaderSize(source, segmentSize),
+		plain:   make([]byte, segmentSize),
+		pending: append([]byte(encryptionMagic), salt...),
+	}, nil
+}
+
+func (e *encryptingReader) Read(p []byte) (int, error) {
+	for len(e.pending) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(e.source, e.plain)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		last := err != nil
+		if !last {
+			// a full segment is the last one when nothing follows it
+			if _, peekErr := e.source.Peek(1); peekErr == io.EOF {
+				last = true
+			} else if peekErr != nil {
+				return 0, peekErr
+			}
+		}
+		additional := midSegment
+		if last {
+			additional = lastSegment
+			e.done = true
+		}
+		e.pending = e.aead.Seal(nil, segmentNonce(e.aead, e.index), e.plain[:n], additional)
+		e.index++
+	}
+	n := copy(p, e.pending)
+	e.pending = e.pending[n:]
+	return n, nil
+}
+
+// decryptingReader authenticates and decrypts a blob written by encryptingReader.
+type decryptingReader struct {
+	aead    cipher.AEAD
+	source  *bufio.Reader
+	index   uint64
+	sealed  []byte
+	pending []byte
+	done    bool
+}
+
+func newDecryptingReader(key []byte, source io.Reader) (io.Reader, error) {
+	header := make([]byte, len(encryptionMagic)+saltSize)
+	if _, err := io.ReadFull(source, header); err != nil || string(header[:len(encryptionMagic)]) != encryptionMagic {
+		return nil, ErrCorruptBlob
+	}
+	aead, err := blobAead(key, header[len(encryptionMagic):])
+	if err != nil {
+		return nil, err
+	}
+	return &decryptingReader{
+		aead:   aead,
+		source: bufio.NewReaderSize(source, segmentSize+gcmTagSize),
+		sealed: make([]byte, segmentSize+gcmTagSize),
+	}, nil
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(d.source, d.sealed)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		last := err != nil
+		if !last {
+			if _, peekErr := d.source.Peek(1); peekErr == io.EOF {
+				last = true
+			} else if peekErr != nil {
+				return 0, peekErr
+			}
+		}
+		additional := midSegment
+		if last {
+			additional = lastSegment
+			d.done = true
+		}
+		plain, err := d.aead.Open(nil, segmentNonce(d.aead, d.index), d.sealed[:n], additional)
+		if err != nil {
+			return 0, ErrCorruptBlob
+		}
+		d.index++
+		d.pending = plain
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const headerSize = len(encryptionMagic) + saltSize
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func randomBytes(t *testing.T, size int) []byte {
+	t.Helper()
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func encrypt(t *testing.T, key []byte, plain []byte) []byte {
+	t.Helper()
+	reader, err := newEncryptingReader(key, bytes.NewReader(plain))
+	if err != nil {
+		t.Fatalf("newEncryptingReader: %v", err)
+	}
+	sealed, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("encrypting: %v", err)
+	}
+	return sealed
+}
+
+func decrypt(key []byte, sealed []byte) ([]byte, error) {
+	reader, err := newDecryptingReader(key, bytes.NewReader(sealed))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(reader)
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	key := testKey(t)
+	sizes := []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 3*segmentSize + 5}
+	for _, size := range sizes {
+		plain := randomBytes(t, size)
+		sealed := encrypt(t, key, plain)
+		if int64(len(sealed)) != encryptedSize(int64(size)) {
+			t.Errorf("%d bytes were sealed into %d bytes, encryptedSize says %d", size, len(sealed), encryptedSize(int64(size)))
+		}
+		opened, err := decrypt(key, sealed)
+		if err != nil {
+			t.Fatalf("decrypting %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(opened, plain) {
+			t.Errorf("%d bytes didn't survive the round trip", size)
+		}
+	}
+}
+
+func TestEncryptionSaltsEveryBlob(t *testing.T) {
+	key := testKey(t)
+	plain := randomBytes(t, 100)
+	first, second := encrypt(t, key, plain), encrypt(t, key, plain)
+	if bytes.Equal(first[:headerSize], second[:headerSize]) {
+		t.Error("two blobs were sealed with the same salt")
+	}
+	if bytes.Equal(first[headerSize:], second[headerSize:]) {
+		t.Error("the same plaintext was sealed to the same ciphertext twice")
+	}
+}
+
+func TestEncryptionDetectsTampering(t *testing.T) {
+	key := testKey(t)
+	plain := randomBytes(t, 3*segmentSize+5)
+	sealed := encrypt(t, key, plain)
+	sealedSegment := segmentSize + gcmTagSize
+	segment := func(i int) []byte {
+		start := headerSize + i*sealedSegment
+		end := start + sealedSegment
+		if end > len(sealed) {
+			end = len(sealed)
+		}
+		return sealed[start:end]
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	flip := func(offset int) []byte {
+		tampered := append([]byte{}, sealed...)
+		tampered[offset] ^= 1
+		return tampered
+	}
+	header := sealed[:headerSize]
+	tests := []struct {
+		name   string
+		sealed []byte
+		key    []byte
+	}{
+		{name: "wrong key", sealed: sealed, key: testKey(t)},
+		{name: "bad magic", sealed: flip(0)},
+		{name: "altered salt", sealed: flip(len(encryptionMagic))},
+		{name: "altered first segment", sealed: flip(headerSize + 10)},
+		{name: "altered last segment", sealed: flip(len(sealed) - 1)},
+		{name: "truncated header", sealed: sealed[:headerSize-1]},
+		{name: "truncated last segment", sealed: sealed[:len(sealed)-1]},
+		{name: "dropped last segment", sealed: join(header, segment(0), segment(1), segment(2))},
+		{name: "dropped middle segment", sealed: join(header, segment(0), segment(2), segment(3))},
+		{name: "swapped segments", sealed: join(header, segment(1), segment(0), segment(2), segment(3))},
+		{name: "appended data", sealed: join(sealed, []byte{0})},
+		{name: "appended segment", sealed: join(sealed, segment(0))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			openKey := key
+			if test.key != nil {
+				openKey = test.key
+			}
+			if _, err := decrypt(openKey, test.sealed); err != ErrCorruptBlob {
+				t.Errorf("decrypting returned %v, want %v", err, ErrCorruptBlob)
+			}
+		})
+	}
+}
+
+func TestDocumentStoreEncryptsAtRest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ditto-storage-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	blobs, err := NewFileBlobStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewDocumentStore(blobs, testKey(t), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	plain := append([]byte("%PDF-1.4 "), randomBytes(t, segmentSize)...)
+	digest, size, err := store.Put(ctx, bytes.NewReader(plain), "", int64(len(plain)))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if size != int64(len(plain)) {
+		t.Errorf("Put stored %d bytes, want %d", size, len(plain))
+	}
+
+	blob, err := blobs.Get(ctx, store.blobKey(digest))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	stored, _ := ioutil.ReadAll(blob)
+	blob.Close()
+	if bytes.Contains(stored, plain[:16]) {
+		t.Error("the stored blob holds the plaintext")
+	}
+
+	content, err := store.Open(ctx, digest)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	opened, err := ioutil.ReadAll(content)
+	content.Close()
+	if err != nil {
+		t.Fatalf("reading the document: %v", err)
+	}
+	if !bytes.Equal(opened, plain) {
+		t.Error("the document read back differs from the one stored")
+	}
+
+	stored[len(stored)-1] ^= 1
+	if err := blobs.Put(ctx, store.blobKey(digest), bytes.NewReader(stored), int64(len(stored))); err != nil {
+		t.Fatal(err)
+	}
+	content, err = store.Open(ctx, digest)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	_, err = ioutil.ReadAll(content)
+	content.Close()
+	if err != ErrCorruptBlob {
+		t.Errorf("reading a tampered document returned %v, want %v", err, ErrCorruptBlob)
+	}
+}
+
+func TestDocumentStoreRejectsShortKeys(t *testing.T) {
+	if _, err := NewDocumentStore(nil, make([]byte, 16), ""); err == nil {
+		t.Error("NewDocumentStore accepted a 16 byte key")
+	}
+}
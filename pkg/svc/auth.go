@@ -0,0 +1,31 @@
+package svc
+
+import (
+	"context"
+	"ditto/pkg/apierr"
+)
+
+// requireAdmin fails unless the authenticated caller was granted the admin role.
+func requireAdmin(ctx context.Context) error {
+	user, _ := ctx.Value("user").(map[string]string)
+	if user["role"] != "admin" {
+		return apierr.PermissionDenied("admin privileges required")
+	}
+	return nil
+}
+
+// requireTenantAdmin fails unless the caller administers their tenant, admins administer every tenant. What tenant
+// admins can reach is confined to their tenant by the repositories.
+func requireTenantAdmin(ctx context.Context) error {
+	user, _ := ctx.Value("user").(map[string]string)
+	if user["role"] != "admin" && user["tenant_role"] != "admin" {
+		return apierr.PermissionDenied("tenant admin privileges required")
+	}
+	return nil
+}
+
+// detached returns a context carrying the caller of ctx, so that the statements run with it stay confined to the
+// caller's tenant, without ctx's deadline or cancellation. It is for the writes that must happen once a call is over.
+func detached(ctx context.Context) context.Context {
+	return context.WithValue(context.Background(), "user", ctx.Value("user"))
+}
@@ -0,0 +1,252 @@
+package svc
+
+import (
+	"context"
+	"ditto/pkg/apierr"
+	"ditto/pkg/domain"
+	"ditto/pkg/metrics"
+	"ditto/pkg/repository"
+	ditto "github.com/kutty-kumar/ho_oh/ditto_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+)
+
+// BatchItemResult is the outcome of a single item of a batch, Status is OK when the item was written.
+type BatchItemResult struct {
+	Index    int
+	Response *ditto.PrinterDto
+	Status   *status.Status
+}
+
+// CreatePrinterStream is the receiving half of a client streaming BatchCreatePrinters call.
+type CreatePrinterStream interface {
+	Context() context.Context
+	Recv() (*ditto.CreatePrinterRequest, error)
+}
+
+// UpdatePrinterStream is the receiving half of a client streaming BatchUpdatePrinters call.
+type UpdatePrinterStream interface {
+	Context() context.Context
+	Recv() (*ditto.UpdatePrinterRequest, error)
+}
+
+// BatchPrinterSvc creates and updates printers in chunked transactions, reporting the outcome of every item.
+type BatchPrinterSvc struct {
+	Repository repository.PrinterRepository
+	Models     repository.PrinterModelRepository
+	chunkSize  int
+	maxItems   int
+}
+
+func NewBatchPrinterSvc(repository repository.PrinterRepository, models repository.PrinterModelRepository, chunkSize int, maxItems int) *BatchPrinterSvc {
+	return &BatchPrinterSvc{
+		Repository: repository,
+		Models:     models,
+		chunkSize:  chunkSize,
+		maxItems:   maxItems,
+	}
+}
+
+func (b *BatchPrinterSvc) BatchCreatePrinters(ctx context.Context, requests []*ditto.CreatePrinterRequest) ([]BatchItemResult, error) {
+	userId := ctx.Value("user").(map[string]string)["user_id"]
+	if len(userId) == 0 {
+		return nil, status.Errorf(codes.Unauthenticated, "user id is required")
+	}
+	if b.maxItems > 0 && len(requests) > b.maxItems {
+		return nil, status.Errorf(codes.InvalidArgument, "batch holds %d printers, at most %d are allowed", len(requests), b.maxItems)
+	}
+	results := make([]BatchItemResult, len(requests))
+	var printers []*domain.Printer
+	var positions []int
+	for i, request := range requests {
+		results[i].Index = i
+		if err := request.Validate(); err != nil {
+			results[i].Status = status.New(codes.InvalidArgument, err.Error())
+			continue
+		}
+		if request.Request == nil {
+			results[i].Status = status.New(codes.InvalidArgument, "printer is required")
+			continue
+		}
+		if err := checkProductNumber(ctx, b.Models, request.Request.ProductNumber); err != nil {
+			results[i].Status = status.Convert(err)
+			continue
+		}
+		printer := &domain.Printer{}
+		printer.FillProperties(request.Request)
+		printer.UserId = userId
+		printers = append(printers, printer)
+		positions = append(positions, i)
+	}
+	errs := b.Repository.BatchCreatePrinters(ctx, printers, b.chunkSize)
+	for j, printer := range printers {
+		results[positions[j]].Status = itemStatus(errs[j], printer.SerialNumber)
+		metrics.PrinterCreated(results[positions[j]].Status.Err())
+		if errs[j] == nil {
+			dto := printer.ToDto().(ditto.PrinterDto)
+			results[positions[j]].Response = &dto
+		}
+	}
+	return results, nil
+}
+
+func (b *BatchPrinterSvc) BatchUpdatePrinters(ctx context.Context, requests []*ditto.UpdatePrinterRequest) ([]BatchItemResult, error) {
+	userId := ctx.Value("user").(map[string]string)["user_id"]
+	if len(userId) == 0 {
+		return nil, status.Errorf(codes.Unauthenticated, "user id is required")
+	}
+	if b.maxItems > 0 && len(requests) > b.maxItems {
+		return nil, status.Errorf(codes.InvalidArgument, "batch holds %d printers, at most %d are allowed", len(requests), b.maxItems)
+	}
+	results := make([]BatchItemResult, len(requests))
+	var printers []*domain.Printer
+	var positions []int
+	for i, request := range requests {
+		results[i].Index = i
+		if err := request.Validate(); err != nil {
+			results[i].Status = status.New(codes.InvalidArgument, err.Error())
+			continue
+		}
+		if request.Request == nil || request.PrinterId == "" {
+			results[i].Status = status.New(codes.InvalidArgument, "printer id and printer are required")
+			continue
+		}
+		printer := &domain.Printer{}
+		printer.FillProperties(request.Request)
+		printer.SetExternalId(request.PrinterId)
+		printers = append(printers, printer)
+		positions = append(positions, i)
+	}
+	updated, errs := b.Repository.BatchUpdatePrinters(ctx, userId, printers, b.chunkSize)
+	for j, printer := range printers {
+		results[positions[j]].Status = itemStatus(errs[j], printer.ExternalId)
+		if errs[j] == nil {
+			dto := updated[j].ToDto().(ditto.PrinterDto)
+			results[positions[j]].Response = &dto
+		}
+	}
+	return results, nil
+}
+
+// BatchCreatePrintersFromStream drains the stream and writes the received printers a chunk at a time, so large
+// streams are never held in memory in full. A malformed item ends the stream: the items before it are written and it
+// is reported as the last, failed, result. The chunks written before any other receive error, or before the stream
+// grows past the batch limit, stay written.
+func (b *BatchPrinterSvc) BatchCreatePrintersFromStream(stream CreatePrinterStream) ([]BatchItemResult, error) {
+	var results []BatchItemResult
+	var chunk []*ditto.CreatePrinterRequest
+	flush := func() error {
+		chunkResults, err := b.BatchCreatePrinters(stream.Context(), chunk)
+		if err != nil {
+			return err
+		}
+		offset := len(results)
+		for _, result := range chunkResults {
+			result.Index += offset
+			results = append(results, result)
+		}
+		chunk = chunk[:0]
+		return nil
+	}
+	for {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if !malformedItem(err) {
+				return nil, err
+			}
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			return append(results, BatchItemResult{Index: len(results), Status: status.Convert(err)}), nil
+		}
+		if b.maxItems > 0 && len(results)+len(chunk) >= b.maxItems {
+			return nil, status.Errorf(codes.InvalidArgument, "batch holds more than %d printers", b.maxItems)
+		}
+		chunk = append(chunk, request)
+		if len(chunk) >= b.streamChunkSize() {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// BatchUpdatePrintersFromStream is the update counterpart of BatchCreatePrintersFromStream.
+func (b *BatchPrinterSvc) BatchUpdatePrintersFromStream(stream UpdatePrinterStream) ([]BatchItemResult, error) {
+	var results []BatchItemResult
+	var chunk []*ditto.UpdatePrinterRequest
+	flush := func() error {
+		chunkResults, err := b.BatchUpdatePrinters(stream.Context(), chunk)
+		if err != nil {
+			return err
+		}
+		offset := len(results)
+		for _, result := range chunkResults {
+			result.Index += offset
+			results = append(results, result)
+		}
+		chunk = chunk[:0]
+		return nil
+	}
+	for {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if !malformedItem(err) {
+				return nil, err
+			}
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			return append(results, BatchItemResult{Index: len(results), Status: status.Convert(err)}), nil
+		}
+		if b.maxItems > 0 && len(results)+len(chunk) >= b.maxItems {
+			return nil, status.Errorf(codes.InvalidArgument, "batch holds more than %d printers", b.maxItems)
+		}
+		chunk = append(chunk, request)
+		if len(chunk) >= b.streamChunkSize() {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (b *BatchPrinterSvc) streamChunkSize() int {
+	size := 100
+	if b.chunkSize > 0 {
+		size = b.chunkSize
+	}
+	if b.maxItems > 0 && size > b.maxItems {
+		size = b.maxItems
+	}
+	return size
+}
+
+// itemStatus is the status of writing the printer identified by name, storage errors are mapped by apierr.FromStorage.
+func itemStatus(err error, name string) *status.Status {
+	if err == nil {
+		return status.New(codes.OK, "")
+	}
+	return status.Convert(apierr.FromStorage(err, printerResource, name))
+}
+
+// malformedItem reports whether err, returned by the Recv of a stream, is about a malformed item rather than the
+// stream itself.
+func malformedItem(err error) bool {
+	return status.Code(err) == codes.InvalidArgument
+}
@@ -0,0 +1,210 @@
+package svc
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"ditto/pkg/repository"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	ditto "github.com/kutty-kumar/ho_oh/ditto_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// batchPrinterRepository writes every printer of a batch successfully.
+type batchPrinterRepository struct {
+	repository.PrinterRepository
+}
+
+func (b *batchPrinterRepository) BatchCreatePrinters(ctx context.Context, printers []*domain.Printer, chunkSize int) []error {
+	return make([]error, len(printers))
+}
+
+func (b *batchPrinterRepository) BatchUpdatePrinters(ctx context.Context, userId string, printers []*domain.Printer, chunkSize int) ([]*domain.Printer, []error) {
+	return printers, make([]error, len(printers))
+}
+
+// createPrinterStream receives requests, then fails with err if set.
+type createPrinterStream struct {
+	ctx      context.Context
+	requests []*ditto.CreatePrinterRequest
+	err      error
+}
+
+func (c *createPrinterStream) Context() context.Context {
+	return c.ctx
+}
+
+func (c *createPrinterStream) Recv() (*ditto.CreatePrinterRequest, error) {
+	if len(c.requests) == 0 && c.err != nil {
+		return nil, c.err
+	}
+	if len(c.requests) == 0 {
+		return nil, io.EOF
+	}
+	request := c.requests[0]
+	c.requests = c.requests[1:]
+	return request, nil
+}
+
+type updatePrinterStream struct {
+	ctx      context.Context
+	requests []*ditto.UpdatePrinterRequest
+}
+
+func (u *updatePrinterStream) Context() context.Context {
+	return u.ctx
+}
+
+func (u *updatePrinterStream) Recv() (*ditto.UpdatePrinterRequest, error) {
+	if len(u.requests) == 0 {
+		return nil, io.EOF
+	}
+	request := u.requests[0]
+	u.requests = u.requests[1:]
+	return request, nil
+}
+
+func batchContext() context.Context {
+	return context.WithValue(context.Background(), "user", map[string]string{"user_id": "user-1"})
+}
+
+// checkBatchResults checks that result i reports item i, invalid being the indices of the items that can't be written.
+func checkBatchResults(t *testing.T, results []BatchItemResult, count int, invalid map[int]bool) {
+	t.Helper()
+	if len(results) != count {
+		t.Fatalf("got %d results, want %d", len(results), count)
+	}
+	for i, result := range results {
+		if result.Index != i {
+			t.Errorf("result %d has index %d", i, result.Index)
+		}
+		if invalid[i] {
+			if result.Status.Code() != codes.InvalidArgument {
+				t.Errorf("result %d has code %v, want %v", i, result.Status.Code(), codes.InvalidArgument)
+			}
+			continue
+		}
+		if result.Status.Code() != codes.OK {
+			t.Errorf("result %d has code %v, want %v", i, result.Status.Code(), codes.OK)
+			continue
+		}
+		if name := fmt.Sprintf("printer-%d", i); result.Response.Name != name {
+			t.Errorf("result %d is for printer %v, want %v", i, result.Response.Name, name)
+		}
+	}
+}
+
+func TestBatchPrintersFromStreamIndices(t *testing.T) {
+	tests := []struct {
+		name      string
+		chunkSize int
+		count     int
+		invalid   map[int]bool
+	}{
+		{name: "single chunk", chunkSize: 10, count: 4},
+		{name: "full chunks", chunkSize: 2, count: 6},
+		{name: "partial last chunk", chunkSize: 3, count: 7},
+		{name: "chunk of one", chunkSize: 1, count: 5},
+		{name: "invalid items", chunkSize: 2, count: 7, invalid: map[int]bool{0: true, 3: true, 6: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			batchSvc := NewBatchPrinterSvc(&batchPrinterRepository{}, nil, test.chunkSize, 0)
+
+			creates := &createPrinterStream{ctx: batchContext()}
+			updates := &updatePrinterStream{ctx: batchContext()}
+			for i := 0; i < test.count; i++ {
+				printer := &ditto.PrinterDto{Name: fmt.Sprintf("printer-%d", i)}
+				if test.invalid[i] {
+					printer = nil
+				}
+				creates.requests = append(creates.requests, &ditto.CreatePrinterRequest{Request: printer})
+				updates.requests = append(updates.requests, &ditto.UpdatePrinterRequest{PrinterId: fmt.Sprintf("id-%d", i), Request: printer})
+			}
+
+			results, err := batchSvc.BatchCreatePrintersFromStream(creates)
+			if err != nil {
+				t.Fatalf("BatchCreatePrintersFromStream: %v", err)
+			}
+			checkBatchResults(t, results, test.count, test.invalid)
+
+			results, err = batchSvc.BatchUpdatePrintersFromStream(updates)
+			if err != nil {
+				t.Fatalf("BatchUpdatePrintersFromStream: %v", err)
+			}
+			checkBatchResults(t, results, test.count, test.invalid)
+		})
+	}
+}
+
+func TestBatchPrintersFromStreamMaxItems(t *testing.T) {
+	batchSvc := NewBatchPrinterSvc(&batchPrinterRepository{}, nil, 2, 3)
+	stream := &createPrinterStream{ctx: batchContext()}
+	for i := 0; i < 4; i++ {
+		stream.requests = append(stream.requests, &ditto.CreatePrinterRequest{Request: &ditto.PrinterDto{Name: fmt.Sprintf("printer-%d", i)}})
+	}
+	if _, err := batchSvc.BatchCreatePrintersFromStream(stream); err == nil {
+		t.Fatal("BatchCreatePrintersFromStream accepted a stream longer than the batch limit")
+	}
+}
+
+func TestBatchPrintersFromStreamWithMalformedItem(t *testing.T) {
+	batchSvc := NewBatchPrinterSvc(&batchPrinterRepository{}, nil, 2, 0)
+	stream := &createPrinterStream{ctx: batchContext(), err: status.Error(codes.InvalidArgument, "item 3: unexpected EOF")}
+	for i := 0; i < 3; i++ {
+		stream.requests = append(stream.requests, &ditto.CreatePrinterRequest{Request: &ditto.PrinterDto{Name: fmt.Sprintf("printer-%d", i)}})
+	}
+	results, err := batchSvc.BatchCreatePrintersFromStream(stream)
+	if err != nil {
+		t.Fatalf("BatchCreatePrintersFromStream: %v", err)
+	}
+	checkBatchResults(t, results[:3], 3, nil)
+	if len(results) != 4 || results[3].Index != 3 || results[3].Status.Code() != codes.InvalidArgument {
+		t.Errorf("got results %v, want the written printers and the malformed item", results)
+	}
+
+	stream = &createPrinterStream{ctx: batchContext(), err: status.Error(codes.Canceled, "context canceled")}
+	if _, err := batchSvc.BatchCreatePrintersFromStream(stream); status.Code(err) != codes.Canceled {
+		t.Errorf("BatchCreatePrintersFromStream returned %v for a broken stream, want %v", err, codes.Canceled)
+	}
+}
+
+// failingPrinterRepository fails to create the printers with errs.
+type failingPrinterRepository struct {
+	repository.PrinterRepository
+	errs []error
+}
+
+func (f *failingPrinterRepository) BatchCreatePrinters(ctx context.Context, printers []*domain.Printer, chunkSize int) []error {
+	return f.errs
+}
+
+func TestBatchCreatePrintersMapsStorageErrors(t *testing.T) {
+	duplicate := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 't1-SN-1' for key 'uix_printers_tenant_serial_number'"}
+	broken := errors.New("Error 1213: Deadlock found when trying to get lock")
+	batchSvc := NewBatchPrinterSvc(&failingPrinterRepository{errs: []error{duplicate, broken}}, nil, 2, 0)
+	results, err := batchSvc.BatchCreatePrinters(batchContext(), []*ditto.CreatePrinterRequest{
+		{Request: &ditto.PrinterDto{SerialNumber: "SN-1"}},
+		{Request: &ditto.PrinterDto{SerialNumber: "SN-2"}},
+	})
+	if err != nil {
+		t.Fatalf("BatchCreatePrinters: %v", err)
+	}
+	want := []struct {
+		code    codes.Code
+		message string
+	}{
+		{codes.AlreadyExists, "printer SN-1 already exists"},
+		{codes.Internal, "internal error"},
+	}
+	for i, result := range results {
+		if result.Status.Code() != want[i].code || result.Status.Message() != want[i].message {
+			t.Errorf("result %d is %v, want code %v and message %q", i, result.Status.Err(), want[i].code, want[i].message)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package svc
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"ditto/pkg/metrics"
+	"ditto/pkg/repository"
+	"errors"
+	"fmt"
+	"github.com/kutty-kumar/ho_oh/core_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"io"
+)
+
+const (
+	maxImportRows   = 10000
+	maxFieldLength  = 255
+	exportFlushRows = 100
+	ImportCreated   = "created"
+	ImportUpdated   = "updated"
+	ImportInvalid   = "invalid"
+	ImportFailed    = "failed"
+)
+
+// ImportResult is the outcome of importing a single row.
+type ImportResult struct {
+	Row          int      `json:"row"`
+	SerialNumber string   `json:"serial_number,omitempty"`
+	ExternalId   string   `json:"external_id,omitempty"`
+	Action       string   `json:"action"`
+	Errors       []string `json:"errors,omitempty"`
+}
+
+type ImportSummary struct {
+	DryRun  bool           `json:"dry_run"`
+	Created int            `json:"created"`
+	Updated int            `json:"updated"`
+	Failed  int            `json:"failed"`
+	Results []ImportResult `json:"results"`
+}
+
+// BulkPrinterSvc imports and exports printers in bulk, printers are matched on serial number so re-importing the same
+// payload is idempotent.
+type BulkPrinterSvc struct {
+	Repository repository.PrinterRepository
+	Models     repository.PrinterModelRepository
+}
+
+func NewBulkPrinterSvc(repository repository.PrinterRepository, models repository.PrinterModelRepository) *BulkPrinterSvc {
+	return &BulkPrinterSvc{Repository: repository, Models: models}
+}
+
+func (b *BulkPrinterSvc) ImportPrinters(ctx context.Context, userId string, format string, reader io.Reader, dryRun bool) (*ImportSummary, error) {
+	if len(userId) == 0 {
+		return nil, status.Errorf(codes.Unauthenticated, "user id is required")
+	}
+	records, err := DecodePrinterRecords(format, reader)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if len(records) > maxImportRows {
+		return nil, status.Errorf(codes.InvalidArgument, "import holds %d rows, at most %d are allowed", len(records), maxImportRows)
+	}
+	summary := &ImportSummary{DryRun: dryRun, Results: make([]ImportResult, 0, len(records))}
+	seen := make(map[string]int)
+	for _, decoded := range records {
+		result := ImportResult{Row: decoded.Row, SerialNumber: decoded.Record.SerialNumber}
+		violations := validateRecord(decoded, seen)
+		if decoded.Err == nil {
+			if err := checkProductNumber(ctx, b.Models, decoded.Record.ProductNumber); err != nil {
+				violations = append(violations, status.Convert(err).Message())
+			}
+		}
+		if len(violations) > 0 {
+			result.Action = ImportInvalid
+			result.Errors = violations
+		} else if dryRun {
+			result = b.plan(ctx, userId, result)
+		} else {
+			result = b.upsert(ctx, userId, decoded.Record, result)
+		}
+		switch result.Action {
+		case ImportCreated:
+			summary.Created++
+		case ImportUpdated:
+			summary.Updated++
+		default:
+			summary.Failed++
+		}
+		summary.Results = append(summary.Results, result)
+	}
+	return summary, nil
+}
+
+func validateRecord(decoded DecodedRecord, seen map[string]int) []string {
+	if decoded.Err != nil {
+		return []string{decoded.Err.Error()}
+	}
+	record := decoded.Record
+	var violations []string
+	if record.Name == "" {
+		violations = append(violations, "name is required")
+	}
+	if record.SerialNumber == "" {
+		violations = append(violations, "serial_number is required")
+	} else if row, ok := seen[record.SerialNumber]; ok {
+		violations = append(violations, fmt.Sprintf("serial_number duplicates row %d", row))
+	} else {
+		seen[record.SerialNumber] = decoded.Row
+	}
+	for column, value := range map[string]string{
+		"name":           record.Name,
+		"description":    record.Description,
+		"serial_number":  record.SerialNumber,
+		"product_number": record.ProductNumber,
+	} {
+		if len(value) > maxFieldLength {
+			violations = append(violations, fmt.Sprintf("%v must be at most %d characters", column, maxFieldLength))
+		}
+	}
+	if _, ok := core_v1.Status_value[record.Status]; record.Status != "" && !ok {
+		violations = append(violations, fmt.Sprintf("unknown status %v", record.Status))
+	}
+	return violations
+}
+
+// plan reports what importing the row would do without writing anything.
+func (b *BulkPrinterSvc) plan(ctx context.Context, userId string, result ImportResult) ImportResult {
+	existing, err := b.Repository.GetPrinterBySerialNumber(ctx, result.SerialNumber)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		result.Action = ImportCreated
+	case err != nil:
+		result.Action = ImportFailed
+		result.Errors = []string{err.Error()}
+	case existing.UserId != userId:
+		result.Action = ImportFailed
+		result.Errors = []string{"printer belongs to another user"}
+	default:
+		result.Action = ImportUpdated
+		result.ExternalId = existing.ExternalId
+	}
+	return result
+}
+
+func (b *BulkPrinterSvc) upsert(ctx context.Context, userId string, record PrinterRecord, result ImportResult) ImportResult {
+	printer := &domain.Printer{
+		Name:          record.Name,
+		UserId:        userId,
+		SerialNumber:  record.SerialNumber,
+		ProductNumber: record.ProductNumber,
+		Description:   record.Description,
+	}
+	printer.Status = int(core_v1.Status_active)
+	if record.Status != "" {
+		printer.Status = int(core_v1.Status_value[record.Status])
+	}
+	upserted, created, err := b.Repository.UpsertPrinter(ctx, printer)
+	if err != nil {
+		result.Action = ImportFailed
+		result.Errors = []string{status.Convert(err).Message()}
+		return result
+	}
+	result.ExternalId = upserted.ExternalId
+	result.Action = ImportUpdated
+	if created {
+		result.Action = ImportCreated
+		metrics.PrinterCreated(nil)
+	}
+	return result
+}
+
+// ExportPrinters streams the user's active printers to w, flushing periodically when w supports it.
+func (b *BulkPrinterSvc) ExportPrinters(ctx context.Context, userId string, format string, w io.Writer) error {
+	encoder, err := NewPrinterEncoder(format, w)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	flusher, canFlush := w.(interface{ Flush() })
+	rows := 0
+	err = b.Repository.StreamPrintersByUserId(ctx, userId, func(printer *domain.Printer) error {
+		if err := encoder.Encode(NewPrinterRecord(printer)); err != nil {
+			return err
+		}
+		rows++
+		if canFlush && rows%exportFlushRows == 0 {
+			if err := encoder.Flush(); err != nil {
+				return err
+			}
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,560 @@
+package svc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"ditto/pkg/connector"
+	"ditto/pkg/domain"
+	"ditto/pkg/repository"
+	"ditto/pkg/storage"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/kutty-kumar/ho_oh/core_v1"
+	uuid "github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// connectorJobStates are the job states a connector may report.
+var connectorJobStates = map[string]domain.JobState{
+	connector.JobStateProcessing: domain.JobStateProcessing,
+	connector.JobStateCompleted:  domain.JobStateCompleted,
+	connector.JobStateFailed:     domain.JobStateFailed,
+	connector.JobStateCanceled:   domain.JobStateCanceled,
+}
+
+// ConnectorOptions tune how jobs are handed to connectors.
+type ConnectorOptions struct {
+	// DispatchInterval is how often a connected connector's printers are checked for queued jobs.
+	DispatchInterval time.Duration
+	// MaxInFlight bounds the jobs handed to a connector that it hasn't acknowledged yet.
+	MaxInFlight int
+	// ChunkBytes is the size of the chunks documents are streamed in.
+	ChunkBytes int
+}
+
+// ConnectorSvc manages the connectors fronting printers ditto can't reach and serves their streams. A connector
+// registers its printers when it connects, is handed the queued jobs of those printers along with their documents
+// and reports back job states and printer telemetry. A connector has at most one stream, a new one replaces the
+// old. Streams are tracked per process, so with several replicas a connector is only replaced on the one it
+// reconnects to.
+type ConnectorSvc struct {
+	Repository        repository.ConnectorRepository
+	JobRepository     repository.PrintJobRepository
+	PrinterRepository repository.PrinterRepository
+	Models            repository.PrinterModelRepository
+	store             *storage.DocumentStore
+	logger            *logrus.Logger
+	options           ConnectorOptions
+
+	mu       sync.Mutex
+	sessions map[string]*connectorSession
+}
+
+func NewConnectorSvc(repository repository.ConnectorRepository, jobRepository repository.PrintJobRepository, printerRepository repository.PrinterRepository,
+	models repository.PrinterModelRepository, store *storage.DocumentStore, logger *logrus.Logger, options ConnectorOptions) *ConnectorSvc {
+	return &ConnectorSvc{
+		Repository:        repository,
+		JobRepository:     jobRepository,
+		PrinterRepository: printerRepository,
+		Models:            models,
+		store:             store,
+		logger:            logger,
+		options:           options,
+		sessions:          map[string]*connectorSession{},
+	}
+}
+
+func newConnectorSecret() (string, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	return encoded, secretDigest(encoded), nil
+}
+
+func secretDigest(secret string) string {
+	digest := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(digest[:])
+}
+
+// CreateConnector creates a connector for the caller. Its secret is part of the response and can't be read back
+// later, only rotated.
+func (c *ConnectorSvc) CreateConnector(ctx context.Context, name string) (*domain.ConnectorDto, error) {
+	userId := ctx.Value("user").(map[string]string)["user_id"]
+	if len(userId) == 0 {
+		return nil, status.Errorf(codes.Unauthenticated, "user id is required")
+	}
+	if name == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "name is required")
+	}
+	secret, digest, err := newConnectorSecret()
+	if err != nil {
+		return nil, err
+	}
+	created := &domain.Connector{ConnectorId: uuid.NewV4().String(), UserId: userId, Name: name, SecretDigest: digest}
+	if err := c.Repository.CreateConnector(ctx, created); err != nil {
+		return nil, err
+	}
+	dto := created.ToDto()
+	dto.Secret = secret
+	return &dto, nil
+}
+
+func (c *ConnectorSvc) ListConnectors(ctx context.Context) ([]domain.ConnectorDto, error) {
+	userId := ctx.Value("user").(map[string]string)["user_id"]
+	connectors, err := c.Repository.GetConnectorsByUserId(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]domain.ConnectorDto, 0, len(connectors))
+	for _, found := range connectors {
+		result = append(result, found.ToDto())
+	}
+	return result, nil
+}
+
+func (c *ConnectorSvc) GetConnector(ctx context.Context, connectorId string) (*domain.ConnectorDto, error) {
+	found, err := c.ownedConnector(ctx, connectorId)
+	if err != nil {
+		return nil, err
+	}
+	dto := found.ToDto()
+	if dto.PrinterIds, err = c.Repository.GetPrinterIds(ctx, connectorId); err != nil {
+		return nil, err
+	}
+	return &dto, nil
+}
+
+// DeleteConnector deletes the connector and drops its stream, its printers stay with their owner.
+func (c *ConnectorSvc) DeleteConnector(ctx context.Context, connectorId string) error {
+	if _, err := c.ownedConnector(ctx, connectorId); err != nil {
+		return err
+	}
+	if err := c.Repository.DeleteConnector(ctx, connectorId); err != nil {
+		return err
+	}
+	c.disconnect(connectorId)
+	return nil
+}
+
+// RotateSecret replaces the connector's secret and drops its stream, which has to be reopened with the new one.
+func (c *ConnectorSvc) RotateSecret(ctx context.Context, connectorId string) (*domain.ConnectorDto, error) {
+	found, err := c.ownedConnector(ctx, connectorId)
+	if err != nil {
+		return nil, err
+	}
+	secret, digest, err := newConnectorSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Repository.UpdateSecret(ctx, connectorId, digest); err != nil {
+		return nil, err
+	}
+	c.disconnect(connectorId)
+	dto := found.ToDto()
+	dto.Secret = secret
+	return &dto, nil
+}
+
+// ownedConnector loads a connector the caller owns, tenant admins may access any connector of their tenant.
+func (c *ConnectorSvc) ownedConnector(ctx context.Context, connectorId string) (*domain.Connector, error) {
+	found, err := c.Repository.GetConnector(ctx, connectorId)
+	if err != nil {
+		return nil, err
+	}
+	if found.UserId != ctx.Value("user").(map[string]string)["user_id"] {
+		if err := requireTenantAdmin(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
+
+func (c *ConnectorSvc) disconnect(connectorId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if session, ok := c.sessions[connectorId]; ok {
+		session.cancel()
+		delete(c.sessions, connectorId)
+	}
+}
+
+// DisconnectAll drops every stream served by this process, the jobs in flight on them are queued again. Connectors
+// reconnect, to another replica when this one is shutting down.
+func (c *ConnectorSvc) DisconnectAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for connectorId, session := range c.sessions {
+		session.cancel()
+		delete(c.sessions, connectorId)
+	}
+}
+
+// authenticate resolves the connector whose credentials the stream was opened with.
+func (c *ConnectorSvc) authenticate(ctx context.Context) (*domain.Connector, error) {
+	headers, _ := metadata.FromIncomingContext(ctx)
+	connectorIds, secrets := headers.Get(connector.MetadataConnectorId), headers.Get(connector.MetadataConnectorSecret)
+	if len(connectorIds) == 0 || len(secrets) == 0 {
+		return nil, status.Errorf(codes.Unauthenticated, "connector credentials are required")
+	}
+	found, err := c.Repository.GetConnectorOfAnyTenant(ctx, connectorIds[0])
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid connector credentials")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(found.SecretDigest), []byte(secretDigest(secrets[0]))) != 1 {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid connector credentials")
+	}
+	return found, nil
+}
+
+// Connect serves a connector stream until the connector hangs up, another stream replaces it or the connector is
+// deleted. Jobs handed out but not acknowledged by then are queued again.
+func (c *ConnectorSvc) Connect(stream connector.ConnectServer) error {
+	found, err := c.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if first.Register == nil {
+		return status.Errorf(codes.InvalidArgument, "a stream must start with a registration")
+	}
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	session := &connectorSession{
+		svc:       c,
+		connector: found,
+		stream:    stream,
+		cancel:    cancel,
+		printers:  map[string]string{},
+		inFlight:  map[string]bool{},
+	}
+	ctx = session.asOwner(ctx)
+	c.mu.Lock()
+	if previous, ok := c.sessions[found.ConnectorId]; ok {
+		previous.cancel()
+	}
+	c.sessions[found.ConnectorId] = session
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		if c.sessions[found.ConnectorId] == session {
+			delete(c.sessions, found.ConnectorId)
+		}
+		c.mu.Unlock()
+		session.requeue()
+	}()
+
+	if err := c.Repository.TouchConnector(ctx, found.ConnectorId, time.Now()); err != nil {
+		return err
+	}
+	if err := session.register(ctx, first.Register); err != nil {
+		return err
+	}
+	c.logger.Infof("connector %v connected", found.ConnectorId)
+	received := make(chan error, 1)
+	go func() { received <- session.receive(ctx) }()
+	ticker := time.NewTicker(c.options.DispatchInterval)
+	defer ticker.Stop()
+	for {
+		if err := session.dispatch(ctx); err != nil {
+			return err
+		}
+		select {
+		case err := <-received:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-ctx.Done():
+			if stream.Context().Err() != nil {
+				return stream.Context().Err()
+			}
+			return status.Errorf(codes.Aborted, "connector stream was replaced, revoked or closed by the server")
+		case <-ticker.C:
+		}
+	}
+}
+
+// connectorSession is an open connector stream. printers maps the serial numbers of the registered printers to
+// their ids, inFlight holds the jobs handed out but not acknowledged yet.
+type connectorSession struct {
+	svc       *ConnectorSvc
+	connector *domain.Connector
+	stream    connector.ConnectServer
+	cancel    context.CancelFunc
+
+	sendMu   sync.Mutex
+	mu       sync.Mutex
+	printers map[string]string
+	inFlight map[string]bool
+}
+
+func (s *connectorSession) send(message *connector.ServerMessage) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	return s.stream.Send(message)
+}
+
+func (s *connectorSession) printerIds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	printerIds := make([]string, 0, len(s.printers))
+	for _, printerId := range s.printers {
+		printerIds = append(printerIds, printerId)
+	}
+	return printerIds
+}
+
+// asOwner returns ctx acting as the connector's owner. The stream carries no user, the session works as the owner so
+// that the records of other tenants stay out of sight.
+func (s *connectorSession) asOwner(ctx context.Context) context.Context {
+	return context.WithValue(ctx, "user", map[string]string{"user_id": s.connector.UserId, "tenant_id": s.connector.TenantId})
+}
+
+// register takes on the printers the connector fronts, creating the unknown ones for its owner.
+func (s *connectorSession) register(ctx context.Context, register *connector.Register) error {
+	registered := &connector.Registered{Printers: []connector.RegisteredPrinter{}}
+	printers := map[string]string{}
+	for _, info := range register.Printers {
+		printerId, err := s.registerPrinter(ctx, info)
+		if err != nil {
+			if _, ok := status.FromError(err); !ok {
+				return err
+			}
+			registered.Rejected = append(registered.Rejected, connector.RejectedPrinter{SerialNumber: info.SerialNumber, Reason: status.Convert(err).Message()})
+			continue
+		}
+		printers[info.SerialNumber] = printerId
+		registered.Printers = append(registered.Printers, connector.RegisteredPrinter{SerialNumber: info.SerialNumber, PrinterId: printerId})
+	}
+	s.mu.Lock()
+	s.printers = printers
+	s.mu.Unlock()
+	return s.send(&connector.ServerMessage{Registered: registered})
+}
+
+// registerPrinter returns the id of the printer, rejections are returned as status errors.
+func (s *connectorSession) registerPrinter(ctx context.Context, info connector.PrinterInfo) (string, error) {
+	if info.SerialNumber == "" {
+		return "", status.Errorf(codes.InvalidArgument, "serial number is required")
+	}
+	if err := checkProductNumber(ctx, s.svc.Models, info.ProductNumber); err != nil {
+		return "", err
+	}
+	existing, err := s.svc.PrinterRepository.GetPrinterBySerialNumber(ctx, info.SerialNumber)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	if err == nil && existing.Status != int(core_v1.Status_active) && existing.UserId == s.connector.UserId {
+		return "", status.Errorf(codes.FailedPrecondition, "printer %v is deleted", info.SerialNumber)
+	}
+	printer := &domain.Printer{
+		Name:          info.Name,
+		UserId:        s.connector.UserId,
+		TenantId:      s.connector.TenantId,
+		SerialNumber:  info.SerialNumber,
+		ProductNumber: info.ProductNumber,
+		Status:        int(core_v1.Status_active),
+	}
+	if printer.Name == "" && existing == nil {
+		printer.Name = info.SerialNumber
+	}
+	upserted, _, err := s.svc.PrinterRepository.UpsertPrinter(ctx, printer)
+	if err != nil {
+		return "", err
+	}
+	if err := s.svc.Repository.AttachPrinter(ctx, s.connector.ConnectorId, upserted.ExternalId); err != nil {
+		return "", err
+	}
+	return upserted.ExternalId, nil
+}
+
+// receive handles the connector's messages until the stream ends.
+func (s *connectorSession) receive(ctx context.Context) error {
+	for {
+		message, err := s.stream.Recv()
+		if err != nil {
+			return err
+		}
+		switch {
+		case message.Register != nil:
+			err = s.register(ctx, message.Register)
+		case message.JobState != nil:
+			err = s.updateJob(ctx, message.JobState)
+		case message.Telemetry != nil:
+			err = s.recordTelemetry(ctx, message.Telemetry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *connectorSession) updateJob(ctx context.Context, update *connector.JobState) error {
+	state, ok := connectorJobStates[update.State]
+	if !ok {
+		return status.Errorf(codes.InvalidArgument, "unknown job state %v", update.State)
+	}
+	s.mu.Lock()
+	delete(s.inFlight, update.JobId)
+	s.mu.Unlock()
+	if state == domain.JobStateProcessing {
+		return nil
+	}
+	updated, err := s.svc.JobRepository.UpdateDispatchedJobState(ctx, update.JobId, s.printerIds(), state, update.Error)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		s.svc.logger.Debugf("connector %v reported job %v %v, which it isn't printing", s.connector.ConnectorId, update.JobId, update.State)
+	}
+	return nil
+}
+
+func (s *connectorSession) recordTelemetry(ctx context.Context, telemetry *connector.Telemetry) error {
+	s.mu.Lock()
+	printerId, ok := s.printers[telemetry.SerialNumber]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	encoded, err := json.Marshal(telemetry)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := s.svc.Repository.RecordTelemetry(ctx, s.connector.ConnectorId, printerId, telemetry.State, string(encoded), now); err != nil {
+		return err
+	}
+	return s.svc.Repository.TouchPrinters(ctx, []string{printerId}, now)
+}
+
+// dispatch marks the connector's printers online and hands it their queued jobs, as many as it may have in flight.
+func (s *connectorSession) dispatch(ctx context.Context) error {
+	printerIds := s.printerIds()
+	if err := s.svc.Repository.TouchPrinters(ctx, printerIds, time.Now()); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	free := s.svc.options.MaxInFlight - len(s.inFlight)
+	s.mu.Unlock()
+	if free <= 0 {
+		return nil
+	}
+	jobs, err := s.svc.JobRepository.GetDispatchableJobs(ctx, printerIds, free)
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		claimed, err := s.svc.JobRepository.ClaimJob(ctx, jobs[i].ExternalId)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		s.mu.Lock()
+		s.inFlight[jobs[i].ExternalId] = true
+		s.mu.Unlock()
+		if err := s.sendJob(ctx, &jobs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendJob streams the job and its document to the connector. A job whose document is gone or can't be read in full
+// fails, content that turns out corrupt while being streamed fails the digest check of the connector.
+func (s *connectorSession) sendJob(ctx context.Context, job *domain.PrintJob) error {
+	document, err := s.svc.JobRepository.GetDocument(ctx, job.ExternalId, domain.DocumentKindPrint)
+	var content io.ReadCloser
+	if err == nil {
+		content, err = s.svc.store.Open(ctx, document.Digest)
+	}
+	if err != nil {
+		s.mu.Lock()
+		delete(s.inFlight, job.ExternalId)
+		s.mu.Unlock()
+		_, err = s.svc.JobRepository.UpdateDispatchedJobState(ctx, job.ExternalId, []string{job.PrinterId}, domain.JobStateFailed, "document unavailable: "+err.Error())
+		return err
+	}
+	defer content.Close()
+	s.mu.Lock()
+	serialNumber := ""
+	for serial, printerId := range s.printers {
+		if printerId == job.PrinterId {
+			serialNumber = serial
+		}
+	}
+	s.mu.Unlock()
+	err = s.send(&connector.ServerMessage{Job: &connector.Job{
+		JobId:        job.ExternalId,
+		PrinterId:    job.PrinterId,
+		SerialNumber: serialNumber,
+		DocumentName: job.DocumentName,
+		Format:       document.Format,
+		Copies:       job.Copies,
+		Size:         document.Size,
+		Sha256:       document.Digest,
+	}})
+	if err != nil {
+		return err
+	}
+	chunk := make([]byte, s.svc.options.ChunkBytes)
+	for {
+		n, err := io.ReadFull(content, chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return s.abortJob(ctx, job, err)
+		}
+		last := err != nil
+		if err := s.send(&connector.ServerMessage{JobData: &connector.JobData{JobId: job.ExternalId, Data: chunk[:n], Last: last}}); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// abortJob fails a job whose document couldn't be read in full and tells the connector to drop what it received.
+func (s *connectorSession) abortJob(ctx context.Context, job *domain.PrintJob, readErr error) error {
+	s.svc.logger.WithError(readErr).Errorf("failed to read the document of job %v", job.ExternalId)
+	s.mu.Lock()
+	delete(s.inFlight, job.ExternalId)
+	s.mu.Unlock()
+	if _, err := s.svc.JobRepository.UpdateDispatchedJobState(ctx, job.ExternalId, []string{job.PrinterId}, domain.JobStateFailed, "document unreadable"); err != nil {
+		return err
+	}
+	return s.send(&connector.ServerMessage{JobData: &connector.JobData{JobId: job.ExternalId, Last: true, Error: "document unreadable"}})
+}
+
+// requeue queues the jobs the connector never acknowledged again, so they are handed out once more.
+func (s *connectorSession) requeue() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for jobId := range s.inFlight {
+		if err := s.svc.JobRepository.RequeueJob(s.asOwner(context.Background()), jobId); err != nil {
+			s.svc.logger.WithError(err).Errorf("failed to requeue job %v", jobId)
+		}
+	}
+	s.inFlight = map[string]bool{}
+}
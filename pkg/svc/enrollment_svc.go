@@ -0,0 +1,322 @@
+package svc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/x509"
+	"ditto/pkg/domain"
+	"ditto/pkg/pki"
+	"ditto/pkg/repository"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/kutty-kumar/ho_oh/core_v1"
+	uuid "github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// claimCodeAlphabet leaves out characters that are easily confused when read off a device display.
+const claimCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const claimCodeLength = 8
+
+// EnrollmentRequest is what a device sends to be enrolled, Csr being a PEM encoded certificate request for the key
+// it will authenticate with.
+type EnrollmentRequest struct {
+	SerialNumber  string `json:"serial_number"`
+	ProductNumber string `json:"product_number,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Csr           string `json:"csr"`
+}
+
+type EnrollmentOptions struct {
+	// ClaimCodeTtl is how long a claim code can be entered, and how long a device has to fetch its certificate after.
+	ClaimCodeTtl time.Duration
+	// CertificateTtl is how long device certificates are valid, devices renew them before they expire.
+	CertificateTtl time.Duration
+}
+
+// EnrollmentSvc enrolls devices. A device requests a claim code, the user enters it to bind the device to their
+// account as a printer, and the device fetches a client certificate from the internal CA that it authenticates
+// further calls with over mutual TLS.
+type EnrollmentSvc struct {
+	Repository        repository.EnrollmentRepository
+	PrinterRepository repository.PrinterRepository
+	Models            repository.PrinterModelRepository
+	ca                *pki.CertificateAuthority
+	logger            *logrus.Logger
+	options           EnrollmentOptions
+}
+
+func NewEnrollmentSvc(repository repository.EnrollmentRepository, printerRepository repository.PrinterRepository, models repository.PrinterModelRepository,
+	ca *pki.CertificateAuthority, logger *logrus.Logger, options EnrollmentOptions) *EnrollmentSvc {
+	return &EnrollmentSvc{
+		Repository:        repository,
+		PrinterRepository: printerRepository,
+		Models:            models,
+		ca:                ca,
+		logger:            logger,
+		options:           options,
+	}
+}
+
+func newClaimCode() (string, error) {
+	random := make([]byte, claimCodeLength)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	code := make([]byte, claimCodeLength)
+	for i, b := range random {
+		// 256 is a multiple of the alphabet's 32 characters, so every character is equally likely
+		code[i] = claimCodeAlphabet[int(b)%len(claimCodeAlphabet)]
+	}
+	return string(code), nil
+}
+
+// formatClaimCode splits a claim code in half for display, normalizeClaimCode undoes it along with any case changes.
+func formatClaimCode(code string) string {
+	return code[:claimCodeLength/2] + "-" + code[claimCodeLength/2:]
+}
+
+func normalizeClaimCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// RequestEnrollment starts the enrollment of a device. The response holds the claim code to display and the token
+// the device polls the enrollment with, neither can be read back later.
+func (e *EnrollmentSvc) RequestEnrollment(ctx context.Context, request *EnrollmentRequest) (*domain.DeviceEnrollmentDto, error) {
+	if request.SerialNumber == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "serial number is required")
+	}
+	if _, err := pki.ParseCertificateRequest([]byte(request.Csr)); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := checkProductNumber(ctx, e.Models, request.ProductNumber); err != nil {
+		return nil, err
+	}
+	claimCode, err := newClaimCode()
+	if err != nil {
+		return nil, err
+	}
+	pollToken, pollTokenDigest, err := newConnectorSecret()
+	if err != nil {
+		return nil, err
+	}
+	enrollment := &domain.DeviceEnrollment{
+		EnrollmentId:    uuid.NewV4().String(),
+		ClaimCode:       claimCode,
+		PollTokenDigest: pollTokenDigest,
+		SerialNumber:    request.SerialNumber,
+		ProductNumber:   request.ProductNumber,
+		Name:            request.Name,
+		Csr:             request.Csr,
+		State:           int(domain.EnrollmentStatePending),
+		ExpiresAt:       time.Now().Add(e.options.ClaimCodeTtl),
+	}
+	if err := e.Repository.CreateEnrollment(ctx, enrollment); err != nil {
+		return nil, err
+	}
+	dto := enrollment.ToDto()
+	dto.ClaimCode = formatClaimCode(claimCode)
+	dto.PollToken = pollToken
+	return &dto, nil
+}
+
+// PollEnrollment returns the state of an enrollment to the device that requested it, along with its certificate
+// once a user claimed it.
+func (e *EnrollmentSvc) PollEnrollment(ctx context.Context, enrollmentId string, pollToken string) (*domain.DeviceEnrollmentDto, error) {
+	enrollment, err := e.Repository.GetEnrollment(ctx, enrollmentId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, status.Errorf(codes.NotFound, "enrollment %v doesn't exist or expired", enrollmentId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(enrollment.PollTokenDigest), []byte(secretDigest(pollToken))) != 1 {
+		return nil, status.Errorf(codes.PermissionDenied, "invalid poll token")
+	}
+	if !time.Now().Before(enrollment.ExpiresAt) {
+		return nil, status.Errorf(codes.NotFound, "enrollment %v doesn't exist or expired", enrollmentId)
+	}
+	dto := enrollment.ToDto()
+	if dto.Certificate != "" {
+		dto.CaCertificate = string(e.ca.CertificatePem())
+	}
+	return &dto, nil
+}
+
+// ClaimDevice binds the device displaying the claim code to the caller's account, creating its printer, and issues
+// the device its certificate.
+func (e *EnrollmentSvc) ClaimDevice(ctx context.Context, claimCode string) (*domain.DeviceEnrollmentDto, error) {
+	userId := ctx.Value("user").(map[string]string)["user_id"]
+	if len(userId) == 0 {
+		return nil, status.Errorf(codes.Unauthenticated, "user id is required")
+	}
+	enrollment, err := e.Repository.GetPendingEnrollmentByClaimCode(ctx, normalizeClaimCode(claimCode), time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, status.Errorf(codes.NotFound, "unknown or expired claim code")
+	}
+	if err != nil {
+		return nil, err
+	}
+	claimed, err := e.Repository.ClaimEnrollment(ctx, enrollment.EnrollmentId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, status.Errorf(codes.NotFound, "unknown or expired claim code")
+	}
+	enrollment.UserId = userId
+	if err := e.bind(ctx, enrollment); err != nil {
+		if releaseErr := e.Repository.ReleaseEnrollment(context.Background(), enrollment.EnrollmentId); releaseErr != nil {
+			e.logger.WithError(releaseErr).Errorf("failed to release enrollment %v", enrollment.EnrollmentId)
+		}
+		return nil, err
+	}
+	dto := enrollment.ToDto()
+	dto.Certificate = ""
+	return &dto, nil
+}
+
+// bind creates or takes over the printer of a claimed enrollment and issues its certificate.
+func (e *EnrollmentSvc) bind(ctx context.Context, enrollment *domain.DeviceEnrollment) error {
+	existing, err := e.PrinterRepository.GetPrinterBySerialNumber(ctx, enrollment.SerialNumber)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if existing != nil && existing.UserId == enrollment.UserId && existing.Status != int(core_v1.Status_active) {
+		return status.Errorf(codes.FailedPrecondition, "printer %v is deleted", enrollment.SerialNumber)
+	}
+	printer := &domain.Printer{
+		Name:          enrollment.Name,
+		UserId:        enrollment.UserId,
+		SerialNumber:  enrollment.SerialNumber,
+		ProductNumber: enrollment.ProductNumber,
+		Status:        int(core_v1.Status_active),
+	}
+	if printer.Name == "" && existing == nil {
+		printer.Name = enrollment.SerialNumber
+	}
+	upserted, _, err := e.PrinterRepository.UpsertPrinter(ctx, printer)
+	if err != nil {
+		return err
+	}
+	issued, err := e.ca.IssueDeviceCertificate([]byte(enrollment.Csr), upserted.ExternalId, e.options.CertificateTtl)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	enrollment.PrinterId = upserted.ExternalId
+	enrollment.Certificate = string(issued.Pem)
+	enrollment.State = int(domain.EnrollmentStateClaimed)
+	enrollment.ExpiresAt = time.Now().Add(e.options.ClaimCodeTtl)
+	return e.Repository.CompleteEnrollment(ctx, enrollment, &domain.DeviceCertificate{
+		Serial:    issued.Serial,
+		PrinterId: upserted.ExternalId,
+		NotAfter:  issued.NotAfter,
+	})
+}
+
+// AuthenticateDevice resolves the printer a verified client certificate was issued to, failing for revoked
+// certificates and deleted printers.
+func (e *EnrollmentSvc) AuthenticateDevice(ctx context.Context, certificate *x509.Certificate) (*domain.Printer, error) {
+	printerId, err := pki.DevicePrinterId(certificate)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "%v", err)
+	}
+	issued, err := e.Repository.GetCertificateOfAnyTenant(ctx, pki.SerialString(certificate.SerialNumber))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, status.Errorf(codes.Unauthenticated, "unknown device certificate")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if issued.RevokedAt != nil || issued.PrinterId != printerId {
+		return nil, status.Errorf(codes.Unauthenticated, "device certificate was revoked")
+	}
+	// the printer is looked up in the tenant the certificate was issued in
+	ctx = context.WithValue(ctx, "device", map[string]string{"printer_id": printerId, "tenant_id": issued.TenantId})
+	printer, err := e.PrinterRepository.GetPrinter(ctx, printerId)
+	if err != nil {
+		return nil, err
+	}
+	if printer.Status != int(core_v1.Status_active) {
+		return nil, status.Errorf(codes.PermissionDenied, "printer %v is deleted", printerId)
+	}
+	return printer, nil
+}
+
+// RenewCertificate issues the calling device a new certificate for the key in csr, its current one stays valid
+// until it expires or is revoked.
+func (e *EnrollmentSvc) RenewCertificate(ctx context.Context, csr string) (*domain.DeviceEnrollmentDto, error) {
+	printerId := ctx.Value("device").(map[string]string)["printer_id"]
+	issued, err := e.ca.IssueDeviceCertificate([]byte(csr), printerId, e.options.CertificateTtl)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	err = e.Repository.CreateCertificate(ctx, &domain.DeviceCertificate{Serial: issued.Serial, PrinterId: printerId, NotAfter: issued.NotAfter})
+	if err != nil {
+		return nil, err
+	}
+	return &domain.DeviceEnrollmentDto{
+		State:         domain.EnrollmentStateClaimed.String(),
+		PrinterId:     printerId,
+		Certificate:   string(issued.Pem),
+		CaCertificate: string(e.ca.CertificatePem()),
+		ExpiresAt:     issued.NotAfter,
+	}, nil
+}
+
+// DeviceHeartbeat marks the calling device online.
+func (e *EnrollmentSvc) DeviceHeartbeat(ctx context.Context) error {
+	device := ctx.Value("device").(map[string]string)
+	return e.PrinterRepository.TouchPrinter(ctx, device["user_id"], device["printer_id"], time.Now())
+}
+
+// ListCertificates lists the certificates issued to one of the caller's printers.
+func (e *EnrollmentSvc) ListCertificates(ctx context.Context, printerId string) ([]domain.DeviceCertificateDto, error) {
+	if err := e.ownPrinter(ctx, printerId); err != nil {
+		return nil, err
+	}
+	certificates, err := e.Repository.GetCertificatesByPrinterId(ctx, printerId)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]domain.DeviceCertificateDto, 0, len(certificates))
+	for _, certificate := range certificates {
+		result = append(result, certificate.ToDto())
+	}
+	return result, nil
+}
+
+// RevokeCertificate revokes a certificate issued to one of the caller's printers, the device can't authenticate
+// with it anymore.
+func (e *EnrollmentSvc) RevokeCertificate(ctx context.Context, serial string) error {
+	certificate, err := e.Repository.GetCertificate(ctx, serial)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return status.Errorf(codes.NotFound, "certificate %v doesn't exist", serial)
+	}
+	if err != nil {
+		return err
+	}
+	if err := e.ownPrinter(ctx, certificate.PrinterId); err != nil {
+		return err
+	}
+	return e.Repository.RevokeCertificate(ctx, serial, time.Now())
+}
+
+// ownPrinter fails unless the caller owns the printer, tenant admins own every printer of their tenant.
+func (e *EnrollmentSvc) ownPrinter(ctx context.Context, printerId string) error {
+	printer, err := e.PrinterRepository.GetPrinter(ctx, printerId)
+	if err != nil {
+		return err
+	}
+	if printer.UserId != ctx.Value("user").(map[string]string)["user_id"] {
+		return requireTenantAdmin(ctx)
+	}
+	return nil
+}
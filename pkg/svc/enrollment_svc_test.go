@@ -0,0 +1,281 @@
+package svc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"ditto/pkg/domain"
+	"ditto/pkg/pki"
+	"ditto/pkg/repository"
+	"encoding/pem"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kutty-kumar/charminder/pkg"
+	"github.com/kutty-kumar/ho_oh/core_v1"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// enrollmentRepository keeps enrollments and certificates in memory.
+type enrollmentRepository struct {
+	repository.EnrollmentRepository
+	enrollments  map[string]*domain.DeviceEnrollment
+	certificates map[string]*domain.DeviceCertificate
+}
+
+func newEnrollmentRepository() *enrollmentRepository {
+	return &enrollmentRepository{
+		enrollments:  map[string]*domain.DeviceEnrollment{},
+		certificates: map[string]*domain.DeviceCertificate{},
+	}
+}
+
+func (e *enrollmentRepository) CreateEnrollment(ctx context.Context, enrollment *domain.DeviceEnrollment) error {
+	stored := *enrollment
+	e.enrollments[enrollment.EnrollmentId] = &stored
+	return nil
+}
+
+func (e *enrollmentRepository) GetEnrollment(ctx context.Context, enrollmentId string) (*domain.DeviceEnrollment, error) {
+	enrollment, ok := e.enrollments[enrollmentId]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	stored := *enrollment
+	return &stored, nil
+}
+
+func (e *enrollmentRepository) GetPendingEnrollmentByClaimCode(ctx context.Context, claimCode string, now time.Time) (*domain.DeviceEnrollment, error) {
+	for _, enrollment := range e.enrollments {
+		if enrollment.ClaimCode == claimCode && enrollment.State == int(domain.EnrollmentStatePending) && now.Before(enrollment.ExpiresAt) {
+			stored := *enrollment
+			return &stored, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (e *enrollmentRepository) ClaimEnrollment(ctx context.Context, enrollmentId string, userId string) (bool, error) {
+	enrollment, ok := e.enrollments[enrollmentId]
+	if !ok || enrollment.State != int(domain.EnrollmentStatePending) || enrollment.UserId != "" {
+		return false, nil
+	}
+	enrollment.UserId = userId
+	return true, nil
+}
+
+func (e *enrollmentRepository) ReleaseEnrollment(ctx context.Context, enrollmentId string) error {
+	e.enrollments[enrollmentId].UserId = ""
+	return nil
+}
+
+func (e *enrollmentRepository) CompleteEnrollment(ctx context.Context, enrollment *domain.DeviceEnrollment, certificate *domain.DeviceCertificate) error {
+	stored := *enrollment
+	e.enrollments[enrollment.EnrollmentId] = &stored
+	return e.CreateCertificate(ctx, certificate)
+}
+
+func (e *enrollmentRepository) CreateCertificate(ctx context.Context, certificate *domain.DeviceCertificate) error {
+	stored := *certificate
+	e.certificates[certificate.Serial] = &stored
+	return nil
+}
+
+func (e *enrollmentRepository) GetCertificate(ctx context.Context, serial string) (*domain.DeviceCertificate, error) {
+	certificate, ok := e.certificates[serial]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	stored := *certificate
+	return &stored, nil
+}
+
+func (e *enrollmentRepository) GetCertificateOfAnyTenant(ctx context.Context, serial string) (*domain.DeviceCertificate, error) {
+	return e.GetCertificate(ctx, serial)
+}
+
+func (e *enrollmentRepository) RevokeCertificate(ctx context.Context, serial string, revokedAt time.Time) error {
+	e.certificates[serial].RevokedAt = &revokedAt
+	return nil
+}
+
+// enrolledPrinterRepository creates printers by serial number.
+type enrolledPrinterRepository struct {
+	repository.PrinterRepository
+	printers map[string]*domain.Printer
+}
+
+func (e *enrolledPrinterRepository) GetPrinterBySerialNumber(ctx context.Context, serialNumber string) (*domain.Printer, error) {
+	for _, printer := range e.printers {
+		if printer.SerialNumber == serialNumber {
+			return printer, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (e *enrolledPrinterRepository) UpsertPrinter(ctx context.Context, printer *domain.Printer) (*domain.Printer, bool, error) {
+	if existing, err := e.GetPrinterBySerialNumber(ctx, printer.SerialNumber); err == nil {
+		existing.UserId = printer.UserId
+		existing.Status = printer.Status
+		return existing, false, nil
+	}
+	printer.BaseDomain = pkg.BaseDomain{ExternalId: "printer-" + printer.SerialNumber}
+	e.printers[printer.ExternalId] = printer
+	return printer, true, nil
+}
+
+func (e *enrolledPrinterRepository) GetPrinter(ctx context.Context, printerId string) (*domain.Printer, error) {
+	printer, ok := e.printers[printerId]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return printer, nil
+}
+
+func newCertificateRequest(t *testing.T, curve elliptic.Curve) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "device"}}, key)
+	if err != nil {
+		t.Fatalf("creating certificate request: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+}
+
+func newTestEnrollmentSvc(t *testing.T) (*EnrollmentSvc, *enrollmentRepository, *enrolledPrinterRepository) {
+	t.Helper()
+	ca, err := pki.NewEphemeralCertificateAuthority()
+	if err != nil {
+		t.Fatalf("creating CA: %v", err)
+	}
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	enrollments := newEnrollmentRepository()
+	printers := &enrolledPrinterRepository{printers: map[string]*domain.Printer{}}
+	options := EnrollmentOptions{ClaimCodeTtl: 10 * time.Minute, CertificateTtl: 24 * time.Hour}
+	return NewEnrollmentSvc(enrollments, printers, testCatalog, ca, logger, options), enrollments, printers
+}
+
+func TestEnrollDevice(t *testing.T) {
+	enrollmentSvc, _, printers := newTestEnrollmentSvc(t)
+	ctx := batchContext()
+
+	requested, err := enrollmentSvc.RequestEnrollment(context.Background(), &EnrollmentRequest{
+		SerialNumber: "SN-1", ProductNumber: "M404", Csr: newCertificateRequest(t, elliptic.P256()),
+	})
+	if err != nil {
+		t.Fatalf("RequestEnrollment: %v", err)
+	}
+	if len(requested.ClaimCode) != claimCodeLength+1 || requested.ClaimCode[claimCodeLength/2] != '-' || requested.PollToken == "" {
+		t.Fatalf("got claim code %q and poll token %q, want a formatted claim code and a poll token", requested.ClaimCode, requested.PollToken)
+	}
+
+	if _, err := enrollmentSvc.PollEnrollment(context.Background(), requested.EnrollmentId, "wrong"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("polling with the wrong token returned %v, want %v", err, codes.PermissionDenied)
+	}
+	pending, err := enrollmentSvc.PollEnrollment(context.Background(), requested.EnrollmentId, requested.PollToken)
+	if err != nil {
+		t.Fatalf("PollEnrollment: %v", err)
+	}
+	if pending.State != domain.EnrollmentStatePending.String() || pending.Certificate != "" {
+		t.Errorf("got %v enrollment with certificate %q before the claim, want a pending one without", pending.State, pending.Certificate)
+	}
+
+	claimed, err := enrollmentSvc.ClaimDevice(ctx, strings.ToLower(requested.ClaimCode))
+	if err != nil {
+		t.Fatalf("ClaimDevice: %v", err)
+	}
+	if claimed.Certificate != "" {
+		t.Errorf("the claim response carries the device certificate")
+	}
+	printer, ok := printers.printers[claimed.PrinterId]
+	if !ok || printer.UserId != "user-1" || printer.Name != "SN-1" || printer.Status != int(core_v1.Status_active) {
+		t.Fatalf("got printer %+v for the claimed enrollment, want an active SN-1 printer of user-1", printer)
+	}
+	if _, err := enrollmentSvc.ClaimDevice(ctx, requested.ClaimCode); status.Code(err) != codes.NotFound {
+		t.Errorf("claiming the device twice returned %v, want %v", err, codes.NotFound)
+	}
+
+	completed, err := enrollmentSvc.PollEnrollment(context.Background(), requested.EnrollmentId, requested.PollToken)
+	if err != nil {
+		t.Fatalf("PollEnrollment: %v", err)
+	}
+	block, _ := pem.Decode([]byte(completed.Certificate))
+	if block == nil {
+		t.Fatalf("got certificate %q after the claim, want a PEM certificate", completed.Certificate)
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("parsing the device certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM([]byte(completed.CaCertificate))
+	_, err = certificate.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	if err != nil {
+		t.Errorf("the device certificate doesn't verify against the returned CA: %v", err)
+	}
+	if printerId, err := pki.DevicePrinterId(certificate); err != nil || printerId != claimed.PrinterId {
+		t.Errorf("the device certificate names printer %q (%v), want %q", printerId, err, claimed.PrinterId)
+	}
+
+	authenticated, err := enrollmentSvc.AuthenticateDevice(context.Background(), certificate)
+	if err != nil || authenticated.ExternalId != claimed.PrinterId {
+		t.Fatalf("AuthenticateDevice returned %+v, %v, want printer %v", authenticated, err, claimed.PrinterId)
+	}
+	if err := enrollmentSvc.RevokeCertificate(ctx, pki.SerialString(certificate.SerialNumber)); err != nil {
+		t.Fatalf("RevokeCertificate: %v", err)
+	}
+	if _, err := enrollmentSvc.AuthenticateDevice(context.Background(), certificate); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("authenticating with a revoked certificate returned %v, want %v", err, codes.Unauthenticated)
+	}
+}
+
+func TestRequestEnrollmentChecksCsr(t *testing.T) {
+	enrollmentSvc, enrollments, _ := newTestEnrollmentSvc(t)
+	tests := []struct {
+		name    string
+		request EnrollmentRequest
+	}{
+		{name: "no serial number", request: EnrollmentRequest{Csr: newCertificateRequest(t, elliptic.P256())}},
+		{name: "no CSR", request: EnrollmentRequest{SerialNumber: "SN-1"}},
+		{name: "weak curve", request: EnrollmentRequest{SerialNumber: "SN-1", Csr: newCertificateRequest(t, elliptic.P224())}},
+		{name: "unknown product", request: EnrollmentRequest{SerialNumber: "SN-1", ProductNumber: "X1", Csr: newCertificateRequest(t, elliptic.P256())}},
+	}
+	for _, test := range tests {
+		if _, err := enrollmentSvc.RequestEnrollment(context.Background(), &test.request); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%v: RequestEnrollment returned %v, want %v", test.name, err, codes.InvalidArgument)
+		}
+	}
+	if len(enrollments.enrollments) != 0 {
+		t.Errorf("invalid requests created %d enrollments", len(enrollments.enrollments))
+	}
+}
+
+func TestClaimDeviceOfDeletedPrinter(t *testing.T) {
+	enrollmentSvc, enrollments, printers := newTestEnrollmentSvc(t)
+	printers.printers["printer-SN-1"] = &domain.Printer{UserId: "user-1", SerialNumber: "SN-1", Status: int(core_v1.Status_inactive)}
+	requested, err := enrollmentSvc.RequestEnrollment(context.Background(), &EnrollmentRequest{SerialNumber: "SN-1", Csr: newCertificateRequest(t, elliptic.P256())})
+	if err != nil {
+		t.Fatalf("RequestEnrollment: %v", err)
+	}
+
+	if _, err := enrollmentSvc.ClaimDevice(batchContext(), requested.ClaimCode); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("claiming a device of a deleted printer returned %v, want %v", err, codes.FailedPrecondition)
+	}
+	enrollment := enrollments.enrollments[requested.EnrollmentId]
+	if enrollment.UserId != "" || enrollment.State != int(domain.EnrollmentStatePending) || len(enrollments.certificates) != 0 {
+		t.Errorf("got enrollment %+v with %d certificates after the failed claim, want it released", enrollment, len(enrollments.certificates))
+	}
+}
@@ -0,0 +1,122 @@
+package svc
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"ditto/pkg/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const maxNearbyRadiusMeters = 50000
+
+// LocationSvc maintains the location hierarchy of each tenant, only tenant admins may change it while every user of
+// the tenant may browse it and place their own printers in it.
+type LocationSvc struct {
+	Repository repository.LocationRepository
+}
+
+func NewLocationSvc(repository repository.LocationRepository) *LocationSvc {
+	return &LocationSvc{Repository: repository}
+}
+
+func validateCoordinates(location *domain.Location) error {
+	if (location.Latitude == nil) != (location.Longitude == nil) {
+		return status.Errorf(codes.InvalidArgument, "latitude and longitude must be set together")
+	}
+	if location.HasCoordinates() && (*location.Latitude < -90 || *location.Latitude > 90 || *location.Longitude < -180 || *location.Longitude > 180) {
+		return status.Errorf(codes.InvalidArgument, "coordinates out of range")
+	}
+	return nil
+}
+
+func (l *LocationSvc) CreateLocation(ctx context.Context, dto *domain.LocationDto) (*domain.LocationDto, error) {
+	if err := requireTenantAdmin(ctx); err != nil {
+		return nil, err
+	}
+	location := &domain.Location{}
+	location.FillProperties(dto)
+	if location.Name == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "name is required")
+	}
+	if err := validateCoordinates(location); err != nil {
+		return nil, err
+	}
+	created, err := l.Repository.CreateLocation(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	createdDto := created.ToDto().(domain.LocationDto)
+	return &createdDto, nil
+}
+
+func (l *LocationSvc) GetLocation(ctx context.Context, locationId string) (*domain.LocationDto, error) {
+	location, err := l.Repository.GetLocation(ctx, locationId)
+	if err != nil {
+		return nil, err
+	}
+	dto := location.ToDto().(domain.LocationDto)
+	return &dto, nil
+}
+
+func (l *LocationSvc) ListLocations(ctx context.Context, parentId string) ([]domain.LocationDto, error) {
+	locations, err := l.Repository.GetChildLocations(ctx, parentId)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]domain.LocationDto, 0, len(locations))
+	for _, location := range locations {
+		result = append(result, location.ToDto().(domain.LocationDto))
+	}
+	return result, nil
+}
+
+// UpdateLocation changes the name, description and coordinates of a location, it can't be moved in the hierarchy.
+func (l *LocationSvc) UpdateLocation(ctx context.Context, locationId string, dto *domain.LocationDto) (*domain.LocationDto, error) {
+	if err := requireTenantAdmin(ctx); err != nil {
+		return nil, err
+	}
+	location := &domain.Location{}
+	location.FillProperties(dto)
+	if err := validateCoordinates(location); err != nil {
+		return nil, err
+	}
+	updated, err := l.Repository.UpdateLocation(ctx, locationId, location)
+	if err != nil {
+		return nil, err
+	}
+	updatedDto := updated.ToDto().(domain.LocationDto)
+	return &updatedDto, nil
+}
+
+func (l *LocationSvc) DeleteLocation(ctx context.Context, locationId string) error {
+	if err := requireTenantAdmin(ctx); err != nil {
+		return err
+	}
+	return l.Repository.DeleteLocation(ctx, locationId)
+}
+
+func (l *LocationSvc) AssignPrinter(ctx context.Context, printerId string, locationId string) (*domain.Printer, error) {
+	userId := ctx.Value("user").(map[string]string)["user_id"]
+	if len(userId) == 0 {
+		return nil, status.Errorf(codes.Unauthenticated, "user id is required")
+	}
+	return l.Repository.AssignPrinter(ctx, userId, printerId, locationId)
+}
+
+func (l *LocationSvc) GetPrintersInLocation(ctx context.Context, locationId string) ([]domain.Printer, error) {
+	return l.Repository.GetPrintersInLocation(ctx, locationId)
+}
+
+func (l *LocationSvc) GetPrintersNear(ctx context.Context, latitude float64, longitude float64, radiusMeters float64, limit int) ([]repository.NearbyPrinter, error) {
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return nil, status.Errorf(codes.InvalidArgument, "coordinates out of range")
+	}
+	if radiusMeters <= 0 || radiusMeters > maxNearbyRadiusMeters {
+		return nil, status.Errorf(codes.InvalidArgument, "radius must be between 0 and %d meters", maxNearbyRadiusMeters)
+	}
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	return l.Repository.GetPrintersNear(ctx, latitude, longitude, radiusMeters, limit)
+}
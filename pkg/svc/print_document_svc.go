@@ -0,0 +1,390 @@
+package svc
+
+import (
+	"context"
+	"ditto/pkg/conversion"
+	"ditto/pkg/domain"
+	"ditto/pkg/repository"
+	"ditto/pkg/storage"
+	"errors"
+	"fmt"
+	uuid "github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"io"
+	"time"
+)
+
+// defaultPrintFormats are assumed for printers whose model isn't in the catalog.
+var defaultPrintFormats = []string{conversion.FormatPdf}
+
+// PrintDocumentLimits bounds the documents the service accepts and produces.
+type PrintDocumentLimits struct {
+	MaxDocumentBytes  int64
+	MaxConvertedBytes int64
+	UploadTtl         time.Duration
+	ConversionTimeout time.Duration
+}
+
+// PrintDocumentSvc receives the documents of print jobs, either in one piece or as resumable chunked uploads, keeps
+// them in the document store and converts them, on a bounded pool of workers, to a format the job's printer accepts.
+// Conversion failures fail the job with the reason recorded as its error.
+type PrintDocumentSvc struct {
+	Repository         repository.PrintJobRepository
+	DocumentRepository repository.DocumentRepository
+	PrinterRepository  repository.PrinterRepository
+	ModelRepository    repository.PrinterModelRepository
+	store              *storage.DocumentStore
+	registry           *conversion.Registry
+	pool               *conversion.Pool
+	logger             *logrus.Logger
+	limits             PrintDocumentLimits
+}
+
+func NewPrintDocumentSvc(repository repository.PrintJobRepository, documentRepository repository.DocumentRepository, printerRepository repository.PrinterRepository,
+	modelRepository repository.PrinterModelRepository, store *storage.DocumentStore, registry *conversion.Registry, pool *conversion.Pool,
+	logger *logrus.Logger, limits PrintDocumentLimits) *PrintDocumentSvc {
+	return &PrintDocumentSvc{
+		Repository:         repository,
+		DocumentRepository: documentRepository,
+		PrinterRepository:  printerRepository,
+		ModelRepository:    modelRepository,
+		store:              store,
+		registry:           registry,
+		pool:               pool,
+		logger:             logger,
+		limits:             limits,
+	}
+}
+
+// UploadDocument attaches the document to one of the caller's queued jobs and schedules its conversion. When
+// expectedDigest is set the document must have that hex SHA-256 digest.
+func (p *PrintDocumentSvc) UploadDocument(ctx context.Context, jobId string, format string, expectedDigest string, reader io.Reader) (*domain.PrintJobDto, error) {
+	job, pipeline, err := p.acceptingJob(ctx, jobId, format)
+	if err != nil {
+		return nil, err
+	}
+	digest, size, err := p.store.Put(ctx, reader, expectedDigest, p.limits.MaxDocumentBytes)
+	if err != nil {
+		return nil, storeError(err, p.limits.MaxDocumentBytes)
+	}
+	return p.attach(ctx, job, pipeline, digest, size)
+}
+
+// acceptingJob loads one of the caller's jobs that can still take a document and plans the conversion of format.
+func (p *PrintDocumentSvc) acceptingJob(ctx context.Context, jobId string, format string) (*domain.PrintJob, *conversion.Pipeline, error) {
+	userId := ctx.Value("user").(map[string]string)["user_id"]
+	job, err := p.Repository.GetJob(ctx, userId, jobId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if state := domain.JobState(job.State); (state != domain.JobStateQueued && state != domain.JobStateHeld) || job.PrintFormat != "" {
+		return nil, nil, status.Errorf(codes.FailedPrecondition, "job %v is %v and can't take a document", jobId, domain.JobState(job.State))
+	}
+	accepted, err := p.printFormats(ctx, job.PrinterId)
+	if err != nil {
+		return nil, nil, err
+	}
+	pipeline, err := p.registry.Plan(format, accepted)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return job, pipeline, nil
+}
+
+func storeError(err error, maxBytes int64) error {
+	switch {
+	case errors.Is(err, storage.ErrTooLarge):
+		return status.Errorf(codes.InvalidArgument, "documents must be at most %d bytes", maxBytes)
+	case errors.Is(err, storage.ErrDigestMismatch):
+		return status.Errorf(codes.InvalidArgument, "document doesn't match its sha256")
+	default:
+		return err
+	}
+}
+
+// attach records the stored document as the job's source and schedules its conversion, releasing the content again
+// if the job can't take it.
+func (p *PrintDocumentSvc) attach(ctx context.Context, job *domain.PrintJob, pipeline *conversion.Pipeline, digest string, size int64) (*domain.PrintJobDto, error) {
+	if size == 0 {
+		p.release(digest)
+		return nil, status.Errorf(codes.InvalidArgument, "document is empty")
+	}
+	source := &domain.PrintJobDocument{Format: pipeline.Source, Digest: digest, Size: size}
+	// The conversion must be done within ConversionTimeout of the job entering converting, time spent queued
+	// included, so that the ConversionWorker can tell jobs converting for longer were abandoned.
+	deadline := time.Now().Add(p.limits.ConversionTimeout)
+	if err := p.Repository.StartConversion(ctx, job.ExternalId, source); err != nil {
+		p.release(digest)
+		return nil, err
+	}
+	jobId := job.ExternalId
+	// the conversion runs on the pool's context, as the caller so that it stays within the caller's tenant
+	caller := ctx.Value("user")
+	convert := func(ctx context.Context) {
+		p.convert(context.WithValue(ctx, "user", caller), jobId, pipeline, digest, deadline)
+	}
+	if err := p.pool.Submit(convert); err != nil {
+		p.fail(ctx, jobId, err)
+		return nil, status.Errorf(codes.ResourceExhausted, "%v, try again later", err)
+	}
+	job.State = int(domain.JobStateConverting)
+	job.DocumentFormat = pipeline.Source
+	dto := job.ToDto().(domain.PrintJobDto)
+	return &dto, nil
+}
+
+// printFormats returns the document formats the printer accepts, in its order of preference.
+func (p *PrintDocumentSvc) printFormats(ctx context.Context, printerId string) ([]string, error) {
+	printer, err := p.PrinterRepository.GetPrinter(ctx, printerId)
+	if err != nil {
+		return nil, err
+	}
+	return acceptedFormats(ctx, p.ModelRepository, printer)
+}
+
+// acceptedFormats looks the formats a printer accepts up in the model catalog.
+func acceptedFormats(ctx context.Context, models repository.PrinterModelRepository, printer *domain.Printer) ([]string, error) {
+	model, err := models.GetModel(ctx, printer.ProductNumber)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return defaultPrintFormats, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return model.ToDto().(domain.PrinterModelDto).DocumentFormats, nil
+}
+
+// convert runs the pipeline over the stored source document, streaming the result back into the store. It fails the
+// job straight away when ctx is done already, which it is for conversions still queued when the pool stops.
+func (p *PrintDocumentSvc) convert(ctx context.Context, jobId string, pipeline *conversion.Pipeline, digest string, deadline time.Time) {
+	if ctx.Err() != nil {
+		p.fail(ctx, jobId, errors.New("conversion was interrupted, the server shut down"))
+		return
+	}
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	source, err := p.store.Open(ctx, digest)
+	if err != nil {
+		p.fail(ctx, jobId, fmt.Errorf("source document unavailable: %v", err))
+		return
+	}
+	defer source.Close()
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(pipeline.Run(ctx, source, writer))
+	}()
+	convertedDigest, size, err := p.store.Put(ctx, reader, "", p.limits.MaxConvertedBytes)
+	reader.CloseWithError(err)
+	if err != nil {
+		p.fail(ctx, jobId, fmt.Errorf("conversion failed: %v", err))
+		return
+	}
+	converted := &domain.PrintJobDocument{Format: pipeline.Target, Digest: convertedDigest, Size: size}
+	if err := p.Repository.CompleteConversion(ctx, jobId, converted); err != nil {
+		p.fail(ctx, jobId, err)
+	}
+}
+
+// fail records cause as the error of the job. It detaches from ctx as the job must be failed even when the conversion
+// ran out of time.
+func (p *PrintDocumentSvc) fail(ctx context.Context, jobId string, cause error) {
+	if _, err := p.Repository.UpdateJobState(detached(ctx), jobId, domain.JobStateFailed, cause.Error()); err != nil {
+		p.logger.WithError(err).Errorf("failed to record the failure of job %v: %v", jobId, cause)
+	}
+}
+
+// OpenDocument returns a document of one of the caller's jobs along with its content, kind is either source or
+// print.
+func (p *PrintDocumentSvc) OpenDocument(ctx context.Context, jobId string, kind string) (*domain.PrintJobDocument, io.ReadCloser, error) {
+	if kind != domain.DocumentKindSource && kind != domain.DocumentKindPrint {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "unknown document kind %v", kind)
+	}
+	userId := ctx.Value("user").(map[string]string)["user_id"]
+	if _, err := p.Repository.GetJob(ctx, userId, jobId); err != nil {
+		return nil, nil, err
+	}
+	document, err := p.Repository.GetDocument(ctx, jobId, kind)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := p.store.Open(ctx, document.Digest)
+	if errors.Is(err, storage.ErrBlobNotFound) {
+		return nil, nil, status.Errorf(codes.NotFound, "document of job %v has expired", jobId)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return document, content, nil
+}
+
+// CreateUpload starts a resumable upload of the source document of one of the caller's jobs.
+func (p *PrintDocumentSvc) CreateUpload(ctx context.Context, jobId string, format string, expectedDigest string) (*domain.DocumentUploadDto, error) {
+	if _, _, err := p.acceptingJob(ctx, jobId, format); err != nil {
+		return nil, err
+	}
+	upload := &domain.DocumentUpload{
+		UploadId:       uuid.NewV4().String(),
+		JobId:          jobId,
+		UserId:         ctx.Value("user").(map[string]string)["user_id"],
+		Format:         format,
+		ExpectedDigest: expectedDigest,
+		ExpiresAt:      time.Now().Add(p.limits.UploadTtl),
+	}
+	if err := p.DocumentRepository.CreateUpload(ctx, upload); err != nil {
+		return nil, err
+	}
+	dto := upload.ToDto()
+	return &dto, nil
+}
+
+func (p *PrintDocumentSvc) GetUpload(ctx context.Context, uploadId string) (*domain.DocumentUploadDto, error) {
+	upload, err := p.upload(ctx, uploadId)
+	if err != nil {
+		return nil, err
+	}
+	dto := upload.ToDto()
+	return &dto, nil
+}
+
+func (p *PrintDocumentSvc) upload(ctx context.Context, uploadId string) (*domain.DocumentUpload, error) {
+	userId := ctx.Value("user").(map[string]string)["user_id"]
+	upload, err := p.DocumentRepository.GetUpload(ctx, userId, uploadId)
+	if err != nil {
+		return nil, err
+	}
+	if !time.Now().Before(upload.ExpiresAt) {
+		return nil, status.Errorf(codes.NotFound, "upload %v has expired", uploadId)
+	}
+	return upload, nil
+}
+
+// AppendChunk stores the chunk read from reader at offset, which must be the number of bytes received so far, and
+// returns the new offset.
+func (p *PrintDocumentSvc) AppendChunk(ctx context.Context, uploadId string, offset int64, reader io.Reader) (int64, error) {
+	upload, err := p.upload(ctx, uploadId)
+	if err != nil {
+		return 0, err
+	}
+	if offset != upload.Received {
+		return 0, status.Errorf(codes.FailedPrecondition, "upload %v continues at offset %d, not %d", uploadId, upload.Received, offset)
+	}
+	digest, size, err := p.store.Put(ctx, reader, "", p.limits.MaxDocumentBytes-upload.Received)
+	if err != nil {
+		return 0, storeError(err, p.limits.MaxDocumentBytes)
+	}
+	if size == 0 {
+		p.release(digest)
+		return upload.Received, nil
+	}
+	received, err := p.DocumentRepository.AppendChunk(ctx, uploadId, &domain.DocumentUploadChunk{Position: offset, Size: size, Digest: digest})
+	if err != nil {
+		p.release(digest)
+		return 0, err
+	}
+	return received, nil
+}
+
+// CompleteUpload joins the chunks of the upload into the job's source document and schedules its conversion.
+func (p *PrintDocumentSvc) CompleteUpload(ctx context.Context, uploadId string) (*domain.PrintJobDto, error) {
+	upload, err := p.upload(ctx, uploadId)
+	if err != nil {
+		return nil, err
+	}
+	job, pipeline, err := p.acceptingJob(ctx, upload.JobId, upload.Format)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := p.DocumentRepository.GetChunks(ctx, uploadId)
+	if err != nil {
+		return nil, err
+	}
+	reader := &chunkReader{ctx: ctx, store: p.store, chunks: chunks}
+	digest, size, err := p.store.Put(ctx, reader, upload.ExpectedDigest, p.limits.MaxDocumentBytes)
+	reader.Close()
+	if err != nil {
+		return nil, storeError(err, p.limits.MaxDocumentBytes)
+	}
+	if size != upload.Received {
+		return nil, status.Errorf(codes.Internal, "upload %v holds %d bytes, expected %d", uploadId, size, upload.Received)
+	}
+	dto, err := p.attach(ctx, job, pipeline, digest, size)
+	if err != nil {
+		return nil, err
+	}
+	p.discard(upload, chunks)
+	return dto, nil
+}
+
+func (p *PrintDocumentSvc) AbortUpload(ctx context.Context, uploadId string) error {
+	upload, err := p.upload(ctx, uploadId)
+	if err != nil {
+		return err
+	}
+	chunks, err := p.DocumentRepository.GetChunks(ctx, uploadId)
+	if err != nil {
+		return err
+	}
+	p.discard(upload, chunks)
+	return nil
+}
+
+// discard deletes the upload and releases the content of its chunks.
+func (p *PrintDocumentSvc) discard(upload *domain.DocumentUpload, chunks []domain.DocumentUploadChunk) {
+	if err := p.DocumentRepository.DeleteUpload(context.Background(), upload.UploadId); err != nil {
+		p.logger.WithError(err).Errorf("failed to delete upload %v, it is left to expire", upload.UploadId)
+		return
+	}
+	for _, chunk := range chunks {
+		p.release(chunk.Digest)
+	}
+}
+
+func (p *PrintDocumentSvc) release(digest string) {
+	if err := p.store.DeleteUnreferenced(context.Background(), digest, p.DocumentRepository.DigestReferenced); err != nil {
+		p.logger.WithError(err).Errorf("failed to release document %v", digest)
+	}
+}
+
+// chunkReader reads the chunks of an upload back to back from the document store.
+type chunkReader struct {
+	ctx     context.Context
+	store   *storage.DocumentStore
+	chunks  []domain.DocumentUploadChunk
+	current io.ReadCloser
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.current == nil {
+			if len(c.chunks) == 0 {
+				return 0, io.EOF
+			}
+			chunk, err := c.store.Open(c.ctx, c.chunks[0].Digest)
+			if err != nil {
+				return 0, err
+			}
+			c.current = chunk
+			c.chunks = c.chunks[1:]
+		}
+		n, err := c.current.Read(p)
+		if err == io.EOF {
+			c.current.Close()
+			c.current = nil
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.current != nil {
+		return c.current.Close()
+	}
+	return nil
+}
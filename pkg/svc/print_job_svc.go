@@ -0,0 +1,181 @@
+package svc
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"ditto/pkg/repository"
+	"github.com/kutty-kumar/ho_oh/core_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// PrintJobSvc queues jobs on printers. A job sent to a pool is routed to the online member with the shortest queue,
+// secure jobs are held until their owner releases them at a printer.
+type PrintJobSvc struct {
+	Repository        repository.PrintJobRepository
+	PrinterRepository repository.PrinterRepository
+	GroupRepository   repository.PrinterGroupRepository
+	onlineWindow      time.Duration
+}
+
+func NewPrintJobSvc(repository repository.PrintJobRepository, printerRepository repository.PrinterRepository, groupRepository repository.PrinterGroupRepository, onlineWindow time.Duration) *PrintJobSvc {
+	return &PrintJobSvc{
+		Repository:        repository,
+		PrinterRepository: printerRepository,
+		GroupRepository:   groupRepository,
+		onlineWindow:      onlineWindow,
+	}
+}
+
+// SubmitJob queues the job on its printer, or on the least busy online member when it targets a pool. Secure jobs are
+// held instead and may target any group, the printer picked for them only decides the format their document is
+// converted to.
+func (p *PrintJobSvc) SubmitJob(ctx context.Context, dto *domain.PrintJobDto) (*domain.PrintJobDto, error) {
+	userId := ctx.Value("user").(map[string]string)["user_id"]
+	if len(userId) == 0 {
+		return nil, status.Errorf(codes.Unauthenticated, "user id is required")
+	}
+	job := &domain.PrintJob{}
+	job.FillProperties(dto)
+	job.UserId = userId
+	job.State = int(domain.JobStateQueued)
+	if job.Secure {
+		job.State = int(domain.JobStateHeld)
+	}
+	if job.DocumentName == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "document name is required")
+	}
+	if job.Copies == 0 {
+		job.Copies = 1
+	}
+	if job.Copies < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "copies must be positive")
+	}
+	switch {
+	case job.GroupId != "" && job.PrinterId != "":
+		return nil, status.Errorf(codes.InvalidArgument, "a job targets either a printer or a group")
+	case job.GroupId != "" && job.Secure:
+		printerId, err := p.anyMember(ctx, job.GroupId)
+		if err != nil {
+			return nil, err
+		}
+		job.PrinterId = printerId
+	case job.GroupId != "":
+		printerId, err := p.route(ctx, job.GroupId)
+		if err != nil {
+			return nil, err
+		}
+		job.PrinterId = printerId
+	case job.PrinterId != "":
+		printer, err := p.PrinterRepository.GetPrinter(ctx, job.PrinterId)
+		if err != nil {
+			return nil, err
+		}
+		if printer.Status != int(core_v1.Status_active) {
+			return nil, status.Errorf(codes.FailedPrecondition, "printer %v is deleted", job.PrinterId)
+		}
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "printer id or group id is required")
+	}
+	created, err := p.Repository.CreateJob(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	createdDto := created.ToDto().(domain.PrintJobDto)
+	return &createdDto, nil
+}
+
+// route picks the pool member to print on: online members only, fewest pending jobs first, ties broken by the
+// most recently seen printer.
+func (p *PrintJobSvc) route(ctx context.Context, groupId string) (string, error) {
+	group, err := p.GroupRepository.GetGroup(ctx, groupId)
+	if err != nil {
+		return "", err
+	}
+	if !group.Pool {
+		return "", status.Errorf(codes.FailedPrecondition, "group %v is not a pool", groupId)
+	}
+	members, err := p.GroupRepository.GetMembers(ctx, group)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	var online []domain.Printer
+	var printerIds []string
+	for _, member := range members {
+		if member.Online(now, p.onlineWindow) {
+			online = append(online, member)
+			printerIds = append(printerIds, member.ExternalId)
+		}
+	}
+	if len(online) == 0 {
+		return "", status.Errorf(codes.Unavailable, "no printer in group %v is online", groupId)
+	}
+	depths, err := p.Repository.GetQueueDepths(ctx, printerIds)
+	if err != nil {
+		return "", err
+	}
+	best := online[0]
+	for _, member := range online[1:] {
+		if depths[member.ExternalId] < depths[best.ExternalId] ||
+			(depths[member.ExternalId] == depths[best.ExternalId] && member.LastSeenAt.After(*best.LastSeenAt)) {
+			best = member
+		}
+	}
+	return best.ExternalId, nil
+}
+
+// anyMember picks the most recently seen member of a group.
+func (p *PrintJobSvc) anyMember(ctx context.Context, groupId string) (string, error) {
+	group, err := p.GroupRepository.GetGroup(ctx, groupId)
+	if err != nil {
+		return "", err
+	}
+	members, err := p.GroupRepository.GetMembers(ctx, group)
+	if err != nil {
+		return "", err
+	}
+	if len(members) == 0 {
+		return "", status.Errorf(codes.FailedPrecondition, "group %v has no printers", groupId)
+	}
+	best := members[0]
+	for _, member := range members[1:] {
+		if member.LastSeenAt != nil && (best.LastSeenAt == nil || member.LastSeenAt.After(*best.LastSeenAt)) {
+			best = member
+		}
+	}
+	return best.ExternalId, nil
+}
+
+func (p *PrintJobSvc) GetJob(ctx context.Context, jobId string) (*domain.PrintJobDto, error) {
+	userId := ctx.Value("user").(map[string]string)["user_id"]
+	job, err := p.Repository.GetJob(ctx, userId, jobId)
+	if err != nil {
+		return nil, err
+	}
+	dto := job.ToDto().(domain.PrintJobDto)
+	return &dto, nil
+}
+
+func (p *PrintJobSvc) ListJobs(ctx context.Context) ([]domain.PrintJobDto, error) {
+	userId := ctx.Value("user").(map[string]string)["user_id"]
+	jobs, err := p.Repository.GetJobsByUserId(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]domain.PrintJobDto, 0, len(jobs))
+	for _, job := range jobs {
+		result = append(result, job.ToDto().(domain.PrintJobDto))
+	}
+	return result, nil
+}
+
+// Heartbeat marks one of the caller's printers as online.
+func (p *PrintJobSvc) Heartbeat(ctx context.Context, printerId string) error {
+	userId := ctx.Value("user").(map[string]string)["user_id"]
+	if printerId == "" {
+		return status.Errorf(codes.InvalidArgument, "printer id is required")
+	}
+	return p.PrinterRepository.TouchPrinter(ctx, userId, printerId, time.Now())
+}
@@ -0,0 +1,116 @@
+package svc
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"ditto/pkg/repository"
+	"testing"
+	"time"
+
+	"github.com/kutty-kumar/ho_oh/core_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// poolRepository serves a single group with the given members.
+type poolRepository struct {
+	repository.PrinterGroupRepository
+	group   domain.PrinterGroup
+	members []domain.Printer
+}
+
+func (p *poolRepository) GetGroup(ctx context.Context, groupId string) (*domain.PrinterGroup, error) {
+	return &p.group, nil
+}
+
+func (p *poolRepository) GetMembers(ctx context.Context, group *domain.PrinterGroup) ([]domain.Printer, error) {
+	return p.members, nil
+}
+
+// queueRepository reports the given queue depths and keeps the jobs it is asked to create.
+type queueRepository struct {
+	repository.PrintJobRepository
+	depths map[string]int64
+	asked  []string
+}
+
+func (q *queueRepository) GetQueueDepths(ctx context.Context, printerIds []string) (map[string]int64, error) {
+	q.asked = printerIds
+	return q.depths, nil
+}
+
+func (q *queueRepository) CreateJob(ctx context.Context, job *domain.PrintJob) (*domain.PrintJob, error) {
+	return job, nil
+}
+
+func poolMember(printerId string, status core_v1.Status, lastSeen time.Duration) domain.Printer {
+	printer := domain.Printer{Status: int(status)}
+	printer.SetExternalId(printerId)
+	if lastSeen > 0 {
+		seenAt := time.Now().Add(-lastSeen)
+		printer.LastSeenAt = &seenAt
+	}
+	return printer
+}
+
+func TestSubmitJobToPool(t *testing.T) {
+	tests := []struct {
+		name    string
+		members []domain.Printer
+		depths  map[string]int64
+		want    string
+		code    codes.Code
+	}{
+		{name: "shortest queue",
+			members: []domain.Printer{poolMember("p1", core_v1.Status_active, time.Second), poolMember("p2", core_v1.Status_active, time.Second)},
+			depths:  map[string]int64{"p1": 3, "p2": 1},
+			want:    "p2"},
+		{name: "tie broken by the most recently seen printer",
+			members: []domain.Printer{poolMember("p1", core_v1.Status_active, time.Minute), poolMember("p2", core_v1.Status_active, time.Second)},
+			depths:  map[string]int64{"p1": 2, "p2": 2},
+			want:    "p2"},
+		{name: "offline and deleted printers skipped",
+			members: []domain.Printer{
+				poolMember("p1", core_v1.Status_active, time.Hour),
+				poolMember("p2", core_v1.Status_inactive, time.Second),
+				poolMember("p3", core_v1.Status_active, 0),
+				poolMember("p4", core_v1.Status_active, time.Second),
+			},
+			depths: map[string]int64{"p4": 9},
+			want:   "p4"},
+		{name: "no printer online",
+			members: []domain.Printer{poolMember("p1", core_v1.Status_active, time.Hour)},
+			code:    codes.Unavailable},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			groups := &poolRepository{group: domain.PrinterGroup{Pool: true}, members: test.members}
+			jobs := &queueRepository{depths: test.depths}
+			printJobSvc := NewPrintJobSvc(jobs, nil, groups, 2*time.Minute)
+
+			job, err := printJobSvc.SubmitJob(batchContext(), &domain.PrintJobDto{DocumentName: "report.pdf", GroupId: "g1"})
+			if status.Code(err) != test.code {
+				t.Fatalf("SubmitJob returned %v, want code %v", err, test.code)
+			}
+			if err == nil && job.PrinterId != test.want {
+				t.Errorf("routed the job to %v, want %v", job.PrinterId, test.want)
+			}
+			for _, printerId := range jobs.asked {
+				for _, member := range test.members {
+					if member.ExternalId == printerId && !member.Online(time.Now(), 2*time.Minute) {
+						t.Errorf("looked up the queue of %v, which is offline", printerId)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSubmitJobToGroupThatIsNotAPool(t *testing.T) {
+	groups := &poolRepository{members: []domain.Printer{poolMember("p1", core_v1.Status_active, time.Second)}}
+	printJobSvc := NewPrintJobSvc(&queueRepository{}, nil, groups, 2*time.Minute)
+	_, err := printJobSvc.SubmitJob(batchContext(), &domain.PrintJobDto{DocumentName: "report.pdf", GroupId: "g1"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("SubmitJob returned %v, want %v", err, codes.FailedPrecondition)
+	}
+}
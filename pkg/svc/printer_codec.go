@@ -0,0 +1,232 @@
+package svc
+
+import (
+	"bufio"
+	"bytes"
+	"ditto/pkg/domain"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/kutty-kumar/ho_oh/core_v1"
+	"io"
+	"strings"
+)
+
+const (
+	BulkFormatCsv    = "csv"
+	BulkFormatJson   = "json"
+	BulkFormatNdJson = "ndjson"
+)
+
+var csvColumns = []string{"external_id", "name", "description", "serial_number", "product_number", "status"}
+
+// PrinterRecord is the flat representation of a printer used by bulk import and export.
+type PrinterRecord struct {
+	ExternalId    string `json:"external_id,omitempty"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	SerialNumber  string `json:"serial_number"`
+	ProductNumber string `json:"product_number"`
+	Status        string `json:"status,omitempty"`
+}
+
+func NewPrinterRecord(printer *domain.Printer) PrinterRecord {
+	return PrinterRecord{
+		ExternalId:    printer.ExternalId,
+		Name:          printer.Name,
+		Description:   printer.Description,
+		SerialNumber:  printer.SerialNumber,
+		ProductNumber: printer.ProductNumber,
+		Status:        core_v1.Status(printer.Status).String(),
+	}
+}
+
+func (r *PrinterRecord) field(column string) string {
+	switch column {
+	case "external_id":
+		return r.ExternalId
+	case "name":
+		return r.Name
+	case "description":
+		return r.Description
+	case "serial_number":
+		return r.SerialNumber
+	case "product_number":
+		return r.ProductNumber
+	case "status":
+		return r.Status
+	}
+	return ""
+}
+
+func (r *PrinterRecord) setField(column string, value string) {
+	switch column {
+	case "external_id":
+		r.ExternalId = value
+	case "name":
+		r.Name = value
+	case "description":
+		r.Description = value
+	case "serial_number":
+		r.SerialNumber = value
+	case "product_number":
+		r.ProductNumber = value
+	case "status":
+		r.Status = value
+	}
+}
+
+// DecodedRecord is a record read from an import payload along with its 1 based position and any decoding error.
+type DecodedRecord struct {
+	Row    int
+	Record PrinterRecord
+	Err    error
+}
+
+// DecodePrinterRecords reads every record of the payload, malformed rows are returned with Err set rather than
+// failing the whole import.
+func DecodePrinterRecords(format string, reader io.Reader) ([]DecodedRecord, error) {
+	switch format {
+	case BulkFormatCsv:
+		return decodeCsv(reader)
+	case BulkFormatJson:
+		return decodeJson(reader)
+	case BulkFormatNdJson:
+		return decodeNdJson(reader)
+	}
+	return nil, fmt.Errorf("unsupported format %v", format)
+}
+
+func decodeCsv(reader io.Reader) ([]DecodedRecord, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv header: %v", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+	var records []DecodedRecord
+	for row := 1; ; row++ {
+		fields, err := csvReader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		decoded := DecodedRecord{Row: row}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return nil, err
+			}
+			decoded.Err = err
+		} else if len(fields) != len(header) {
+			decoded.Err = fmt.Errorf("expected %d fields, got %d", len(header), len(fields))
+		} else {
+			for i, column := range header {
+				decoded.Record.setField(column, strings.TrimSpace(fields[i]))
+			}
+		}
+		records = append(records, decoded)
+	}
+}
+
+func decodeJson(reader io.Reader) ([]DecodedRecord, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(reader).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("expected a json array of printers: %v", err)
+	}
+	records := make([]DecodedRecord, 0, len(raw))
+	for i, item := range raw {
+		decoded := DecodedRecord{Row: i + 1}
+		decoded.Err = json.Unmarshal(item, &decoded.Record)
+		records = append(records, decoded)
+	}
+	return records, nil
+}
+
+func decodeNdJson(reader io.Reader) ([]DecodedRecord, error) {
+	var records []DecodedRecord
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for row := 1; scanner.Scan(); row++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		decoded := DecodedRecord{Row: row}
+		decoded.Err = json.Unmarshal(line, &decoded.Record)
+		records = append(records, decoded)
+	}
+	return records, scanner.Err()
+}
+
+// PrinterEncoder writes printer records to w in one of the bulk formats.
+type PrinterEncoder struct {
+	format    string
+	w         io.Writer
+	csvWriter *csv.Writer
+	count     int
+}
+
+func NewPrinterEncoder(format string, w io.Writer) (*PrinterEncoder, error) {
+	encoder := &PrinterEncoder{format: format, w: w}
+	switch format {
+	case BulkFormatCsv:
+		encoder.csvWriter = csv.NewWriter(w)
+		if err := encoder.csvWriter.Write(csvColumns); err != nil {
+			return nil, err
+		}
+	case BulkFormatJson:
+		if _, err := io.WriteString(w, "["); err != nil {
+			return nil, err
+		}
+	case BulkFormatNdJson:
+	default:
+		return nil, fmt.Errorf("unsupported format %v", format)
+	}
+	return encoder, nil
+}
+
+func (e *PrinterEncoder) Encode(record PrinterRecord) error {
+	defer func() { e.count++ }()
+	switch e.format {
+	case BulkFormatCsv:
+		fields := make([]string, len(csvColumns))
+		for i, column := range csvColumns {
+			fields[i] = record.field(column)
+		}
+		return e.csvWriter.Write(fields)
+	case BulkFormatJson:
+		if e.count > 0 {
+			if _, err := io.WriteString(e.w, ","); err != nil {
+				return err
+			}
+		}
+		return json.NewEncoder(e.w).Encode(record)
+	default:
+		return json.NewEncoder(e.w).Encode(record)
+	}
+}
+
+// Close terminates the payload, it must be called once every record has been encoded.
+func (e *PrinterEncoder) Close() error {
+	switch e.format {
+	case BulkFormatCsv:
+		e.csvWriter.Flush()
+		return e.csvWriter.Error()
+	case BulkFormatJson:
+		_, err := io.WriteString(e.w, "]\n")
+		return err
+	}
+	return nil
+}
+
+// Flush pushes buffered csv rows to the underlying writer.
+func (e *PrinterEncoder) Flush() error {
+	if e.csvWriter != nil {
+		e.csvWriter.Flush()
+		return e.csvWriter.Error()
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package svc
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"ditto/pkg/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PrinterGroupSvc maintains printer groups, every user can see them while only their owner or an admin may change them.
+type PrinterGroupSvc struct {
+	Repository repository.PrinterGroupRepository
+}
+
+func NewPrinterGroupSvc(repository repository.PrinterGroupRepository) *PrinterGroupSvc {
+	return &PrinterGroupSvc{Repository: repository}
+}
+
+func (p *PrinterGroupSvc) CreateGroup(ctx context.Context, dto *domain.PrinterGroupDto) (*domain.PrinterGroupDto, error) {
+	userId := ctx.Value("user").(map[string]string)["user_id"]
+	if len(userId) == 0 {
+		return nil, status.Errorf(codes.Unauthenticated, "user id is required")
+	}
+	group := &domain.PrinterGroup{}
+	group.FillProperties(dto)
+	group.UserId = userId
+	if group.Name == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "name is required")
+	}
+	switch domain.GroupMembership(group.Membership) {
+	case domain.GroupMembershipStatic:
+		if group.RuleProductNumbers != "" || group.RuleLocationId != "" {
+			return nil, status.Errorf(codes.InvalidArgument, "static groups can't have rules")
+		}
+	case domain.GroupMembershipRule:
+		if group.RuleProductNumbers == "" && group.RuleLocationId == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "rule groups need product numbers or a location")
+		}
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "membership must be static or rule")
+	}
+	created, err := p.Repository.CreateGroup(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	createdDto := created.ToDto().(domain.PrinterGroupDto)
+	return &createdDto, nil
+}
+
+func (p *PrinterGroupSvc) GetGroup(ctx context.Context, groupId string) (*domain.PrinterGroupDto, error) {
+	group, err := p.Repository.GetGroup(ctx, groupId)
+	if err != nil {
+		return nil, err
+	}
+	dto := group.ToDto().(domain.PrinterGroupDto)
+	return &dto, nil
+}
+
+func (p *PrinterGroupSvc) ListGroups(ctx context.Context) ([]domain.PrinterGroupDto, error) {
+	groups, err := p.Repository.GetGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]domain.PrinterGroupDto, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, group.ToDto().(domain.PrinterGroupDto))
+	}
+	return result, nil
+}
+
+// UpdateGroup changes the name, description and rules of a group, its membership mode is fixed at creation.
+func (p *PrinterGroupSvc) UpdateGroup(ctx context.Context, groupId string, dto *domain.PrinterGroupDto) (*domain.PrinterGroupDto, error) {
+	group, err := p.ownedGroup(ctx, groupId)
+	if err != nil {
+		return nil, err
+	}
+	changes := &domain.PrinterGroup{}
+	changes.FillProperties(dto)
+	if domain.GroupMembership(group.Membership) == domain.GroupMembershipStatic && (changes.RuleProductNumbers != "" || changes.RuleLocationId != "") {
+		return nil, status.Errorf(codes.InvalidArgument, "static groups can't have rules")
+	}
+	updated, err := p.Repository.UpdateGroup(ctx, groupId, changes)
+	if err != nil {
+		return nil, err
+	}
+	updatedDto := updated.ToDto().(domain.PrinterGroupDto)
+	return &updatedDto, nil
+}
+
+func (p *PrinterGroupSvc) DeleteGroup(ctx context.Context, groupId string) error {
+	if _, err := p.ownedGroup(ctx, groupId); err != nil {
+		return err
+	}
+	return p.Repository.DeleteGroup(ctx, groupId)
+}
+
+func (p *PrinterGroupSvc) AddMember(ctx context.Context, groupId string, printerId string) error {
+	group, err := p.ownedGroup(ctx, groupId)
+	if err != nil {
+		return err
+	}
+	if domain.GroupMembership(group.Membership) != domain.GroupMembershipStatic {
+		return status.Errorf(codes.FailedPrecondition, "members of rule groups follow from their rules")
+	}
+	return p.Repository.AddMember(ctx, groupId, printerId)
+}
+
+func (p *PrinterGroupSvc) RemoveMember(ctx context.Context, groupId string, printerId string) error {
+	if _, err := p.ownedGroup(ctx, groupId); err != nil {
+		return err
+	}
+	return p.Repository.RemoveMember(ctx, groupId, printerId)
+}
+
+func (p *PrinterGroupSvc) GetMembers(ctx context.Context, groupId string) ([]domain.Printer, error) {
+	group, err := p.Repository.GetGroup(ctx, groupId)
+	if err != nil {
+		return nil, err
+	}
+	return p.Repository.GetMembers(ctx, group)
+}
+
+// ownedGroup loads the group, failing unless the caller owns it or is an admin.
+func (p *PrinterGroupSvc) ownedGroup(ctx context.Context, groupId string) (*domain.PrinterGroup, error) {
+	group, err := p.Repository.GetGroup(ctx, groupId)
+	if err != nil {
+		return nil, err
+	}
+	user := ctx.Value("user").(map[string]string)
+	if group.UserId != user["user_id"] && user["role"] != "admin" {
+		return nil, status.Errorf(codes.PermissionDenied, "group %v belongs to another user", groupId)
+	}
+	return group, nil
+}
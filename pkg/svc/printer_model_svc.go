@@ -0,0 +1,167 @@
+package svc
+
+import (
+	"context"
+	"ditto/pkg/apierr"
+	"ditto/pkg/domain"
+	"ditto/pkg/repository"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const maxCapabilityLookups = 100
+
+// PrinterCapabilities pairs a printer with the catalog entry of its product number, Model is nil for unknown models.
+type PrinterCapabilities struct {
+	Printer *domain.Printer
+	Model   *domain.PrinterModelDto
+}
+
+// PrinterModelSvc maintains the printer model catalog, only admins may change it while every user may read it.
+type PrinterModelSvc struct {
+	Repository        repository.PrinterModelRepository
+	PrinterRepository repository.PrinterRepository
+}
+
+func NewPrinterModelSvc(repository repository.PrinterModelRepository, printerRepository repository.PrinterRepository) *PrinterModelSvc {
+	return &PrinterModelSvc{Repository: repository, PrinterRepository: printerRepository}
+}
+
+// checkProductNumber fails unless the product number is empty or listed in the catalog, a nil catalog accepts every
+// product number.
+func checkProductNumber(ctx context.Context, models repository.PrinterModelRepository, productNumber string) error {
+	if models == nil || productNumber == "" {
+		return nil
+	}
+	_, err := models.GetModel(ctx, productNumber)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return apierr.InvalidField("product_number", fmt.Sprintf("unknown product number %v", productNumber))
+	}
+	return apierr.FromStorage(err, "printer model", productNumber)
+}
+
+func validateModel(model *domain.PrinterModel) error {
+	if model.ProductNumber == "" {
+		return status.Errorf(codes.InvalidArgument, "product number is required")
+	}
+	if model.Manufacturer == "" || model.ModelName == "" {
+		return status.Errorf(codes.InvalidArgument, "manufacturer and model name are required")
+	}
+	if model.DocumentFormats == "" {
+		return status.Errorf(codes.InvalidArgument, "at least one document format is required")
+	}
+	return nil
+}
+
+func (p *PrinterModelSvc) CreateModel(ctx context.Context, dto *domain.PrinterModelDto) (*domain.PrinterModelDto, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	model := &domain.PrinterModel{}
+	model.FillProperties(dto)
+	if err := validateModel(model); err != nil {
+		return nil, err
+	}
+	if _, err := p.Repository.GetModel(ctx, model.ProductNumber); err == nil {
+		return nil, status.Errorf(codes.AlreadyExists, "product number %v is already in the catalog", model.ProductNumber)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	created, err := p.Repository.CreateModel(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	createdDto := created.ToDto().(domain.PrinterModelDto)
+	return &createdDto, nil
+}
+
+func (p *PrinterModelSvc) GetModel(ctx context.Context, productNumber string) (*domain.PrinterModelDto, error) {
+	model, err := p.Repository.GetModel(ctx, productNumber)
+	if err != nil {
+		return nil, err
+	}
+	dto := model.ToDto().(domain.PrinterModelDto)
+	return &dto, nil
+}
+
+func (p *PrinterModelSvc) ListModels(ctx context.Context) ([]domain.PrinterModelDto, error) {
+	models, err := p.Repository.GetModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]domain.PrinterModelDto, 0, len(models))
+	for _, model := range models {
+		result = append(result, model.ToDto().(domain.PrinterModelDto))
+	}
+	return result, nil
+}
+
+// UpdateModel replaces every capability of the model, the product number itself can't be changed.
+func (p *PrinterModelSvc) UpdateModel(ctx context.Context, productNumber string, dto *domain.PrinterModelDto) (*domain.PrinterModelDto, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	model := &domain.PrinterModel{}
+	model.FillProperties(dto)
+	if model.ProductNumber != "" && model.ProductNumber != productNumber {
+		return nil, status.Errorf(codes.InvalidArgument, "product number can't be changed")
+	}
+	model.ProductNumber = productNumber
+	if err := validateModel(model); err != nil {
+		return nil, err
+	}
+	updated, err := p.Repository.UpdateModel(ctx, productNumber, model)
+	if err != nil {
+		return nil, err
+	}
+	updatedDto := updated.ToDto().(domain.PrinterModelDto)
+	return &updatedDto, nil
+}
+
+func (p *PrinterModelSvc) DeleteModel(ctx context.Context, productNumber string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	return p.Repository.DeleteModel(ctx, productNumber)
+}
+
+// GetCapabilities looks up the printers and the catalog entries of their product numbers. Printers the caller
+// doesn't own are reported as not found, unless the caller administers their tenant.
+func (p *PrinterModelSvc) GetCapabilities(ctx context.Context, printerIds []string) ([]PrinterCapabilities, error) {
+	if len(printerIds) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "printer ids are required")
+	}
+	if len(printerIds) > maxCapabilityLookups {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d printers can be looked up at once", maxCapabilityLookups)
+	}
+	printers := make([]*domain.Printer, 0, len(printerIds))
+	var productNumbers []string
+	for _, printerId := range printerIds {
+		printer, err := p.PrinterRepository.GetPrinter(ctx, printerId)
+		if err != nil {
+			return nil, apierr.FromStorage(err, printerResource, printerId)
+		}
+		if printer.UserId != ctx.Value("user").(map[string]string)["user_id"] && requireTenantAdmin(ctx) != nil {
+			return nil, apierr.NotFound(printerResource, printerId)
+		}
+		printers = append(printers, printer)
+		productNumbers = append(productNumbers, printer.ProductNumber)
+	}
+	models, err := p.Repository.GetModelsByProductNumber(ctx, productNumbers)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]PrinterCapabilities, 0, len(printers))
+	for _, printer := range printers {
+		capabilities := PrinterCapabilities{Printer: printer}
+		if model, ok := models[printer.ProductNumber]; ok {
+			dto := model.ToDto().(domain.PrinterModelDto)
+			capabilities.Model = &dto
+		}
+		result = append(result, capabilities)
+	}
+	return result, nil
+}
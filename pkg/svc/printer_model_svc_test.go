@@ -0,0 +1,95 @@
+package svc
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"ditto/pkg/repository"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// catalogRepository serves the models of a catalog by product number.
+type catalogRepository struct {
+	repository.PrinterModelRepository
+	models map[string]domain.PrinterModel
+}
+
+func (c *catalogRepository) GetModel(ctx context.Context, productNumber string) (*domain.PrinterModel, error) {
+	model, ok := c.models[productNumber]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &model, nil
+}
+
+func (c *catalogRepository) GetModelsByProductNumber(ctx context.Context, productNumbers []string) (map[string]domain.PrinterModel, error) {
+	return c.models, nil
+}
+
+// fleetRepository serves printers by id.
+type fleetRepository struct {
+	repository.PrinterRepository
+	printers map[string]domain.Printer
+}
+
+func (f *fleetRepository) GetPrinter(ctx context.Context, printerId string) (*domain.Printer, error) {
+	printer, ok := f.printers[printerId]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &printer, nil
+}
+
+var testCatalog = &catalogRepository{models: map[string]domain.PrinterModel{
+	"M404": {ProductNumber: "M404", Manufacturer: "HP", ModelName: "LaserJet Pro M404", DocumentFormats: "application/pdf"},
+}}
+
+func TestCheckProductNumber(t *testing.T) {
+	tests := []struct {
+		name          string
+		catalog       repository.PrinterModelRepository
+		productNumber string
+		code          codes.Code
+	}{
+		{name: "listed", catalog: testCatalog, productNumber: "M404"},
+		{name: "unknown", catalog: testCatalog, productNumber: "X1", code: codes.InvalidArgument},
+		{name: "empty", catalog: testCatalog},
+		{name: "validation switched off", productNumber: "X1"},
+	}
+	for _, test := range tests {
+		if err := checkProductNumber(context.Background(), test.catalog, test.productNumber); status.Code(err) != test.code {
+			t.Errorf("%v: checkProductNumber returned %v, want code %v", test.name, err, test.code)
+		}
+	}
+}
+
+func TestGetCapabilities(t *testing.T) {
+	printers := &fleetRepository{printers: map[string]domain.Printer{
+		"p1": {UserId: "user-1", ProductNumber: "M404"},
+		"p2": {UserId: "user-1", ProductNumber: "X1"},
+		"p3": {UserId: "user-2", ProductNumber: "M404"},
+	}}
+	modelSvc := NewPrinterModelSvc(testCatalog, printers)
+
+	capabilities, err := modelSvc.GetCapabilities(batchContext(), []string{"p1", "p2"})
+	if err != nil {
+		t.Fatalf("GetCapabilities: %v", err)
+	}
+	if len(capabilities) != 2 || capabilities[0].Model == nil || capabilities[0].Model.ModelName != "LaserJet Pro M404" || capabilities[1].Model != nil {
+		t.Errorf("got capabilities %+v, want the M404 model for p1 and none for p2", capabilities)
+	}
+
+	if _, err := modelSvc.GetCapabilities(batchContext(), []string{"p3"}); status.Code(err) != codes.NotFound {
+		t.Errorf("looking up the printer of another user returned %v, want %v", err, codes.NotFound)
+	}
+	tenantAdmin := context.WithValue(context.Background(), "user", map[string]string{"user_id": "user-1", "tenant_role": "admin"})
+	if _, err := modelSvc.GetCapabilities(tenantAdmin, []string{"p3"}); err != nil {
+		t.Errorf("a tenant admin looking up the printer of another user got %v", err)
+	}
+	if _, err := modelSvc.GetCapabilities(batchContext(), []string{"p4"}); status.Code(err) != codes.NotFound {
+		t.Errorf("looking up a missing printer returned %v, want %v", err, codes.NotFound)
+	}
+}
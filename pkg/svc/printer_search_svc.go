@@ -0,0 +1,41 @@
+package svc
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"ditto/pkg/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+type PrinterSearchSvc struct {
+	Repository repository.PrinterSearchRepository
+}
+
+func NewPrinterSearchSvc(repository repository.PrinterSearchRepository) *PrinterSearchSvc {
+	return &PrinterSearchSvc{Repository: repository}
+}
+
+// SearchPrinters runs query on behalf of the caller over the whole fleet of the caller's tenant, the owner facet
+// narrows it down to the printers of given users.
+func (p *PrinterSearchSvc) SearchPrinters(ctx context.Context, query domain.PrinterQuery) (*domain.PrinterSearchResult, error) {
+	user, _ := ctx.Value("user").(map[string]string)
+	if len(user["user_id"]) == 0 {
+		return nil, status.Errorf(codes.Unauthenticated, "user id is required")
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultSearchLimit
+	}
+	if query.Limit > maxSearchLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be at most %d", maxSearchLimit)
+	}
+	if query.Offset < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "offset must not be negative")
+	}
+	return p.Repository.Search(ctx, query)
+}
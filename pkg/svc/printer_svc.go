@@ -2,7 +2,9 @@ package svc
 
 import (
 	"context"
+	"ditto/pkg/apierr"
 	"ditto/pkg/domain"
+	"ditto/pkg/metrics"
 	"ditto/pkg/repository"
 	"github.com/kutty-kumar/charminder/pkg"
 	ditto "github.com/kutty-kumar/ho_oh/ditto_v1"
@@ -10,15 +12,22 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// printerResource is the resource type of printers in the details of errors.
+const printerResource = "printer"
+
 type PrinterSvc struct {
 	pkg.BaseSvc
 	Repository repository.PrinterRepository
+	Models     repository.PrinterModelRepository
 }
 
-func NewPrinterSvc(baseSvc *pkg.BaseSvc, repository repository.PrinterRepository) *PrinterSvc {
+// NewPrinterSvc builds the printer service, product numbers of new printers are checked against models unless it is
+// nil.
+func NewPrinterSvc(baseSvc *pkg.BaseSvc, repository repository.PrinterRepository, models repository.PrinterModelRepository) *PrinterSvc {
 	return &PrinterSvc{
 		*baseSvc,
 		repository,
+		models,
 	}
 }
 
@@ -31,7 +40,12 @@ func (p *PrinterSvc) CreatePrinter(ctx context.Context, request *ditto.CreatePri
 	printer := domain.Printer{}
 	printer.FillProperties(request.Request)
 	printer.UserId = ctx.Value("user").(map[string]string)["user_id"]
+	if err := checkProductNumber(ctx, p.Models, printer.ProductNumber); err != nil {
+		return nil, err
+	}
 	err, cPrinter := p.Create(ctx, &printer)
+	err = apierr.FromStorage(err, printerResource, printer.SerialNumber)
+	metrics.PrinterCreated(err)
 	if err != nil {
 		return nil, err
 	}
@@ -44,16 +58,16 @@ func (p *PrinterSvc) UpdatePrinter(ctx context.Context, request *ditto.UpdatePri
 	updatedPrinter.FillProperties(request.Request)
 	err, uPrinter := p.Update(ctx, request.PrinterId, &updatedPrinter)
 	if err != nil {
-		return nil, err
+		return nil, apierr.FromStorage(err, printerResource, request.PrinterId)
 	}
 	dto := p.ToDto(uPrinter.(*domain.Printer))
 	return &ditto.UpdatePrinterResponse{Response: &dto}, nil
 }
 
 func (p *PrinterSvc) GetPrinterByExternalId(ctx context.Context, request *ditto.GetPrinterByExternalIdRequest) (*ditto.GetPrinterByExternalIdResponse, error) {
-	err, printer := p.FindByExternalId(ctx, request.PrinterId)
+	err, printer := p.FindByExternalId(repository.FromReplica(ctx), request.PrinterId)
 	if err != nil {
-		return nil, err
+		return nil, apierr.FromStorage(err, printerResource, request.PrinterId)
 	}
 	dto := p.ToDto(printer.(*domain.Printer))
 	return &ditto.GetPrinterByExternalIdResponse{Response: &dto}, nil
@@ -61,9 +75,9 @@ func (p *PrinterSvc) GetPrinterByExternalId(ctx context.Context, request *ditto.
 
 func (p *PrinterSvc) MultiGetPrintersByExternalId(ctx context.Context, request *ditto.MultiGetPrintersByExternalIdRequest) (*ditto.MultiGetPrintersByExternalIdResponse, error) {
 	var dtoResponse []*ditto.PrinterDto
-	err, printers := p.MultiGetByExternalId(ctx, request.PrinterIds)
+	err, printers := p.MultiGetByExternalId(repository.FromReplica(ctx), request.PrinterIds)
 	if err != nil {
-		return nil, err
+		return nil, apierr.FromStorage(err, printerResource, "")
 	}
 	for _, printer := range printers {
 		dto := p.ToDto(printer.(*domain.Printer))
@@ -75,9 +89,9 @@ func (p *PrinterSvc) MultiGetPrintersByExternalId(ctx context.Context, request *
 func (p *PrinterSvc) MultiGetPrintersForUser(ctx context.Context, req *ditto.NoOpRequest) (*ditto.MultiGetPrintersByExternalIdResponse, error) {
 	userId := ctx.Value("user").(map[string]string)["user_id"]
 	if len(userId) > 0 {
-		printers, err := p.Repository.GetPrintersByUserId(ctx, userId)
+		printers, err := p.Repository.GetPrintersByUserId(repository.FromReplica(ctx), userId)
 		if err != nil {
-			return nil, err
+			return nil, apierr.FromStorage(err, printerResource, "")
 		}
 		var result []*ditto.PrinterDto
 		for _, printer := range printers {
@@ -93,6 +107,8 @@ func (p *PrinterSvc) DeletePrinter(ctx context.Context, req *ditto.DeletePrinter
 	userId := ctx.Value("user").(map[string]string)["user_id"]
 	if len(userId) > 0 {
 		updatedPrinter, err := p.Repository.DeletePrinter(ctx, userId, req.PrinterId)
+		err = apierr.FromStorage(err, printerResource, req.PrinterId)
+		metrics.PrinterDeleted("delete", err)
 		if err != nil {
 			return nil, err
 		}
@@ -101,3 +117,48 @@ func (p *PrinterSvc) DeletePrinter(ctx context.Context, req *ditto.DeletePrinter
 	}
 	return nil, status.Errorf(codes.NotFound, "printer not found for user %v", userId)
 }
+
+func (p *PrinterSvc) RestorePrinter(ctx context.Context, req *ditto.GetPrinterByExternalIdRequest) (*ditto.UpdatePrinterResponse, error) {
+	userId := ctx.Value("user").(map[string]string)["user_id"]
+	if len(userId) > 0 {
+		restoredPrinter, err := p.Repository.RestorePrinter(ctx, userId, req.PrinterId)
+		if err != nil {
+			return nil, apierr.FromStorage(err, printerResource, req.PrinterId)
+		}
+		dto := restoredPrinter.ToDto().(ditto.PrinterDto)
+		return &ditto.UpdatePrinterResponse{Response: &dto}, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "printer not found for user %v", userId)
+}
+
+func (p *PrinterSvc) ListDeletedPrinters(ctx context.Context, req *ditto.NoOpRequest) (*ditto.MultiGetPrintersByExternalIdResponse, error) {
+	userId := ctx.Value("user").(map[string]string)["user_id"]
+	if len(userId) > 0 {
+		printers, err := p.Repository.GetDeletedPrintersByUserId(ctx, userId)
+		if err != nil {
+			return nil, apierr.FromStorage(err, printerResource, "")
+		}
+		var result []*ditto.PrinterDto
+		for _, printer := range printers {
+			dto := printer.ToDto().(ditto.PrinterDto)
+			result = append(result, &dto)
+		}
+		return &ditto.MultiGetPrintersByExternalIdResponse{Result: result}, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "printers not found for user %v", userId)
+}
+
+// PurgePrinter permanently deletes a printer of any user in the tenant, it is restricted to tenant admins.
+func (p *PrinterSvc) PurgePrinter(ctx context.Context, req *ditto.DeletePrinterRequest) (*ditto.UpdatePrinterResponse, error) {
+	if err := requireTenantAdmin(ctx); err != nil {
+		return nil, err
+	}
+	purgedPrinter, err := p.Repository.PurgePrinter(ctx, req.PrinterId)
+	err = apierr.FromStorage(err, printerResource, req.PrinterId)
+	metrics.PrinterDeleted("purge", err)
+	if err != nil {
+		return nil, err
+	}
+	dto := purgedPrinter.ToDto().(ditto.PrinterDto)
+	return &ditto.UpdatePrinterResponse{Response: &dto}, nil
+}
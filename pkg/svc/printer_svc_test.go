@@ -0,0 +1,33 @@
+package svc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/kutty-kumar/charminder/pkg"
+	ditto "github.com/kutty-kumar/ho_oh/ditto_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// duplicateSerialPersistence fails every create on the unique serial number index.
+type duplicateSerialPersistence struct {
+	pkg.BaseRepository
+}
+
+func (d *duplicateSerialPersistence) Create(ctx context.Context, base pkg.Base) (error, pkg.Base) {
+	return &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 't1-SN-1' for key 'uix_printers_tenant_serial_number'"}, nil
+}
+
+func TestCreatePrinterWithDuplicateSerialNumber(t *testing.T) {
+	baseSvc := pkg.NewBaseSvc(&duplicateSerialPersistence{})
+	printerSvc := NewPrinterSvc(&baseSvc, &batchPrinterRepository{}, nil)
+	_, err := printerSvc.CreatePrinter(batchContext(), &ditto.CreatePrinterRequest{Request: &ditto.PrinterDto{SerialNumber: "SN-1"}})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("CreatePrinter returned %v, want %v", err, codes.AlreadyExists)
+	}
+	if message := status.Convert(err).Message(); message != "printer SN-1 already exists" {
+		t.Errorf("CreatePrinter failed with %q, want the serial number without the database's message", message)
+	}
+}
@@ -0,0 +1,303 @@
+package svc
+
+import (
+	"context"
+	"crypto/sha256"
+	"ditto/pkg/domain"
+	"ditto/pkg/repository"
+	"encoding/hex"
+	"errors"
+	"github.com/kutty-kumar/ho_oh/core_v1"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ReleaseRequest identifies the user releasing their held jobs at a printer, either by badge or by user id and PIN.
+type ReleaseRequest struct {
+	PrinterId string `json:"printer_id"`
+	UserId    string `json:"user_id,omitempty"`
+	Pin       string `json:"pin,omitempty"`
+	BadgeId   string `json:"badge_id,omitempty"`
+}
+
+// ReleaseSvc manages the PINs and badges users release secure jobs with, and releases the held jobs of a user at a
+// printer. A job is released at the printer it was submitted to, or at any member of its group that accepts its
+// converted document.
+type ReleaseSvc struct {
+	Repository        repository.ReleaseCredentialRepository
+	JobRepository     repository.PrintJobRepository
+	PrinterRepository repository.PrinterRepository
+	GroupRepository   repository.PrinterGroupRepository
+	ModelRepository   repository.PrinterModelRepository
+	maxPinAttempts    int
+	maxBadgeAttempts  int
+	lockout           time.Duration
+}
+
+func NewReleaseSvc(repository repository.ReleaseCredentialRepository, jobRepository repository.PrintJobRepository, printerRepository repository.PrinterRepository,
+	groupRepository repository.PrinterGroupRepository, modelRepository repository.PrinterModelRepository, maxPinAttempts int, maxBadgeAttempts int,
+	lockout time.Duration) *ReleaseSvc {
+	return &ReleaseSvc{
+		Repository:        repository,
+		JobRepository:     jobRepository,
+		PrinterRepository: printerRepository,
+		GroupRepository:   groupRepository,
+		ModelRepository:   modelRepository,
+		maxPinAttempts:    maxPinAttempts,
+		maxBadgeAttempts:  maxBadgeAttempts,
+		lockout:           lockout,
+	}
+}
+
+// credentialOwner resolves whose credential a call manages, the caller's own unless an admin names another user.
+func credentialOwner(ctx context.Context, userId string) (string, error) {
+	callerId := ctx.Value("user").(map[string]string)["user_id"]
+	if userId == "" || userId == callerId {
+		return callerId, nil
+	}
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
+	}
+	return userId, nil
+}
+
+func badgeDigest(badgeId string) string {
+	digest := sha256.Sum256([]byte(badgeId))
+	return hex.EncodeToString(digest[:])
+}
+
+func validPin(pin string) bool {
+	if len(pin) < 4 || len(pin) > 12 {
+		return false
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// SetCredential sets the PIN and or badge of a user, leaving whichever is empty as it was. Users set their own PIN,
+// badges are assigned by admins.
+func (r *ReleaseSvc) SetCredential(ctx context.Context, userId string, pin string, badgeId string) (*domain.ReleaseCredentialDto, error) {
+	userId, err := credentialOwner(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if pin == "" && badgeId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "pin or badge id is required")
+	}
+	if pin != "" && !validPin(pin) {
+		return nil, status.Errorf(codes.InvalidArgument, "pin must be 4 to 12 digits")
+	}
+	if badgeId != "" {
+		if err := requireAdmin(ctx); err != nil {
+			return nil, err
+		}
+	}
+	credential, err := r.Repository.GetCredential(ctx, userId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		credential, err = &domain.ReleaseCredential{UserId: userId}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pin != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		credential.PinHash = string(hash)
+		credential.FailedAttempts = 0
+		credential.LockedUntil = nil
+	}
+	if badgeId != "" {
+		digest := badgeDigest(badgeId)
+		holder, err := r.Repository.GetCredentialByBadge(ctx, digest)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err == nil && holder.UserId != userId {
+			return nil, status.Errorf(codes.AlreadyExists, "badge is assigned to another user")
+		}
+		credential.BadgeDigest = &digest
+	}
+	if err := r.Repository.SaveCredential(ctx, credential); err != nil {
+		return nil, err
+	}
+	dto := credential.ToDto()
+	return &dto, nil
+}
+
+func (r *ReleaseSvc) GetCredential(ctx context.Context, userId string) (*domain.ReleaseCredentialDto, error) {
+	userId, err := credentialOwner(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := r.Repository.GetCredential(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	dto := credential.ToDto()
+	return &dto, nil
+}
+
+func (r *ReleaseSvc) DeleteCredential(ctx context.Context, userId string) error {
+	userId, err := credentialOwner(ctx, userId)
+	if err != nil {
+		return err
+	}
+	return r.Repository.DeleteCredential(ctx, userId)
+}
+
+// ReleaseJobs authenticates the user at the printer and queues every held job of theirs the printer can print on it.
+// It is called by the agent running at the printer, authenticated as the printer's owner.
+func (r *ReleaseSvc) ReleaseJobs(ctx context.Context, request *ReleaseRequest) ([]domain.PrintJobDto, error) {
+	if request.PrinterId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "printer id is required")
+	}
+	printer, err := r.PrinterRepository.GetPrinter(ctx, request.PrinterId)
+	if err != nil {
+		return nil, err
+	}
+	if printer.UserId != ctx.Value("user").(map[string]string)["user_id"] {
+		if err := requireAdmin(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if printer.Status != int(core_v1.Status_active) {
+		return nil, status.Errorf(codes.FailedPrecondition, "printer %v is deleted", request.PrinterId)
+	}
+	userId, err := r.authenticate(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := r.JobRepository.GetHeldJobs(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	formats, err := acceptedFormats(ctx, r.ModelRepository, printer)
+	if err != nil {
+		return nil, err
+	}
+	accepted := make(map[string]bool, len(formats))
+	for _, format := range formats {
+		accepted[format] = true
+	}
+	groups := map[string]bool{}
+	released := make([]domain.PrintJobDto, 0, len(jobs))
+	for _, job := range jobs {
+		if !accepted[job.PrintFormat] {
+			continue
+		}
+		if job.PrinterId != printer.ExternalId {
+			if job.GroupId == "" {
+				continue
+			}
+			member, ok := groups[job.GroupId]
+			if !ok {
+				if member, err = r.inGroup(ctx, job.GroupId, printer.ExternalId); err != nil {
+					return nil, err
+				}
+				groups[job.GroupId] = member
+			}
+			if !member {
+				continue
+			}
+		}
+		ok, err := r.JobRepository.ReleaseJob(ctx, job.ExternalId, printer.ExternalId)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		job.State = int(domain.JobStateQueued)
+		job.PrinterId = printer.ExternalId
+		released = append(released, job.ToDto().(domain.PrintJobDto))
+	}
+	return released, nil
+}
+
+// authenticate resolves the user a release request is for. Failed PIN attempts are counted, locking the user's
+// credential for a while once there are too many. Unknown badges are counted against the printer they were presented
+// at, locking badge release at the printer in the same way.
+func (r *ReleaseSvc) authenticate(ctx context.Context, request *ReleaseRequest) (string, error) {
+	if request.BadgeId != "" {
+		return r.authenticateBadge(ctx, request.PrinterId, request.BadgeId)
+	}
+	if request.UserId == "" || request.Pin == "" {
+		return "", status.Errorf(codes.InvalidArgument, "badge id or user id and pin are required")
+	}
+	credential, err := r.Repository.GetCredential(ctx, request.UserId)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && credential.PinHash == "") {
+		return "", status.Errorf(codes.PermissionDenied, "invalid user id or pin")
+	}
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if credential.Locked(now) {
+		return "", status.Errorf(codes.PermissionDenied, "too many failed attempts, try again after %v", credential.LockedUntil.Format(time.RFC3339))
+	}
+	if bcrypt.CompareHashAndPassword([]byte(credential.PinHash), []byte(request.Pin)) != nil {
+		if err := r.Repository.RecordFailedAttempt(ctx, credential.UserId, r.maxPinAttempts, now.Add(r.lockout)); err != nil {
+			return "", err
+		}
+		return "", status.Errorf(codes.PermissionDenied, "invalid user id or pin")
+	}
+	if err := r.Repository.ResetFailedAttempts(ctx, credential.UserId); err != nil {
+		return "", err
+	}
+	return credential.UserId, nil
+}
+
+// authenticateBadge resolves the holder of the badge presented at the printer. A valid badge doesn't start the count
+// of unknown badges at the printer over, or whoever holds one could go on guessing indefinitely.
+func (r *ReleaseSvc) authenticateBadge(ctx context.Context, printerId string, badgeId string) (string, error) {
+	now := time.Now()
+	attempts, err := r.Repository.GetBadgeAttempts(ctx, printerId)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	if err == nil && attempts.Locked(now) {
+		return "", status.Errorf(codes.PermissionDenied, "too many unknown badges at printer %v, try again after %v", printerId,
+			attempts.LockedUntil.Format(time.RFC3339))
+	}
+	credential, err := r.Repository.GetCredentialByBadge(ctx, badgeDigest(badgeId))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if err := r.Repository.RecordFailedBadge(ctx, printerId, r.maxBadgeAttempts, now.Add(r.lockout)); err != nil {
+			return "", err
+		}
+		return "", status.Errorf(codes.PermissionDenied, "unknown badge")
+	}
+	if err != nil {
+		return "", err
+	}
+	return credential.UserId, nil
+}
+
+// inGroup reports whether the printer is a member of the group, a deleted group has no members.
+func (r *ReleaseSvc) inGroup(ctx context.Context, groupId string, printerId string) (bool, error) {
+	group, err := r.GroupRepository.GetGroup(ctx, groupId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	members, err := r.GroupRepository.GetMembers(ctx, group)
+	if err != nil {
+		return false, err
+	}
+	for _, member := range members {
+		if member.ExternalId == printerId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,89 @@
+package svc
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"ditto/pkg/repository"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// releaseCredentials keeps release credentials and badge attempts in memory, locking the way the GORM repository does.
+type releaseCredentials struct {
+	repository.ReleaseCredentialRepository
+	badges   map[string]*domain.ReleaseCredential
+	attempts map[string]*domain.BadgeAttempts
+}
+
+func (r *releaseCredentials) GetCredentialByBadge(ctx context.Context, badgeDigest string) (*domain.ReleaseCredential, error) {
+	credential, ok := r.badges[badgeDigest]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return credential, nil
+}
+
+func (r *releaseCredentials) GetBadgeAttempts(ctx context.Context, printerId string) (*domain.BadgeAttempts, error) {
+	attempts, ok := r.attempts[printerId]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return attempts, nil
+}
+
+func (r *releaseCredentials) RecordFailedBadge(ctx context.Context, printerId string, maxAttempts int, lockedUntil time.Time) error {
+	attempts, ok := r.attempts[printerId]
+	if !ok {
+		attempts = &domain.BadgeAttempts{PrinterId: printerId}
+		r.attempts[printerId] = attempts
+	}
+	attempts.FailedAttempts++
+	if attempts.FailedAttempts >= maxAttempts {
+		attempts.FailedAttempts = 0
+		attempts.LockedUntil = &lockedUntil
+	}
+	return nil
+}
+
+func TestBadgeLockout(t *testing.T) {
+	credentials := &releaseCredentials{
+		badges: map[string]*domain.ReleaseCredential{
+			badgeDigest("valid"): {UserId: "user-1"},
+		},
+		attempts: map[string]*domain.BadgeAttempts{},
+	}
+	releaseSvc := NewReleaseSvc(credentials, nil, nil, nil, nil, 5, 3, time.Hour)
+	ctx := context.Background()
+	badge := func(printerId string, badgeId string) (string, codes.Code) {
+		userId, err := releaseSvc.authenticate(ctx, &ReleaseRequest{PrinterId: printerId, BadgeId: badgeId})
+		return userId, status.Code(err)
+	}
+
+	if userId, code := badge("printer-1", "valid"); code != codes.OK || userId != "user-1" {
+		t.Fatalf("valid badge authenticated %q with %v", userId, code)
+	}
+	for i := 0; i < 3; i++ {
+		if _, code := badge("printer-1", "guess"); code != codes.PermissionDenied {
+			t.Fatalf("unknown badge %d returned %v, want %v", i, code, codes.PermissionDenied)
+		}
+	}
+	if _, code := badge("printer-1", "valid"); code != codes.PermissionDenied {
+		t.Errorf("valid badge at a locked printer returned %v, want %v", code, codes.PermissionDenied)
+	}
+	if userId, code := badge("printer-2", "valid"); code != codes.OK || userId != "user-1" {
+		t.Errorf("valid badge at another printer authenticated %q with %v", userId, code)
+	}
+
+	expired := time.Now().Add(-time.Second)
+	credentials.attempts["printer-1"].LockedUntil = &expired
+	if userId, code := badge("printer-1", "valid"); code != codes.OK || userId != "user-1" {
+		t.Errorf("valid badge once the lock expired authenticated %q with %v", userId, code)
+	}
+	if credentials.attempts["printer-1"].FailedAttempts != 0 {
+		t.Errorf("the count of unknown badges didn't start over after the lock")
+	}
+}
@@ -0,0 +1,126 @@
+package svc
+
+import (
+	"context"
+	"ditto/pkg/domain"
+	"ditto/pkg/repository"
+	"errors"
+	"regexp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+var tenantIdPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// TenantSvc administers tenants. Admins create, list and delete tenants, tenant admins may read and rename their
+// own.
+type TenantSvc struct {
+	Repository repository.TenantRepository
+}
+
+func NewTenantSvc(repository repository.TenantRepository) *TenantSvc {
+	return &TenantSvc{Repository: repository}
+}
+
+func (t *TenantSvc) CreateTenant(ctx context.Context, tenantId string, name string) (*domain.TenantDto, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if !tenantIdPattern.MatchString(tenantId) {
+		return nil, status.Errorf(codes.InvalidArgument, "tenant id must be up to 63 lowercase letters, digits and dashes")
+	}
+	if name == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "name is required")
+	}
+	_, err := t.Repository.GetTenant(ctx, tenantId)
+	if err == nil {
+		return nil, status.Errorf(codes.AlreadyExists, "tenant %v already exists", tenantId)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	tenant := &domain.Tenant{TenantId: tenantId, Name: name}
+	if err := t.Repository.CreateTenant(ctx, tenant); err != nil {
+		return nil, err
+	}
+	dto := tenant.ToDto()
+	return &dto, nil
+}
+
+func (t *TenantSvc) ListTenants(ctx context.Context) ([]domain.TenantDto, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	tenants, err := t.Repository.GetTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]domain.TenantDto, 0, len(tenants))
+	for _, tenant := range tenants {
+		result = append(result, tenant.ToDto())
+	}
+	return result, nil
+}
+
+// GetTenant returns a tenant along with how many printers belong to it.
+func (t *TenantSvc) GetTenant(ctx context.Context, tenantId string) (*domain.TenantDto, error) {
+	tenant, err := t.administeredTenant(ctx, tenantId)
+	if err != nil {
+		return nil, err
+	}
+	dto := tenant.ToDto()
+	if dto.PrinterCount, err = t.Repository.CountPrinters(ctx, tenant.TenantId); err != nil {
+		return nil, err
+	}
+	return &dto, nil
+}
+
+func (t *TenantSvc) RenameTenant(ctx context.Context, tenantId string, name string) (*domain.TenantDto, error) {
+	if name == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "name is required")
+	}
+	tenant, err := t.administeredTenant(ctx, tenantId)
+	if err != nil {
+		return nil, err
+	}
+	tenant.Name = name
+	if err := t.Repository.UpdateTenant(ctx, tenant); err != nil {
+		return nil, err
+	}
+	dto := tenant.ToDto()
+	return &dto, nil
+}
+
+// DeleteTenant deletes a tenant no printers belong to anymore.
+func (t *TenantSvc) DeleteTenant(ctx context.Context, tenantId string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	err := t.Repository.DeleteTenant(ctx, tenantId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return status.Errorf(codes.NotFound, "tenant %v doesn't exist", tenantId)
+	}
+	return err
+}
+
+// administeredTenant loads a tenant the caller administers, admins administer every tenant and tenant admins their
+// own.
+func (t *TenantSvc) administeredTenant(ctx context.Context, tenantId string) (*domain.Tenant, error) {
+	if tenantId != ctx.Value("user").(map[string]string)["tenant_id"] {
+		if err := requireAdmin(ctx); err != nil {
+			return nil, err
+		}
+	} else if err := requireTenantAdmin(ctx); err != nil {
+		return nil, err
+	}
+	tenant, err := t.Repository.GetTenant(ctx, tenantId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, status.Errorf(codes.NotFound, "tenant %v doesn't exist", tenantId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
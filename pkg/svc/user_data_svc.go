@@ -0,0 +1,209 @@
+package svc
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"ditto/pkg/domain"
+	"ditto/pkg/repository"
+	"ditto/pkg/storage"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/url"
+	"time"
+)
+
+const (
+	ExportFormatJson = "json"
+	ExportFormatZip  = "zip"
+)
+
+// UserDataSvc exports and erases everything ditto holds about a user.
+type UserDataSvc struct {
+	Repository repository.UserDataRepository
+	documents  repository.DocumentRepository
+	store      *storage.DocumentStore
+	logger     *logrus.Logger
+	signingKey []byte
+}
+
+func NewUserDataSvc(repository repository.UserDataRepository, documents repository.DocumentRepository, store *storage.DocumentStore,
+	logger *logrus.Logger, signingKey string) *UserDataSvc {
+	return &UserDataSvc{
+		Repository: repository,
+		documents:  documents,
+		store:      store,
+		logger:     logger,
+		signingKey: []byte(signingKey),
+	}
+}
+
+// ExportUserData returns an archive of the user's data, either as a single json document holding every record by
+// kind and id, or as a zip holding a manifest and one json file per record.
+func (u *UserDataSvc) ExportUserData(ctx context.Context, userId string, format string) ([]byte, error) {
+	if len(userId) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "user id is required")
+	}
+	data, err := u.Repository.GetUserData(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	records, err := userDataRecords(data)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(records))
+	for kind, kindRecords := range records {
+		counts[kind] = len(kindRecords)
+	}
+	manifest := map[string]interface{}{
+		"user_id":     userId,
+		"exported_at": time.Now().UTC(),
+		"printers":    len(data.Printers),
+		"records":     counts,
+	}
+	switch format {
+	case ExportFormatJson, "":
+		archive := map[string]interface{}{"manifest": manifest}
+		for kind, kindRecords := range records {
+			archive[kind] = kindRecords
+		}
+		return json.Marshal(archive)
+	case ExportFormatZip:
+		return u.zipArchive(manifest, records)
+	}
+	return nil, status.Errorf(codes.InvalidArgument, "unsupported export format %v", format)
+}
+
+// userDataRecords renders the records of data as json by kind and id, printers as the gateway renders them and the
+// other records as their dtos, which leave out secrets such as PIN hashes and connector secret digests.
+func userDataRecords(data *domain.UserData) (map[string]map[string]json.RawMessage, error) {
+	records := map[string]map[string]json.RawMessage{
+		"printers":            {},
+		"print_jobs":          {},
+		"printer_groups":      {},
+		"connectors":          {},
+		"device_enrollments":  {},
+		"document_uploads":    {},
+		"release_credentials": {},
+		"idempotency_records": {},
+	}
+	for i := range data.Printers {
+		printerJson, err := data.Printers[i].ToJson()
+		if err != nil {
+			return nil, err
+		}
+		records["printers"][data.Printers[i].ExternalId] = json.RawMessage(printerJson)
+	}
+	type entry struct {
+		kind string
+		id   string
+		dto  interface{}
+	}
+	var entries []entry
+	for i := range data.PrintJobs {
+		entries = append(entries, entry{"print_jobs", data.PrintJobs[i].ExternalId, data.PrintJobs[i].ToDto()})
+	}
+	for i := range data.PrinterGroups {
+		entries = append(entries, entry{"printer_groups", data.PrinterGroups[i].ExternalId, data.PrinterGroups[i].ToDto()})
+	}
+	for i := range data.Connectors {
+		entries = append(entries, entry{"connectors", data.Connectors[i].ConnectorId, data.Connectors[i].ToDto()})
+	}
+	for i := range data.DeviceEnrollments {
+		entries = append(entries, entry{"device_enrollments", data.DeviceEnrollments[i].EnrollmentId, data.DeviceEnrollments[i].ToDto()})
+	}
+	for i := range data.DocumentUploads {
+		entries = append(entries, entry{"document_uploads", data.DocumentUploads[i].UploadId, data.DocumentUploads[i].ToDto()})
+	}
+	for i := range data.ReleaseCredentials {
+		entries = append(entries, entry{"release_credentials", data.ReleaseCredentials[i].UserId, data.ReleaseCredentials[i].ToDto()})
+	}
+	for i := range data.IdempotencyRecords {
+		record := &data.IdempotencyRecords[i]
+		entries = append(entries, entry{"idempotency_records", fmt.Sprintf("%v %v", record.Method, record.Key), record.ToDto()})
+	}
+	for _, e := range entries {
+		record, err := json.Marshal(e.dto)
+		if err != nil {
+			return nil, err
+		}
+		records[e.kind][e.id] = record
+	}
+	return records, nil
+}
+
+func (u *UserDataSvc) zipArchive(manifest map[string]interface{}, records map[string]map[string]json.RawMessage) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	archive := zip.NewWriter(buffer)
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeZipEntry(archive, "manifest.json", manifestBytes); err != nil {
+		return nil, err
+	}
+	for kind, kindRecords := range records {
+		for id, record := range kindRecords {
+			if err := writeZipEntry(archive, fmt.Sprintf("%v/%v.json", kind, url.PathEscape(id)), record); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func writeZipEntry(archive *zip.Writer, name string, content []byte) error {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = entry.Write(content)
+	return err
+}
+
+// EraseUserData transactionally removes everything ditto holds about the user and returns a signed receipt. The
+// content of the documents erased is then released from the document store unless other documents share it.
+func (u *UserDataSvc) EraseUserData(ctx context.Context, userId string) (*domain.ErasureReceipt, error) {
+	if len(userId) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "user id is required")
+	}
+	erasure, err := u.Repository.EraseUserData(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	for _, digest := range erasure.Digests {
+		if err := u.store.DeleteUnreferenced(ctx, digest, u.documents.DigestReferenced); err != nil {
+			u.logger.Errorf("An error %v occurred while releasing document %v of erased user %v", err, digest, userId)
+		}
+	}
+	receipt := &domain.ErasureReceipt{
+		UserId:         userId,
+		ErasedPrinters: erasure.Erased["printers"],
+		Erased:         erasure.Erased,
+		ErasedAt:       time.Now().UTC(),
+	}
+	receipt.Signature = u.sign(receipt.Payload())
+	return receipt, nil
+}
+
+// VerifyReceipt reports whether the receipt was issued by this service and has not been tampered with.
+func (u *UserDataSvc) VerifyReceipt(receipt *domain.ErasureReceipt) bool {
+	expected := u.sign(receipt.Payload())
+	return hmac.Equal([]byte(expected), []byte(receipt.Signature))
+}
+
+func (u *UserDataSvc) sign(payload string) string {
+	signer := hmac.New(sha256.New, u.signingKey)
+	signer.Write([]byte(payload))
+	return hex.EncodeToString(signer.Sum(nil))
+}
@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"context"
+	"ditto/pkg/repository"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// ConversionWorker periodically fails the jobs whose conversion was abandoned, as their conversion was queued or
+// running when the server crashed, and would otherwise leave them converting for good.
+type ConversionWorker struct {
+	repository repository.PrintJobRepository
+	logger     *logrus.Logger
+	timeout    time.Duration
+	interval   time.Duration
+}
+
+func NewConversionWorker(repository repository.PrintJobRepository, logger *logrus.Logger, timeout time.Duration, interval time.Duration) *ConversionWorker {
+	return &ConversionWorker{
+		repository: repository,
+		logger:     logger,
+		timeout:    timeout,
+		interval:   interval,
+	}
+}
+
+// Run fails abandoned conversions every interval until ctx is cancelled, starting with the ones left over by the
+// previous run of the server.
+func (c *ConversionWorker) Run(ctx context.Context) {
+	runEvery(ctx, c.interval, c.failAbandoned)
+}
+
+// failAbandoned fails the jobs converting for longer than the conversion timeout, conversions being cut off when
+// they reach it.
+func (c *ConversionWorker) failAbandoned(ctx context.Context) {
+	failed, err := c.repository.FailAbandonedConversions(ctx, time.Now().Add(-c.timeout), "conversion was interrupted")
+	if err != nil {
+		c.logger.Errorf("An error %v occurred while failing abandoned conversions", err)
+		return
+	}
+	if failed > 0 {
+		c.logger.Infof("failed %d jobs whose conversion was abandoned", failed)
+	}
+}
@@ -0,0 +1,92 @@
+package worker
+
+import (
+	"context"
+	"ditto/pkg/repository"
+	"ditto/pkg/storage"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// documentBatchSize bounds the uploads and documents expired in one pass.
+const documentBatchSize = 500
+
+// DocumentWorker periodically removes abandoned uploads and the documents of jobs that finished more than the
+// retention period ago or no longer exist, releasing their content from the document store once nothing else
+// references it.
+type DocumentWorker struct {
+	repository repository.DocumentRepository
+	store      *storage.DocumentStore
+	logger     *logrus.Logger
+	retention  time.Duration
+	interval   time.Duration
+}
+
+func NewDocumentWorker(repository repository.DocumentRepository, store *storage.DocumentStore, logger *logrus.Logger, retention time.Duration, interval time.Duration) *DocumentWorker {
+	return &DocumentWorker{
+		repository: repository,
+		store:      store,
+		logger:     logger,
+		retention:  retention,
+		interval:   interval,
+	}
+}
+
+// Run expires uploads and documents every interval until ctx is cancelled.
+func (d *DocumentWorker) Run(ctx context.Context) {
+	runEvery(ctx, d.interval, d.expire)
+}
+
+func (d *DocumentWorker) expire(ctx context.Context) {
+	d.expireUploads(ctx)
+	d.expireDocuments(ctx)
+}
+
+func (d *DocumentWorker) expireUploads(ctx context.Context) {
+	uploads, err := d.repository.GetExpiredUploads(ctx, time.Now(), documentBatchSize)
+	if err != nil {
+		d.logger.Errorf("An error %v occurred while fetching expired uploads", err)
+		return
+	}
+	for _, upload := range uploads {
+		chunks, err := d.repository.GetChunks(ctx, upload.UploadId)
+		if err != nil {
+			d.logger.Errorf("An error %v occurred while fetching the chunks of upload %v", err, upload.UploadId)
+			continue
+		}
+		if err := d.repository.DeleteUpload(ctx, upload.UploadId); err != nil {
+			d.logger.Errorf("An error %v occurred while deleting upload %v", err, upload.UploadId)
+			continue
+		}
+		for _, chunk := range chunks {
+			d.release(ctx, chunk.Digest)
+		}
+	}
+	if len(uploads) > 0 {
+		d.logger.Infof("expired %d abandoned uploads", len(uploads))
+	}
+}
+
+func (d *DocumentWorker) expireDocuments(ctx context.Context) {
+	documents, err := d.repository.GetExpiredDocuments(ctx, time.Now().Add(-d.retention), documentBatchSize)
+	if err != nil {
+		d.logger.Errorf("An error %v occurred while fetching expired documents", err)
+		return
+	}
+	for _, document := range documents {
+		if err := d.repository.DeleteDocument(ctx, document.Id); err != nil {
+			d.logger.Errorf("An error %v occurred while deleting document %d", err, document.Id)
+			continue
+		}
+		d.release(ctx, document.Digest)
+	}
+	if len(documents) > 0 {
+		d.logger.Infof("expired %d documents of jobs finished more than %v ago", len(documents), d.retention)
+	}
+}
+
+func (d *DocumentWorker) release(ctx context.Context, digest string) {
+	if err := d.store.DeleteUnreferenced(ctx, digest, d.repository.DigestReferenced); err != nil {
+		d.logger.Errorf("An error %v occurred while releasing document %v", err, digest)
+	}
+}
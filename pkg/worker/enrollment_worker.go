@@ -0,0 +1,40 @@
+package worker
+
+import (
+	"context"
+	"ditto/pkg/repository"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// EnrollmentWorker periodically deletes device enrollments that weren't claimed, or whose certificate wasn't
+// fetched, in time.
+type EnrollmentWorker struct {
+	repository repository.EnrollmentRepository
+	logger     *logrus.Logger
+	interval   time.Duration
+}
+
+func NewEnrollmentWorker(repository repository.EnrollmentRepository, logger *logrus.Logger, interval time.Duration) *EnrollmentWorker {
+	return &EnrollmentWorker{
+		repository: repository,
+		logger:     logger,
+		interval:   interval,
+	}
+}
+
+// Run deletes expired enrollments every interval until ctx is cancelled.
+func (e *EnrollmentWorker) Run(ctx context.Context) {
+	runEvery(ctx, e.interval, e.deleteExpired)
+}
+
+func (e *EnrollmentWorker) deleteExpired(ctx context.Context) {
+	deleted, err := e.repository.DeleteExpiredEnrollments(ctx, time.Now())
+	if err != nil {
+		e.logger.Errorf("An error %v occurred while deleting expired enrollments", err)
+		return
+	}
+	if deleted > 0 {
+		e.logger.Infof("deleted %d expired device enrollments", deleted)
+	}
+}
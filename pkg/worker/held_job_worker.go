@@ -0,0 +1,41 @@
+package worker
+
+import (
+	"context"
+	"ditto/pkg/repository"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// HeldJobWorker periodically deletes secure jobs that weren't released within the hold timeout.
+type HeldJobWorker struct {
+	repository  repository.PrintJobRepository
+	logger      *logrus.Logger
+	holdTimeout time.Duration
+	interval    time.Duration
+}
+
+func NewHeldJobWorker(repository repository.PrintJobRepository, logger *logrus.Logger, holdTimeout time.Duration, interval time.Duration) *HeldJobWorker {
+	return &HeldJobWorker{
+		repository:  repository,
+		logger:      logger,
+		holdTimeout: holdTimeout,
+		interval:    interval,
+	}
+}
+
+// Run deletes unreleased jobs every interval until ctx is cancelled.
+func (h *HeldJobWorker) Run(ctx context.Context) {
+	runEvery(ctx, h.interval, h.deleteExpired)
+}
+
+func (h *HeldJobWorker) deleteExpired(ctx context.Context) {
+	deleted, err := h.repository.DeleteExpiredHeldJobs(ctx, time.Now().Add(-h.holdTimeout))
+	if err != nil {
+		h.logger.Errorf("An error %v occurred while deleting unreleased jobs", err)
+		return
+	}
+	if deleted > 0 {
+		h.logger.Infof("deleted %d jobs not released within %v", deleted, h.holdTimeout)
+	}
+}
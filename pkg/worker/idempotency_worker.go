@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"context"
+	"ditto/pkg/repository"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// IdempotencyWorker periodically deletes expired idempotency records.
+type IdempotencyWorker struct {
+	repository repository.IdempotencyRepository
+	logger     *logrus.Logger
+	interval   time.Duration
+}
+
+func NewIdempotencyWorker(repository repository.IdempotencyRepository, logger *logrus.Logger, interval time.Duration) *IdempotencyWorker {
+	return &IdempotencyWorker{
+		repository: repository,
+		logger:     logger,
+		interval:   interval,
+	}
+}
+
+// Run deletes expired records every interval until ctx is cancelled.
+func (i *IdempotencyWorker) Run(ctx context.Context) {
+	runEvery(ctx, i.interval, i.deleteExpired)
+}
+
+func (i *IdempotencyWorker) deleteExpired(ctx context.Context) {
+	deleted, err := i.repository.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		i.logger.Errorf("An error %v occurred while deleting expired idempotency records", err)
+		return
+	}
+	if deleted > 0 {
+		i.logger.Debugf("deleted %d expired idempotency records", deleted)
+	}
+}
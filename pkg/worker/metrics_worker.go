@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"context"
+	"ditto/pkg/metrics"
+	"ditto/pkg/repository"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// MetricsWorker periodically refreshes the metrics counted in the database rather than as things happen.
+type MetricsWorker struct {
+	repository repository.PrinterRepository
+	logger     *logrus.Logger
+	interval   time.Duration
+}
+
+func NewMetricsWorker(repository repository.PrinterRepository, logger *logrus.Logger, interval time.Duration) *MetricsWorker {
+	return &MetricsWorker{
+		repository: repository,
+		logger:     logger,
+		interval:   interval,
+	}
+}
+
+// Run refreshes the metrics every interval until ctx is cancelled.
+func (m *MetricsWorker) Run(ctx context.Context) {
+	runEvery(ctx, m.interval, m.refresh)
+}
+
+func (m *MetricsWorker) refresh(ctx context.Context) {
+	printers, err := m.repository.CountActivePrintersByTenant(ctx)
+	if err != nil {
+		m.logger.Errorf("An error %v occurred while counting active printers", err)
+		return
+	}
+	// tenants left without active printers drop out rather than keep their last count
+	metrics.ActivePrinters.Reset()
+	for tenantId, count := range printers {
+		metrics.ActivePrinters.WithLabelValues(tenantId).Set(float64(count))
+	}
+}
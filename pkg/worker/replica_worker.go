@@ -0,0 +1,26 @@
+package worker
+
+import (
+	"context"
+	"ditto/pkg/repository"
+	"time"
+)
+
+// ReplicaWorker periodically checks how far behind the primary the read replicas are, taking the lagging ones out of
+// rotation.
+type ReplicaWorker struct {
+	routing  *repository.ReplicaRouting
+	interval time.Duration
+}
+
+func NewReplicaWorker(routing *repository.ReplicaRouting, interval time.Duration) *ReplicaWorker {
+	return &ReplicaWorker{
+		routing:  routing,
+		interval: interval,
+	}
+}
+
+// Run checks the replicas every interval until ctx is cancelled.
+func (r *ReplicaWorker) Run(ctx context.Context) {
+	runEvery(ctx, r.interval, r.routing.CheckLag)
+}
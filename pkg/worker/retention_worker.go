@@ -0,0 +1,44 @@
+package worker
+
+import (
+	"context"
+	"ditto/pkg/metrics"
+	"ditto/pkg/repository"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"time"
+)
+
+// RetentionWorker periodically purges printers that have been soft deleted for longer than the retention period.
+type RetentionWorker struct {
+	repository repository.PrinterRepository
+	logger     *logrus.Logger
+	retention  time.Duration
+	interval   time.Duration
+}
+
+func NewRetentionWorker(repository repository.PrinterRepository, logger *logrus.Logger, retention time.Duration, interval time.Duration) *RetentionWorker {
+	return &RetentionWorker{
+		repository: repository,
+		logger:     logger,
+		retention:  retention,
+		interval:   interval,
+	}
+}
+
+// Run purges expired printers every interval until ctx is cancelled.
+func (r *RetentionWorker) Run(ctx context.Context) {
+	runEvery(ctx, r.interval, r.purge)
+}
+
+func (r *RetentionWorker) purge(ctx context.Context) {
+	purged, err := r.repository.PurgeInactivePrinters(ctx, time.Now().Add(-r.retention))
+	if err != nil {
+		r.logger.Errorf("An error %v occurred while purging inactive printers", err)
+		return
+	}
+	metrics.PrintersDeleted.WithLabelValues("retention", codes.OK.String()).Add(float64(purged))
+	if purged > 0 {
+		r.logger.Infof("purged %d printers inactive for more than %v", purged, r.retention)
+	}
+}
@@ -0,0 +1,41 @@
+package worker
+
+import (
+	"context"
+	"ditto/pkg/repository"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// purgingRepository records the cutoffs the inactive printers are purged with.
+type purgingRepository struct {
+	repository.PrinterRepository
+	inactiveSince []time.Time
+}
+
+func (p *purgingRepository) PurgeInactivePrinters(ctx context.Context, inactiveSince time.Time) (int64, error) {
+	p.inactiveSince = append(p.inactiveSince, inactiveSince)
+	return 2, nil
+}
+
+func TestRetentionWorkerPurgesPrintersInactiveForTheRetentionPeriod(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	printers := &purgingRepository{}
+	retention := 30 * 24 * time.Hour
+	worker := NewRetentionWorker(printers, logger, retention, time.Hour)
+
+	before := time.Now()
+	worker.purge(context.Background())
+	after := time.Now()
+
+	if len(printers.inactiveSince) != 1 {
+		t.Fatalf("purged %d times, want once", len(printers.inactiveSince))
+	}
+	if cutoff := printers.inactiveSince[0]; cutoff.Before(before.Add(-retention)) || cutoff.After(after.Add(-retention)) {
+		t.Errorf("purged the printers inactive since %v, want the ones inactive for more than %v", cutoff, retention)
+	}
+}
@@ -0,0 +1,25 @@
+package worker
+
+import (
+	"context"
+	"ditto/pkg/secrets"
+	"time"
+)
+
+// SecretWorker periodically renews the leases of the secrets the config refers to and picks up rotated ones.
+type SecretWorker struct {
+	resolver *secrets.Resolver
+	interval time.Duration
+}
+
+func NewSecretWorker(resolver *secrets.Resolver, interval time.Duration) *SecretWorker {
+	return &SecretWorker{
+		resolver: resolver,
+		interval: interval,
+	}
+}
+
+// Run refreshes the secrets every interval until ctx is cancelled.
+func (s *SecretWorker) Run(ctx context.Context) {
+	runEvery(ctx, s.interval, s.resolver.Refresh)
+}
@@ -0,0 +1,23 @@
+package worker
+
+import (
+	"context"
+	"time"
+)
+
+// runEvery calls fn immediately and then every interval until ctx is cancelled.
+func runEvery(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		fn(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}